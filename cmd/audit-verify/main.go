@@ -0,0 +1,50 @@
+// Command audit-verify checks the hash chain of audit log files written by
+// clamav-api-go.
+//
+// Files must be given from the oldest to the most recent, for instance:
+//
+//	audit-verify audit.log.2 audit.log.1 audit.log
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lescactus/clamav-api-go/internal/audit"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s FILE...\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(names []string) error {
+	var readers []io.Reader
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		readers = append(readers, f)
+	}
+
+	n, last, err := audit.Verify(readers...)
+	if err != nil {
+		return fmt.Errorf("verification failed after %d records: %w", n, err)
+	}
+	if last == nil {
+		fmt.Println("no audit record found")
+		return nil
+	}
+	fmt.Printf("%d records verified, last record seq %d hash %s\n", n, last.Seq, last.Hash)
+	return nil
+}
@@ -0,0 +1,318 @@
+// Package admission implements a global admission control for scans.
+//
+// It bounds the number of in-flight scans and, optionally, takes into account
+// the backlog of the clamd daemon as reported by the STATS command. Scans
+// exceeding the limits wait in a bounded queue until they can be admitted or
+// until a timeout expires.
+package admission
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/metrics"
+	"github.com/rs/zerolog"
+)
+
+var (
+	// ErrQueueFull indicates the scan couldn't be admitted and the waiting queue is full.
+	ErrQueueFull = errors.New("scan queue is full")
+	// ErrQueueTimeout indicates the scan waited too long to be admitted.
+	ErrQueueTimeout = errors.New("timed out waiting for a scan slot")
+	// ErrParsingStats indicates the clamd STATS reply couldn't be parsed.
+	ErrParsingStats = errors.New("error while parsing clamd stats")
+)
+
+// Config holds the admission control thresholds.
+type Config struct {
+	// MaxInFlight is the maximum number of concurrent scans. Zero means unlimited.
+	MaxInFlight int
+	// MaxQueued is the maximum number of scans waiting to be admitted.
+	// Zero means scans are rejected as soon as they can't be admitted.
+	MaxQueued int
+	// QueueTimeout is the maximum duration a scan waits to be admitted.
+	// Zero means scans wait until their context is done.
+	QueueTimeout time.Duration
+	// MaxClamdQueue is the clamd queue length above which no new scan is admitted.
+	// Zero disables the check.
+	MaxClamdQueue int
+	// MinClamdIdleThreads is the number of idle clamd threads below which
+	// no new scan is admitted. Zero disables the check.
+	MinClamdIdleThreads int
+	// PollInterval is the interval between two clamd STATS polls.
+	PollInterval time.Duration
+}
+
+// PollsClamd returns true if the configuration relies on the clamd backlog.
+func (c Config) PollsClamd() bool {
+	return c.MaxClamdQueue > 0 || c.MinClamdIdleThreads > 0
+}
+
+// Enabled returns true if the configuration sets any threshold.
+func (c Config) Enabled() bool {
+	return c.MaxInFlight > 0 || c.PollsClamd()
+}
+
+// ClamdLoad is the backlog of clamd as reported by the STATS command.
+type ClamdLoad struct {
+	// Queue is the number of items waiting in the clamd queue.
+	Queue int
+	// IdleThreads is the number of idle clamd threads.
+	IdleThreads int
+	// MaxThreads is the maximum number of clamd threads.
+	MaxThreads int
+}
+
+// Controller admits or rejects scans according to its Config.
+type Controller struct {
+	cfg Config
+
+	mu             sync.Mutex
+	inflight       int
+	waiting        int
+	clamdOverload  bool
+	changed        chan struct{}
+	lastClamdError error
+}
+
+// New creates a new Controller with the given configuration.
+func New(cfg Config) *Controller {
+	return &Controller{
+		cfg:     cfg,
+		changed: make(chan struct{}),
+	}
+}
+
+// Acquire admits a new scan, waiting in the queue if needed.
+//
+// On success, the returned release function must be called once the scan
+// is complete. Otherwise, it returns ErrQueueFull, ErrQueueTimeout or the
+// error of ctx.
+func (c *Controller) Acquire(ctx context.Context) (func(), error) {
+	c.mu.Lock()
+
+	if c.admissible() {
+		return c.admit(), nil
+	}
+
+	if c.waiting >= c.cfg.MaxQueued {
+		c.mu.Unlock()
+		metrics.AdmissionRejections.WithLabelValues("queue_full").Inc()
+		return nil, ErrQueueFull
+	}
+
+	c.waiting++
+	metrics.AdmissionQueued.Set(float64(c.waiting))
+
+	// A nil channel never fires: without timeout, the wait is bounded by ctx
+	var timeout <-chan time.Time
+	if c.cfg.QueueTimeout > 0 {
+		timer := time.NewTimer(c.cfg.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timeout:
+			c.leaveQueue()
+			metrics.AdmissionRejections.WithLabelValues("queue_timeout").Inc()
+			return nil, ErrQueueTimeout
+		case <-ctx.Done():
+			c.leaveQueue()
+			return nil, fmt.Errorf("error while waiting for a scan slot: %w", ctx.Err())
+		}
+
+		c.mu.Lock()
+		if c.admissible() {
+			c.waiting--
+			metrics.AdmissionQueued.Set(float64(c.waiting))
+			return c.admit(), nil
+		}
+	}
+}
+
+// RetryAfter returns the duration after which a rejected client may retry.
+func (c *Controller) RetryAfter() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.clamdOverload && c.cfg.PollInterval > time.Second {
+		return c.cfg.PollInterval
+	}
+	return time.Second
+}
+
+// admissible returns true if a new scan can be admitted right away.
+// Must be called with c.mu held.
+func (c *Controller) admissible() bool {
+	if c.clamdOverload {
+		return false
+	}
+	return c.cfg.MaxInFlight == 0 || c.inflight < c.cfg.MaxInFlight
+}
+
+// admit accounts for a new in-flight scan, releases c.mu
+// and returns the function releasing the scan slot.
+// Must be called with c.mu held.
+func (c *Controller) admit() func() {
+	c.inflight++
+	metrics.AdmissionInFlight.Set(float64(c.inflight))
+	c.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.inflight--
+			metrics.AdmissionInFlight.Set(float64(c.inflight))
+			c.notify()
+		})
+	}
+}
+
+// leaveQueue removes a waiting scan from the queue.
+func (c *Controller) leaveQueue() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waiting--
+	metrics.AdmissionQueued.Set(float64(c.waiting))
+}
+
+// notify wakes up the waiting scans.
+// Must be called with c.mu held.
+func (c *Controller) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Observe updates the controller with the current clamd backlog.
+func (c *Controller) Observe(load ClamdLoad) {
+	overload := (c.cfg.MaxClamdQueue > 0 && load.Queue >= c.cfg.MaxClamdQueue) ||
+		(c.cfg.MinClamdIdleThreads > 0 && load.IdleThreads < c.cfg.MinClamdIdleThreads)
+
+	metrics.ClamdQueueItems.Set(float64(load.Queue))
+	metrics.ClamdIdleThreads.Set(float64(load.IdleThreads))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if overload {
+		metrics.ClamdOverloaded.Set(1)
+	} else {
+		metrics.ClamdOverloaded.Set(0)
+	}
+
+	if overload != c.clamdOverload {
+		c.clamdOverload = overload
+		c.notify()
+	}
+}
+
+// Poll periodically queries clamd STATS and updates the controller
+// until ctx is done.
+// When STATS fails, the last known backlog is kept.
+func (c *Controller) Poll(ctx context.Context, client clamav.Clamaver, logger *zerolog.Logger) {
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		c.pollOnce(ctx, client, logger)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) pollOnce(ctx context.Context, client clamav.Clamaver, logger *zerolog.Logger) {
+	stats, err := client.Stats(ctx)
+	if err == nil {
+		var load *ClamdLoad
+		load, err = ParseClamdLoad(stats)
+		if err == nil {
+			c.Observe(*load)
+		}
+	}
+
+	c.mu.Lock()
+	changed := (err == nil) != (c.lastClamdError == nil)
+	c.lastClamdError = err
+	c.mu.Unlock()
+
+	// Only log transitions to avoid flooding the logs when clamd is down
+	if changed {
+		if err != nil {
+			logger.Warn().Err(err).Msg("admission control: unable to poll clamd stats")
+		} else {
+			logger.Info().Msg("admission control: clamd stats polling recovered")
+		}
+	}
+}
+
+// ParseClamdLoad extracts the queue length and the thread counts
+// from a clamd STATS reply.
+//
+// Example of the relevant lines:
+//
+//	THREADS: live 1  idle 0 max 10 idle-timeout 30
+//	QUEUE: 0 items
+func ParseClamdLoad(stats []byte) (*ClamdLoad, error) {
+	var load ClamdLoad
+	var foundThreads, foundQueue bool
+
+	scanner := bufio.NewScanner(bytes.NewReader(stats))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if rest, ok := strings.CutPrefix(line, "THREADS: "); ok {
+			fields := strings.Fields(rest)
+			for i := 0; i+1 < len(fields); i += 2 {
+				n, err := strconv.Atoi(fields[i+1])
+				if err != nil {
+					return nil, ErrParsingStats
+				}
+				switch fields[i] {
+				case "idle":
+					load.IdleThreads = n
+				case "max":
+					load.MaxThreads = n
+				}
+			}
+			foundThreads = true
+		}
+
+		if rest, ok := strings.CutPrefix(line, "QUEUE: "); ok {
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				return nil, ErrParsingStats
+			}
+			n, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, ErrParsingStats
+			}
+			load.Queue = n
+			foundQueue = true
+		}
+	}
+
+	if !foundThreads || !foundQueue {
+		return nil, ErrParsingStats
+	}
+	return &load, nil
+}
@@ -0,0 +1,256 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	assert.False(t, Config{}.Enabled())
+	assert.True(t, Config{MaxInFlight: 1}.Enabled())
+	assert.False(t, Config{MaxInFlight: 1}.PollsClamd())
+	assert.True(t, Config{MaxClamdQueue: 1}.PollsClamd())
+	assert.True(t, Config{MinClamdIdleThreads: 1}.Enabled())
+}
+
+func TestControllerAcquireUnlimited(t *testing.T) {
+	c := New(Config{QueueTimeout: time.Second})
+
+	for i := 0; i < 100; i++ {
+		_, err := c.Acquire(context.Background())
+		assert.NoError(t, err)
+	}
+}
+
+func TestControllerAcquireQueueFull(t *testing.T) {
+	c := New(Config{MaxInFlight: 1, QueueTimeout: time.Second})
+
+	release, err := c.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	_, err = c.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	release()
+	release, err = c.Acquire(context.Background())
+	assert.NoError(t, err)
+	release()
+}
+
+func TestControllerAcquireQueueTimeout(t *testing.T) {
+	c := New(Config{MaxInFlight: 1, MaxQueued: 1, QueueTimeout: 50 * time.Millisecond})
+
+	release, err := c.Acquire(context.Background())
+	assert.NoError(t, err)
+	defer release()
+
+	start := time.Now()
+	_, err = c.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrQueueTimeout)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// The queue slot is freed
+	assert.Equal(t, 0, c.waiting)
+}
+
+func TestControllerAcquireWithoutQueueTimeout(t *testing.T) {
+	c := New(Config{MaxInFlight: 1, MaxQueued: 1})
+
+	release, err := c.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	admitted := make(chan func())
+	go func() {
+		r, err := c.Acquire(context.Background())
+		assert.NoError(t, err)
+		admitted <- r
+	}()
+
+	// The scan waits instead of timing out right away
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.waiting == 1
+	}, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, admitted, 0)
+
+	release()
+	(<-admitted)()
+	assert.Equal(t, 0, c.inflight)
+}
+
+func TestControllerAcquireWaitsForSlot(t *testing.T) {
+	c := New(Config{MaxInFlight: 1, MaxQueued: 2, QueueTimeout: 5 * time.Second})
+
+	release, err := c.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	admitted := make(chan func(), 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := c.Acquire(context.Background())
+			assert.NoError(t, err)
+			admitted <- r
+		}()
+	}
+
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.waiting == 2
+	}, time.Second, 5*time.Millisecond)
+
+	// A third waiting scan doesn't fit in the queue
+	_, err = c.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	// Slots are handed over one by one
+	release()
+	r := <-admitted
+	assert.Len(t, admitted, 0)
+	r()
+	r = <-admitted
+	r()
+
+	wg.Wait()
+	assert.Equal(t, 0, c.inflight)
+}
+
+func TestControllerAcquireContextCancelled(t *testing.T) {
+	c := New(Config{MaxInFlight: 1, MaxQueued: 1, QueueTimeout: 5 * time.Second})
+
+	release, err := c.Acquire(context.Background())
+	assert.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.Acquire(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestControllerObserve(t *testing.T) {
+	c := New(Config{MaxClamdQueue: 5, MinClamdIdleThreads: 1, MaxQueued: 1, QueueTimeout: 5 * time.Second, PollInterval: 3 * time.Second})
+
+	c.Observe(ClamdLoad{Queue: 5, IdleThreads: 2})
+	assert.Equal(t, 3*time.Second, c.RetryAfter())
+
+	// The scan waits until clamd recovers
+	done := make(chan error)
+	go func() {
+		release, err := c.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("scan admitted while clamd is overloaded")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.Observe(ClamdLoad{Queue: 0, IdleThreads: 2})
+	assert.NoError(t, <-done)
+	assert.Equal(t, time.Second, c.RetryAfter())
+
+	// Not enough idle threads
+	c.Observe(ClamdLoad{Queue: 0, IdleThreads: 0})
+	c.mu.Lock()
+	assert.True(t, c.clamdOverload)
+	c.mu.Unlock()
+}
+
+type mockStats struct {
+	clamav.Clamaver
+	stats []byte
+	err   error
+}
+
+func (m *mockStats) Stats(_ context.Context) ([]byte, error) {
+	return m.stats, m.err
+}
+
+func TestControllerPollOnce(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	c := New(Config{MaxClamdQueue: 2, PollInterval: time.Second})
+
+	c.pollOnce(context.Background(), &mockStats{stats: []byte("THREADS: live 10  idle 0 max 10 idle-timeout 30\nQUEUE: 4 items\n")}, &logger)
+	assert.True(t, c.clamdOverload)
+
+	// Errors keep the last known state
+	c.pollOnce(context.Background(), &mockStats{err: errors.New("connection refused")}, &logger)
+	assert.True(t, c.clamdOverload)
+	assert.Error(t, c.lastClamdError)
+
+	c.pollOnce(context.Background(), &mockStats{stats: []byte("THREADS: live 1  idle 9 max 10 idle-timeout 30\nQUEUE: 0 items\n")}, &logger)
+	assert.False(t, c.clamdOverload)
+	assert.NoError(t, c.lastClamdError)
+}
+
+func TestParseClamdLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		stats   string
+		want    *ClamdLoad
+		wantErr bool
+	}{
+		{
+			name: "clamd stats",
+			stats: `POOLS: 1
+
+STATE: VALID PRIMARY
+THREADS: live 3  idle 7 max 10 idle-timeout 30
+QUEUE: 12 items
+	STATS 0.000086
+
+MEMSTATS: heap N/A mmap N/A used N/A free N/A releasable N/A pools 1 pools_used 1306.837M pools_total 1306.882M
+END`,
+			want: &ClamdLoad{Queue: 12, IdleThreads: 7, MaxThreads: 10},
+		},
+		{
+			name:    "empty stats",
+			stats:   "",
+			wantErr: true,
+		},
+		{
+			name:    "missing queue",
+			stats:   "THREADS: live 3  idle 7 max 10 idle-timeout 30",
+			wantErr: true,
+		},
+		{
+			name:    "invalid threads",
+			stats:   "THREADS: live x  idle y\nQUEUE: 0 items",
+			wantErr: true,
+		},
+		{
+			name:    "invalid queue",
+			stats:   "THREADS: live 3  idle 7 max 10 idle-timeout 30\nQUEUE: many items",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClamdLoad([]byte(tt.stats))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrParsingStats)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,240 @@
+// Package audit implements a tamper-evident audit log of scans and
+// administrative actions.
+//
+// Records are written as JSON lines. Each record holds the hash of the previous
+// one and its own hash, computed over its content and the previous hash, so that
+// modifying, removing or reordering records breaks the chain and can be detected
+// with Verify.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionStart     = "audit_start"
+	ActionScan      = "scan"
+	ActionReload    = "reload"
+	ActionShutdown  = "shutdown"
+	ActionFreshClam = "freshclam"
+
+	ActionFreshClamConfig = "freshclam_config"
+
+	ActionQuarantineDownload = "quarantine_download"
+	ActionQuarantineDelete   = "quarantine_delete"
+	ActionQuarantinePurge    = "quarantine_purge"
+
+	ActionSignatureAdd    = "signature_add"
+	ActionSignatureDelete = "signature_delete"
+
+	ActionRuleUpload = "rule_upload"
+	ActionRuleDelete = "rule_delete"
+
+	ActionMirrorUpload = "mirror_upload"
+)
+
+// Outcomes of the recorded actions.
+const (
+	VerdictClean      = "clean"
+	VerdictInfected   = "infected"
+	VerdictSuspicious = "suspicious"
+	VerdictError      = "error"
+	VerdictRejected   = "rejected"
+	VerdictSuccess    = "success"
+	VerdictFailure    = "failure"
+)
+
+var (
+	// ErrBrokenChain indicates a record doesn't reference the hash of the previous one.
+	ErrBrokenChain = errors.New("audit log hash chain is broken")
+	// ErrTamperedRecord indicates the hash of a record doesn't match its content.
+	ErrTamperedRecord = errors.New("audit log record has been tampered with")
+)
+
+// Record is an entry of the audit log.
+type Record struct {
+	Seq       uint64    `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Principal string    `json:"principal,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	FileName  string    `json:"file_name,omitempty"`
+	FileSize  int64     `json:"file_size,omitempty"`
+	SHA256    string    `json:"sha256,omitempty"`
+	Verdict   string    `json:"verdict,omitempty"`
+	Signature string    `json:"signature,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	// PolicyVerdict and PolicyRule are the verdict of the verdict policy
+	// and the rule which decided it, if a verdict policy is configured.
+	PolicyVerdict string `json:"policy_verdict,omitempty"`
+	PolicyRule    string `json:"policy_rule,omitempty"`
+	PrevHash      string `json:"prev_hash"`
+	Hash          string `json:"hash,omitempty"`
+}
+
+// computeHash returns the hash of the record, computed over its
+// JSON encoding without the Hash field. PrevHash is part of the encoding.
+func (r Record) computeHash() (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("error while marshalling audit record: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Sink is the destination of the audit records.
+type Sink interface {
+	// WriteRecord writes a single JSON-encoded record.
+	WriteRecord(line []byte) error
+	// Close releases the resources of the sink.
+	Close() error
+}
+
+// Logger appends hash-chained records to a Sink.
+// It is safe for concurrent use.
+type Logger struct {
+	mu       sync.Mutex
+	sink     Sink
+	prevHash string
+	seq      uint64
+	now      func() time.Time
+}
+
+// New creates a new Logger writing to sink and continuing the chain after
+// last, the last record previously written to the sink, if any.
+// It writes an ActionStart record marking the (re)start of the service.
+func New(sink Sink, last *Record) (*Logger, error) {
+	l := &Logger{
+		sink: sink,
+		now:  time.Now,
+	}
+	if last != nil {
+		l.prevHash = last.Hash
+		l.seq = last.Seq
+	}
+
+	if err := l.Log(Record{Action: ActionStart}); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Log chains and writes rec to the sink.
+// The sequence number, timestamp and hashes of rec are set by the logger.
+func (l *Logger) Log(rec Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.Seq = l.seq + 1
+	rec.Timestamp = l.now().UTC()
+	rec.PrevHash = l.prevHash
+
+	hash, err := rec.computeHash()
+	if err != nil {
+		return err
+	}
+	rec.Hash = hash
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("error while marshalling audit record: %w", err)
+	}
+
+	if err := l.sink.WriteRecord(line); err != nil {
+		return fmt.Errorf("error while writing audit record: %w", err)
+	}
+
+	l.seq = rec.Seq
+	l.prevHash = rec.Hash
+	return nil
+}
+
+// Complete returns rec completed with the principal, client IP address and
+// ID of the request it records.
+func Complete(rec Record, principal, clientIP, requestID string) Record {
+	rec.Principal = principal
+	rec.ClientIP = clientIP
+	rec.RequestID = requestID
+	return rec
+}
+
+// LogRequest records rec in l, after completing it with the principal, client
+// IP address and ID of the request it records. Nothing is recorded if l is nil.
+// Failures are logged to logger but don't fail the request.
+func LogRequest(l *Logger, logger *zerolog.Logger, rec Record, principal, clientIP, requestID string) {
+	if l == nil {
+		return
+	}
+	if err := l.Log(Complete(rec, principal, clientIP, requestID)); err != nil {
+		logger.Error().Str("req_id", requestID).Msgf("failed to write audit record: %v", err)
+	}
+}
+
+// Close closes the underlying sink.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.sink.Close()
+}
+
+// Verify reads JSON lines audit records from the given readers, in order,
+// and checks the hash chain. It returns the number of verified records and
+// the last one.
+//
+// The first record is trusted as the anchor of the chain: to detect truncation,
+// compare its hash with a copy kept out of reach of the audited host.
+func Verify(readers ...io.Reader) (int, *Record, error) {
+	var n int
+	var last *Record
+
+	for _, r := range readers {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			var rec Record
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				return n, last, fmt.Errorf("error while parsing audit record #%d: %w", n+1, err)
+			}
+
+			hash, err := rec.computeHash()
+			if err != nil {
+				return n, last, err
+			}
+			if hash != rec.Hash {
+				return n, last, fmt.Errorf("record seq %d: %w", rec.Seq, ErrTamperedRecord)
+			}
+
+			if last != nil && (rec.PrevHash != last.Hash || rec.Seq != last.Seq+1) {
+				return n, last, fmt.Errorf("record seq %d: %w", rec.Seq, ErrBrokenChain)
+			}
+
+			n++
+			last = &rec
+		}
+		if err := scanner.Err(); err != nil {
+			return n, last, fmt.Errorf("error while reading audit log: %w", err)
+		}
+	}
+
+	return n, last, nil
+}
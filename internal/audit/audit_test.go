@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bufferSink struct {
+	bytes.Buffer
+	err error
+}
+
+func (s *bufferSink) WriteRecord(line []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.Write(line)
+	s.WriteByte('\n')
+	return nil
+}
+
+func (s *bufferSink) Close() error { return nil }
+
+func (s *bufferSink) lines() []string {
+	return strings.Split(strings.TrimRight(s.String(), "\n"), "\n")
+}
+
+func newTestLogger(t *testing.T, sink Sink, last *Record) *Logger {
+	t.Helper()
+	l, err := New(sink, last)
+	require.NoError(t, err)
+	l.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return l
+}
+
+func TestLoggerChain(t *testing.T) {
+	sink := &bufferSink{}
+	l := newTestLogger(t, sink, nil)
+
+	require.NoError(t, l.Log(Record{Action: ActionScan, FileName: "eicar.txt", Verdict: VerdictInfected, Signature: "Eicar-Signature"}))
+	require.NoError(t, l.Log(Record{Action: ActionReload, Verdict: VerdictSuccess}))
+
+	lines := sink.lines()
+	require.Len(t, lines, 3)
+
+	var recs []Record
+	for _, line := range lines {
+		var rec Record
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		recs = append(recs, rec)
+	}
+
+	assert.Equal(t, ActionStart, recs[0].Action)
+	assert.Equal(t, "", recs[0].PrevHash)
+	for i, rec := range recs {
+		assert.Equal(t, uint64(i+1), rec.Seq)
+		assert.Len(t, rec.Hash, 64)
+		if i > 0 {
+			assert.Equal(t, recs[i-1].Hash, rec.PrevHash)
+		}
+	}
+
+	n, last, err := Verify(strings.NewReader(sink.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, recs[2], *last)
+}
+
+func TestLoggerContinuesChain(t *testing.T) {
+	first := &bufferSink{}
+	l := newTestLogger(t, first, nil)
+	require.NoError(t, l.Log(Record{Action: ActionShutdown, Verdict: VerdictSuccess}))
+
+	_, last, err := Verify(strings.NewReader(first.String()))
+	require.NoError(t, err)
+
+	second := &bufferSink{}
+	newTestLogger(t, second, last)
+
+	n, _, err := Verify(strings.NewReader(first.String()), strings.NewReader(second.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestLoggerSinkError(t *testing.T) {
+	sink := &bufferSink{}
+	l := newTestLogger(t, sink, nil)
+
+	sink.err = errors.New("disk full")
+	assert.Error(t, l.Log(Record{Action: ActionScan}))
+
+	// The failed record doesn't advance the chain
+	sink.err = nil
+	require.NoError(t, l.Log(Record{Action: ActionScan}))
+	_, _, err := Verify(strings.NewReader(sink.String()))
+	assert.NoError(t, err)
+}
+
+func TestLogRequest(t *testing.T) {
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+
+	// Disabled
+	LogRequest(nil, &logger, Record{Action: ActionScan}, "api-key", "192.0.2.1", "req-1")
+
+	sink := &bufferSink{}
+	l := newTestLogger(t, sink, nil)
+	LogRequest(l, &logger, Record{Action: ActionScan, Verdict: VerdictClean}, "api-key", "192.0.2.1", "req-1")
+	lines := sink.lines()
+	require.Len(t, lines, 2)
+	var rec Record
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	assert.Equal(t, "api-key", rec.Principal)
+	assert.Equal(t, "192.0.2.1", rec.ClientIP)
+	assert.Equal(t, "req-1", rec.RequestID)
+	assert.Empty(t, logs.String())
+
+	// Failures are logged
+	sink.err = errors.New("disk full")
+	LogRequest(l, &logger, Record{Action: ActionScan}, "api-key", "192.0.2.1", "req-2")
+	assert.Contains(t, logs.String(), "disk full")
+	assert.Contains(t, logs.String(), "req-2")
+}
+
+func TestVerify(t *testing.T) {
+	sink := &bufferSink{}
+	l := newTestLogger(t, sink, nil)
+	for range 3 {
+		require.NoError(t, l.Log(Record{Action: ActionScan, FileName: "file.txt", Verdict: VerdictClean}))
+	}
+	lines := sink.lines()
+
+	tests := []struct {
+		name    string
+		lines   []string
+		wantN   int
+		wantErr error
+	}{
+		{
+			name:  "intact",
+			lines: lines,
+			wantN: 4,
+		},
+		{
+			name:    "modified record",
+			lines:   []string{lines[0], strings.Replace(lines[1], `"verdict":"clean"`, `"verdict":"infected"`, 1), lines[2], lines[3]},
+			wantN:   1,
+			wantErr: ErrTamperedRecord,
+		},
+		{
+			name:    "removed record",
+			lines:   []string{lines[0], lines[1], lines[3]},
+			wantN:   2,
+			wantErr: ErrBrokenChain,
+		},
+		{
+			name:    "reordered records",
+			lines:   []string{lines[0], lines[2], lines[1], lines[3]},
+			wantN:   1,
+			wantErr: ErrBrokenChain,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, _, err := Verify(strings.NewReader(strings.Join(tt.lines, "\n")))
+			assert.Equal(t, tt.wantN, n)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
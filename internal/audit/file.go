@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// tailSize is the size of the end of the file read to recover the last record.
+const tailSize = 64 * 1024
+
+// FileSink writes audit records to a local file, rotated by size.
+//
+// When the file would exceed maxSize, it is renamed to <path>.1, previous
+// backups are shifted (<path>.1 to <path>.2, etc.) and the oldest ones beyond
+// maxBackups are removed. The hash chain continues across rotations.
+type FileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+// NewFileSink opens, or creates, the audit log file at path.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("error while opening audit log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error while opening audit log file: %w", err)
+	}
+	s.f = f
+	s.size = info.Size()
+	return nil
+}
+
+// WriteRecord appends line, followed by a new line, to the file.
+func (s *FileSink) WriteRecord(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := int64(len(line) + 1)
+	if s.maxSize > 0 && s.size > 0 && s.size+n > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error while writing audit log file: %w", err)
+	}
+	s.size += n
+
+	// Audit records must survive a crash
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("error while syncing audit log file: %w", err)
+	}
+	return nil
+}
+
+// rotate shifts the backups and reopens a new, empty file.
+// Must be called with s.mu held.
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("error while closing audit log file: %w", err)
+	}
+
+	if s.maxBackups > 0 {
+		_ = os.Remove(backupName(s.path, s.maxBackups))
+		for i := s.maxBackups - 1; i >= 1; i-- {
+			if err := os.Rename(backupName(s.path, i), backupName(s.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("error while rotating audit log file: %w", err)
+			}
+		}
+		if err := os.Rename(s.path, backupName(s.path, 1)); err != nil {
+			return fmt.Errorf("error while rotating audit log file: %w", err)
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return fmt.Errorf("error while rotating audit log file: %w", err)
+	}
+
+	return s.open()
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("error while closing audit log file: %w", err)
+	}
+	return nil
+}
+
+// LastRecord returns the last record written to the audit log at path,
+// looking into the most recent backup if the file is empty.
+// It returns nil if there is no record.
+func LastRecord(path string, maxBackups int) (*Record, error) {
+	candidates := []string{path}
+	if maxBackups > 0 {
+		candidates = append(candidates, backupName(path, 1))
+	}
+
+	for _, p := range candidates {
+		line, err := lastLine(p)
+		if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("error while parsing last audit record of %s: %w", p, err)
+		}
+		return &rec, nil
+	}
+	return nil, nil //nolint:nilnil // no record is not an error
+}
+
+// lastLine returns the last non-empty line of the file at path,
+// or nil if the file doesn't exist or is empty.
+func lastLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error while opening audit log file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error while reading audit log file: %w", err)
+	}
+
+	offset := max(0, info.Size()-tailSize)
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error while reading audit log file: %w", err)
+	}
+
+	buf = bytes.TrimRight(buf, "\n")
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		return buf[i+1:], nil
+	}
+	if offset > 0 {
+		return nil, fmt.Errorf("error while reading audit log file: last record exceeds %d bytes", tailSize)
+	}
+	return buf, nil
+}
+
+func backupName(path string, i int) string {
+	return path + "." + strconv.Itoa(i)
+}
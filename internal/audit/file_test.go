@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	s, err := NewFileSink(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"first", "second", "third", "fourth"} {
+		require.NoError(t, s.WriteRecord([]byte(line)))
+	}
+	require.NoError(t, s.Close())
+
+	for name, want := range map[string]string{
+		path:                "fourth\n",
+		backupName(path, 1): "third\n",
+		backupName(path, 2): "second\n",
+	} {
+		b, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(b), name)
+	}
+	_, err = os.Stat(backupName(path, 3))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestLastRecord(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	// No audit log yet
+	last, err := LastRecord(path, 1)
+	assert.NoError(t, err)
+	assert.Nil(t, last)
+
+	s, err := NewFileSink(path, 0, 1)
+	require.NoError(t, err)
+	l, err := New(s, nil)
+	require.NoError(t, err)
+	require.NoError(t, l.Log(Record{Action: ActionReload, Verdict: VerdictSuccess}))
+	require.NoError(t, l.Close())
+
+	last, err = LastRecord(path, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), last.Seq)
+	assert.Equal(t, ActionReload, last.Action)
+
+	// Freshly rotated: the last record is in the backup
+	require.NoError(t, os.Rename(path, backupName(path, 1)))
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+	last, err = LastRecord(path, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), last.Seq)
+
+	// Corrupted last record
+	require.NoError(t, os.WriteFile(path, []byte("{not json\n"), 0o600))
+	_, err = LastRecord(path, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// SyslogSink writes audit records to syslog, with the LOG_AUTH facility.
+//
+// The last record can't be read back from syslog, so the hash chain
+// restarts every time the service starts.
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink connects to the syslog daemon at raddr over network.
+// If network is empty, it connects to the local syslog daemon.
+func NewSyslogSink(network, raddr, tag string) (*SyslogSink, error) {
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, fmt.Errorf("error while connecting to syslog: %w", err)
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+// WriteRecord sends line as a single syslog message.
+func (s *SyslogSink) WriteRecord(line []byte) error {
+	if err := s.w.Info(string(line)); err != nil {
+		return fmt.Errorf("error while writing to syslog: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection to the syslog daemon.
+func (s *SyslogSink) Close() error {
+	if err := s.w.Close(); err != nil {
+		return fmt.Errorf("error while closing syslog connection: %w", err)
+	}
+	return nil
+}
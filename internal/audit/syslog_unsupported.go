@@ -0,0 +1,26 @@
+//go:build windows || plan9
+
+package audit
+
+import "errors"
+
+// ErrSyslogUnsupported indicates syslog is not available on this platform.
+var ErrSyslogUnsupported = errors.New("syslog is not supported on this platform")
+
+// SyslogSink is not available on this platform.
+type SyslogSink struct{}
+
+// NewSyslogSink always returns ErrSyslogUnsupported on this platform.
+func NewSyslogSink(_, _, _ string) (*SyslogSink, error) {
+	return nil, ErrSyslogUnsupported
+}
+
+// WriteRecord always returns ErrSyslogUnsupported on this platform.
+func (s *SyslogSink) WriteRecord(_ []byte) error {
+	return ErrSyslogUnsupported
+}
+
+// Close does nothing on this platform.
+func (s *SyslogSink) Close() error {
+	return nil
+}
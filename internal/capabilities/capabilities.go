@@ -0,0 +1,210 @@
+// Package capabilities negotiates the features of the API with the commands
+// supported by clamd, as reported by its VERSIONCOMMANDS command.
+package capabilities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/rs/zerolog"
+)
+
+// DefaultRefreshInterval is the default interval between two queries of
+// the commands supported by clamd.
+const DefaultRefreshInterval = 5 * time.Minute
+
+// Commands of clamd the features depend on.
+const (
+	CommandPing     = "PING"
+	CommandVersion  = "VERSION"
+	CommandReload   = "RELOAD"
+	CommandStats    = "STATS"
+	CommandShutdown = "SHUTDOWN"
+	CommandInstream = "INSTREAM"
+)
+
+// ErrUnsupported indicates a feature needs a command clamd doesn't support.
+var ErrUnsupported = errors.New("command not supported by clamd")
+
+// Status is the status of the commands supported by clamd.
+type Status struct {
+	// Known is false until clamd has reported its commands.
+	Known     bool       `json:"known"`
+	Commands  []string   `json:"commands,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Cache caches the commands supported by clamd. Until clamd has reported
+// them, every command is assumed to be supported, so that an unreachable
+// clamd at startup doesn't disable the features.
+type Cache struct {
+	clamav   clamav.Clamaver
+	interval time.Duration
+	now      func() time.Time
+
+	mu     sync.RWMutex
+	status Status
+	// commands is the set of Status.Commands.
+	commands map[string]bool
+}
+
+// New returns a Cache of the commands supported by the clamd of client,
+// refreshed every interval by Run.
+func New(client clamav.Clamaver, interval time.Duration) *Cache {
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+	return &Cache{clamav: client, interval: interval, now: time.Now}
+}
+
+// Refresh queries the commands supported by clamd. The commands previously
+// reported are kept if the query fails.
+func (c *Cache) Refresh(ctx context.Context) error {
+	reply, err := c.clamav.VersionCommands(ctx)
+	return c.update(reply, err)
+}
+
+// update caches the commands of reply, the reply of clamd to VERSIONCOMMANDS,
+// or records err, the error of the query.
+func (c *Cache) update(reply []byte, err error) error {
+	var cmds []string
+	if err == nil {
+		cmds, err = clamav.ParseCommands(reply)
+	}
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.status.LastError = err.Error()
+		return fmt.Errorf("error while querying the commands supported by clamd: %w", err)
+	}
+	c.status = Status{Known: true, Commands: cmds, CheckedAt: &now}
+	c.commands = make(map[string]bool, len(cmds))
+	for _, cmd := range cmds {
+		c.commands[cmd] = true
+	}
+	return nil
+}
+
+// Run refreshes the commands every interval until ctx is done.
+func (c *Cache) Run(ctx context.Context, logger *zerolog.Logger) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		before := c.Status()
+		if err := c.Refresh(ctx); err != nil {
+			if ctx.Err() == nil {
+				logger.Warn().Err(err).Msg("unable to refresh the commands supported by clamd")
+			}
+			continue
+		}
+		if after := c.Status(); !slices.Equal(before.Commands, after.Commands) {
+			logger.Info().Strs("commands", after.Commands).Msg("commands supported by clamd changed")
+		}
+	}
+}
+
+// Status returns the status of the commands supported by clamd.
+func (c *Cache) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.status
+}
+
+// Supports returns true if clamd supports cmd, or hasn't reported its
+// commands yet.
+func (c *Cache) Supports(cmd string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return !c.status.Known || c.commands[cmd]
+}
+
+// Require returns an error wrapping ErrUnsupported if clamd doesn't support cmd.
+func (c *Cache) Require(cmd string) error {
+	if !c.Supports(cmd) {
+		return fmt.Errorf("%w: %s", ErrUnsupported, cmd)
+	}
+	return nil
+}
+
+// Client returns a client failing with ErrUnsupported, instead of sending
+// them to clamd, the commands clamd doesn't support.
+func (c *Cache) Client(client clamav.Clamaver) clamav.Clamaver {
+	return &gatedClient{Clamaver: client, cache: c}
+}
+
+// gatedClient checks the commands are supported before sending them to clamd.
+// VERSIONCOMMANDS, used to refresh the commands, and freshclam, which isn't
+// a command of clamd, are never gated.
+type gatedClient struct {
+	clamav.Clamaver
+	cache *Cache
+}
+
+func (g *gatedClient) Ping(ctx context.Context) ([]byte, error) {
+	if err := g.cache.Require(CommandPing); err != nil {
+		return nil, err
+	}
+	return g.Clamaver.Ping(ctx)
+}
+
+// VersionCommands is always sent to clamd, the version of the databases it
+// reports changing with each reload, and its reply refreshes the cache.
+func (g *gatedClient) VersionCommands(ctx context.Context) ([]byte, error) {
+	reply, err := g.Clamaver.VersionCommands(ctx)
+	_ = g.cache.update(reply, err)
+	return reply, err
+}
+
+func (g *gatedClient) Version(ctx context.Context) ([]byte, error) {
+	if err := g.cache.Require(CommandVersion); err != nil {
+		return nil, err
+	}
+	return g.Clamaver.Version(ctx)
+}
+
+func (g *gatedClient) Reload(ctx context.Context) error {
+	if err := g.cache.Require(CommandReload); err != nil {
+		return err
+	}
+	return g.Clamaver.Reload(ctx)
+}
+
+func (g *gatedClient) Stats(ctx context.Context) ([]byte, error) {
+	if err := g.cache.Require(CommandStats); err != nil {
+		return nil, err
+	}
+	return g.Clamaver.Stats(ctx)
+}
+
+func (g *gatedClient) Shutdown(ctx context.Context) error {
+	if err := g.cache.Require(CommandShutdown); err != nil {
+		return err
+	}
+	return g.Clamaver.Shutdown(ctx)
+}
+
+func (g *gatedClient) InStream(ctx context.Context, r io.Reader, size int64) ([]byte, error) {
+	if err := g.cache.Require(CommandInstream); err != nil {
+		return nil, err
+	}
+	return g.Clamaver.InStream(ctx, r, size)
+}
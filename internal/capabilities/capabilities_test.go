@@ -0,0 +1,146 @@
+package capabilities
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClamd reports the commands and answers the commands it receives.
+type fakeClamd struct {
+	clamav.Clamaver
+
+	mu    sync.Mutex
+	reply string
+	err   error
+	sent  []string
+}
+
+func (f *fakeClamd) setReply(reply string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reply, f.err = reply, err
+}
+
+func (f *fakeClamd) VersionCommands(context.Context) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return []byte(f.reply), f.err
+}
+
+func (f *fakeClamd) Stats(context.Context) ([]byte, error) {
+	f.sent = append(f.sent, CommandStats)
+	return []byte("POOLS: 1"), nil
+}
+
+func (f *fakeClamd) InStream(context.Context, io.Reader, int64) ([]byte, error) {
+	f.sent = append(f.sent, CommandInstream)
+	return []byte("stream: OK"), nil
+}
+
+func (f *fakeClamd) FreshClam(context.Context) ([]byte, error) {
+	f.sent = append(f.sent, "freshclam")
+	return nil, nil
+}
+
+const versionCommands = "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023| COMMANDS: SCAN QUIT RELOAD PING CONTSCAN VERSIONCOMMANDS VERSION END SHUTDOWN INSTREAM"
+
+func TestCacheRefresh(t *testing.T) {
+	clamd := &fakeClamd{}
+	c := New(clamd, 0)
+	assert.Equal(t, DefaultRefreshInterval, c.interval)
+
+	// Every command is assumed to be supported until clamd reports them
+	clamd.setReply("", errors.New("connection refused"))
+	require.Error(t, c.Refresh(context.Background()))
+	assert.False(t, c.Status().Known)
+	assert.Equal(t, "connection refused", c.Status().LastError)
+	assert.True(t, c.Supports(CommandStats))
+	assert.NoError(t, c.Require(CommandShutdown))
+
+	clamd.setReply(versionCommands, nil)
+	require.NoError(t, c.Refresh(context.Background()))
+	status := c.Status()
+	assert.True(t, status.Known)
+	assert.NotNil(t, status.CheckedAt)
+	assert.Empty(t, status.LastError)
+	assert.Contains(t, status.Commands, CommandInstream)
+	assert.True(t, c.Supports(CommandInstream))
+	assert.False(t, c.Supports(CommandStats))
+	err := c.Require(CommandStats)
+	assert.ErrorIs(t, err, ErrUnsupported)
+	assert.EqualError(t, err, "command not supported by clamd: STATS")
+
+	// The commands previously reported are kept
+	clamd.setReply("UNKNOWN COMMAND", nil)
+	require.ErrorIs(t, c.Refresh(context.Background()), clamav.ErrUnexpectedResponse)
+	assert.True(t, c.Supports(CommandInstream))
+	assert.False(t, c.Supports(CommandStats))
+	assert.NotEmpty(t, c.Status().LastError)
+}
+
+func TestCacheClient(t *testing.T) {
+	clamd := &fakeClamd{reply: versionCommands}
+	c := New(clamd, time.Minute)
+	client := c.Client(clamd)
+
+	// Unknown commands are sent
+	_, err := client.Stats(context.Background())
+	require.NoError(t, err)
+	reply, err := client.VersionCommands(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, versionCommands, string(reply))
+
+	require.NoError(t, c.Refresh(context.Background()))
+
+	_, err = client.Stats(context.Background())
+	assert.ErrorIs(t, err, ErrUnsupported)
+	_, err = client.InStream(context.Background(), strings.NewReader("content"), 7)
+	assert.NoError(t, err)
+	_, err = client.FreshClam(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{CommandStats, CommandInstream, "freshclam"}, clamd.sent)
+
+	// clamd is always queried, its reply refreshing the commands
+	clamd.setReply(versionCommands+" STATS", nil)
+	reply, err = client.VersionCommands(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, versionCommands+" STATS", string(reply))
+	assert.True(t, c.Supports(CommandStats))
+
+	clamd.setReply("", errors.New("connection refused"))
+	_, err = client.VersionCommands(context.Background())
+	assert.EqualError(t, err, "connection refused")
+	assert.True(t, c.Supports(CommandStats))
+	assert.Equal(t, "connection refused", c.Status().LastError)
+}
+
+func TestCacheRun(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	clamd := &fakeClamd{reply: "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023| COMMANDS: PING"}
+	c := New(clamd, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx, &logger)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return c.Status().Known && !c.Supports(CommandStats) }, time.Second, time.Millisecond)
+	clamd.setReply(versionCommands+" STATS", nil)
+	assert.Eventually(t, func() bool { return c.Supports(CommandStats) }, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+}
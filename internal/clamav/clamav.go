@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"os/exec"
 	"strings"
 	"time"
@@ -33,9 +34,25 @@ type Clamaver interface {
 // Client implements the Clamaver interface and provides
 // TCP-based communication with a ClamAV daemon.
 type Client struct {
-	dialer  net.Dialer
-	address string
-	network string
+	dialer    net.Dialer
+	address   string
+	network   string
+	freshclam FreshClamOptions
+}
+
+// FreshClamOptions configures the freshclam command run by FreshClam.
+type FreshClamOptions struct {
+	// Binary is the path of freshclam. Empty defaults to "freshclam", looked up in the PATH.
+	Binary string
+	// ConfigFile is the configuration file of freshclam. Empty defaults to
+	// the configuration file freshclam was built with.
+	ConfigFile string
+	// DataDir is the database directory, overriding the DatabaseDirectory of the configuration file.
+	DataDir string
+	// Args are the extra arguments of freshclam.
+	Args []string
+	// Env are the "KEY=value" variables added to the environment of freshclam.
+	Env []string
 }
 
 var _ Clamaver = (*Client)(nil)
@@ -54,6 +71,12 @@ func NewClamavClient(addr string, netw string, timeout time.Duration, keepalive
 	}
 }
 
+// SetFreshClamOptions sets the options of the freshclam command run by FreshClam.
+// It must be called before FreshClam.
+func (c *Client) SetFreshClamOptions(opts FreshClamOptions) {
+	c.freshclam = opts
+}
+
 // Ping sends a PING command to the ClamAV daemon to test connectivity.
 func (c *Client) Ping(ctx context.Context) ([]byte, error) {
 	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
@@ -177,12 +200,19 @@ func (c *Client) Shutdown(ctx context.Context) error {
 // and stream the given io.Reader to let Clamd scan it.
 //
 // The stream is sent to Clamd in chunks, after INSTREAM, on the same socket on which the command was sent.
+// When size is known, the content of r is sent as a single chunk of size bytes.
+// When size is negative, r is read until EOF and sent in chunks of InStreamChunkSize bytes,
+// which allows scanning content whose size isn't known in advance.
 //
 // It will read the response and return it as a byte slice as well as any error
 // encountered.
 //
 // See https://linux.die.net/man/8/clamd for a detailed explanation of the INSTREAM command.
 func (c *Client) InStream(ctx context.Context, r io.Reader, size int64) ([]byte, error) {
+	if size == 0 || size > 4294967295 { // Check for valid uint32 range
+		return nil, fmt.Errorf("file size %d exceeds maximum allowed size", size)
+	}
+
 	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
 	if err != nil {
 		return nil, fmt.Errorf("error while dialing %s/%s: %w", c.network, c.address, err)
@@ -193,7 +223,6 @@ func (c *Client) InStream(ctx context.Context, r io.Reader, size int64) ([]byte,
 	// expressed as a 4 byte unsigned integer in network byte order and <data> is the actual chunk.
 	// Streaming is terminated by sending a zero-length chunk.
 
-	reader := bufio.NewReaderSize(r, 2048)
 	writer := bufio.NewWriter(conn)
 
 	// Start scan command.
@@ -205,37 +234,28 @@ func (c *Client) InStream(ctx context.Context, r io.Reader, size int64) ([]byte,
 		return nil, fmt.Errorf("error while flushing command to %s/%s: %w", c.network, c.address, err)
 	}
 
-	// The size (referred previously as '<length>') must be a byte[] of length 4 - representing a
-	// uint32 in a big-endian format (network byte order, tcp standard).
-	b := make([]byte, 4)
-	if size > 0 && size <= 4294967295 { // Check for valid uint32 range
-		binary.BigEndian.PutUint32(b, uint32(size))
+	// Streaming the data
+	if size > 0 {
+		err = c.writeChunk(writer, bufio.NewReaderSize(r, 2048), size)
 	} else {
-		return nil, fmt.Errorf("file size %d exceeds maximum allowed size", size)
+		err = c.writeChunks(writer, r)
 	}
-	_, err = writer.Write(b)
-	if err != nil {
-		return nil, fmt.Errorf("error while writing data length to %s/%s: %w", c.network, c.address, err)
-	}
-	if err = writer.Flush(); err != nil {
-		return nil, fmt.Errorf("error while flushing data length to %s/%s: %w", c.network, c.address, err)
+	if errors.Is(err, errReadingContent) {
+		// Clamd is still waiting for content, there is no response to read.
+		return nil, err
 	}
-
-	// Streaming the data
-	_, err = reader.WriteTo(writer)
 	if err != nil {
 		resp, e := c.readResponse(conn)
 		if e != nil {
-			return nil, fmt.Errorf("error while streaming content to %s/%s: %w", c.network, c.address, err)
+			return nil, err
 		}
-		err = c.parseResponse(resp)
-		if err != nil {
-			if errors.Is(err, ErrScanFileSizeLimitExceeded) {
-				return nil, err
+		if e = c.parseResponse(resp); e != nil {
+			if errors.Is(e, ErrScanFileSizeLimitExceeded) {
+				return nil, e
 			}
-			return nil, fmt.Errorf("error from clamav: %w", err)
+			return nil, fmt.Errorf("error from clamav: %w", e)
 		}
-		return resp, fmt.Errorf("error while streaming content to %s/%s: %w", c.network, c.address, err)
+		return resp, err
 	}
 
 	// Sending 4 bytes to signal the end of the transfer.
@@ -263,6 +283,77 @@ func (c *Client) InStream(ctx context.Context, r io.Reader, size int64) ([]byte,
 	return resp, nil
 }
 
+// errReadingContent indicates the content to stream couldn't be read.
+var errReadingContent = errors.New("error while reading content to stream")
+
+// InStreamChunkSize is the size of the chunks sent to Clamd
+// when streaming content of unknown size.
+const InStreamChunkSize = 64 * 1024
+
+// writeChunk writes the content of r to w as a single chunk of size bytes.
+func (c *Client) writeChunk(w *bufio.Writer, r io.Reader, size int64) error {
+	// The size (referred previously as '<length>') must be a byte[] of length 4 - representing a
+	// uint32 in a big-endian format (network byte order, tcp standard).
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("error while writing data length to %s/%s: %w", c.network, c.address, err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error while flushing data length to %s/%s: %w", c.network, c.address, err)
+	}
+
+	_, err := io.CopyN(w, contentReader{r}, size)
+	switch {
+	case errors.Is(err, io.EOF):
+		// The content is shorter than announced
+		return fmt.Errorf("%w: %w", errReadingContent, io.ErrUnexpectedEOF)
+	case errors.Is(err, errReadingContent):
+		return err
+	case err != nil:
+		return fmt.Errorf("error while streaming content to %s/%s: %w", c.network, c.address, err)
+	}
+	return nil
+}
+
+// contentReader tells the errors reading the content to stream
+// from the errors writing it to clamd.
+type contentReader struct {
+	r io.Reader
+}
+
+func (c contentReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("%w: %w", errReadingContent, err)
+	}
+	return n, err
+}
+
+// writeChunks reads r until EOF and writes its content to w
+// in chunks of at most InStreamChunkSize bytes.
+func (c *Client) writeChunks(w *bufio.Writer, r io.Reader) error {
+	buf := make([]byte, 4+InStreamChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := w.Write(buf[:4+n]); err != nil {
+				return fmt.Errorf("error while streaming content to %s/%s: %w", c.network, c.address, err)
+			}
+			if err := w.Flush(); err != nil {
+				return fmt.Errorf("error while streaming content to %s/%s: %w", c.network, c.address, err)
+			}
+		}
+		switch {
+		case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			return nil
+		case err != nil:
+			return fmt.Errorf("%w: %w", errReadingContent, err)
+		}
+	}
+}
+
 // SendCommand will attempt send the given command to Clamd
 // over the network.
 // It will read the response and return it as a byte slice as well as any error
@@ -328,7 +419,7 @@ func (c *Client) parseResponse(msg []byte) error {
 // and returns the combined output.
 func (c *Client) FreshClam(ctx context.Context) ([]byte, error) {
 	// Create the freshclam command with context for cancellation
-	cmd := exec.CommandContext(ctx, "freshclam", "--verbose", "--stdout")
+	cmd := c.freshClamCommand(ctx)
 
 	// Capture both stdout and stderr for comprehensive output
 	output, err := cmd.CombinedOutput()
@@ -353,3 +444,27 @@ func (c *Client) FreshClam(ctx context.Context) ([]byte, error) {
 
 	return output, nil
 }
+
+// freshClamCommand returns the freshclam command configured by the options.
+func (c *Client) freshClamCommand(ctx context.Context) *exec.Cmd {
+	opts := c.freshclam
+	binary := opts.Binary
+	if binary == "" {
+		binary = "freshclam"
+	}
+
+	args := []string{"--verbose", "--stdout"}
+	if opts.ConfigFile != "" {
+		args = append(args, "--config-file="+opts.ConfigFile)
+	}
+	if opts.DataDir != "" {
+		args = append(args, "--datadir="+opts.DataDir)
+	}
+	args = append(args, opts.Args...)
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
+	}
+	return cmd
+}
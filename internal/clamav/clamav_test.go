@@ -9,10 +9,13 @@ import (
 	"io"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/stretchr/testify/assert"
@@ -39,6 +42,7 @@ var (
 	handlerInStreamGoodFile    handlerType = "instreamgoodfile"
 	handlerInStreamBadFile     handlerType = "instreamgbadfile"
 	handlerInStreamTooLongFile handlerType = "instreamtoolongfile"
+	handlerInStreamChunks      handlerType = "instreamchunks"
 )
 
 // ClamdMockTCPServer is a tcp server
@@ -49,6 +53,10 @@ type ClamdMockTCPServer struct {
 	quit     chan struct{}
 	ready    chan bool
 	wg       sync.WaitGroup
+
+	// chunks holds the sizes of the chunks received by handlerInStreamChunks
+	mu     sync.Mutex
+	chunks []int
 }
 
 // Mostly taken from https://eli.thegreenplace.net/2020/graceful-shutdown-of-a-tcp-server-in-go/
@@ -115,6 +123,9 @@ func (s *ClamdMockTCPServer) Serve(handler handlerType) {
 				case handlerInStreamTooLongFile:
 					s.handlerInStreamTooLongFile(conn)
 					s.wg.Done()
+				case handlerInStreamChunks:
+					s.handlerInStreamChunks(conn)
+					s.wg.Done()
 				default:
 					s.handlerPing(conn)
 					s.wg.Done()
@@ -262,6 +273,45 @@ func (s *ClamdMockTCPServer) handlerInStreamTooLongFile(conn net.Conn) {
 	}
 }
 
+// handlerInStreamChunks decodes the chunks of an INSTREAM command, records their sizes
+// and replies as clamd would for the reassembled content.
+func (s *ClamdMockTCPServer) handlerInStreamChunks(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	cmd := make([]byte, len(CmdInstream))
+	if _, err := io.ReadFull(conn, cmd); err != nil {
+		return
+	}
+
+	var content []byte
+	for {
+		l := make([]byte, 4)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return
+		}
+		size := binary.BigEndian.Uint32(l)
+		if size == 0 {
+			break
+		}
+
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(conn, chunk); err != nil {
+			return
+		}
+		content = append(content, chunk...)
+
+		s.mu.Lock()
+		s.chunks = append(s.chunks, int(size))
+		s.mu.Unlock()
+	}
+
+	if bytes.Contains(content, []byte(badFile)) {
+		_, _ = fmt.Fprint(conn, "stream: Win.Test.EICAR_HDB-1 FOUND\000")
+		return
+	}
+	_, _ = fmt.Fprint(conn, "stream: OK\000")
+}
+
 func TestNewClamavClient(t *testing.T) {
 	type args struct {
 		addr      string
@@ -492,6 +542,60 @@ func TestClientInStream(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestClientInStreamUnknownSize(t *testing.T) {
+	s := NewServer(network, listen, handlerInStreamChunks)
+	<-s.ready
+	defer s.Stop()
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	// Content is sent in chunks of InStreamChunkSize bytes
+	content := strings.Repeat("a", 2*InStreamChunkSize+10)
+	resp, err := c.InStream(context.Background(), strings.NewReader(content), -1)
+	assert.NoError(t, err)
+	assert.EqualValues(t, RespScan, resp)
+
+	s.mu.Lock()
+	assert.Equal(t, []int{InStreamChunkSize, InStreamChunkSize, 10}, s.chunks)
+	s.chunks = nil
+	s.mu.Unlock()
+
+	// Signatures spanning the whole stream are found
+	resp, err = c.InStream(context.Background(), strings.NewReader(badFile), -1)
+	assert.ErrorIs(t, err, ErrVirusFound)
+	assert.True(t, bytes.Contains(resp, []byte("FOUND")))
+
+	// Errors reading the content are returned
+	pr, pw := io.Pipe()
+	pw.CloseWithError(errors.New("client went away"))
+	_, err = c.InStream(context.Background(), pr, -1)
+	assert.ErrorContains(t, err, "client went away")
+
+	// Empty content can't be streamed with a known size
+	_, err = c.InStream(context.Background(), strings.NewReader(""), 0)
+	assert.Error(t, err)
+}
+
+func TestClientInStreamReadError(t *testing.T) {
+	s := NewServer(network, listen, handlerInStreamChunks)
+	<-s.ready
+	defer s.Stop()
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	// Errors reading content of known size are returned without
+	// waiting for clamd, which still expects the rest of the chunk
+	r := io.MultiReader(strings.NewReader("foo"), iotest.ErrReader(errors.New("connection reset")))
+	_, err := c.InStream(context.Background(), r, 10)
+	assert.ErrorContains(t, err, "connection reset")
+
+	// So is content shorter than announced
+	_, err = c.InStream(context.Background(), strings.NewReader("foo"), 10)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
 func TestClientParseResponse(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -562,3 +666,41 @@ func TestClientParseResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestClientFreshClamCommand(t *testing.T) {
+	c := NewClamavClient(listen, network, time.Second, time.Second)
+
+	cmd := c.freshClamCommand(context.Background())
+	assert.Equal(t, []string{"freshclam", "--verbose", "--stdout"}, cmd.Args)
+	assert.Nil(t, cmd.Env)
+
+	c.SetFreshClamOptions(FreshClamOptions{
+		Binary:     "/usr/local/bin/freshclam",
+		ConfigFile: "/etc/clamav-api/freshclam.conf",
+		DataDir:    "/var/lib/clamav",
+		Args:       []string{"--no-dns"},
+		Env:        []string{"HTTPS_PROXY=http://proxy:3128"},
+	})
+	cmd = c.freshClamCommand(context.Background())
+	assert.Equal(t, "/usr/local/bin/freshclam", cmd.Path)
+	assert.Equal(t, []string{"/usr/local/bin/freshclam", "--verbose", "--stdout", "--config-file=/etc/clamav-api/freshclam.conf", "--datadir=/var/lib/clamav", "--no-dns"}, cmd.Args)
+	assert.Contains(t, cmd.Env, "HTTPS_PROXY=http://proxy:3128")
+}
+
+func TestClientFreshClam(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "freshclam")
+	script := "#!/bin/sh\necho \"$@\"\necho \"proxy: $HTTPS_PROXY\"\necho \"daily.cld database is up-to-date (version: 27000)\"\n"
+	if err := os.WriteFile(binary, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClamavClient(listen, network, time.Second, time.Second)
+	c.SetFreshClamOptions(FreshClamOptions{
+		Binary: binary,
+		Args:   []string{"--no-dns"},
+		Env:    []string{"HTTPS_PROXY=http://proxy:3128"},
+	})
+	out, err := c.FreshClam(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "--verbose --stdout --no-dns\nproxy: http://proxy:3128\ndaily.cld database is up-to-date (version: 27000)\n", string(out))
+}
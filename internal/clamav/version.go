@@ -0,0 +1,73 @@
+package clamav
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// versionDateLayout is the layout of the date of the databases in the
+// replies of the VERSION command, as formatted by ctime(3).
+const versionDateLayout = "Mon Jan _2 15:04:05 2006"
+
+// VersionInfo is the parsed reply of the VERSION command, such as
+// "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023".
+type VersionInfo struct {
+	// Engine is the version of the engine, eg. "1.0.1".
+	Engine string
+	// Database is the version of the databases, the version of the most
+	// recent one. Zero if clamd reports no database.
+	Database int
+	// DatabaseDate is the build time of the databases, in UTC.
+	// Zero if clamd reports no database.
+	DatabaseDate time.Time
+}
+
+// ParseVersion parses the reply of the VERSION command. The commands
+// following the version in the reply of VERSIONCOMMANDS are ignored.
+func ParseVersion(reply []byte) (VersionInfo, error) {
+	s := string(bytes.TrimSpace(reply))
+	// ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023| COMMANDS: SCAN QUIT ...
+	s, _, _ = strings.Cut(s, "|")
+
+	engine, ok := strings.CutPrefix(s, "ClamAV ")
+	if !ok {
+		return VersionInfo{}, fmt.Errorf("%w: %q", ErrUnexpectedResponse, s)
+	}
+
+	var v VersionInfo
+	engine, db, ok := strings.Cut(engine, "/")
+	v.Engine = strings.TrimSpace(engine)
+	if v.Engine == "" {
+		return VersionInfo{}, fmt.Errorf("%w: %q", ErrUnexpectedResponse, s)
+	}
+	if !ok {
+		return v, nil
+	}
+
+	db, date, _ := strings.Cut(db, "/")
+	var err error
+	if v.Database, err = strconv.Atoi(strings.TrimSpace(db)); err != nil {
+		return VersionInfo{}, fmt.Errorf("%w: invalid database version in %q", ErrUnexpectedResponse, s)
+	}
+	if date = strings.TrimSpace(date); date != "" {
+		if v.DatabaseDate, err = time.Parse(versionDateLayout, date); err != nil {
+			return VersionInfo{}, fmt.Errorf("%w: invalid database date in %q", ErrUnexpectedResponse, s)
+		}
+	}
+	return v, nil
+}
+
+// ParseCommands parses the commands supported by clamd from the reply of
+// the VERSIONCOMMANDS command, such as
+// "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023| COMMANDS: SCAN QUIT RELOAD ...".
+func ParseCommands(reply []byte) ([]string, error) {
+	s := string(bytes.TrimSpace(reply))
+	_, cmds, ok := strings.Cut(s, "| COMMANDS:")
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnexpectedResponse, s)
+	}
+	return strings.Fields(cmds), nil
+}
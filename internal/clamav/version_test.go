@@ -0,0 +1,73 @@
+package clamav
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    VersionInfo
+		wantErr bool
+	}{
+		{
+			name:  "version",
+			reply: "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023\n",
+			want:  VersionInfo{Engine: "1.0.1", Database: 26961, DatabaseDate: time.Date(2023, time.July, 6, 7, 29, 38, 0, time.UTC)},
+		},
+		{
+			name:  "versioncommands",
+			reply: "ClamAV 1.4.2/27431/Mon Oct 13 08:15:02 2025| COMMANDS: SCAN QUIT RELOAD PING CONTSCAN VERSIONCOMMANDS VERSION",
+			want:  VersionInfo{Engine: "1.4.2", Database: 27431, DatabaseDate: time.Date(2025, time.October, 13, 8, 15, 2, 0, time.UTC)},
+		},
+		{name: "no database", reply: "ClamAV 1.0.1", want: VersionInfo{Engine: "1.0.1"}},
+		{name: "no date", reply: "ClamAV 1.0.1/26961", want: VersionInfo{Engine: "1.0.1", Database: 26961}},
+		{name: "not clamav", reply: "PONG", wantErr: true},
+		{name: "no engine", reply: "ClamAV /26961/Thu Jul  6 07:29:38 2023", wantErr: true},
+		{name: "invalid database", reply: "ClamAV 1.0.1/daily/Thu Jul  6 07:29:38 2023", wantErr: true},
+		{name: "invalid date", reply: "ClamAV 1.0.1/26961/yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVersion([]byte(tt.reply))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrUnexpectedResponse)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "commands",
+			reply: "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023| COMMANDS: SCAN QUIT RELOAD PING CONTSCAN VERSIONCOMMANDS VERSION\n",
+			want:  []string{"SCAN", "QUIT", "RELOAD", "PING", "CONTSCAN", "VERSIONCOMMANDS", "VERSION"},
+		},
+		{name: "no commands", reply: "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023| COMMANDS:", want: []string{}},
+		{name: "version only", reply: "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCommands([]byte(tt.reply))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrUnexpectedResponse)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
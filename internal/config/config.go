@@ -3,14 +3,24 @@
 package config
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
 
+	"github.com/lescactus/clamav-api-go/internal/capabilities"
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/lescactus/clamav-api-go/internal/freshclam"
+	"github.com/lescactus/clamav-api-go/internal/heuristics"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/internal/ratelimit"
+	"github.com/lescactus/clamav-api-go/internal/rules"
+	"github.com/lescactus/clamav-api-go/internal/signatures"
 	"github.com/spf13/viper"
 )
 
@@ -29,6 +39,11 @@ var (
 	defaultServerReadHeaderTimeout = 10 * time.Second
 	defaultServerWriteTimeout      = 30 * time.Second
 	defaultServerMaxRequestSize    = int64(10 * 1024 * 1024) // 10MiB
+	defaultServerTrustedProxies    = ""                      // Empty by default (proxy headers are ignored)
+	defaultServerSwaggerUI         = false
+	defaultServerGRPCAddr          = "" // Empty by default (gRPC server disabled)
+	defaultServerICAPAddr          = "" // Empty by default (ICAP server disabled)
+	defaultServerICAPIdleTimeout   = 60 * time.Second
 
 	defaultLoggerLogLevel          = "info"
 	defaultLoggerDurationFieldUnit = "ms"
@@ -39,8 +54,97 @@ var (
 	defaultClamavTimeout   = 30 * time.Second
 	defaultClamavKeepAlive = 30 * time.Second
 
+	defaultClamavCapabilitiesRefresh = capabilities.DefaultRefreshInterval
+
+	defaultArchiveHeuristicsPolicy = "" // Empty by default (archive heuristics reported as infected)
+	defaultPolicyFile              = "" // Empty by default (verdict policy disabled)
+
 	defaultAuthAPIKey       = ""          // Empty by default (authentication disabled)
 	defaultAuthAPIKeyHeader = "X-API-Key" // Standard API key header
+
+	defaultAuthHMACKeys         = "" // Empty by default (HMAC signing disabled)
+	defaultAuthHMACMaxClockSkew = 5 * time.Minute
+
+	defaultRateLimitRules = "" // Empty by default (rate limiting disabled)
+
+	defaultAdmissionMaxInFlightScans    = 0 // 0 by default (admission control disabled)
+	defaultAdmissionMaxQueuedScans      = 0
+	defaultAdmissionQueueTimeout        = 10 * time.Second
+	defaultAdmissionClamdMaxQueue       = 0 // 0 by default (clamd backlog ignored)
+	defaultAdmissionClamdMinIdleThreads = 0
+	defaultAdmissionClamdPollInterval   = 5 * time.Second
+
+	defaultAuditLogOutput        = "" // Empty by default (audit log disabled)
+	defaultAuditLogFile          = "audit.log"
+	defaultAuditLogMaxSize       = int64(100 * 1024 * 1024) // 100MiB
+	defaultAuditLogMaxBackups    = 10
+	defaultAuditLogSyslogNetwork = "" // Empty by default (local syslog daemon)
+	defaultAuditLogSyslogAddr    = ""
+
+	defaultQuarantineDir             = "" // Empty by default (quarantine disabled)
+	defaultQuarantineKey             = ""
+	defaultQuarantineRetention       = 30 * 24 * time.Hour
+	defaultQuarantineArchivePassword = "infected" // Customary password of malware sample archives
+
+	defaultS3Endpoint       = "" // Empty by default (S3 scanning disabled)
+	defaultS3AccessKey      = ""
+	defaultS3SecretKey      = ""
+	defaultS3Region         = "us-east-1"
+	defaultS3UseSSL         = true
+	defaultS3AllowedBuckets = "" // Empty by default (all buckets allowed)
+	defaultS3TagVerdict     = false
+
+	defaultURLScanEnabled         = false
+	defaultURLScanAllowedSchemes  = "http,https"
+	defaultURLScanAllowedHosts    = ""                      // Empty by default (all hosts allowed)
+	defaultURLScanAllowedNetworks = ""                      // Empty by default (all internal addresses blocked)
+	defaultURLScanMaxSize         = int64(10 * 1024 * 1024) // 10MiB
+	defaultURLScanTimeout         = 30 * time.Second
+	defaultURLScanMaxRedirects    = 5
+
+	defaultFileTypeDetectionEnabled = false
+	defaultFileTypeAllow            = "" // Empty by default (all types allowed)
+	defaultFileTypeDeny             = "" // Empty by default (no type denied)
+	defaultFileTypePeekSize         = filetype.DefaultPeekSize
+
+	defaultReputationAllowFiles     = "" // Empty by default (no allow-list)
+	defaultReputationDenyFiles      = "" // Empty by default (no deny-list)
+	defaultReputationReloadInterval = 30 * time.Second
+
+	defaultSignaturesDBDir  = "" // Empty by default (custom signatures disabled)
+	defaultSignaturesDBName = signatures.DefaultDatabaseName
+
+	defaultRulesDir         = "" // Empty by default (custom rules disabled)
+	defaultRulesValidator   = "" // Empty by default (syntax checks only)
+	defaultRulesReloadCheck = rules.DefaultCheckDuration
+
+	defaultFreshClamTimeout     = freshclam.DefaultTimeout
+	defaultFreshClamHistorySize = freshclam.DefaultHistorySize
+
+	defaultFreshClamBinary         = "freshclam"
+	defaultFreshClamConfigFile     = "" // Empty by default (configuration file freshclam was built with)
+	defaultFreshClamDataDir        = "" // Empty by default (DatabaseDirectory of the configuration file)
+	defaultFreshClamExtraArgs      = ""
+	defaultFreshClamEnv            = ""
+	defaultFreshClamConfigTemplate = "" // Empty by default (management of the freshclam settings disabled)
+
+	defaultFreshClamScheduleInterval   = time.Duration(0) // Zero by default (scheduled updates disabled)
+	defaultFreshClamScheduleJitter     = freshclam.DefaultJitter
+	defaultFreshClamScheduleBackoff    = freshclam.DefaultBackoff
+	defaultFreshClamScheduleMaxBackoff = freshclam.DefaultMaxBackoff
+	defaultFreshClamReloadConfirm      = freshclam.DefaultConfirmTimeout
+
+	defaultDatabasesDir    = "" // Empty by default (inspection of the database directory disabled)
+	defaultDatabasesMaxAge = 48 * time.Hour
+
+	defaultMirrorDir           = ""                       // Empty by default (mirror of the virus databases disabled)
+	defaultMirrorMaxUploadSize = int64(512 * 1024 * 1024) // 512MiB
+)
+
+// Audit log outputs.
+const (
+	AuditLogOutputFile   = "file"
+	AuditLogOutputSyslog = "syslog"
 )
 
 // App holds the complete application configuration.
@@ -60,6 +164,22 @@ type App struct {
 	// Maximum size of a client request, including headers and body
 	ServerMaxRequestSize int64 `json:"server_max_request_size" yaml:"server_max_request_size" mapstructure:"SERVER_MAX_REQUEST_SIZE"`
 
+	// Comma-separated list of IP addresses or CIDR ranges of the reverse proxies
+	// allowed to set the X-Forwarded-For and X-Real-IP headers
+	ServerTrustedProxies string `json:"server_trusted_proxies" yaml:"server_trusted_proxies" mapstructure:"SERVER_TRUSTED_PROXIES"`
+
+	// Whether to serve a Swagger UI page rendering the OpenAPI document on /docs
+	ServerSwaggerUI bool `json:"server_swagger_ui" yaml:"server_swagger_ui" mapstructure:"SERVER_SWAGGER_UI"`
+
+	// Address for the gRPC server to listen on (if empty, the gRPC server is disabled)
+	ServerGRPCAddr string `json:"server_grpc_addr" yaml:"server_grpc_addr" mapstructure:"SERVER_GRPC_ADDR"`
+
+	// Address for the ICAP server to listen on (if empty, the ICAP server is disabled)
+	ServerICAPAddr string `json:"server_icap_addr" yaml:"server_icap_addr" mapstructure:"SERVER_ICAP_ADDR"`
+
+	// Maximum duration to wait for an ICAP client before closing its connection
+	ServerICAPIdleTimeout time.Duration `json:"server_icap_idle_timeout" yaml:"server_icap_idle_timeout" mapstructure:"SERVER_ICAP_IDLE_TIMEOUT"`
+
 	// Logger log level
 	// Available: "trace", "debug", "info", "warn", "error", "fatal", "panic"
 	// ref: https://pkg.go.dev/github.com/rs/zerolog@v1.26.1#pkg-variables
@@ -84,11 +204,212 @@ type App struct {
 	// Interval between keep-alive probes for an active connection to the Clamav server
 	ClamavKeepAlive time.Duration `json:"clamav_keepalive" yaml:"clamav_keepalive" mapstructure:"CLAMAV_KEEPALIVE"`
 
+	// Interval between two queries of the commands supported by the Clamav server
+	ClamavCapabilitiesRefresh time.Duration `json:"clamav_capabilities_refresh" yaml:"clamav_capabilities_refresh" mapstructure:"CLAMAV_CAPABILITIES_REFRESH"`
+
+	// Comma-separated list of "category=verdict" pairs deciding how the archive heuristics
+	// reported by clamd are reported (if empty, they are reported as infected)
+	ArchiveHeuristicsPolicy string `json:"archive_heuristics_policy" yaml:"archive_heuristics_policy" mapstructure:"ARCHIVE_HEURISTICS_POLICY"`
+
+	// Path of the YAML file of the verdict policies deciding whether the scanned files
+	// are allowed, warned about or blocked (if empty, the verdict policy is disabled)
+	PolicyFile string `json:"policy_file" yaml:"policy_file" mapstructure:"POLICY_FILE"`
+
 	// Optional API Key for authentication (if empty, authentication is disabled)
 	AuthAPIKey string `json:"auth_api_key" yaml:"auth_api_key" mapstructure:"AUTH_API_KEY"`
 
 	// Header name for API key authentication
 	AuthAPIKeyHeader string `json:"auth_api_key_header" yaml:"auth_api_key_header" mapstructure:"AUTH_API_KEY_HEADER"`
+
+	// Optional comma-separated list of "key-id:secret" pairs accepted for
+	// HMAC-SHA256 request signing (if empty, HMAC signing is disabled)
+	AuthHMACKeys string `json:"auth_hmac_keys" yaml:"auth_hmac_keys" mapstructure:"AUTH_HMAC_KEYS"`
+
+	// Maximum allowed difference between the timestamp of a signed request and the server clock
+	AuthHMACMaxClockSkew time.Duration `json:"auth_hmac_max_clock_skew" yaml:"auth_hmac_max_clock_skew" mapstructure:"AUTH_HMAC_MAX_CLOCK_SKEW"`
+
+	// Optional comma-separated list of per-route rate limits of the form
+	// "route=rate:burst[:max_concurrent]", applied to each client
+	// (if empty, rate limiting is disabled)
+	RateLimitRules string `json:"ratelimit_rules" yaml:"ratelimit_rules" mapstructure:"RATELIMIT_RULES"`
+
+	// Maximum number of concurrent scans, all clients included (if 0, unlimited)
+	AdmissionMaxInFlightScans int `json:"admission_max_inflight_scans" yaml:"admission_max_inflight_scans" mapstructure:"ADMISSION_MAX_INFLIGHT_SCANS"`
+
+	// Maximum number of scans waiting to be admitted (if 0, scans are rejected right away)
+	AdmissionMaxQueuedScans int `json:"admission_max_queued_scans" yaml:"admission_max_queued_scans" mapstructure:"ADMISSION_MAX_QUEUED_SCANS"`
+
+	// Maximum duration a scan waits to be admitted before being rejected (if 0, until the request is cancelled)
+	AdmissionQueueTimeout time.Duration `json:"admission_queue_timeout" yaml:"admission_queue_timeout" mapstructure:"ADMISSION_QUEUE_TIMEOUT"`
+
+	// Length of the clamd queue from which new scans are held back (if 0, the clamd queue is ignored)
+	AdmissionClamdMaxQueue int `json:"admission_clamd_max_queue" yaml:"admission_clamd_max_queue" mapstructure:"ADMISSION_CLAMD_MAX_QUEUE"`
+
+	// Number of idle clamd threads under which new scans are held back (if 0, idle threads are ignored)
+	AdmissionClamdMinIdleThreads int `json:"admission_clamd_min_idle_threads" yaml:"admission_clamd_min_idle_threads" mapstructure:"ADMISSION_CLAMD_MIN_IDLE_THREADS"`
+
+	// Interval between two polls of the clamd stats
+	AdmissionClamdPollInterval time.Duration `json:"admission_clamd_poll_interval" yaml:"admission_clamd_poll_interval" mapstructure:"ADMISSION_CLAMD_POLL_INTERVAL"`
+
+	// Destination of the audit log: "file" or "syslog" (if empty, the audit log is disabled)
+	AuditLogOutput string `json:"audit_log_output" yaml:"audit_log_output" mapstructure:"AUDIT_LOG_OUTPUT"`
+
+	// Path of the audit log file
+	AuditLogFile string `json:"audit_log_file" yaml:"audit_log_file" mapstructure:"AUDIT_LOG_FILE"`
+
+	// Size in bytes from which the audit log file is rotated (if 0, never rotated)
+	AuditLogMaxSize int64 `json:"audit_log_max_size" yaml:"audit_log_max_size" mapstructure:"AUDIT_LOG_MAX_SIZE"`
+
+	// Number of rotated audit log files to keep
+	AuditLogMaxBackups int `json:"audit_log_max_backups" yaml:"audit_log_max_backups" mapstructure:"AUDIT_LOG_MAX_BACKUPS"`
+
+	// Network of the syslog daemon: "tcp", "udp" or "unix" (if empty, the local syslog daemon)
+	AuditLogSyslogNetwork string `json:"audit_log_syslog_network" yaml:"audit_log_syslog_network" mapstructure:"AUDIT_LOG_SYSLOG_NETWORK"`
+
+	// Address of the syslog daemon
+	AuditLogSyslogAddr string `json:"audit_log_syslog_addr" yaml:"audit_log_syslog_addr" mapstructure:"AUDIT_LOG_SYSLOG_ADDR"`
+
+	// Directory where infected uploads are quarantined (if empty, quarantine is disabled)
+	QuarantineDir string `json:"quarantine_dir" yaml:"quarantine_dir" mapstructure:"QUARANTINE_DIR"`
+
+	// Hex-encoded 32 bytes key used to encrypt the quarantined files
+	QuarantineKey string `json:"quarantine_key" yaml:"quarantine_key" mapstructure:"QUARANTINE_KEY"`
+
+	// Duration after which quarantined files are purged (if 0, they are kept forever)
+	QuarantineRetention time.Duration `json:"quarantine_retention" yaml:"quarantine_retention" mapstructure:"QUARANTINE_RETENTION"`
+
+	// Password of the archives of quarantined files
+	QuarantineArchivePassword string `json:"quarantine_archive_password" yaml:"quarantine_archive_password" mapstructure:"QUARANTINE_ARCHIVE_PASSWORD"`
+
+	// host[:port] of the S3-compatible object storage to scan objects from (if empty, S3 scanning is disabled)
+	S3Endpoint string `json:"s3_endpoint" yaml:"s3_endpoint" mapstructure:"S3_ENDPOINT"`
+
+	// Access key of the object storage
+	S3AccessKey string `json:"s3_access_key" yaml:"s3_access_key" mapstructure:"S3_ACCESS_KEY"`
+
+	// Secret key of the object storage
+	S3SecretKey string `json:"s3_secret_key" yaml:"s3_secret_key" mapstructure:"S3_SECRET_KEY"`
+
+	// Region of the object storage
+	S3Region string `json:"s3_region" yaml:"s3_region" mapstructure:"S3_REGION"`
+
+	// Whether to connect to the object storage with HTTPS
+	S3UseSSL bool `json:"s3_use_ssl" yaml:"s3_use_ssl" mapstructure:"S3_USE_SSL"`
+
+	// Comma-separated list of the buckets objects can be scanned from (if empty, all buckets are allowed)
+	S3AllowedBuckets string `json:"s3_allowed_buckets" yaml:"s3_allowed_buckets" mapstructure:"S3_ALLOWED_BUCKETS"`
+
+	// Whether to write the verdicts back as object tags
+	S3TagVerdict bool `json:"s3_tag_verdict" yaml:"s3_tag_verdict" mapstructure:"S3_TAG_VERDICT"`
+
+	// Whether to enable the scan of remote content by URL
+	URLScanEnabled bool `json:"url_scan_enabled" yaml:"url_scan_enabled" mapstructure:"URL_SCAN_ENABLED"`
+
+	// Comma-separated list of the URL schemes allowed
+	URLScanAllowedSchemes string `json:"url_scan_allowed_schemes" yaml:"url_scan_allowed_schemes" mapstructure:"URL_SCAN_ALLOWED_SCHEMES"`
+
+	// Comma-separated list of the hosts allowed, "*.example.com" allowing the subdomains (if empty, all hosts are allowed)
+	URLScanAllowedHosts string `json:"url_scan_allowed_hosts" yaml:"url_scan_allowed_hosts" mapstructure:"URL_SCAN_ALLOWED_HOSTS"`
+
+	// Comma-separated list of IP addresses or CIDR ranges exempted from the blocking of internal addresses
+	URLScanAllowedNetworks string `json:"url_scan_allowed_networks" yaml:"url_scan_allowed_networks" mapstructure:"URL_SCAN_ALLOWED_NETWORKS"`
+
+	// Maximum size in bytes of the remote content
+	URLScanMaxSize int64 `json:"url_scan_max_size" yaml:"url_scan_max_size" mapstructure:"URL_SCAN_MAX_SIZE"`
+
+	// Maximum duration of the fetch of the remote content
+	URLScanTimeout time.Duration `json:"url_scan_timeout" yaml:"url_scan_timeout" mapstructure:"URL_SCAN_TIMEOUT"`
+
+	// Maximum number of redirects followed
+	URLScanMaxRedirects int `json:"url_scan_max_redirects" yaml:"url_scan_max_redirects" mapstructure:"URL_SCAN_MAX_REDIRECTS"`
+
+	// Whether to detect the type of the scanned files from their magic bytes
+	FileTypeDetectionEnabled bool `json:"filetype_detection_enabled" yaml:"filetype_detection_enabled" mapstructure:"FILETYPE_DETECTION_ENABLED"`
+
+	// Comma-separated list of the only file types allowed, as categories or MIME type patterns (if empty, all types are allowed)
+	FileTypeAllow string `json:"filetype_allow" yaml:"filetype_allow" mapstructure:"FILETYPE_ALLOW"`
+
+	// Comma-separated list of the file types rejected before their scan, as categories or MIME type patterns
+	FileTypeDeny string `json:"filetype_deny" yaml:"filetype_deny" mapstructure:"FILETYPE_DENY"`
+
+	// Number of bytes peeked at to detect the type of the files
+	FileTypePeekSize int `json:"filetype_peek_size" yaml:"filetype_peek_size" mapstructure:"FILETYPE_PEEK_SIZE"`
+
+	// Comma-separated list of the files of hashes of known good files, which aren't scanned
+	ReputationAllowFiles string `json:"reputation_allow_files" yaml:"reputation_allow_files" mapstructure:"REPUTATION_ALLOW_FILES"`
+
+	// Comma-separated list of the files of hashes of known bad files, reported infected without being scanned
+	ReputationDenyFiles string `json:"reputation_deny_files" yaml:"reputation_deny_files" mapstructure:"REPUTATION_DENY_FILES"`
+
+	// Interval between two checks of the hash list files for changes
+	ReputationReloadInterval time.Duration `json:"reputation_reload_interval" yaml:"reputation_reload_interval" mapstructure:"REPUTATION_RELOAD_INTERVAL"`
+
+	// Database directory of clamd where the custom signatures are written (if empty, custom signatures are disabled)
+	SignaturesDBDir string `json:"signatures_db_dir" yaml:"signatures_db_dir" mapstructure:"SIGNATURES_DB_DIR"`
+
+	// Name of the database files of the custom signatures, without extension
+	SignaturesDBName string `json:"signatures_db_name" yaml:"signatures_db_name" mapstructure:"SIGNATURES_DB_NAME"`
+
+	// Database directory of clamd where the custom rule files are written (if empty, custom rules are disabled)
+	RulesDir string `json:"rules_dir" yaml:"rules_dir" mapstructure:"RULES_DIR"`
+
+	// Command validating the rule files before they are written, "{}" being replaced by the path of the file
+	RulesValidator string `json:"rules_validator" yaml:"rules_validator" mapstructure:"RULES_VALIDATOR"`
+
+	// Duration clamd is pinged for after a reload, before a change of the rule files is kept
+	RulesReloadCheck time.Duration `json:"rules_reload_check" yaml:"rules_reload_check" mapstructure:"RULES_RELOAD_CHECK"`
+
+	// Maximum duration of an update of the virus definitions by freshclam
+	FreshClamTimeout time.Duration `json:"freshclam_timeout" yaml:"freshclam_timeout" mapstructure:"FRESHCLAM_TIMEOUT"`
+
+	// Number of finished updates of the virus definitions kept in the history
+	FreshClamHistorySize int `json:"freshclam_history_size" yaml:"freshclam_history_size" mapstructure:"FRESHCLAM_HISTORY_SIZE"`
+
+	// Path of the freshclam binary
+	FreshClamBinary string `json:"freshclam_binary" yaml:"freshclam_binary" mapstructure:"FRESHCLAM_BINARY"`
+
+	// Configuration file of freshclam (if empty, the one freshclam was built with)
+	FreshClamConfigFile string `json:"freshclam_config_file" yaml:"freshclam_config_file" mapstructure:"FRESHCLAM_CONFIG_FILE"`
+
+	// Database directory of freshclam, overriding the DatabaseDirectory of its configuration file
+	FreshClamDataDir string `json:"freshclam_datadir" yaml:"freshclam_datadir" mapstructure:"FRESHCLAM_DATADIR"`
+
+	// Space-separated extra arguments of freshclam
+	FreshClamExtraArgs string `json:"freshclam_extra_args" yaml:"freshclam_extra_args" mapstructure:"FRESHCLAM_EXTRA_ARGS"`
+
+	// Comma-separated list of "KEY=value" variables added to the environment of freshclam
+	FreshClamEnv string `json:"freshclam_env" yaml:"freshclam_env" mapstructure:"FRESHCLAM_ENV"`
+
+	// Template of the configuration file of freshclam, rendered with the settings managed
+	// through the API into FRESHCLAM_CONFIG_FILE (if empty, the settings aren't managed)
+	FreshClamConfigTemplate string `json:"freshclam_config_template" yaml:"freshclam_config_template" mapstructure:"FRESHCLAM_CONFIG_TEMPLATE"`
+
+	// Interval between two scheduled updates of the virus definitions (if zero, scheduled updates are disabled)
+	FreshClamScheduleInterval time.Duration `json:"freshclam_schedule_interval" yaml:"freshclam_schedule_interval" mapstructure:"FRESHCLAM_SCHEDULE_INTERVAL"`
+
+	// Maximum random delay added to the interval between two scheduled updates
+	FreshClamScheduleJitter time.Duration `json:"freshclam_schedule_jitter" yaml:"freshclam_schedule_jitter" mapstructure:"FRESHCLAM_SCHEDULE_JITTER"`
+
+	// Delay before retrying a failed scheduled update, doubled after each failure
+	FreshClamScheduleBackoff time.Duration `json:"freshclam_schedule_backoff" yaml:"freshclam_schedule_backoff" mapstructure:"FRESHCLAM_SCHEDULE_BACKOFF"`
+
+	// Maximum delay before retrying a failed scheduled update
+	FreshClamScheduleMaxBackoff time.Duration `json:"freshclam_schedule_max_backoff" yaml:"freshclam_schedule_max_backoff" mapstructure:"FRESHCLAM_SCHEDULE_MAX_BACKOFF"`
+
+	// Duration clamd is given to report the new version of the databases after a reload
+	FreshClamReloadConfirm time.Duration `json:"freshclam_reload_confirm" yaml:"freshclam_reload_confirm" mapstructure:"FRESHCLAM_RELOAD_CONFIRM"`
+
+	// Database directory of clamd, whose databases are inspected (if empty, they aren't)
+	DatabasesDir string `json:"databases_dir" yaml:"databases_dir" mapstructure:"DATABASES_DIR"`
+
+	// Age above which the databases loaded by clamd are reported as stale
+	DatabasesMaxAge time.Duration `json:"databases_max_age" yaml:"databases_max_age" mapstructure:"DATABASES_MAX_AGE"`
+
+	// Directory of the .cvd and .cdiff files served to freshclam as a private mirror (if empty, they aren't)
+	MirrorDir string `json:"mirror_dir" yaml:"mirror_dir" mapstructure:"MIRROR_DIR"`
+
+	// Maximum size of the files imported into the mirror, in place of SERVER_MAX_REQUEST_SIZE
+	MirrorMaxUploadSize int64 `json:"mirror_max_upload_size" yaml:"mirror_max_upload_size" mapstructure:"MIRROR_MAX_UPLOAD_SIZE"`
 }
 
 // New will retrieve the runtime configuration from either
@@ -144,10 +465,246 @@ func New() (*App, error) {
 
 // validateConfig will make sure the provided configuration is valid
 // by looking if the values are present when they are expected to be present
-func validateConfig(_ *App) error {
+func validateConfig(c *App) error {
+	if c.ClamavCapabilitiesRefresh <= 0 {
+		return errors.New("invalid CLAMAV_CAPABILITIES_REFRESH: must be positive")
+	}
+	if _, err := ParseHMACKeys(c.AuthHMACKeys); err != nil {
+		return err
+	}
+	if c.AuthHMACMaxClockSkew <= 0 {
+		return errors.New("invalid AUTH_HMAC_MAX_CLOCK_SKEW: must be positive")
+	}
+	if _, err := ParseTrustedProxies(c.ServerTrustedProxies); err != nil {
+		return err
+	}
+	if _, err := heuristics.ParsePolicy(c.ArchiveHeuristicsPolicy); err != nil {
+		return fmt.Errorf("invalid ARCHIVE_HEURISTICS_POLICY: %w", err)
+	}
+	if _, err := ratelimit.ParseRules(c.RateLimitRules); err != nil {
+		return fmt.Errorf("invalid RATELIMIT_RULES: %w", err)
+	}
+	if c.AdmissionMaxInFlightScans < 0 || c.AdmissionMaxQueuedScans < 0 ||
+		c.AdmissionClamdMaxQueue < 0 || c.AdmissionClamdMinIdleThreads < 0 {
+		return errors.New("invalid admission control thresholds: must not be negative")
+	}
+	if c.AdmissionQueueTimeout < 0 {
+		return errors.New("invalid ADMISSION_QUEUE_TIMEOUT: must be positive or zero")
+	}
+	if c.AdmissionClamdPollInterval <= 0 {
+		return errors.New("invalid ADMISSION_CLAMD_POLL_INTERVAL: must be positive")
+	}
+	switch c.AuditLogOutput {
+	case "", AuditLogOutputSyslog:
+	case AuditLogOutputFile:
+		if c.AuditLogFile == "" {
+			return errors.New("invalid AUDIT_LOG_FILE: must not be empty")
+		}
+		if c.AuditLogMaxSize < 0 || c.AuditLogMaxBackups < 0 {
+			return errors.New("invalid audit log rotation settings: must not be negative")
+		}
+	default:
+		return fmt.Errorf("invalid AUDIT_LOG_OUTPUT %q: must be %q or %q", c.AuditLogOutput, AuditLogOutputFile, AuditLogOutputSyslog)
+	}
+	if c.QuarantineDir != "" {
+		if _, err := ParseQuarantineKey(c.QuarantineKey); err != nil {
+			return err
+		}
+		if c.QuarantineRetention < 0 {
+			return errors.New("invalid QUARANTINE_RETENTION: must not be negative")
+		}
+		if c.QuarantineArchivePassword == "" {
+			return errors.New("invalid QUARANTINE_ARCHIVE_PASSWORD: must not be empty")
+		}
+	}
+	if strings.Contains(c.S3Endpoint, "/") {
+		return errors.New("invalid S3_ENDPOINT: must be host[:port], use S3_USE_SSL to choose the scheme")
+	}
+	if c.URLScanEnabled {
+		if _, err := ParseURLScanAllowedNetworks(c.URLScanAllowedNetworks); err != nil {
+			return err
+		}
+		if len(ParseList(c.URLScanAllowedSchemes)) == 0 {
+			return errors.New("invalid URL_SCAN_ALLOWED_SCHEMES: must not be empty")
+		}
+		if c.URLScanMaxSize <= 0 {
+			return errors.New("invalid URL_SCAN_MAX_SIZE: must be positive")
+		}
+		if c.URLScanTimeout <= 0 {
+			return errors.New("invalid URL_SCAN_TIMEOUT: must be positive")
+		}
+		if c.URLScanMaxRedirects < 0 {
+			return errors.New("invalid URL_SCAN_MAX_REDIRECTS: must not be negative")
+		}
+	}
+	if c.FileTypeDetectionEnabled {
+		if c.FileTypePeekSize <= 0 {
+			return errors.New("invalid FILETYPE_PEEK_SIZE: must be positive")
+		}
+		if _, err := NewFileTypeDetector(c); err != nil {
+			return fmt.Errorf("invalid FILETYPE_ALLOW or FILETYPE_DENY: %w", err)
+		}
+	} else if c.FileTypeAllow != "" || c.FileTypeDeny != "" {
+		return errors.New("invalid FILETYPE_ALLOW or FILETYPE_DENY: FILETYPE_DETECTION_ENABLED must be true")
+	}
+	if c.ReputationAllowFiles != "" || c.ReputationDenyFiles != "" {
+		if c.ReputationReloadInterval <= 0 {
+			return errors.New("invalid REPUTATION_RELOAD_INTERVAL: must be positive")
+		}
+	}
+	if c.RulesDir != "" && c.RulesReloadCheck <= 0 {
+		return errors.New("invalid RULES_RELOAD_CHECK: must be positive")
+	}
+	if c.FreshClamTimeout <= 0 {
+		return errors.New("invalid FRESHCLAM_TIMEOUT: must be positive")
+	}
+	if c.FreshClamHistorySize <= 0 {
+		return errors.New("invalid FRESHCLAM_HISTORY_SIZE: must be positive")
+	}
+	if c.FreshClamBinary == "" {
+		return errors.New("invalid FRESHCLAM_BINARY: must not be empty")
+	}
+	if _, err := ParseEnv(c.FreshClamEnv); err != nil {
+		return fmt.Errorf("invalid FRESHCLAM_ENV: %w", err)
+	}
+	if c.FreshClamConfigTemplate != "" && c.FreshClamConfigFile == "" {
+		return errors.New("invalid FRESHCLAM_CONFIG_FILE: must be set when FRESHCLAM_CONFIG_TEMPLATE is set")
+	}
+	if c.FreshClamScheduleInterval < 0 {
+		return errors.New("invalid FRESHCLAM_SCHEDULE_INTERVAL: must be positive or zero")
+	}
+	if c.FreshClamScheduleInterval > 0 {
+		if c.FreshClamScheduleJitter < 0 {
+			return errors.New("invalid FRESHCLAM_SCHEDULE_JITTER: must be positive or zero")
+		}
+		if c.FreshClamScheduleBackoff <= 0 {
+			return errors.New("invalid FRESHCLAM_SCHEDULE_BACKOFF: must be positive")
+		}
+		if c.FreshClamScheduleMaxBackoff < c.FreshClamScheduleBackoff {
+			return errors.New("invalid FRESHCLAM_SCHEDULE_MAX_BACKOFF: must be greater than or equal to FRESHCLAM_SCHEDULE_BACKOFF")
+		}
+	}
+	if c.FreshClamReloadConfirm <= 0 {
+		return errors.New("invalid FRESHCLAM_RELOAD_CONFIRM: must be positive")
+	}
+	if c.DatabasesMaxAge <= 0 {
+		return errors.New("invalid DATABASES_MAX_AGE: must be positive")
+	}
+	if c.MirrorDir != "" && c.MirrorMaxUploadSize <= 0 {
+		return errors.New("invalid MIRROR_MAX_UPLOAD_SIZE: must be positive")
+	}
+	if c.SignaturesDBDir != "" && !signatures.ValidName(c.SignaturesDBName) {
+		return fmt.Errorf("invalid SIGNATURES_DB_NAME %q: must be made of letters, digits, '.', '-' and '_'", c.SignaturesDBName)
+	}
 	return nil
 }
 
+// NewFileTypeDetector returns the detector of file types configured by c.
+func NewFileTypeDetector(c *App) (*filetype.Detector, error) {
+	return filetype.New(filetype.Config{
+		Allow:    ParseList(c.FileTypeAllow),
+		Deny:     ParseList(c.FileTypeDeny),
+		PeekSize: c.FileTypePeekSize,
+	})
+}
+
+// ParseS3AllowedBuckets parses a comma-separated list of bucket names.
+func ParseS3AllowedBuckets(s string) []string {
+	return ParseList(s)
+}
+
+// ParseList parses a comma-separated list, skipping the empty entries.
+func ParseList(s string) []string {
+	var entries []string
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// ParseEnv parses a comma-separated list of "KEY=value" environment variables.
+func ParseEnv(s string) ([]string, error) {
+	env := ParseList(s)
+	for _, v := range env {
+		if key, _, ok := strings.Cut(v, "="); !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("%q isn't a KEY=value variable", v)
+		}
+	}
+	return env, nil
+}
+
+// ParseQuarantineKey decodes the hex-encoded quarantine encryption key.
+func ParseQuarantineKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != quarantine.KeySize {
+		// Don't echo the key back
+		return nil, fmt.Errorf("invalid QUARANTINE_KEY: must be %d hex-encoded bytes", quarantine.KeySize)
+	}
+	return key, nil
+}
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses
+// or CIDR ranges.
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	return parsePrefixes("SERVER_TRUSTED_PROXIES", s)
+}
+
+// ParseURLScanAllowedNetworks parses a comma-separated list of IP addresses
+// or CIDR ranges.
+func ParseURLScanAllowedNetworks(s string) ([]netip.Prefix, error) {
+	return parsePrefixes("URL_SCAN_ALLOWED_NETWORKS", s)
+}
+
+// parsePrefixes parses a comma-separated list of IP addresses or CIDR
+// ranges of the name setting.
+func parsePrefixes(name, s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			p, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s entry %q: %w", name, entry, err)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q: %w", name, entry, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// ParseHMACKeys parses a comma-separated list of "key-id:secret" pairs
+// into a map of secrets indexed by key identifier.
+func ParseHMACKeys(s string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for i, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || secret == "" {
+			// Don't echo the entry back, it may contain a secret
+			return nil, fmt.Errorf("invalid AUTH_HMAC_KEYS entry #%d: expected \"key-id:secret\"", i+1)
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("invalid AUTH_HMAC_KEYS: duplicate key id %q", id)
+		}
+		keys[id] = secret
+	}
+	return keys, nil
+}
+
 func readConfigFromEnvVars(c App) {
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	bindEnvs(c)
@@ -179,6 +736,11 @@ func (config *App) setDefaults() {
 	config.ServerReadHeaderTimeout = defaultServerReadHeaderTimeout
 	config.ServerWriteTimeout = defaultServerWriteTimeout
 	config.ServerMaxRequestSize = defaultServerMaxRequestSize
+	config.ServerTrustedProxies = defaultServerTrustedProxies
+	config.ServerSwaggerUI = defaultServerSwaggerUI
+	config.ServerGRPCAddr = defaultServerGRPCAddr
+	config.ServerICAPAddr = defaultServerICAPAddr
+	config.ServerICAPIdleTimeout = defaultServerICAPIdleTimeout
 
 	config.LoggerLogLevel = defaultLoggerLogLevel
 	config.LoggerDurationFieldUnit = defaultLoggerDurationFieldUnit
@@ -188,7 +750,87 @@ func (config *App) setDefaults() {
 	config.ClamavNetwork = defaultClamavNetwork
 	config.ClamavTimeout = defaultClamavTimeout
 	config.ClamavKeepAlive = defaultClamavKeepAlive
+	config.ClamavCapabilitiesRefresh = defaultClamavCapabilitiesRefresh
+
+	config.ArchiveHeuristicsPolicy = defaultArchiveHeuristicsPolicy
+	config.PolicyFile = defaultPolicyFile
 
 	config.AuthAPIKey = defaultAuthAPIKey
 	config.AuthAPIKeyHeader = defaultAuthAPIKeyHeader
+
+	config.AuthHMACKeys = defaultAuthHMACKeys
+	config.AuthHMACMaxClockSkew = defaultAuthHMACMaxClockSkew
+
+	config.RateLimitRules = defaultRateLimitRules
+
+	config.AdmissionMaxInFlightScans = defaultAdmissionMaxInFlightScans
+	config.AdmissionMaxQueuedScans = defaultAdmissionMaxQueuedScans
+	config.AdmissionQueueTimeout = defaultAdmissionQueueTimeout
+	config.AdmissionClamdMaxQueue = defaultAdmissionClamdMaxQueue
+	config.AdmissionClamdMinIdleThreads = defaultAdmissionClamdMinIdleThreads
+	config.AdmissionClamdPollInterval = defaultAdmissionClamdPollInterval
+
+	config.AuditLogOutput = defaultAuditLogOutput
+	config.AuditLogFile = defaultAuditLogFile
+	config.AuditLogMaxSize = defaultAuditLogMaxSize
+	config.AuditLogMaxBackups = defaultAuditLogMaxBackups
+	config.AuditLogSyslogNetwork = defaultAuditLogSyslogNetwork
+	config.AuditLogSyslogAddr = defaultAuditLogSyslogAddr
+
+	config.QuarantineDir = defaultQuarantineDir
+	config.QuarantineKey = defaultQuarantineKey
+	config.QuarantineRetention = defaultQuarantineRetention
+	config.QuarantineArchivePassword = defaultQuarantineArchivePassword
+
+	config.S3Endpoint = defaultS3Endpoint
+	config.S3AccessKey = defaultS3AccessKey
+	config.S3SecretKey = defaultS3SecretKey
+	config.S3Region = defaultS3Region
+	config.S3UseSSL = defaultS3UseSSL
+	config.S3AllowedBuckets = defaultS3AllowedBuckets
+	config.S3TagVerdict = defaultS3TagVerdict
+
+	config.URLScanEnabled = defaultURLScanEnabled
+	config.URLScanAllowedSchemes = defaultURLScanAllowedSchemes
+	config.URLScanAllowedHosts = defaultURLScanAllowedHosts
+	config.URLScanAllowedNetworks = defaultURLScanAllowedNetworks
+	config.URLScanMaxSize = defaultURLScanMaxSize
+	config.URLScanTimeout = defaultURLScanTimeout
+	config.URLScanMaxRedirects = defaultURLScanMaxRedirects
+
+	config.FileTypeDetectionEnabled = defaultFileTypeDetectionEnabled
+	config.FileTypeAllow = defaultFileTypeAllow
+	config.FileTypeDeny = defaultFileTypeDeny
+	config.FileTypePeekSize = defaultFileTypePeekSize
+
+	config.ReputationAllowFiles = defaultReputationAllowFiles
+	config.ReputationDenyFiles = defaultReputationDenyFiles
+	config.ReputationReloadInterval = defaultReputationReloadInterval
+
+	config.SignaturesDBDir = defaultSignaturesDBDir
+	config.SignaturesDBName = defaultSignaturesDBName
+
+	config.RulesDir = defaultRulesDir
+	config.RulesValidator = defaultRulesValidator
+	config.RulesReloadCheck = defaultRulesReloadCheck
+
+	config.FreshClamTimeout = defaultFreshClamTimeout
+	config.FreshClamHistorySize = defaultFreshClamHistorySize
+	config.FreshClamBinary = defaultFreshClamBinary
+	config.FreshClamConfigFile = defaultFreshClamConfigFile
+	config.FreshClamDataDir = defaultFreshClamDataDir
+	config.FreshClamExtraArgs = defaultFreshClamExtraArgs
+	config.FreshClamEnv = defaultFreshClamEnv
+	config.FreshClamConfigTemplate = defaultFreshClamConfigTemplate
+	config.FreshClamScheduleInterval = defaultFreshClamScheduleInterval
+	config.FreshClamScheduleJitter = defaultFreshClamScheduleJitter
+	config.FreshClamScheduleBackoff = defaultFreshClamScheduleBackoff
+	config.FreshClamScheduleMaxBackoff = defaultFreshClamScheduleMaxBackoff
+	config.FreshClamReloadConfirm = defaultFreshClamReloadConfirm
+
+	config.DatabasesDir = defaultDatabasesDir
+	config.DatabasesMaxAge = defaultDatabasesMaxAge
+
+	config.MirrorDir = defaultMirrorDir
+	config.MirrorMaxUploadSize = defaultMirrorMaxUploadSize
 }
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"net/netip"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -16,6 +19,11 @@ func TestAppSetDefaults(t *testing.T) {
 	assert.Equal(t, defaultServerReadHeaderTimeout, app.ServerReadHeaderTimeout)
 	assert.Equal(t, defaultServerWriteTimeout, app.ServerWriteTimeout)
 	assert.Equal(t, defaultServerMaxRequestSize, app.ServerMaxRequestSize)
+	assert.Equal(t, defaultServerTrustedProxies, app.ServerTrustedProxies)
+	assert.Equal(t, defaultServerSwaggerUI, app.ServerSwaggerUI)
+	assert.Equal(t, defaultServerGRPCAddr, app.ServerGRPCAddr)
+	assert.Equal(t, defaultServerICAPAddr, app.ServerICAPAddr)
+	assert.Equal(t, defaultServerICAPIdleTimeout, app.ServerICAPIdleTimeout)
 
 	assert.Equal(t, defaultLoggerLogLevel, app.LoggerLogLevel)
 	assert.Equal(t, defaultLoggerDurationFieldUnit, app.LoggerDurationFieldUnit)
@@ -25,4 +33,552 @@ func TestAppSetDefaults(t *testing.T) {
 	assert.Equal(t, defaultClamavNetwork, app.ClamavNetwork)
 	assert.Equal(t, defaultClamavTimeout, app.ClamavTimeout)
 	assert.Equal(t, defaultClamavKeepAlive, app.ClamavKeepAlive)
+	assert.Equal(t, defaultClamavCapabilitiesRefresh, app.ClamavCapabilitiesRefresh)
+
+	assert.Equal(t, defaultArchiveHeuristicsPolicy, app.ArchiveHeuristicsPolicy)
+	assert.Equal(t, defaultPolicyFile, app.PolicyFile)
+
+	assert.Equal(t, defaultAuthHMACKeys, app.AuthHMACKeys)
+	assert.Equal(t, defaultAuthHMACMaxClockSkew, app.AuthHMACMaxClockSkew)
+
+	assert.Equal(t, defaultRateLimitRules, app.RateLimitRules)
+
+	assert.Equal(t, defaultAdmissionMaxInFlightScans, app.AdmissionMaxInFlightScans)
+	assert.Equal(t, defaultAdmissionMaxQueuedScans, app.AdmissionMaxQueuedScans)
+	assert.Equal(t, defaultAdmissionQueueTimeout, app.AdmissionQueueTimeout)
+	assert.Equal(t, defaultAdmissionClamdMaxQueue, app.AdmissionClamdMaxQueue)
+	assert.Equal(t, defaultAdmissionClamdMinIdleThreads, app.AdmissionClamdMinIdleThreads)
+	assert.Equal(t, defaultAdmissionClamdPollInterval, app.AdmissionClamdPollInterval)
+
+	assert.Equal(t, defaultAuditLogOutput, app.AuditLogOutput)
+	assert.Equal(t, defaultAuditLogFile, app.AuditLogFile)
+	assert.Equal(t, defaultAuditLogMaxSize, app.AuditLogMaxSize)
+	assert.Equal(t, defaultAuditLogMaxBackups, app.AuditLogMaxBackups)
+	assert.Equal(t, defaultAuditLogSyslogNetwork, app.AuditLogSyslogNetwork)
+	assert.Equal(t, defaultAuditLogSyslogAddr, app.AuditLogSyslogAddr)
+
+	assert.Equal(t, defaultQuarantineDir, app.QuarantineDir)
+	assert.Equal(t, defaultQuarantineKey, app.QuarantineKey)
+	assert.Equal(t, defaultQuarantineRetention, app.QuarantineRetention)
+	assert.Equal(t, defaultQuarantineArchivePassword, app.QuarantineArchivePassword)
+
+	assert.Equal(t, defaultS3Endpoint, app.S3Endpoint)
+	assert.Equal(t, defaultS3AccessKey, app.S3AccessKey)
+	assert.Equal(t, defaultS3SecretKey, app.S3SecretKey)
+	assert.Equal(t, defaultS3Region, app.S3Region)
+	assert.Equal(t, defaultS3UseSSL, app.S3UseSSL)
+	assert.Equal(t, defaultS3AllowedBuckets, app.S3AllowedBuckets)
+	assert.Equal(t, defaultS3TagVerdict, app.S3TagVerdict)
+
+	assert.Equal(t, defaultURLScanEnabled, app.URLScanEnabled)
+	assert.Equal(t, defaultURLScanAllowedSchemes, app.URLScanAllowedSchemes)
+	assert.Equal(t, defaultURLScanAllowedHosts, app.URLScanAllowedHosts)
+	assert.Equal(t, defaultURLScanAllowedNetworks, app.URLScanAllowedNetworks)
+	assert.Equal(t, defaultURLScanMaxSize, app.URLScanMaxSize)
+	assert.Equal(t, defaultURLScanTimeout, app.URLScanTimeout)
+	assert.Equal(t, defaultURLScanMaxRedirects, app.URLScanMaxRedirects)
+	assert.Equal(t, defaultFileTypeDetectionEnabled, app.FileTypeDetectionEnabled)
+	assert.Equal(t, defaultFileTypeAllow, app.FileTypeAllow)
+	assert.Equal(t, defaultFileTypeDeny, app.FileTypeDeny)
+	assert.Equal(t, defaultFileTypePeekSize, app.FileTypePeekSize)
+	assert.Equal(t, defaultReputationAllowFiles, app.ReputationAllowFiles)
+	assert.Equal(t, defaultReputationDenyFiles, app.ReputationDenyFiles)
+	assert.Equal(t, defaultReputationReloadInterval, app.ReputationReloadInterval)
+	assert.Equal(t, defaultSignaturesDBDir, app.SignaturesDBDir)
+	assert.Equal(t, defaultSignaturesDBName, app.SignaturesDBName)
+	assert.Equal(t, defaultRulesDir, app.RulesDir)
+	assert.Equal(t, defaultRulesValidator, app.RulesValidator)
+	assert.Equal(t, defaultRulesReloadCheck, app.RulesReloadCheck)
+	assert.Equal(t, defaultFreshClamTimeout, app.FreshClamTimeout)
+	assert.Equal(t, defaultFreshClamHistorySize, app.FreshClamHistorySize)
+	assert.Equal(t, defaultFreshClamBinary, app.FreshClamBinary)
+	assert.Equal(t, defaultFreshClamConfigFile, app.FreshClamConfigFile)
+	assert.Equal(t, defaultFreshClamDataDir, app.FreshClamDataDir)
+	assert.Equal(t, defaultFreshClamExtraArgs, app.FreshClamExtraArgs)
+	assert.Equal(t, defaultFreshClamEnv, app.FreshClamEnv)
+	assert.Equal(t, defaultFreshClamConfigTemplate, app.FreshClamConfigTemplate)
+	assert.Equal(t, defaultFreshClamScheduleInterval, app.FreshClamScheduleInterval)
+	assert.Equal(t, defaultFreshClamScheduleJitter, app.FreshClamScheduleJitter)
+	assert.Equal(t, defaultFreshClamScheduleBackoff, app.FreshClamScheduleBackoff)
+	assert.Equal(t, defaultFreshClamScheduleMaxBackoff, app.FreshClamScheduleMaxBackoff)
+	assert.Equal(t, defaultFreshClamReloadConfirm, app.FreshClamReloadConfirm)
+	assert.Equal(t, defaultDatabasesDir, app.DatabasesDir)
+	assert.Equal(t, defaultDatabasesMaxAge, app.DatabasesMaxAge)
+	assert.Equal(t, defaultMirrorDir, app.MirrorDir)
+	assert.Equal(t, defaultMirrorMaxUploadSize, app.MirrorMaxUploadSize)
+}
+
+func TestValidateConfigAuditLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *App)
+		wantErr bool
+	}{
+		{name: "disabled", mutate: func(_ *App) {}},
+		{name: "file", mutate: func(c *App) { c.AuditLogOutput = AuditLogOutputFile }},
+		{name: "syslog", mutate: func(c *App) { c.AuditLogOutput = AuditLogOutputSyslog }},
+		{name: "unknown output", mutate: func(c *App) { c.AuditLogOutput = "kafka" }, wantErr: true},
+		{
+			name:    "empty file",
+			mutate:  func(c *App) { c.AuditLogOutput = AuditLogOutputFile; c.AuditLogFile = "" },
+			wantErr: true,
+		},
+		{
+			name:    "negative max size",
+			mutate:  func(c *App) { c.AuditLogOutput = AuditLogOutputFile; c.AuditLogMaxSize = -1 },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := App{}
+			c.setDefaults()
+			tt.mutate(&c)
+
+			err := validateConfig(&c)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseHMACKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "empty string",
+			s:    "",
+			want: map[string]string{},
+		},
+		{
+			name: "single key",
+			s:    "client-a:secret",
+			want: map[string]string{"client-a": "secret"},
+		},
+		{
+			name: "multiple keys with spaces",
+			s:    "client-a:secret-a, client-b:secret:b ,",
+			want: map[string]string{"client-a": "secret-a", "client-b": "secret:b"},
+		},
+		{
+			name:    "missing secret",
+			s:       "client-a:",
+			wantErr: true,
+		},
+		{
+			name:    "missing separator",
+			s:       "client-a",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate key id",
+			s:       "client-a:x,client-a:y",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHMACKeys(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []netip.Prefix
+		wantErr bool
+	}{
+		{
+			name: "empty string",
+			s:    "",
+			want: nil,
+		},
+		{
+			name: "addresses and ranges",
+			s:    "10.0.0.0/8, 192.0.2.10,2001:db8::/32",
+			want: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("192.0.2.10/32"),
+				netip.MustParsePrefix("2001:db8::/32"),
+			},
+		},
+		{
+			name: "range is masked",
+			s:    "10.1.2.3/8",
+			want: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		},
+		{
+			name:    "invalid address",
+			s:       "10.0.0.256",
+			wantErr: true,
+		},
+		{
+			name:    "invalid range",
+			s:       "10.0.0.0/33",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTrustedProxies(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseQuarantineKey(t *testing.T) {
+	key := strings.Repeat("ab", 32)
+
+	got, err := ParseQuarantineKey(key)
+	assert.NoError(t, err)
+	assert.Len(t, got, 32)
+
+	for _, s := range []string{"", "abcd", strings.Repeat("zz", 32), key + "ab"} {
+		_, err := ParseQuarantineKey(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseS3AllowedBuckets(t *testing.T) {
+	assert.Nil(t, ParseS3AllowedBuckets(""))
+	assert.Equal(t, []string{"uploads", "archives"}, ParseS3AllowedBuckets(" uploads, ,archives "))
+}
+
+func TestValidateConfigFileType(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *App)
+		wantErr bool
+	}{
+		{name: "disabled", mutate: func(c *App) { c.FileTypePeekSize = 0 }},
+		{
+			name: "enabled",
+			mutate: func(c *App) {
+				c.FileTypeDetectionEnabled = true
+				c.FileTypeDeny = "executable, application/*.macroEnabled.*"
+			},
+		},
+		{
+			name:    "lists without detection",
+			mutate:  func(c *App) { c.FileTypeDeny = "executable" },
+			wantErr: true,
+		},
+		{
+			name:    "unknown category",
+			mutate:  func(c *App) { c.FileTypeDetectionEnabled = true; c.FileTypeAllow = "pictures" },
+			wantErr: true,
+		},
+		{
+			name:    "zero peek size",
+			mutate:  func(c *App) { c.FileTypeDetectionEnabled = true; c.FileTypePeekSize = 0 },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := App{}
+			c.setDefaults()
+			tt.mutate(&c)
+
+			err := validateConfig(&c)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfigReputation(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *App)
+		wantErr bool
+	}{
+		{name: "disabled", mutate: func(c *App) { c.ReputationReloadInterval = 0 }},
+		{
+			name:   "enabled",
+			mutate: func(c *App) { c.ReputationDenyFiles = "/etc/clamav-api/deny.txt" },
+		},
+		{
+			name: "zero reload interval",
+			mutate: func(c *App) {
+				c.ReputationAllowFiles = "/etc/clamav-api/allow.txt"
+				c.ReputationReloadInterval = 0
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := App{}
+			c.setDefaults()
+			tt.mutate(&c)
+
+			err := validateConfig(&c)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfigFreshClam(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *App)
+		wantErr bool
+	}{
+		{name: "defaults", mutate: func(c *App) {}},
+		{name: "zero timeout", mutate: func(c *App) { c.FreshClamTimeout = 0 }, wantErr: true},
+		{name: "zero history size", mutate: func(c *App) { c.FreshClamHistorySize = 0 }, wantErr: true},
+		{name: "empty binary", mutate: func(c *App) { c.FreshClamBinary = "" }, wantErr: true},
+		{name: "env", mutate: func(c *App) { c.FreshClamEnv = "HTTPS_PROXY=http://proxy:3128, TZ=UTC" }},
+		{name: "invalid env", mutate: func(c *App) { c.FreshClamEnv = "HTTPS_PROXY" }, wantErr: true},
+		{name: "env without key", mutate: func(c *App) { c.FreshClamEnv = "=value" }, wantErr: true},
+		{
+			name: "config template",
+			mutate: func(c *App) {
+				c.FreshClamConfigTemplate = "config/freshclam.conf"
+				c.FreshClamConfigFile = "/tmp/freshclam.conf"
+			},
+		},
+		{name: "config template without config file", mutate: func(c *App) { c.FreshClamConfigTemplate = "config/freshclam.conf" }, wantErr: true},
+		{name: "schedule enabled", mutate: func(c *App) { c.FreshClamScheduleInterval = 2 * time.Hour }},
+		{name: "negative schedule interval", mutate: func(c *App) { c.FreshClamScheduleInterval = -time.Hour }, wantErr: true},
+		{
+			name:    "negative jitter",
+			mutate:  func(c *App) { c.FreshClamScheduleInterval = 2 * time.Hour; c.FreshClamScheduleJitter = -time.Minute },
+			wantErr: true,
+		},
+		{
+			name:    "zero backoff",
+			mutate:  func(c *App) { c.FreshClamScheduleInterval = 2 * time.Hour; c.FreshClamScheduleBackoff = 0 },
+			wantErr: true,
+		},
+		{
+			name:    "max backoff lower than backoff",
+			mutate:  func(c *App) { c.FreshClamScheduleInterval = 2 * time.Hour; c.FreshClamScheduleMaxBackoff = time.Second },
+			wantErr: true,
+		},
+		{
+			name:    "zero reload confirm",
+			mutate:  func(c *App) { c.FreshClamReloadConfirm = 0 },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := App{}
+			c.setDefaults()
+			tt.mutate(&c)
+
+			err := validateConfig(&c)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfigSignatures(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *App)
+		wantErr bool
+	}{
+		{name: "disabled", mutate: func(c *App) { c.SignaturesDBName = "" }},
+		{name: "enabled", mutate: func(c *App) { c.SignaturesDBDir = "/var/lib/clamav" }},
+		{
+			name:    "invalid database name",
+			mutate:  func(c *App) { c.SignaturesDBDir = "/var/lib/clamav"; c.SignaturesDBName = "../main" },
+			wantErr: true,
+		},
+		{name: "rules enabled", mutate: func(c *App) { c.RulesDir = "/var/lib/clamav" }},
+		{
+			name:    "zero rules reload check",
+			mutate:  func(c *App) { c.RulesDir = "/var/lib/clamav"; c.RulesReloadCheck = 0 },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := App{}
+			c.setDefaults()
+			tt.mutate(&c)
+
+			err := validateConfig(&c)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfigURLScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *App)
+		wantErr bool
+	}{
+		{name: "disabled", mutate: func(c *App) { c.URLScanMaxSize = 0 }},
+		{name: "enabled", mutate: func(c *App) { c.URLScanEnabled = true }},
+		{
+			name:   "allowed networks",
+			mutate: func(c *App) { c.URLScanEnabled = true; c.URLScanAllowedNetworks = "10.0.0.0/8" },
+		},
+		{
+			name:    "invalid allowed networks",
+			mutate:  func(c *App) { c.URLScanEnabled = true; c.URLScanAllowedNetworks = "10.0.0.0/33" },
+			wantErr: true,
+		},
+		{
+			name:    "no scheme",
+			mutate:  func(c *App) { c.URLScanEnabled = true; c.URLScanAllowedSchemes = " , " },
+			wantErr: true,
+		},
+		{
+			name:    "zero max size",
+			mutate:  func(c *App) { c.URLScanEnabled = true; c.URLScanMaxSize = 0 },
+			wantErr: true,
+		},
+		{
+			name:    "zero timeout",
+			mutate:  func(c *App) { c.URLScanEnabled = true; c.URLScanTimeout = 0 },
+			wantErr: true,
+		},
+		{
+			name:    "negative max redirects",
+			mutate:  func(c *App) { c.URLScanEnabled = true; c.URLScanMaxRedirects = -1 },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := App{}
+			c.setDefaults()
+			tt.mutate(&c)
+
+			err := validateConfig(&c)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfigAdmission(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *App)
+		wantErr bool
+	}{
+		{name: "defaults", mutate: func(c *App) {}},
+		{name: "queue without timeout", mutate: func(c *App) {
+			c.AdmissionMaxInFlightScans = 4
+			c.AdmissionMaxQueuedScans = 8
+			c.AdmissionQueueTimeout = 0
+		}},
+		{name: "negative queue timeout", mutate: func(c *App) { c.AdmissionQueueTimeout = -time.Second }, wantErr: true},
+		{name: "negative queue length", mutate: func(c *App) { c.AdmissionMaxQueuedScans = -1 }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := App{}
+			c.setDefaults()
+			tt.mutate(&c)
+
+			err := validateConfig(&c)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfigClamavCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *App)
+		wantErr bool
+	}{
+		{name: "defaults", mutate: func(c *App) {}},
+		{name: "zero refresh", mutate: func(c *App) { c.ClamavCapabilitiesRefresh = 0 }, wantErr: true},
+		{name: "negative refresh", mutate: func(c *App) { c.ClamavCapabilitiesRefresh = -time.Minute }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := App{}
+			c.setDefaults()
+			tt.mutate(&c)
+
+			err := validateConfig(&c)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfigDatabases(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *App)
+		wantErr bool
+	}{
+		{name: "defaults", mutate: func(c *App) {}},
+		{name: "database directory", mutate: func(c *App) { c.DatabasesDir = "/var/lib/clamav" }},
+		{name: "zero max age", mutate: func(c *App) { c.DatabasesMaxAge = 0 }, wantErr: true},
+		{name: "negative max age", mutate: func(c *App) { c.DatabasesMaxAge = -time.Hour }, wantErr: true},
+		{name: "mirror", mutate: func(c *App) { c.MirrorDir = "/var/lib/clamav-api/mirror" }},
+		{name: "zero mirror upload size", mutate: func(c *App) { c.MirrorDir, c.MirrorMaxUploadSize = "/var/lib/clamav-api/mirror", 0 }, wantErr: true},
+		{name: "zero mirror upload size without mirror", mutate: func(c *App) { c.MirrorMaxUploadSize = 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := App{}
+			c.setDefaults()
+			tt.mutate(&c)
+
+			err := validateConfig(&c)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
 }
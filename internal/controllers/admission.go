@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/lescactus/clamav-api-go/internal/admission"
+	"github.com/lescactus/clamav-api-go/internal/ratelimit"
+	"github.com/rs/zerolog/hlog"
+)
+
+// AdmissionControl returns a middleware admitting requests through the given
+// admission controller. Requests which can't be admitted in time are answered
+// with a 503 status code and a Retry-After header.
+//
+// It is meant to be registered on the scan endpoints only.
+func AdmissionControl(ac *admission.Controller) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			release, err := ac.Acquire(r.Context())
+			if err != nil {
+				reqID, _ := hlog.IDFromCtx(r.Context())
+				hlog.FromRequest(r).Warn().Str("req_id", reqID.String()).
+					Err(err).
+					Msg("scan rejected by admission control")
+
+				w.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfterSeconds(ac.RetryAfter())))
+				SetErrorResponse(w, r, err)
+				return
+			}
+			defer release()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
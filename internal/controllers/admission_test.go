@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/admission"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmissionControl(t *testing.T) {
+	ac := admission.New(admission.Config{MaxInFlight: 1, MaxQueued: 1, QueueTimeout: 20 * time.Millisecond})
+
+	inner := make(chan struct{})
+	done := make(chan struct{})
+	handler := AdmissionControl(ac)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		inner <- struct{}{}
+		<-done
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/rest/v1/scan", nil)
+		logger := zerolog.New(io.Discard)
+		return req.WithContext(logger.WithContext(context.Background()))
+	}
+
+	// First scan is in-flight
+	first := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(first, newRequest())
+		close(finished)
+	}()
+	<-inner
+
+	// Second scan waits in the queue and times out
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest())
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"service overloaded: timed out waiting for a scan slot"}`, rr.Body.String())
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	close(done)
+	<-finished
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	// The slot is released
+	go func() { <-inner }()
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest())
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestAdmissionControlQueueFull(t *testing.T) {
+	ac := admission.New(admission.Config{MaxClamdQueue: 1, QueueTimeout: time.Second, PollInterval: 5 * time.Second})
+	ac.Observe(admission.ClamdLoad{Queue: 3})
+
+	handler := AdmissionControl(ac)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/rest/v1/scan", nil)
+	logger := zerolog.New(io.Discard)
+	req = req.WithContext(logger.WithContext(context.Background()))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"service overloaded: scan queue is full"}`, rr.Body.String())
+	assert.Equal(t, "5", rr.Header().Get("Retry-After"))
+}
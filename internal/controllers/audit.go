@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/rs/zerolog/hlog"
+)
+
+// auditLog records rec in the audit log, if enabled, after completing it
+// with the principal, client IP address and ID of the request.
+func (h *Handler) auditLog(r *http.Request, rec audit.Record) {
+	reqID, _ := hlog.IDFromCtx(r.Context())
+	audit.LogRequest(h.Audit, h.Logger, rec, PrincipalFromContext(r.Context()), ClientIP(r), reqID.String())
+}
+
+// sha256Sum returns the hex-encoded SHA-256 digest of the content of f
+// and rewinds it.
+func sha256Sum(f io.ReadSeeker) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("error while hashing file: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("error while rewinding file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/freshclam"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type auditSink struct {
+	bytes.Buffer
+}
+
+func (s *auditSink) WriteRecord(line []byte) error {
+	s.Write(line)
+	s.WriteByte('\n')
+	return nil
+}
+
+func (s *auditSink) Close() error { return nil }
+
+// lastRecord returns the last record written to the sink.
+func (s *auditSink) lastRecord(t *testing.T) audit.Record {
+	t.Helper()
+	lines := strings.Split(strings.TrimRight(s.String(), "\n"), "\n")
+	var rec audit.Record
+	require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &rec))
+	return rec
+}
+
+func newAuditedHandler(t *testing.T) (*Handler, *auditSink) {
+	t.Helper()
+	logger := zerolog.New(io.Discard)
+	sink := &auditSink{}
+	l, err := audit.New(sink, nil)
+	require.NoError(t, err)
+
+	h := NewHandler(&logger, &MockClamav{})
+	h.Audit = l
+	h.FreshClamJobs = freshclam.New(h.Clamav.FreshClam, freshclam.Config{})
+	return h, sink
+}
+
+func TestAuditInStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario MockScenario
+		want     audit.Record
+	}{
+		{
+			name:     "clean",
+			scenario: ScenarioNoError,
+			want:     audit.Record{Verdict: audit.VerdictClean},
+		},
+		{
+			name:     "infected",
+			scenario: ScenarioErrVirusFound,
+			want:     audit.Record{Verdict: audit.VerdictInfected, Signature: "Win.Test.EICAR_HDB-1"},
+		},
+		{
+			name:     "error",
+			scenario: ScenarioNetError,
+			want:     audit.Record{Verdict: audit.VerdictError},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, sink := newAuditedHandler(t)
+
+			b := &bytes.Buffer{}
+			writer := multipart.NewWriter(b)
+			part, _ := writer.CreateFormFile("file", "foo.txt")
+			_, _ = part.Write([]byte("foobar"))
+			_ = writer.Close()
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.scenario)
+			ctx = WithPrincipal(ctx, "key-1")
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan", b)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			req.RemoteAddr = "192.0.2.1:1234"
+
+			http.HandlerFunc(h.InStream).ServeHTTP(httptest.NewRecorder(), req)
+
+			rec := sink.lastRecord(t)
+			assert.Equal(t, audit.ActionScan, rec.Action)
+			assert.Equal(t, "key-1", rec.Principal)
+			assert.Equal(t, "192.0.2.1", rec.ClientIP)
+			assert.Equal(t, "foo.txt", rec.FileName)
+			assert.Equal(t, int64(6), rec.FileSize)
+			assert.Equal(t, "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2", rec.SHA256)
+			assert.Equal(t, tt.want.Verdict, rec.Verdict)
+			assert.Equal(t, tt.want.Signature, rec.Signature)
+			assert.Equal(t, tt.want.Verdict == audit.VerdictError, rec.Error != "")
+		})
+	}
+}
+
+func TestAuditAdminActions(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  func(h *Handler) http.HandlerFunc
+		scenario MockScenario
+		want     audit.Record
+	}{
+		{
+			name:     "reload",
+			handler:  func(h *Handler) http.HandlerFunc { return h.Reload },
+			scenario: ScenarioNoError,
+			want:     audit.Record{Action: audit.ActionReload, Verdict: audit.VerdictSuccess},
+		},
+		{
+			name:     "reload failure",
+			handler:  func(h *Handler) http.HandlerFunc { return h.Reload },
+			scenario: ScenarioErrUnknownResponse,
+			want:     audit.Record{Action: audit.ActionReload, Verdict: audit.VerdictFailure, Error: "unknown response from clamav"},
+		},
+		{
+			name:     "shutdown",
+			handler:  func(h *Handler) http.HandlerFunc { return h.Shutdown },
+			scenario: ScenarioNoError,
+			want:     audit.Record{Action: audit.ActionShutdown, Verdict: audit.VerdictSuccess},
+		},
+		{
+			name:     "freshclam",
+			handler:  func(h *Handler) http.HandlerFunc { return h.FreshClam },
+			scenario: ScenarioNoError,
+			want:     audit.Record{Action: audit.ActionFreshClam, Verdict: audit.VerdictSuccess},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, sink := newAuditedHandler(t)
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.scenario)
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/", nil)
+
+			rr := httptest.NewRecorder()
+			tt.handler(h).ServeHTTP(rr, req)
+
+			// freshclam is audited once the update is finished
+			if rr.Code == http.StatusAccepted {
+				var job freshclam.Job
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &job))
+				_, err := h.FreshClamJobs.Wait(context.Background(), job.ID)
+				require.NoError(t, err)
+			}
+
+			rec := sink.lastRecord(t)
+			assert.Equal(t, tt.want.Action, rec.Action)
+			assert.Equal(t, tt.want.Verdict, rec.Verdict)
+			assert.Equal(t, tt.want.Error, rec.Error)
+			assert.Equal(t, PrincipalAnonymous, rec.Principal)
+		})
+	}
+}
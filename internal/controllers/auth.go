@@ -31,7 +31,7 @@ func APIKeyAuth(apiKey, headerName string) func(next http.Handler) http.Handler
 					Str("expected_header", headerName).
 					Msg("API key authentication required but no key provided")
 
-				writeAPIKeyErrorResponse(w, "API key required")
+				writeAPIKeyErrorResponse(w, r, "API key required")
 				return
 			}
 
@@ -42,7 +42,7 @@ func APIKeyAuth(apiKey, headerName string) func(next http.Handler) http.Handler
 					Str("user_agent", r.UserAgent()).
 					Msg("Invalid API key provided")
 
-				writeAPIKeyErrorResponse(w, "Invalid API key")
+				writeAPIKeyErrorResponse(w, r, "Invalid API key")
 				return
 			}
 
@@ -50,7 +50,7 @@ func APIKeyAuth(apiKey, headerName string) func(next http.Handler) http.Handler
 			logger.Debug().Str("req_id", reqID.String()).
 				Msg("API key authentication successful")
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), PrincipalAPIKey)))
 		})
 	}
 }
@@ -70,16 +70,15 @@ func constantTimeEquals(a, b string) bool {
 }
 
 // writeAPIKeyErrorResponse writes a standardized error response for authentication failures.
-func writeAPIKeyErrorResponse(w http.ResponseWriter, message string) {
-	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
-	w.Header().Set("WWW-Authenticate", "API-Key")
-	w.WriteHeader(http.StatusUnauthorized)
-
-	response := []byte(`{"status":"error","msg":"` + message + `"}`)
-	if _, err := w.Write(response); err != nil {
-		// Log error but don't expose it to client
-		return
-	}
+func writeAPIKeyErrorResponse(w http.ResponseWriter, r *http.Request, message string) {
+	writeAuthErrorResponse(w, r, "API-Key", message)
+}
+
+// writeAuthErrorResponse writes a standardized error response for authentication failures
+// advertising the given authentication scheme.
+func writeAuthErrorResponse(w http.ResponseWriter, r *http.Request, scheme, message string) {
+	w.Header().Set("WWW-Authenticate", scheme)
+	writeError(w, r, apiError{http.StatusUnauthorized, CodeUnauthorized, message})
 }
 
 // IsPublicEndpoint returns true if the endpoint should be accessible without authentication.
@@ -90,6 +89,9 @@ func IsPublicEndpoint(path string) bool {
 		"/health",       // Alternative health check endpoint
 		"/readiness",    // Kubernetes readiness probe
 		"/liveness",     // Kubernetes liveness probe
+		OpenAPIPath,     // API documentation
+		SwaggerUIPath,
+		MirrorPath, // freshclam can't authenticate to the mirror
 	}
 
 	for _, publicPath := range publicPaths {
@@ -174,6 +174,26 @@ func TestIsPublicEndpoint(t *testing.T) {
 			path:     "/liveness",
 			expected: true,
 		},
+		{
+			name:     "openapi document",
+			path:     "/openapi.json",
+			expected: true,
+		},
+		{
+			name:     "swagger ui",
+			path:     "/docs",
+			expected: true,
+		},
+		{
+			name:     "mirror file",
+			path:     "/mirror/daily.cvd",
+			expected: true,
+		},
+		{
+			name:     "protected mirror upload",
+			path:     "/rest/v1/mirror",
+			expected: false,
+		},
 		{
 			name:     "protected scan endpoint",
 			path:     "/rest/v1/scan",
@@ -275,3 +295,22 @@ func TestConditionalAPIKeyAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIKeyAuthProblem(t *testing.T) {
+	handler := APIKeyAuth("secret", "X-API-Key")(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/rest/v1/stats", nil)
+	logger := zerolog.New(io.Discard)
+	req = req.WithContext(logger.WithContext(context.Background()))
+	req.Header.Set("Accept", "application/problem+json")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "API-Key", rr.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"urn:clamav-api-go:problem:unauthorized","title":"Unauthorized","status":401,"detail":"API key required","instance":"/rest/v1/stats","code":"unauthorized"}`, rr.Body.String())
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientIPCtxKey is the context key under which the resolved
+// client IP address of a request is stored.
+type clientIPCtxKey struct{}
+
+// RealIP returns a middleware resolving the IP address of the client.
+//
+// When the request comes from one of the trusted proxies, the address is taken
+// from the X-Forwarded-For header, walking it from right to left and skipping
+// the trusted proxies, or from the X-Real-IP header. Otherwise, the address
+// of the remote end of the connection is used.
+func RealIP(trustedProxies []netip.Prefix) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, trustedProxies)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPCtxKey{}, ip)))
+		})
+	}
+}
+
+// ClientIP returns the IP address of the client as resolved by RealIP,
+// or the address of the remote end of the connection.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPCtxKey{}).(string); ok && ip != "" {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func resolveClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	remote := remoteIP(r)
+	if !IsTrusted(remote, trustedProxies) {
+		return remote
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				// Malformed entries can't be trusted further
+				break
+			}
+			if !IsTrusted(hop, trustedProxies) {
+				return hop
+			}
+		}
+	}
+
+	if xrip := strings.TrimSpace(r.Header.Get("X-Real-IP")); xrip != "" {
+		if _, err := netip.ParseAddr(xrip); err == nil {
+			return xrip
+		}
+	}
+
+	return remote
+}
+
+// remoteIP returns the IP part of r.RemoteAddr.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// IsTrusted returns true if ip belongs to one of the trusted prefixes.
+func IsTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
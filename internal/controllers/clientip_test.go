@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.10/32"),
+	}
+
+	tests := []struct {
+		name       string
+		trusted    []netip.Prefix
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "no proxy",
+			trusted:    trusted,
+			remoteAddr: "198.51.100.1:1234",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "untrusted proxy headers are ignored",
+			trusted:    trusted,
+			remoteAddr: "198.51.100.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.1", "X-Real-IP": "203.0.113.2"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "no trusted proxies configured",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.1"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "trusted proxy with X-Forwarded-For",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.1"},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "chain of trusted proxies",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.9, 203.0.113.1, 192.0.2.10, 10.1.1.1"},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "malformed X-Forwarded-For entry",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.1, garbage, 10.1.1.1"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "trusted proxy with X-Real-IP",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Real-IP": "203.0.113.2"},
+			want:       "203.0.113.2",
+		},
+		{
+			name:       "IPv6 remote address",
+			trusted:    trusted,
+			remoteAddr: "[2001:db8::1]:1234",
+			want:       "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RealIP(tt.trusted)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/rest/v1/scan", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClientIPWithoutMiddleware(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/rest/v1/scan", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+
+	assert.Equal(t, "198.51.100.1", ClientIP(req))
+}
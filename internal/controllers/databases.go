@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/databases"
+	"github.com/rs/zerolog/hlog"
+)
+
+// DatabasesResponse represents the json response of the /databases endpoint.
+type DatabasesResponse struct {
+	VersionDetails
+	// MaxAgeSeconds is the age above which the databases are stale.
+	MaxAgeSeconds int64 `json:"max_age_seconds"`
+	// Stale is true when the databases loaded by clamd are older than the
+	// maximum age, or when clamd reports no database.
+	Stale bool `json:"stale"`
+	// Databases are the databases of the database directory, if configured.
+	Databases []databases.Database `json:"databases,omitempty"`
+}
+
+// Databases handles requests to get the version of the databases loaded by
+// clamd and the databases of the database directory.
+func (h *Handler) Databases(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	reply, err := h.Clamav.Version(r.Context())
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending version command: %v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+	version, err := clamav.ParseVersion(reply)
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while parsing version: %v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	resp := DatabasesResponse{
+		VersionDetails: newVersionDetails(version, h.now()),
+		MaxAgeSeconds:  int64(h.DatabasesMaxAge.Seconds()),
+	}
+	resp.Stale = resp.DatabaseAgeSeconds == nil || time.Duration(*resp.DatabaseAgeSeconds)*time.Second > h.DatabasesMaxAge
+
+	if h.DatabasesDir != "" {
+		resp.Databases, err = databases.List(h.DatabasesDir)
+		if err != nil {
+			h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while listing databases: %v", err)
+			SetErrorResponse(w, r, err)
+			return
+		}
+		for _, db := range resp.Databases {
+			if db.Err != nil {
+				h.Logger.Warn().Str("req_id", reqID.String()).Str("file", db.File).Err(db.Err).Msg("error while inspecting database")
+			}
+		}
+	}
+
+	if resp.Stale {
+		h.Logger.Warn().Str("req_id", reqID.String()).Interface("database_age_seconds", resp.DatabaseAgeSeconds).Msg("virus databases are stale")
+	}
+
+	h.writeJSON(w, r, resp)
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/databases"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerDatabases(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	dir := t.TempDir()
+	header := "ClamAV-VDB:06 Jul 2023 07-29 +0000:26961:2038531:90:md5:dsig:raynman:1688628578"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "daily.cld"), []byte(header+strings.Repeat(" ", databases.HeaderSize-len(header))), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "clamav-api-go.hsb"), []byte("3858f62230ac3c915f300c664312c63f:6:Win.Trojan.Foobar\n"), 0o600))
+
+	databaseDate := time.Date(2023, time.July, 6, 7, 29, 38, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		scenario      MockScenario
+		dir           string
+		maxAge        time.Duration
+		wantStatus    int
+		wantStale     bool
+		wantDatabases []string
+	}{
+		{
+			name:       "stale databases",
+			scenario:   ScenarioNoError,
+			maxAge:     48 * time.Hour,
+			wantStatus: http.StatusOK,
+			wantStale:  true,
+		},
+		{
+			name:          "database directory",
+			scenario:      ScenarioNoError,
+			dir:           dir,
+			maxAge:        time.Since(databaseDate) + time.Hour,
+			wantStatus:    http.StatusOK,
+			wantDatabases: []string{"clamav-api-go.hsb", "daily.cld"},
+		},
+		{
+			name:       "missing database directory",
+			scenario:   ScenarioNoError,
+			dir:        filepath.Join(dir, "missing"),
+			maxAge:     48 * time.Hour,
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "error is net error",
+			scenario:   ScenarioNetError,
+			maxAge:     48 * time.Hour,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "error is ErrUnexpectedResponse",
+			scenario:   ScenarioErrUnexpectedResponse,
+			maxAge:     48 * time.Hour,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			h.DatabasesDir = tt.dir
+			h.DatabasesMaxAge = tt.maxAge
+			rr := httptest.NewRecorder()
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.scenario)
+			req := httptest.NewRequest(http.MethodGet, "/rest/v1/databases", nil).WithContext(ctx)
+			http.HandlerFunc(h.Databases).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			if tt.wantStatus != http.StatusOK {
+				// Local paths aren't disclosed
+				assert.NotContains(t, rr.Body.String(), dir)
+				return
+			}
+
+			var resp DatabasesResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, "1.0.1", resp.EngineVersion)
+			assert.Equal(t, 26961, resp.DatabaseVersion)
+			require.NotNil(t, resp.DatabaseDate)
+			assert.True(t, databaseDate.Equal(*resp.DatabaseDate))
+			require.NotNil(t, resp.DatabaseAgeSeconds)
+			assert.Greater(t, *resp.DatabaseAgeSeconds, int64(0))
+			assert.Equal(t, int64(tt.maxAge.Seconds()), resp.MaxAgeSeconds)
+			assert.Equal(t, tt.wantStale, resp.Stale)
+
+			var files []string
+			for _, db := range resp.Databases {
+				files = append(files, db.File)
+			}
+			assert.Equal(t, tt.wantDatabases, files)
+			if tt.dir != "" {
+				assert.Equal(t, 26961, resp.Databases[1].Version)
+				assert.Equal(t, 2038531, resp.Databases[1].Signatures)
+			}
+		})
+	}
+}
@@ -3,12 +3,30 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"io/fs"
+	"mime"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 
+	"github.com/lescactus/clamav-api-go/internal/admission"
+	"github.com/lescactus/clamav-api-go/internal/capabilities"
 	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/lescactus/clamav-api-go/internal/freshclam"
+	"github.com/lescactus/clamav-api-go/internal/mirror"
+	"github.com/lescactus/clamav-api-go/internal/objectstore"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/internal/ratelimit"
+	"github.com/lescactus/clamav-api-go/internal/rules"
+	"github.com/lescactus/clamav-api-go/internal/signatures"
+	"github.com/lescactus/clamav-api-go/internal/urlfetch"
+	"github.com/rs/zerolog/hlog"
 )
 
 const (
@@ -20,8 +38,41 @@ const (
 	StatusError = "error"
 	// ContentTypeApplicationJSON is the content type for JSON responses.
 	ContentTypeApplicationJSON = "application/json"
+	// ContentTypeProblemJSON is the content type for RFC 7807 problem details responses.
+	ContentTypeProblemJSON = "application/problem+json"
+
+	// ProblemTypePrefix prefixes the error code to build the type of problem details.
+	ProblemTypePrefix = "urn:clamav-api-go:problem:"
 )
 
+// Stable error codes of the problem details responses.
+// See docs/ERRORS.md.
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeRequestTooLarge    = "request_too_large"
+	CodeFileTooLarge       = "file_too_large"
+	CodeFileTypeNotAllowed = "file_type_not_allowed"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeRateLimited        = "rate_limited"
+	CodeOverloaded         = "overloaded"
+	CodeClamdUnreachable   = "clamd_unreachable"
+	CodeClamdTimeout       = "clamd_timeout"
+	CodeReloadFailed       = "reload_failed"
+	CodeStorageError       = "storage_error"
+	CodeFetchError         = "fetch_error"
+	CodeUnknownCommand     = "unknown_command"
+	CodeUnknownResponse    = "unknown_response"
+	CodeUnexpectedResponse = "unexpected_response"
+	CodeUnsupportedCommand = "unsupported_command"
+	CodeInternalError      = "internal_error"
+)
+
+// ErrInvalidBody indicates a malformed request body.
+var ErrInvalidBody = errors.New("invalid request body")
+
 // ErrorResponse represents a standard error response structure.
 type ErrorResponse struct {
 	Status string `json:"status"`
@@ -36,49 +87,195 @@ func NewErrorResponse(msg string) *ErrorResponse {
 	}
 }
 
+// Problem represents an RFC 7807 problem details error response,
+// extended with a stable error code and the request id.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// apiError is the description of an error returned to clients.
+type apiError struct {
+	status int
+	code   string
+	msg    string
+}
+
+// classifyError returns the status code, error code and message
+// describing err to clients.
+func classifyError(err error) apiError {
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	// Errors of the object storage and of the fetch of URLs come first:
+	// they aren't errors talking to clamd
+	case errors.Is(err, objectstore.ErrNotFound):
+		return apiError{http.StatusNotFound, CodeNotFound, err.Error()}
+	case errors.Is(err, objectstore.ErrBucketNotAllowed):
+		return apiError{http.StatusForbidden, CodeForbidden, err.Error()}
+	case errors.Is(err, objectstore.ErrStorage):
+		return apiError{http.StatusBadGateway, CodeStorageError, err.Error()}
+	case errors.Is(err, urlfetch.ErrForbidden):
+		return apiError{http.StatusForbidden, CodeForbidden, err.Error()}
+	case errors.Is(err, urlfetch.ErrTooLarge):
+		return apiError{http.StatusRequestEntityTooLarge, CodeFileTooLarge, err.Error()}
+	case errors.Is(err, urlfetch.ErrFetch):
+		return apiError{http.StatusBadGateway, CodeFetchError, err.Error()}
+	// The cause of a rollback is reported along the rollback
+	case errors.Is(err, rules.ErrRolledBack):
+		return apiError{http.StatusBadGateway, CodeReloadFailed, err.Error()}
+	case errors.Is(err, filetype.ErrDenied):
+		return apiError{http.StatusUnsupportedMediaType, CodeFileTypeNotAllowed, err.Error()}
+	case errors.As(err, &maxBytesErr):
+		return apiError{http.StatusRequestEntityTooLarge, CodeRequestTooLarge, "request too large: " + maxBytesErr.Error()}
+	case errors.Is(err, context.DeadlineExceeded) || isTimeoutError(err):
+		return apiError{http.StatusGatewayTimeout, CodeClamdTimeout, "timed out while communicating with clamav"}
+	case isNetError(err):
+		return apiError{http.StatusBadGateway, CodeClamdUnreachable, "something wrong happened while communicating with clamav"}
+	case isFSError(err):
+		return apiError{http.StatusInternalServerError, CodeInternalError, "internal server error"}
+	case errors.Is(err, ErrFormFile) || errors.Is(err, ErrOpenFileHeaders) ||
+		errors.Is(err, ErrInvalidQueryParam) || errors.Is(err, quarantine.ErrInvalidID) ||
+		errors.Is(err, ErrInvalidBody) || errors.Is(err, objectstore.ErrInvalidRef) ||
+		errors.Is(err, urlfetch.ErrInvalidURL) || errors.Is(err, signatures.ErrInvalid) ||
+		errors.Is(err, rules.ErrInvalid) || errors.Is(err, freshclam.ErrInvalidSettings) ||
+		errors.Is(err, mirror.ErrInvalid):
+		return apiError{http.StatusBadRequest, CodeInvalidRequest, "bad request: " + err.Error()}
+	case errors.Is(err, quarantine.ErrNotFound) || errors.Is(err, signatures.ErrNotFound) ||
+		errors.Is(err, rules.ErrNotFound) || errors.Is(err, freshclam.ErrNotFound) ||
+		errors.Is(err, mirror.ErrNotFound):
+		return apiError{http.StatusNotFound, CodeNotFound, err.Error()}
+	case errors.Is(err, signatures.ErrExists) || errors.Is(err, rules.ErrExists) ||
+		errors.Is(err, mirror.ErrOutdated):
+		return apiError{http.StatusConflict, CodeConflict, err.Error()}
+	case errors.Is(err, ratelimit.ErrRateLimited) || errors.Is(err, ratelimit.ErrConcurrencyLimited):
+		return apiError{http.StatusTooManyRequests, CodeRateLimited, err.Error()}
+	case errors.Is(err, admission.ErrQueueFull) || errors.Is(err, admission.ErrQueueTimeout):
+		return apiError{http.StatusServiceUnavailable, CodeOverloaded, "service overloaded: " + err.Error()}
+	case errors.Is(err, capabilities.ErrUnsupported):
+		return apiError{http.StatusNotImplemented, CodeUnsupportedCommand, err.Error()}
+	case errors.Is(err, clamav.ErrUnknownCommand):
+		return apiError{http.StatusInternalServerError, CodeUnknownCommand, "unknown command sent to clamav"}
+	case errors.Is(err, clamav.ErrUnknownResponse):
+		return apiError{http.StatusInternalServerError, CodeUnknownResponse, "unknown response from clamav"}
+	case errors.Is(err, clamav.ErrUnexpectedResponse):
+		return apiError{http.StatusInternalServerError, CodeUnexpectedResponse, "unexpected response from clamav"}
+	case errors.Is(err, clamav.ErrScanFileSizeLimitExceeded):
+		return apiError{http.StatusRequestEntityTooLarge, CodeFileTooLarge, "clamav: " + err.Error()}
+	default:
+		return apiError{http.StatusInternalServerError, CodeInternalError, err.Error()}
+	}
+}
+
+// ClassifyError returns the status code, error code and message describing
+// err to clients, so that other transports report errors like the REST API.
+func ClassifyError(err error) (status int, code, msg string) {
+	e := classifyError(err)
+	return e.status, e.code, e.msg
+}
+
 // SetErrorResponse will attempt to parse the given error
 // and set the response status code and using the ResponseWriter
 // according to the type of the error.
-func SetErrorResponse(w http.ResponseWriter, err error) {
+//
+// The error is written as RFC 7807 problem details when the client
+// prefers application/problem+json, in the legacy
+// {"status":"error","msg":...} format otherwise.
+func SetErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	if err == nil {
 		return
 	}
 
-	var errResp *ErrorResponse
-
-	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
-
-	if isNetError(err) {
-		errResp = NewErrorResponse("something wrong happened while communicating with clamav")
-		w.WriteHeader(http.StatusBadGateway)
-	} else if errors.Is(err, ErrFormFile) || errors.Is(err, ErrOpenFileHeaders) {
-		errResp = NewErrorResponse("bad request: " + err.Error())
-		w.WriteHeader(http.StatusBadRequest)
-	} else {
-		if errors.Is(err, clamav.ErrUnknownCommand) {
-			errResp = NewErrorResponse("unknown command sent to clamav")
-			w.WriteHeader(http.StatusInternalServerError)
-		} else if errors.Is(err, clamav.ErrUnknownResponse) {
-			errResp = NewErrorResponse("unknown response from clamav")
-			w.WriteHeader(http.StatusInternalServerError)
-		} else if errors.Is(err, clamav.ErrUnexpectedResponse) {
-			errResp = NewErrorResponse("unexpected response from clamav")
-			w.WriteHeader(http.StatusInternalServerError)
-		} else if errors.Is(err, clamav.ErrScanFileSizeLimitExceeded) {
-			errResp = NewErrorResponse("clamav: " + err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-		} else {
-			errResp = NewErrorResponse(err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+	writeError(w, r, classifyError(err))
+}
+
+// writeError writes e in the format negotiated with the client.
+func writeError(w http.ResponseWriter, r *http.Request, e apiError) {
+	w.Header().Add("Vary", "Accept")
+
+	if !prefersProblem(r) {
+		w.Header().Set("Content-Type", ContentTypeApplicationJSON)
+		w.WriteHeader(e.status)
+
+		resp, _ := json.Marshal(NewErrorResponse(e.msg))
+		_, _ = w.Write(resp)
+		return
+	}
+
+	p := Problem{
+		Type:     ProblemTypePrefix + e.code,
+		Title:    http.StatusText(e.status),
+		Status:   e.status,
+		Detail:   e.msg,
+		Instance: r.URL.Path,
+		Code:     e.code,
+	}
+	if id, ok := hlog.IDFromCtx(r.Context()); ok {
+		p.RequestID = id.String()
 	}
 
-	resp, _ := json.Marshal(errResp)
+	w.Header().Set("Content-Type", ContentTypeProblemJSON)
+	w.WriteHeader(e.status)
+
+	resp, _ := json.Marshal(p)
 	_, _ = w.Write(resp)
 }
 
-// isNetError returns true if the error is a net.Error
+// prefersProblem returns true if the Accept header of r ranks
+// application/problem+json above application/json.
+func prefersProblem(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+
+	var problemQ, jsonQ float64
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			q := 1.0
+			if s, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(s, 64); err != nil {
+					continue
+				}
+			}
+
+			switch mediaType {
+			case ContentTypeProblemJSON:
+				problemQ = max(problemQ, q)
+			case ContentTypeApplicationJSON:
+				jsonQ = max(jsonQ, q)
+			}
+		}
+	}
+	return problemQ > 0 && problemQ >= jsonQ
+}
+
+// isNetError returns true if the error is a *net.OpError. Filesystem errors
+// aren't: they wrap a syscall.Errno, which implements net.Error too.
 func isNetError(err error) bool {
-	var e net.Error
+	var e *net.OpError
 	return errors.As(err, &e)
 }
+
+// isTimeoutError returns true if the error is a *net.OpError caused by a timeout
+func isTimeoutError(err error) bool {
+	var e *net.OpError
+	return errors.As(err, &e) && e.Timeout()
+}
+
+// isFSError returns true if the error is an error of the filesystem, whose
+// message holds local paths.
+func isFSError(err error) bool {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	return errors.As(err, &pathErr) || errors.As(err, &linkErr)
+}
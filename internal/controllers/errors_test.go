@@ -1,14 +1,25 @@
 package controllers
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
+	"syscall"
 	"testing"
 
+	"github.com/lescactus/clamav-api-go/internal/capabilities"
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/ratelimit"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog/hlog"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -71,6 +82,11 @@ func TestIsNetError(t *testing.T) {
 			args: args{err: &net.OpError{}},
 			want: true,
 		},
+		{
+			name: "error is fs.PathError",
+			args: args{err: &fs.PathError{Op: "open", Path: "/var/lib/clamav", Err: syscall.ENOENT}},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -110,11 +126,26 @@ func TestSetErrorResponse(t *testing.T) {
 			args: args{&net.OpError{}},
 			want: want{http.StatusBadGateway, "application/json", []byte(`{"status":"error","msg":"something wrong happened while communicating with clamav"}`)},
 		},
+		{
+			name: "error is a clamd timeout",
+			args: args{&net.OpError{Op: "dial", Err: timeoutError{}}},
+			want: want{http.StatusGatewayTimeout, "application/json", []byte(`{"status":"error","msg":"timed out while communicating with clamav"}`)},
+		},
+		{
+			name: "error is fs.PathError",
+			args: args{fmt.Errorf("error while listing databases: %w", &fs.PathError{Op: "open", Path: "/var/lib/clamav", Err: syscall.EACCES})},
+			want: want{http.StatusInternalServerError, "application/json", []byte(`{"status":"error","msg":"internal server error"}`)},
+		},
+		{
+			name: "error is http.MaxBytesError",
+			args: args{fmt.Errorf("%w: %w", ErrFormFile, &http.MaxBytesError{Limit: 10})},
+			want: want{http.StatusRequestEntityTooLarge, "application/json", []byte(`{"status":"error","msg":"request too large: http: request body too large"}`)},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			rr := httptest.NewRecorder()
-			SetErrorResponse(rr, tt.args.err)
+			SetErrorResponse(rr, httptest.NewRequest(http.MethodGet, "/", nil), tt.args.err)
 
 			resp := rr.Result()
 			body, _ := io.ReadAll(resp.Body)
@@ -124,3 +155,137 @@ func TestSetErrorResponse(t *testing.T) {
 		})
 	}
 }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestSetErrorResponseProblem(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{
+			name:   "clamd unreachable",
+			err:    fmt.Errorf("failed to connect to clamav: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}),
+			status: http.StatusBadGateway,
+			code:   CodeClamdUnreachable,
+			detail: "something wrong happened while communicating with clamav",
+		},
+		{
+			name:   "clamd timeout",
+			err:    context.DeadlineExceeded,
+			status: http.StatusGatewayTimeout,
+			code:   CodeClamdTimeout,
+			detail: "timed out while communicating with clamav",
+		},
+		{
+			name:   "file too large",
+			err:    fmt.Errorf("error from clamav: %w", clamav.ErrScanFileSizeLimitExceeded),
+			status: http.StatusRequestEntityTooLarge,
+			code:   CodeFileTooLarge,
+			detail: "clamav: error from clamav: size limit exceeded",
+		},
+		{
+			name:   "request too large",
+			err:    &http.MaxBytesError{Limit: 10},
+			status: http.StatusRequestEntityTooLarge,
+			code:   CodeRequestTooLarge,
+			detail: "request too large: http: request body too large",
+		},
+		{
+			name:   "unknown command",
+			err:    clamav.ErrUnknownCommand,
+			status: http.StatusInternalServerError,
+			code:   CodeUnknownCommand,
+			detail: "unknown command sent to clamav",
+		},
+		{
+			name:   "unsupported command",
+			err:    fmt.Errorf("%w: %s", capabilities.ErrUnsupported, capabilities.CommandStats),
+			status: http.StatusNotImplemented,
+			code:   CodeUnsupportedCommand,
+			detail: "command not supported by clamd: STATS",
+		},
+		{
+			name:   "bad request",
+			err:    fmt.Errorf("%w: %w", ErrFormFile, http.ErrMissingFile),
+			status: http.StatusBadRequest,
+			code:   CodeInvalidRequest,
+			detail: "bad request: failed to parse file: http: no such file",
+		},
+		{
+			name:   "rate limited",
+			err:    ratelimit.ErrRateLimited,
+			status: http.StatusTooManyRequests,
+			code:   CodeRateLimited,
+			detail: ratelimit.ErrRateLimited.Error(),
+		},
+		{
+			name:   "generic error",
+			err:    errors.New("foobar"),
+			status: http.StatusInternalServerError,
+			code:   CodeInternalError,
+			detail: "foobar",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/rest/v1/scan", nil)
+			req.Header.Set("Accept", "application/problem+json")
+			id := xid.New()
+			req = req.WithContext(hlog.CtxWithID(req.Context(), id))
+
+			rr := httptest.NewRecorder()
+			SetErrorResponse(rr, req, tt.err)
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, "Accept", rr.Header().Get("Vary"))
+
+			var p Problem
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+			assert.Equal(t, Problem{
+				Type:      ProblemTypePrefix + tt.code,
+				Title:     http.StatusText(tt.status),
+				Status:    tt.status,
+				Detail:    tt.detail,
+				Instance:  "/rest/v1/scan",
+				Code:      tt.code,
+				RequestID: id.String(),
+			}, p)
+		})
+	}
+}
+
+func TestPrefersProblem(t *testing.T) {
+	tests := []struct {
+		accept []string
+		want   bool
+	}{
+		{accept: nil, want: false},
+		{accept: []string{"*/*"}, want: false},
+		{accept: []string{"application/json"}, want: false},
+		{accept: []string{"application/problem+json"}, want: true},
+		{accept: []string{"application/json, application/problem+json"}, want: true},
+		{accept: []string{"application/json", "application/problem+json"}, want: true},
+		{accept: []string{"application/problem+json;q=0.5, application/json"}, want: false},
+		{accept: []string{"application/problem+json, application/json;q=0.9"}, want: true},
+		{accept: []string{"application/problem+json;q=0"}, want: false},
+		{accept: []string{"application/problem+json;q=foo"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.accept, " | "), func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, v := range tt.accept {
+				req.Header.Add("Accept", v)
+			}
+			assert.Equal(t, tt.want, prefersProblem(req))
+		})
+	}
+}
@@ -1,72 +1,135 @@
 package controllers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"net/http"
 
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/freshclam"
 	"github.com/rs/zerolog/hlog"
 )
 
-// FreshClamResponse represents the json response of a /freshclam endpoint.
-type FreshClamResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message"`
-	Output  string `json:"output,omitempty"`
+// FreshClamStatusResponse represents the json response of the status of the
+// virus definitions updates.
+type FreshClamStatusResponse struct {
+	// Running is the running update, if any.
+	Running *freshclam.Job `json:"running,omitempty"`
+	// History holds the finished updates, newest first.
+	History []freshclam.Job `json:"history"`
+	// Schedule is the status of the scheduled updates, if enabled.
+	Schedule *freshclam.ScheduleStatus `json:"schedule,omitempty"`
 }
 
 // FreshClam handles requests to update ClamAV virus definitions.
-// This endpoint executes the freshclam command to download the latest
-// virus definition updates from ClamAV servers.
+// freshclam runs in the background: the response is the job of the update,
+// whose status is available at /rest/v1/freshclam/jobs/:id. A request made
+// while an update is running doesn't start another one and gets the running job.
 func (h *Handler) FreshClam(w http.ResponseWriter, r *http.Request) {
 	// Get request id for logging purposes
 	reqID, _ := hlog.IDFromCtx(r.Context())
 
-	ctx := r.Context()
+	// The update is logged and audited once finished, on behalf of the
+	// request which started it
+	ar := r.Clone(context.WithoutCancel(r.Context()))
+	job, started := h.FreshClamJobs.Start(r.Context(), func(job freshclam.Job) { h.freshClamDone(ar, job) })
+	if started {
+		h.Logger.Info().Str("req_id", reqID.String()).Str("job_id", job.ID).Msg("freshclam update started")
+	} else {
+		h.Logger.Debug().Str("req_id", reqID.String()).Str("job_id", job.ID).Msg("freshclam update already running")
+	}
 
-	h.Logger.Debug().Str("req_id", reqID.String()).Msg("starting freshclam update")
+	w.Header().Set("Location", "/rest/v1/freshclam/jobs/"+job.ID)
+	h.writeJSONStatus(w, r, http.StatusAccepted, job)
+}
 
-	output, err := h.Clamav.FreshClam(ctx)
-	if err != nil {
-		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while running freshclam: %v", err)
+// freshClamDone logs and audits the result of the update started by r.
+func (h *Handler) freshClamDone(r *http.Request, job freshclam.Job) {
+	reqID, _ := hlog.IDFromCtx(r.Context())
 
-		// Return the output even on error, as it may contain useful information
-		fcr := FreshClamResponse{
-			Status:  "error",
-			Message: "freshclam update failed",
-			Output:  string(output),
-		}
+	if job.State == freshclam.StateFailed {
+		h.Logger.Error().Str("req_id", reqID.String()).Str("job_id", job.ID).Msgf("error while running freshclam: %s", job.Error)
+		h.auditLog(r, audit.Record{Action: audit.ActionFreshClam, Verdict: audit.VerdictFailure, Error: job.Error})
+		return
+	}
 
-		resp, marshalErr := json.Marshal(&fcr)
-		if marshalErr != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	h.Logger.Info().Str("req_id", reqID.String()).Str("job_id", job.ID).Msg("freshclam update completed successfully")
+	h.auditLog(r, audit.Record{Action: audit.ActionFreshClam, Verdict: audit.VerdictSuccess})
+}
 
-		w.Header().Add("Content-Type", ContentTypeApplicationJSON)
-		w.WriteHeader(http.StatusInternalServerError)
-		if _, writeErr := w.Write(resp); writeErr != nil {
-			h.Logger.Error().Str("req_id", reqID.String()).Msgf("failed to write response: %v", writeErr)
-		}
+// FreshClamStatus handles requests to get the running update and the
+// history of the recent ones.
+func (h *Handler) FreshClamStatus(w http.ResponseWriter, r *http.Request) {
+	resp := FreshClamStatusResponse{History: h.FreshClamJobs.History()}
+	if job, ok := h.FreshClamJobs.Running(); ok {
+		resp.Running = &job
+	}
+	if h.FreshClamSchedule != nil {
+		status := h.FreshClamSchedule.Status()
+		resp.Schedule = &status
+	}
+
+	h.writeJSON(w, r, resp)
+}
+
+// FreshClamJob handles requests to get an update, running or recent.
+func (h *Handler) FreshClamJob(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	job, ok := h.FreshClamJobs.Get(id)
+	if !ok {
+		h.Logger.Debug().Str("req_id", reqID.String()).Str("job_id", id).Msg("freshclam job not found")
+
+		SetErrorResponse(w, r, freshclam.ErrNotFound)
 		return
 	}
 
-	h.Logger.Info().Str("req_id", reqID.String()).Msg("freshclam update completed successfully")
+	h.writeJSON(w, r, job)
+}
+
+// FreshClamConfig handles requests to get the settings of freshclam managed
+// through the API. The password of the proxy isn't returned.
+func (h *Handler) FreshClamConfig(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, r, h.FreshClamSettings.Settings().Redacted())
+}
+
+// FreshClamConfigUpdate handles requests to replace the settings of freshclam
+// managed through the API, rendered into its configuration file. They apply
+// to the next update.
+func (h *Handler) FreshClamConfigUpdate(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
 
-	fcr := FreshClamResponse{
-		Status:  "success",
-		Message: "virus definitions updated successfully",
-		Output:  string(output),
+	var settings freshclam.Settings
+	if err := decodeJSON(r, &settings); err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("invalid freshclam settings request")
+
+		SetErrorResponse(w, r, err)
+		return
 	}
 
-	resp, err := json.Marshal(&fcr)
+	updated, err := h.FreshClamSettings.Update(settings)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("error while updating freshclam settings")
+		if !errors.Is(err, freshclam.ErrInvalidSettings) {
+			h.auditLog(r, audit.Record{Action: audit.ActionFreshClamConfig, Verdict: audit.VerdictFailure, Error: err.Error()})
+		}
+
+		SetErrorResponse(w, r, err)
 		return
 	}
 
-	w.Header().Add("Content-Type", ContentTypeApplicationJSON)
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(resp); err != nil {
-		h.Logger.Error().Str("req_id", reqID.String()).Msgf("failed to write response: %v", err)
-	}
+	h.Logger.Info().
+		Str("req_id", reqID.String()).
+		Strs("private_mirrors", updated.PrivateMirrors).
+		Strs("database_custom_urls", updated.DatabaseCustomURLs).
+		Bool("proxy", updated.Proxy != nil).
+		Msg("freshclam settings updated")
+	h.auditLog(r, audit.Record{Action: audit.ActionFreshClamConfig, Verdict: audit.VerdictSuccess})
+
+	h.writeJSON(w, r, updated.Redacted())
 }
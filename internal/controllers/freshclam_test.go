@@ -2,112 +2,193 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/freshclam"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestHandlerFreshClam(t *testing.T) {
-	logger := zerolog.New(io.Discard)
-	mockClamav := &MockClamav{}
+// serveFreshClam serves req with the routes of the virus definitions updates.
+func serveFreshClam(h *Handler, req *http.Request) *httptest.ResponseRecorder {
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodPost, "/rest/v1/freshclam", h.FreshClam)
+	router.HandlerFunc(http.MethodGet, "/rest/v1/freshclam", h.FreshClamStatus)
+	router.HandlerFunc(http.MethodGet, "/rest/v1/freshclam/jobs/:id", h.FreshClamJob)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
 
-	type args struct {
-		scenario MockScenario
-	}
+func TestHandlerFreshClam(t *testing.T) {
 	type want struct {
-		status int
-		body   []byte
+		state   freshclam.State
+		output  string
+		verdict string
+		err     string
 	}
 	tests := []struct {
-		name string
-		args args
-		want want
+		name     string
+		scenario MockScenario
+		want     want
 	}{
 		{
-			name: "no error",
-			args: args{
-				scenario: ScenarioNoError,
-			},
-			want: want{
-				status: http.StatusOK,
-				body:   []byte(`{"status":"success","message":"virus definitions updated successfully","output":"Database updated successfully"}`),
-			},
-		},
-		{
-			name: "error is net error",
-			args: args{
-				scenario: ScenarioNetError,
-			},
-			want: want{
-				status: http.StatusInternalServerError,
-				body:   []byte(`{"status":"error","message":"freshclam update failed","output":"network error"}`),
-			},
+			name:     "no error",
+			scenario: ScenarioNoError,
+			want:     want{state: freshclam.StateSucceeded, output: "Database updated successfully", verdict: audit.VerdictSuccess},
 		},
 		{
-			name: "error is ErrUnknownCommand",
-			args: args{
-				scenario: ScenarioErrUnknownCommand,
-			},
-			want: want{
-				status: http.StatusInternalServerError,
-				body:   []byte(`{"status":"error","message":"freshclam update failed","output":"ERROR: Command not found"}`),
-			},
+			name:     "error is net error",
+			scenario: ScenarioNetError,
+			want:     want{state: freshclam.StateFailed, output: "network error", verdict: audit.VerdictFailure, err: "network error"},
 		},
 		{
-			name: "error is ErrUnknownResponse",
-			args: args{
-				scenario: ScenarioErrUnknownResponse,
-			},
-			want: want{
-				status: http.StatusInternalServerError,
-				body:   []byte(`{"status":"error","message":"freshclam update failed","output":"ERROR: Unknown response"}`),
-			},
+			name:     "error is ErrUnknownCommand",
+			scenario: ScenarioErrUnknownCommand,
+			want:     want{state: freshclam.StateFailed, output: "ERROR: Command not found", verdict: audit.VerdictFailure, err: "unknown command"},
 		},
 		{
-			name: "error is ErrUnexpectedResponse",
-			args: args{
-				scenario: ScenarioErrUnexpectedResponse,
-			},
-			want: want{
-				status: http.StatusInternalServerError,
-				body:   []byte(`{"status":"error","message":"freshclam update failed","output":"ERROR: Unexpected response"}`),
-			},
-		},
-		{
-			name: "error is ErrScanFileSizeLimitExceeded",
-			args: args{
-				scenario: ScenarioErrScanFileSizeLimitExceeded,
-			},
-			want: want{
-				status: http.StatusInternalServerError,
-				body:   []byte(`{"status":"error","message":"freshclam update failed","output":"ERROR: Size limit exceeded"}`),
-			},
+			name:     "error is ErrUnknownResponse",
+			scenario: ScenarioErrUnknownResponse,
+			want:     want{state: freshclam.StateFailed, output: "ERROR: Unknown response", verdict: audit.VerdictFailure, err: "unknown response from clamav"},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			h := NewHandler(&logger, mockClamav)
-			rr := httptest.NewRecorder()
-			handler := http.HandlerFunc(h.FreshClam)
+			h, sink := newAuditedHandler(t)
 
-			ctx := context.WithValue(context.Background(), MockScenario(""), tt.args.scenario)
-			req, err := http.NewRequestWithContext(ctx, "POST", "/rest/v1/freshclam", nil)
-			if err != nil {
-				t.Fatal(err)
-			}
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.scenario)
+			rr := serveFreshClam(h, httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/freshclam", nil))
+			require.Equal(t, http.StatusAccepted, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
 
-			handler.ServeHTTP(rr, req)
+			var job freshclam.Job
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &job))
+			assert.NotEmpty(t, job.ID)
+			assert.Equal(t, freshclam.StateRunning, job.State)
+			assert.Equal(t, "/rest/v1/freshclam/jobs/"+job.ID, rr.Header().Get("Location"))
 
-			resp := rr.Result()
-			body, _ := io.ReadAll(resp.Body)
+			job, err := h.FreshClamJobs.Wait(context.Background(), job.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want.state, job.State)
+			assert.Equal(t, tt.want.output, job.Output)
+			assert.Contains(t, job.Error, tt.want.err)
 
-			assert.Equal(t, tt.want.status, resp.StatusCode)
-			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
-			assert.Equal(t, tt.want.body, body)
+			rec := sink.lastRecord(t)
+			assert.Equal(t, audit.ActionFreshClam, rec.Action)
+			assert.Equal(t, tt.want.verdict, rec.Verdict)
+			assert.Equal(t, job.Error, rec.Error)
 		})
 	}
 }
+
+func TestHandlerFreshClamSingleFlight(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	h := NewHandler(&logger, &MockClamav{})
+
+	release := make(chan struct{})
+	h.FreshClamJobs = freshclam.New(func(ctx context.Context) ([]byte, error) {
+		<-release
+		return []byte("daily.cld updated (version: 27001, sigs: 2070000, f-level: 90, builder: raynman)\n"), nil
+	}, freshclam.Config{})
+
+	// A second request gets the running update
+	var ids []string
+	for range 2 {
+		rr := serveFreshClam(h, httptest.NewRequest(http.MethodPost, "/rest/v1/freshclam", nil))
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		var job freshclam.Job
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &job))
+		ids = append(ids, job.ID)
+	}
+	assert.Equal(t, ids[0], ids[1])
+
+	rr := serveFreshClam(h, httptest.NewRequest(http.MethodGet, "/rest/v1/freshclam", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var status FreshClamStatusResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	require.NotNil(t, status.Running)
+	assert.Equal(t, ids[0], status.Running.ID)
+	assert.Empty(t, status.History)
+
+	close(release)
+	_, err := h.FreshClamJobs.Wait(context.Background(), ids[0])
+	require.NoError(t, err)
+
+	rr = serveFreshClam(h, httptest.NewRequest(http.MethodGet, "/rest/v1/freshclam", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	status = FreshClamStatusResponse{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	assert.Nil(t, status.Running)
+	assert.Nil(t, status.Schedule)
+	require.Len(t, status.History, 1)
+	assert.Equal(t, []freshclam.Database{{Name: "daily", Status: freshclam.DatabaseUpdated, Version: 27001}}, status.History[0].Databases)
+
+	rr = serveFreshClam(h, httptest.NewRequest(http.MethodGet, "/rest/v1/freshclam/jobs/"+ids[0], nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var job freshclam.Job
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &job))
+	assert.Equal(t, freshclam.StateSucceeded, job.State)
+	assert.NotNil(t, job.FinishedAt)
+
+	rr = serveFreshClam(h, httptest.NewRequest(http.MethodGet, "/rest/v1/freshclam/jobs/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandlerFreshClamConfig(t *testing.T) {
+	h, sink := newAuditedHandler(t)
+	dir := t.TempDir()
+	template := filepath.Join(dir, "freshclam.conf.template")
+	path := filepath.Join(dir, "freshclam.conf")
+	require.NoError(t, os.WriteFile(template, []byte("DatabaseMirror database.clamav.net\n"), 0o600))
+	store, err := freshclam.NewSettingsStore(template, path)
+	require.NoError(t, err)
+	h.FreshClamSettings = store
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		router := httprouter.New()
+		router.HandlerFunc(http.MethodGet, "/rest/v1/freshclam/config", h.FreshClamConfig)
+		router.HandlerFunc(http.MethodPut, "/rest/v1/freshclam/config", h.FreshClamConfigUpdate)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, "/rest/v1/freshclam/config", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := serve(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"private_mirrors":[],"database_custom_urls":[]}`, rr.Body.String())
+
+	rr = serve(http.MethodPut, `{"private_mirrors":["mirror.example.com"],"proxy":{"server":"proxy.example.com","port":3128,"username":"user","password":"secret"}}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"private_mirrors":["mirror.example.com"],"database_custom_urls":[],"proxy":{"server":"proxy.example.com","port":3128,"username":"user","password_set":true}}`, rr.Body.String())
+	rec := sink.lastRecord(t)
+	assert.Equal(t, audit.ActionFreshClamConfig, rec.Action)
+	assert.Equal(t, audit.VerdictSuccess, rec.Verdict)
+
+	conf, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(conf), "PrivateMirror mirror.example.com\n")
+	assert.Contains(t, string(conf), "HTTPProxyPassword secret\n")
+
+	rr = serve(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "secret")
+
+	// Invalid settings aren't audited, as nothing changed
+	records := sink.Len()
+	rr = serve(http.MethodPut, `{"private_mirrors":["mirror.example.com\nOnUpdateExecute /bin/sh"]}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = serve(http.MethodPut, `{"unknown":true}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, records, sink.Len())
+}
@@ -2,8 +2,21 @@ package controllers
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/lescactus/clamav-api-go/internal/audit"
 	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/lescactus/clamav-api-go/internal/freshclam"
+	"github.com/lescactus/clamav-api-go/internal/heuristics"
+	"github.com/lescactus/clamav-api-go/internal/mirror"
+	"github.com/lescactus/clamav-api-go/internal/objectstore"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/internal/reputation"
+	"github.com/lescactus/clamav-api-go/internal/rules"
+	"github.com/lescactus/clamav-api-go/internal/signatures"
+	"github.com/lescactus/clamav-api-go/internal/urlfetch"
 	"github.com/rs/zerolog"
 )
 
@@ -11,6 +24,81 @@ import (
 type Handler struct {
 	Clamav clamav.Clamaver
 	Logger *zerolog.Logger
+
+	// FreshClamJobs runs the updates of the virus definitions in the
+	// background, one at a time.
+	FreshClamJobs *freshclam.Runner
+
+	// FreshClamSchedule is the optional scheduler of the updates of the
+	// virus definitions. Nil disables the scheduled updates.
+	FreshClamSchedule *freshclam.Scheduler
+
+	// FreshClamSettings is the optional store of the settings of freshclam
+	// managed through the API. Nil disables their management.
+	FreshClamSettings *freshclam.SettingsStore
+
+	// DatabasesDir is the optional database directory of clamd, whose
+	// databases are inspected. Empty disables their inspection.
+	DatabasesDir string
+
+	// DatabasesMaxAge is the age above which the databases loaded by clamd
+	// are reported as stale.
+	DatabasesMaxAge time.Duration
+
+	// Now returns the current time, which the age of the databases is
+	// computed from. Nil means time.Now.
+	Now func() time.Time
+
+	// Mirror is the optional mirror of the virus databases, served to the
+	// freshclam of other instances. Nil disables the mirror.
+	Mirror *mirror.Store
+
+	// Audit is the optional audit log of scans and administrative actions.
+	// Nil disables auditing.
+	Audit *audit.Logger
+
+	// Quarantine is the optional store of infected uploads.
+	// Nil disables quarantine.
+	Quarantine *quarantine.Store
+
+	// QuarantineArchivePassword protects the archives of quarantined items.
+	QuarantineArchivePassword string
+
+	// ObjectStore is the optional object storage objects can be scanned from.
+	// Nil disables the scan of objects.
+	ObjectStore objectstore.Store
+
+	// ObjectStoreTagVerdict writes the verdicts back as tags of the scanned objects.
+	ObjectStoreTagVerdict bool
+
+	// HeuristicsPolicy decides how the archive heuristics reported
+	// by clamd are reported. Nil reports them as infected.
+	HeuristicsPolicy heuristics.Policy
+
+	// Policy is the optional verdict policy deciding whether the scanned
+	// files are allowed, warned about or blocked. Nil decides no verdict.
+	Policy *policy.Engine
+
+	// FileTypes is the optional detector of the types of the scanned files,
+	// rejecting the types which aren't allowed before their scan.
+	// Nil disables file type detection.
+	FileTypes *filetype.Detector
+
+	// Reputation is the optional store of the hash lists the uploads are
+	// looked up in before their scan. Nil disables the lookups.
+	Reputation *reputation.Store
+
+	// Signatures is the optional database of custom hash signatures
+	// managed through the API. Nil disables their management.
+	Signatures *signatures.Store
+
+	// Rules is the optional store of the custom rule files managed through
+	// the API. Nil disables their management.
+	Rules *rules.Store
+
+	// URLFetcher is the optional fetcher of the URLs to scan.
+	// Nil disables the scan of URLs.
+	URLFetcher *urlfetch.Fetcher
 }
 
 // NewHandler creates a new Handler with the provided logger and ClamAV client.
@@ -18,6 +106,14 @@ func NewHandler(logger *zerolog.Logger, clamav clamav.Clamaver) *Handler {
 	return &Handler{Logger: logger, Clamav: clamav}
 }
 
+// now returns the current time of h.
+func (h *Handler) now() time.Time {
+	if h.Now == nil {
+		return time.Now()
+	}
+	return h.Now()
+}
+
 // MaxReqSize is a HTTP middleware limiting the size of the request.
 // by using http.MaxBytesReader() on the request body.
 func MaxReqSize(maxReqSize int64) func(next http.Handler) http.Handler {
@@ -28,3 +124,19 @@ func MaxReqSize(maxReqSize int64) func(next http.Handler) http.Handler {
 		})
 	}
 }
+
+// MaxReqSizeByPath is a HTTP middleware limiting the size of the request
+// like MaxReqSize, the requests to the paths of limits being limited to
+// their own size instead of maxReqSize.
+func MaxReqSizeByPath(maxReqSize int64, limits map[string]int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit, ok := limits[r.URL.Path]
+			if !ok {
+				limit = maxReqSize
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
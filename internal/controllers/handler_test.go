@@ -3,11 +3,16 @@ package controllers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/lescactus/clamav-api-go/internal/capabilities"
 	"github.com/lescactus/clamav-api-go/internal/clamav"
 	"github.com/rs/zerolog"
 )
@@ -27,12 +32,12 @@ func TestNewHandler(t *testing.T) {
 		{
 			name: "nil args",
 			args: args{nil, nil},
-			want: &Handler{nil, nil},
+			want: &Handler{Clamav: nil, Logger: nil},
 		},
 		{
 			name: "non nil args",
 			args: args{&logger, &c},
-			want: &Handler{&c, &logger},
+			want: &Handler{Clamav: &c, Logger: &logger},
 		},
 	}
 	for _, tt := range tests {
@@ -44,6 +49,32 @@ func TestNewHandler(t *testing.T) {
 	}
 }
 
+func TestMaxReqSizeByPath(t *testing.T) {
+	handler := MaxReqSizeByPath(4, map[string]int64{"/rest/v1/mirror": 8})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			SetErrorResponse(w, r, err)
+		}
+	}))
+
+	tests := []struct {
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{path: "/rest/v1/scan", body: "1234", wantStatus: http.StatusOK},
+		{path: "/rest/v1/scan", body: "12345", wantStatus: http.StatusRequestEntityTooLarge},
+		{path: "/rest/v1/mirror", body: "12345678", wantStatus: http.StatusOK},
+		{path: "/rest/v1/mirror", body: "123456789", wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s with %d bytes: status = %d, want %d", tt.path, len(tt.body), rr.Code, tt.wantStatus)
+		}
+	}
+}
+
 type MockClamav struct{}
 
 var _ clamav.Clamaver = (*MockClamav)(nil)
@@ -136,6 +167,8 @@ func (m *MockClamav) InStream(ctx context.Context, _ io.Reader, _ int64) ([]byte
 		return []byte("stream: OK"), nil
 	case ScenarioErrVirusFound:
 		return []byte("stream: Win.Test.EICAR_HDB-1 FOUND"), clamav.ErrVirusFound
+	case ScenarioHeuristicFound:
+		return []byte("stream: Heuristics.Encrypted.Zip FOUND"), clamav.ErrVirusFound
 	default:
 		return nil, dispatchErrFromScenario(scenario.(MockScenario))
 	}
@@ -176,6 +209,8 @@ func dispatchErrFromScenario(scenario MockScenario) error {
 		return clamav.ErrScanFileSizeLimitExceeded
 	case ScenarioErrVirusFound:
 		return clamav.ErrVirusFound
+	case ScenarioErrUnsupportedCommand:
+		return fmt.Errorf("%w: %s", capabilities.ErrUnsupported, capabilities.CommandStats)
 	default:
 		return nil
 	}
@@ -190,9 +225,11 @@ var (
 	ScenarioErrUnknownResponse           MockScenario = "unknownresponse"
 	ScenarioErrUnexpectedResponse        MockScenario = "unexpectedresponse"
 	ScenarioErrScanFileSizeLimitExceeded MockScenario = "scanfilesizelimitexceeded"
+	ScenarioErrUnsupportedCommand        MockScenario = "unsupportedcommand"
 
 	ScenarioStatsErrMarshall           MockScenario = "statserrmarshall"
 	ScenarioVersionCommandsErrMarshall MockScenario = "versioncommandserrmarshall"
 
-	ScenarioErrVirusFound MockScenario = "virusfound"
+	ScenarioErrVirusFound  MockScenario = "virusfound"
+	ScenarioHeuristicFound MockScenario = "heuristicfound"
 )
@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/pkg/signing"
+	"github.com/rs/zerolog/hlog"
+)
+
+var (
+	// ErrSignatureRequired indicates the request carries no signature.
+	ErrSignatureRequired = errors.New("request signature required")
+	// ErrSignatureIncomplete indicates some of the signature headers are missing.
+	ErrSignatureIncomplete = errors.New("incomplete request signature")
+	// ErrSignatureInvalid indicates the signature or the key identifier is not valid.
+	ErrSignatureInvalid = errors.New("invalid request signature")
+	// ErrSignatureExpired indicates the signature timestamp is outside of the allowed clock skew.
+	ErrSignatureExpired = errors.New("request signature expired")
+	// ErrSignatureReplayed indicates the signature nonce has already been used.
+	ErrSignatureReplayed = errors.New("request signature replayed")
+	// ErrBodyDigestMismatch indicates the request body does not match the signed digest.
+	ErrBodyDigestMismatch = errors.New("request body digest mismatch")
+)
+
+// HMACVerifier verifies HMAC-SHA256 signed requests.
+// See the pkg/signing package for a description of the scheme.
+type HMACVerifier struct {
+	keys    map[string][]byte
+	maxSkew time.Duration
+	nonces  *nonceCache
+	now     func() time.Time
+}
+
+// NewHMACVerifier creates a new HMACVerifier accepting signatures made with
+// any of the given secrets, indexed by key identifier.
+// maxSkew is the maximum allowed difference between the signature
+// timestamp and the server clock.
+func NewHMACVerifier(keys map[string]string, maxSkew time.Duration) *HMACVerifier {
+	k := make(map[string][]byte, len(keys))
+	for id, secret := range keys {
+		k[id] = []byte(secret)
+	}
+
+	return &HMACVerifier{
+		keys:    k,
+		maxSkew: maxSkew,
+		// A nonce must be remembered as long as its timestamp is acceptable,
+		// ie. for the whole [-maxSkew, +maxSkew] window.
+		nonces: newNonceCache(2 * maxSkew),
+		now:    time.Now,
+	}
+}
+
+// Verify checks the signature headers of r and returns the key identifier
+// of the principal who signed it.
+// It does not verify the request body digest.
+func (v *HMACVerifier) Verify(r *http.Request) (string, error) {
+	sig := r.Header.Get(signing.HeaderSignature)
+	if sig == "" {
+		return "", ErrSignatureRequired
+	}
+
+	keyID := r.Header.Get(signing.HeaderKeyID)
+	ts := r.Header.Get(signing.HeaderTimestamp)
+	nonce := r.Header.Get(signing.HeaderNonce)
+	digest := r.Header.Get(signing.HeaderContentSHA256)
+	if keyID == "" || ts == "" || nonce == "" || digest == "" {
+		return "", ErrSignatureIncomplete
+	}
+
+	secret, ok := v.keys[keyID]
+	if !ok {
+		return "", ErrSignatureInvalid
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", ErrSignatureInvalid
+	}
+	now := v.now()
+	if skew := now.Sub(time.Unix(unix, 0)).Abs(); skew > v.maxSkew {
+		return "", ErrSignatureExpired
+	}
+
+	expected := signing.Sign(secret, signing.StringToSign(r.Method, r.URL.RequestURI(), ts, nonce, digest))
+	if !constantTimeEquals(strings.ToLower(sig), expected) {
+		return "", ErrSignatureInvalid
+	}
+
+	// Only record the nonce once the signature is known to be valid,
+	// so that unauthenticated clients can't fill the cache.
+	if !v.nonces.add(keyID+":"+nonce, now) {
+		return "", ErrSignatureReplayed
+	}
+
+	return keyID, nil
+}
+
+// HMACAuth returns a middleware that validates HMAC-SHA256 request signatures.
+//
+// Because the signature covers a digest of the body, the body is spooled to
+// a temporary file and verified before the next handler is called.
+func HMACAuth(v *HMACVerifier) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Get request ID for logging
+			reqID, _ := hlog.IDFromCtx(r.Context())
+			logger := hlog.FromRequest(r)
+
+			keyID, err := v.Verify(r)
+			if err != nil {
+				logger.Warn().Str("req_id", reqID.String()).
+					Str("client_ip", r.RemoteAddr).
+					Str("user_agent", r.UserAgent()).
+					Str("key_id", r.Header.Get(signing.HeaderKeyID)).
+					Err(err).
+					Msg("HMAC signature authentication failed")
+
+				writeAuthErrorResponse(w, r, signing.Algorithm, capitalize(err.Error()))
+				return
+			}
+
+			body, err := verifyBodyDigest(r, r.Header.Get(signing.HeaderContentSHA256))
+			if err != nil {
+				logger.Warn().Str("req_id", reqID.String()).
+					Str("client_ip", r.RemoteAddr).
+					Str("key_id", keyID).
+					Err(err).
+					Msg("HMAC signature authentication failed")
+
+				if errors.Is(err, ErrBodyDigestMismatch) {
+					writeAuthErrorResponse(w, r, signing.Algorithm, capitalize(err.Error()))
+				} else {
+					SetErrorResponse(w, r, err)
+				}
+				return
+			}
+			defer func() { _ = body.Close() }()
+
+			logger.Debug().Str("req_id", reqID.String()).
+				Str("key_id", keyID).
+				Msg("HMAC signature authentication successful")
+
+			r.Body = body
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), keyID)))
+		})
+	}
+}
+
+// ConditionalHMACAuth returns a middleware that applies HMAC signature authentication
+// to non-public endpoints. Requests which don't carry a signature are handed over
+// to fallback (typically the API key authentication) when it is not nil, and
+// rejected otherwise.
+func ConditionalHMACAuth(v *HMACVerifier, fallback func(next http.Handler) http.Handler) func(next http.Handler) http.Handler {
+	hmacMiddleware := HMACAuth(v)
+
+	return func(next http.Handler) http.Handler {
+		signed := hmacMiddleware(next)
+		var unsigned http.Handler
+		if fallback != nil {
+			unsigned = fallback(next)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Check if this is a public endpoint
+			if IsPublicEndpoint(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Header.Get(signing.HeaderSignature) == "" && unsigned != nil {
+				unsigned.ServeHTTP(w, r)
+				return
+			}
+
+			signed.ServeHTTP(w, r)
+		})
+	}
+}
+
+// verifyBodyDigest reads the request body into a temporary file while hashing it
+// and compares the result with the expected hex-encoded SHA-256 digest.
+// On success, it returns a reader positioned at the beginning of the body
+// which removes the temporary file once closed.
+func verifyBodyDigest(r *http.Request, expected string) (io.ReadCloser, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		if !constantTimeEquals(strings.ToLower(expected), signing.EmptyBodyDigest) {
+			return nil, ErrBodyDigestMismatch
+		}
+		return http.NoBody, nil
+	}
+
+	f, err := os.CreateTemp("", "clamav-api-body-*")
+	if err != nil {
+		return nil, fmt.Errorf("error while creating temporary file: %w", err)
+	}
+	body := &tempFileBody{File: f}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r.Body); err != nil {
+		_ = body.Close()
+		return nil, fmt.Errorf("error while reading request body: %w", err)
+	}
+
+	if !constantTimeEquals(strings.ToLower(expected), hex.EncodeToString(h.Sum(nil))) {
+		_ = body.Close()
+		return nil, ErrBodyDigestMismatch
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = body.Close()
+		return nil, fmt.Errorf("error while rewinding request body: %w", err)
+	}
+
+	return body, nil
+}
+
+// tempFileBody is a request body backed by a temporary file,
+// removed when the body is closed.
+type tempFileBody struct {
+	*os.File
+	once sync.Once
+}
+
+// Close closes and removes the underlying temporary file.
+func (b *tempFileBody) Close() error {
+	var err error
+	b.once.Do(func() {
+		err = b.File.Close()
+		_ = os.Remove(b.Name())
+	})
+	return err
+}
+
+// nonceCache remembers the nonces seen during the last ttl.
+type nonceCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newNonceCache(ttl time.Duration) *nonceCache {
+	return &nonceCache{
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+	}
+}
+
+// add records nonce as seen at now.
+// It returns false if the nonce was already seen during the last ttl.
+func (c *nonceCache) add(nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Expired nonces are pruned at most once per ttl
+	if now.Sub(c.lastPrune) > c.ttl {
+		for n, t := range c.seen {
+			if now.Sub(t) > c.ttl {
+				delete(c.seen, n)
+			}
+		}
+		c.lastPrune = now
+	}
+
+	if t, ok := c.seen[nonce]; ok && now.Sub(t) <= c.ttl {
+		return false
+	}
+	c.seen[nonce] = now
+	return true
+}
+
+// capitalize upper-cases the first letter of s.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
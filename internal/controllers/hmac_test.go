@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/pkg/signing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSignedRequest(t *testing.T, method, target, body, keyID, secret string, now time.Time) *http.Request {
+	t.Helper()
+
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	logger := zerolog.New(io.Discard)
+	req = req.WithContext(logger.WithContext(context.Background()))
+
+	s := signing.NewSigner(keyID, []byte(secret))
+	s.Now = func() time.Time { return now }
+	if err := s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestHMACAuth(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	keys := map[string]string{"client-a": "secret-a", "client-b": "secret-b"}
+
+	tests := []struct {
+		name           string
+		req            func(t *testing.T) *http.Request
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "valid signature without body",
+			req: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, http.MethodGet, "/rest/v1/version", "", "client-a", "secret-a", now)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "client-a:",
+		},
+		{
+			name: "valid signature with body",
+			req: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, http.MethodPost, "/rest/v1/scan", "foobar", "client-b", "secret-b", now)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "client-b:foobar",
+		},
+		{
+			name: "missing signature",
+			req: func(t *testing.T) *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/rest/v1/version", nil)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"error","msg":"Request signature required"}`,
+		},
+		{
+			name: "incomplete signature",
+			req: func(t *testing.T) *http.Request {
+				req := newSignedRequest(t, http.MethodGet, "/rest/v1/version", "", "client-a", "secret-a", now)
+				req.Header.Del(signing.HeaderNonce)
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"error","msg":"Incomplete request signature"}`,
+		},
+		{
+			name: "unknown key id",
+			req: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, http.MethodGet, "/rest/v1/version", "", "client-c", "secret-a", now)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"error","msg":"Invalid request signature"}`,
+		},
+		{
+			name: "wrong secret",
+			req: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, http.MethodGet, "/rest/v1/version", "", "client-a", "secret-b", now)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"error","msg":"Invalid request signature"}`,
+		},
+		{
+			name: "tampered path",
+			req: func(t *testing.T) *http.Request {
+				req := newSignedRequest(t, http.MethodGet, "/rest/v1/version", "", "client-a", "secret-a", now)
+				req.URL.Path = "/rest/v1/stats"
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"error","msg":"Invalid request signature"}`,
+		},
+		{
+			name: "timestamp too old",
+			req: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, http.MethodGet, "/rest/v1/version", "", "client-a", "secret-a", now.Add(-10*time.Minute))
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"error","msg":"Request signature expired"}`,
+		},
+		{
+			name: "timestamp in the future",
+			req: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, http.MethodGet, "/rest/v1/version", "", "client-a", "secret-a", now.Add(10*time.Minute))
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"error","msg":"Request signature expired"}`,
+		},
+		{
+			name: "tampered body",
+			req: func(t *testing.T) *http.Request {
+				req := newSignedRequest(t, http.MethodPost, "/rest/v1/scan", "foobar", "client-a", "secret-a", now)
+				req.Body = io.NopCloser(strings.NewReader("barfoo"))
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"status":"error","msg":"Request body digest mismatch"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(PrincipalFromContext(r.Context()) + ":" + string(body)))
+			})
+
+			v := NewHMACVerifier(keys, 5*time.Minute)
+			v.now = func() time.Time { return now }
+			wrappedHandler := HMACAuth(v)(handler)
+
+			rr := httptest.NewRecorder()
+			wrappedHandler.ServeHTTP(rr, tt.req(t))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedBody, rr.Body.String())
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+				assert.Equal(t, signing.Algorithm, rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestHMACAuthReplay(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := NewHMACVerifier(map[string]string{"client-a": "secret-a"}, 5*time.Minute)
+	v.now = func() time.Time { return now }
+
+	handler := HMACAuth(v)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := newSignedRequest(t, http.MethodGet, "/rest/v1/version", "", "client-a", "secret-a", now)
+	replay := req.Clone(req.Context())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, replay)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"Request signature replayed"}`, rr.Body.String())
+}
+
+func TestConditionalHMACAuth(t *testing.T) {
+	now := time.Now()
+	v := NewHMACVerifier(map[string]string{"client-a": "secret-a"}, 5*time.Minute)
+
+	tests := []struct {
+		name           string
+		fallback       func(next http.Handler) http.Handler
+		req            func(t *testing.T) *http.Request
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "public endpoint without credentials",
+			req: func(t *testing.T) *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/rest/v1/ping", nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   PrincipalAnonymous,
+		},
+		{
+			name: "signed request",
+			req: func(t *testing.T) *http.Request {
+				return newSignedRequest(t, http.MethodGet, "/rest/v1/version", "", "client-a", "secret-a", now)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "client-a",
+		},
+		{
+			name: "unsigned request without fallback",
+			req: func(t *testing.T) *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/rest/v1/version", nil)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:     "unsigned request with valid api key fallback",
+			fallback: APIKeyAuth("secret123", "X-API-Key"),
+			req: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/rest/v1/version", nil)
+				req.Header.Set("X-API-Key", "secret123")
+				return req
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   PrincipalAPIKey,
+		},
+		{
+			name:     "unsigned request with invalid api key fallback",
+			fallback: APIKeyAuth("secret123", "X-API-Key"),
+			req: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/rest/v1/version", nil)
+				req.Header.Set("X-API-Key", "wrong-key")
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:     "invalid signature doesn't fall back to api key",
+			fallback: APIKeyAuth("secret123", "X-API-Key"),
+			req: func(t *testing.T) *http.Request {
+				req := newSignedRequest(t, http.MethodGet, "/rest/v1/version", "", "client-a", "wrong", now)
+				req.Header.Set("X-API-Key", "secret123")
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(PrincipalFromContext(r.Context())))
+			})
+
+			wrappedHandler := ConditionalHMACAuth(v, tt.fallback)(handler)
+
+			req := tt.req(t)
+			logger := zerolog.New(io.Discard)
+			req = req.WithContext(logger.WithContext(req.Context()))
+
+			rr := httptest.NewRecorder()
+			wrappedHandler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newNonceCache(time.Minute)
+
+	assert.True(t, c.add("a", now))
+	assert.False(t, c.add("a", now.Add(30*time.Second)))
+	assert.True(t, c.add("b", now.Add(30*time.Second)))
+
+	// Expired nonces can be reused and are pruned
+	assert.True(t, c.add("a", now.Add(2*time.Minute)))
+	assert.NotContains(t, c.seen, "b")
+}
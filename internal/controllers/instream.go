@@ -4,10 +4,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 
+	"github.com/lescactus/clamav-api-go/internal/audit"
 	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/lescactus/clamav-api-go/internal/heuristics"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/internal/reputation"
 	"github.com/rs/zerolog/hlog"
 )
 
@@ -17,8 +24,45 @@ type InStreamResponse struct {
 	Msg        string `json:"msg"`
 	Signature  string `json:"signature"`
 	VirusFound bool   `json:"virus_found"`
+
+	// QuarantineID identifies the quarantined copy of an infected file.
+	QuarantineID string `json:"quarantine_id,omitempty"`
+
+	// Heuristic is the archive heuristic reported by clamd, if any.
+	Heuristic *HeuristicResponse `json:"heuristic,omitempty"`
+
+	// Verdict is the verdict of the verdict policy: allow, warn or block.
+	// Empty if no verdict policy is configured.
+	Verdict string `json:"verdict,omitempty"`
+	// PolicyRule is the rule of the verdict policy which decided the verdict,
+	// empty if the default verdict applied.
+	PolicyRule string `json:"policy_rule,omitempty"`
+
+	// Reputation is the listing of the file by the hash lists, if listed.
+	// The verdict is then decided by the list, without a scan by clamd.
+	Reputation *ReputationResponse `json:"reputation,omitempty"`
+
+	// MIMEType is the type of the file detected from its content.
+	// Empty if file type detection is disabled.
+	MIMEType string `json:"mime_type,omitempty"`
+	// ExtensionMismatch is true if the extension of the file name
+	// isn't one of the usual extensions of the detected type.
+	ExtensionMismatch bool `json:"extension_mismatch,omitempty"`
+}
+
+// HeuristicResponse describes an archive heuristic reported by clamd,
+// such as an encrypted archive or a scan limit exceeded.
+type HeuristicResponse struct {
+	Category  string `json:"category"`
+	Signature string `json:"signature"`
+	// Verdict is how the heuristic is reported, according to the
+	// archive heuristics policy: infected, suspicious or clean.
+	Verdict string `json:"verdict"`
 }
 
+// MsgSuspicious is the message of the responses to suspicious files.
+const MsgSuspicious = "file is suspicious"
+
 var (
 	// ErrFormFile indicates failure to parse file from form data.
 	ErrFormFile = errors.New("failed to parse file")
@@ -37,7 +81,7 @@ func (h *Handler) InStream(w http.ResponseWriter, r *http.Request) {
 		e := fmt.Errorf("%w: %w", ErrFormFile, err)
 		h.Logger.Debug().Str("req_id", reqID.String()).Msgf("%v", e)
 
-		SetErrorResponse(w, e)
+		SetErrorResponse(w, r, e)
 		return
 	}
 
@@ -46,7 +90,7 @@ func (h *Handler) InStream(w http.ResponseWriter, r *http.Request) {
 		e := fmt.Errorf("%w: %w", ErrOpenFileHeaders, err)
 		h.Logger.Debug().Str("req_id", reqID.String()).Msgf("%v", e)
 
-		SetErrorResponse(w, e)
+		SetErrorResponse(w, r, e)
 		return
 	}
 
@@ -64,24 +108,54 @@ func (h *Handler) InStream(w http.ResponseWriter, r *http.Request) {
 		Int64("file_size", hd.Size).
 		Msg("multipart file read successfully")
 
+	rec := audit.Record{
+		Action:   audit.ActionScan,
+		FileName: hd.Filename,
+		FileSize: hd.Size,
+	}
+
+	// The digests of the file are only needed by the audit log and the hash lists
+	var hashes reputation.Hashes
+	if h.Reputation != nil {
+		hashes, err = reputationSum(f)
+		rec.SHA256 = hashes.SHA256
+	} else if h.Audit != nil {
+		rec.SHA256, err = sha256Sum(f)
+	}
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Err(err).Msg("error while hashing file")
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	fileType, body, err := h.detectType(r, f, hd.Filename)
+	if err != nil {
+		h.rejectType(w, r, rec, err)
+		return
+	}
+
 	var inStreamResp InStreamResponse
 	var ctx = r.Context()
 
-	inStream, err := h.Clamav.InStream(ctx, f, size)
-	if err != nil {
+	// Files listed by the hash lists aren't sent to clamd
+	if listed, ok := h.lookupReputation(r, hashes); ok {
+		inStreamResp = listed
+		rec.Verdict, rec.Signature = inStreamResp.AuditVerdict()
+	} else if inStream, err := h.Clamav.InStream(ctx, body, size); err != nil {
 		if errors.Is(err, clamav.ErrVirusFound) {
 			h.Logger.Debug().Str("req_id", reqID.String()).Msg(err.Error())
 
-			inStreamResp = InStreamResponse{
-				Status:     "error",
-				Msg:        clamav.ErrVirusFound.Error(),
-				Signature:  h.parseSignature(string(inStream)),
-				VirusFound: true,
-			}
+			inStreamResp = h.foundResponse(inStream)
+			rec.Verdict, rec.Signature = inStreamResp.AuditVerdict()
 		} else {
 			h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("error while scanning file")
 
-			SetErrorResponse(w, err)
+			rec.Verdict = audit.VerdictError
+			rec.Error = err.Error()
+			h.auditLog(r, rec)
+
+			SetErrorResponse(w, r, err)
 			return
 		}
 	} else {
@@ -91,8 +165,19 @@ func (h *Handler) InStream(w http.ResponseWriter, r *http.Request) {
 			Signature:  "",
 			VirusFound: false,
 		}
+		rec.Verdict = audit.VerdictClean
 	}
 
+	inStreamResp.setType(fileType)
+	h.applyPolicy(r, &inStreamResp, hd.Filename, fileType.Type, &rec)
+
+	// Files the verdict policy allows aren't worth quarantining
+	if h.Quarantine != nil && inStreamResp.VirusFound && inStreamResp.Verdict != string(policy.ActionAllow) {
+		inStreamResp.QuarantineID = h.quarantine(r, f, hd.Filename, inStreamResp.Signature)
+	}
+
+	h.auditLog(r, rec)
+
 	h.Logger.Debug().Str("req_id", reqID.String()).Msg("file scanned successfully")
 
 	resp, err := json.Marshal(inStreamResp)
@@ -108,11 +193,196 @@ func (h *Handler) InStream(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// quarantine stores the infected file f and returns the id of the quarantined item.
+// The scan result is returned regardless of the outcome, so failures are only logged.
+func (h *Handler) quarantine(r *http.Request, f io.ReadSeeker, filename, signature string) string {
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Err(err).Msg("error while rewinding file to quarantine")
+		return ""
+	}
+
+	item, err := h.Quarantine.Put(f, quarantine.Item{
+		FileName:  filename,
+		Signature: signature,
+		Principal: PrincipalFromContext(r.Context()),
+		ClientIP:  ClientIP(r),
+		RequestID: reqID.String(),
+	})
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Err(err).Msg("error while quarantining file")
+		return ""
+	}
+
+	h.Logger.Info().
+		Str("req_id", reqID.String()).
+		Str("quarantine_id", item.ID).
+		Str("sha256", item.SHA256).
+		Msg("infected file quarantined")
+
+	return item.ID
+}
+
+// foundResponse returns the response to a scan clamd reported as infected,
+// reply being the reply of clamd.
+func (h *Handler) foundResponse(reply []byte) InStreamResponse {
+	return FoundResponse(h.HeuristicsPolicy, reply)
+}
+
+// FoundResponse returns the response to a scan clamd reported as infected,
+// reply being the reply of clamd. Archive heuristics are reported according
+// to the policy p.
+func FoundResponse(p heuristics.Policy, reply []byte) InStreamResponse {
+	signature := ParseSignature(string(reply))
+
+	d, ok := p.Detect(signature)
+	if !ok {
+		return InStreamResponse{
+			Status:     "error",
+			Msg:        clamav.ErrVirusFound.Error(),
+			Signature:  signature,
+			VirusFound: true,
+		}
+	}
+
+	heuristic := &HeuristicResponse{Category: string(d.Category), Signature: d.Signature, Verdict: string(d.Verdict)}
+	switch d.Verdict {
+	case heuristics.VerdictClean:
+		return InStreamResponse{Status: "noerror", Msg: string(clamav.RespScan), Heuristic: heuristic}
+	case heuristics.VerdictSuspicious:
+		return InStreamResponse{Status: "noerror", Msg: MsgSuspicious, Heuristic: heuristic}
+	default:
+		return InStreamResponse{
+			Status:     "error",
+			Msg:        clamav.ErrVirusFound.Error(),
+			Signature:  signature,
+			VirusFound: true,
+			Heuristic:  heuristic,
+		}
+	}
+}
+
+// AuditVerdict returns the verdict and the signature of the audit record
+// of the scan r responds to.
+func (r InStreamResponse) AuditVerdict() (verdict, signature string) {
+	if r.Heuristic != nil {
+		switch heuristics.Verdict(r.Heuristic.Verdict) {
+		case heuristics.VerdictClean:
+			return audit.VerdictClean, r.Heuristic.Signature
+		case heuristics.VerdictSuspicious:
+			return audit.VerdictSuspicious, r.Heuristic.Signature
+		}
+	}
+	if r.VirusFound {
+		return audit.VerdictInfected, r.Signature
+	}
+	return audit.VerdictClean, ""
+}
+
+// detectType detects the type of the file filename from the first bytes of
+// body, if file type detection is enabled. It returns the reader to scan in
+// place of body. The error wraps filetype.ErrDenied if the type isn't allowed.
+func (h *Handler) detectType(r *http.Request, body io.Reader, filename string) (filetype.Result, io.Reader, error) {
+	if h.FileTypes == nil {
+		return filetype.Result{}, body, nil
+	}
+
+	res, body, err := h.FileTypes.Inspect(body, filename)
+	if err != nil {
+		return res, nil, err
+	}
+
+	reqID, _ := hlog.IDFromCtx(r.Context())
+	h.Logger.Debug().
+		Str("req_id", reqID.String()).
+		Str("file_name", filename).
+		Str("mime_type", res.MIME).
+		Bool("extension_mismatch", res.ExtensionMismatch).
+		Msg("file type detected")
+
+	return res, body, nil
+}
+
+// rejectType responds to the rejection of a file before its scan, because
+// its type isn't allowed or couldn't be read, and records it in the audit log.
+func (h *Handler) rejectType(w http.ResponseWriter, r *http.Request, rec audit.Record, err error) {
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	if errors.Is(err, filetype.ErrDenied) {
+		h.Logger.Info().Str("req_id", reqID.String()).Str("file_name", rec.FileName).Err(err).Msg("file rejected")
+		rec.Verdict = audit.VerdictRejected
+	} else {
+		h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("error while detecting file type")
+		rec.Verdict = audit.VerdictError
+	}
+	rec.Error = err.Error()
+	h.auditLog(r, rec)
+
+	SetErrorResponse(w, r, err)
+}
+
+// setType reports the detected type of the scanned file in r.
+func (r *InStreamResponse) setType(res filetype.Result) {
+	r.MIMEType = res.MIME
+	r.ExtensionMismatch = res.ExtensionMismatch
+}
+
+// applyPolicy decides the verdict of the scan of the file filename, of the
+// detected type fileType, resp responds to, and reports it in resp and in the
+// audit record rec. Nothing is decided if no verdict policy is configured.
+func (h *Handler) applyPolicy(r *http.Request, resp *InStreamResponse, filename string, fileType filetype.Type, rec *audit.Record) {
+	d, ok := ApplyPolicy(h.Policy, PrincipalFromContext(r.Context()), filename, fileType, resp)
+	if !ok {
+		return
+	}
+	rec.PolicyVerdict = string(d.Verdict)
+	rec.PolicyRule = d.Rule
+
+	reqID, _ := hlog.IDFromCtx(r.Context())
+	h.Logger.Info().
+		Str("req_id", reqID.String()).
+		Str("file_name", filename).
+		Str("signature", rec.Signature).
+		Str("policy", d.Policy).
+		Str("policy_rule", d.Rule).
+		Str("verdict", string(d.Verdict)).
+		Msg("verdict policy applied")
+}
+
+// ApplyPolicy decides the verdict of the scan of the file filename, of the
+// detected type fileType, resp responds to, performed on behalf of principal,
+// according to the policies e. fileType is the zero Type if not detected.
+// The verdict and the matched rule are reported in resp. It returns false,
+// deciding nothing, if e is nil.
+func ApplyPolicy(e *policy.Engine, principal, filename string, fileType filetype.Type, resp *InStreamResponse) (policy.Decision, bool) {
+	if e == nil {
+		return policy.Decision{}, false
+	}
+
+	// Archive heuristics reported as clean aren't detections
+	verdict, signature := resp.AuditVerdict()
+	if verdict == audit.VerdictClean {
+		signature = ""
+	}
+
+	d := e.Decide(principal, policy.Input{Signature: signature, FileName: filename, Type: fileType})
+	resp.Verdict = string(d.Verdict)
+	resp.PolicyRule = d.Rule
+	return d, true
+}
+
 // parseSignature will extract the name of the virus signature
 // from Clamd response when a potential virus is found.
+func (h *Handler) parseSignature(msg string) string {
+	return ParseSignature(msg)
+}
+
+// ParseSignature will extract the name of the virus signature
+// from Clamd response when a potential virus is found.
 //
 // An example of such response from the Clamd daemon is:
 // "stream: Eicar-Signature FOUND"
-func (h *Handler) parseSignature(msg string) string {
+func ParseSignature(msg string) string {
 	return strings.TrimLeft(strings.TrimRight(msg, " FOUND"), "stream: ")
 }
@@ -3,16 +3,26 @@ package controllers
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/lescactus/clamav-api-go/internal/audit"
 	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/lescactus/clamav-api-go/internal/heuristics"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/internal/reputation"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHandlerInStream(t *testing.T) {
@@ -114,7 +124,7 @@ func TestHandlerInStream(t *testing.T) {
 				filecontent: "",
 			},
 			want: want{
-				status: http.StatusInternalServerError,
+				status: http.StatusRequestEntityTooLarge,
 				body:   []byte(`{"status":"error","msg":"clamav: size limit exceeded"}`),
 			},
 		},
@@ -192,6 +202,277 @@ func TestHandlerInStream(t *testing.T) {
 	}
 }
 
+func TestHandlerInStreamHeuristics(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		wantBody   string
+		wantRecord audit.Record
+	}{
+		{
+			name:       "infected by default",
+			wantBody:   `{"status":"error","msg":"file contains potential virus","signature":"Heuristics.Encrypted.Zip","virus_found":true,"quarantine_id":"*","heuristic":{"category":"encrypted","signature":"Heuristics.Encrypted.Zip","verdict":"infected"}}`,
+			wantRecord: audit.Record{Verdict: audit.VerdictInfected, Signature: "Heuristics.Encrypted.Zip"},
+		},
+		{
+			name:       "suspicious",
+			policy:     "encrypted=suspicious",
+			wantBody:   `{"status":"noerror","msg":"file is suspicious","signature":"","virus_found":false,"heuristic":{"category":"encrypted","signature":"Heuristics.Encrypted.Zip","verdict":"suspicious"}}`,
+			wantRecord: audit.Record{Verdict: audit.VerdictSuspicious, Signature: "Heuristics.Encrypted.Zip"},
+		},
+		{
+			name:       "clean",
+			policy:     "clean",
+			wantBody:   `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"heuristic":{"category":"encrypted","signature":"Heuristics.Encrypted.Zip","verdict":"clean"}}`,
+			wantRecord: audit.Record{Verdict: audit.VerdictClean, Signature: "Heuristics.Encrypted.Zip"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, sink := newAuditedHandler(t)
+			policy, err := heuristics.ParsePolicy(tt.policy)
+			require.NoError(t, err)
+			h.HeuristicsPolicy = policy
+			store, err := quarantine.New(t.TempDir(), bytes.Repeat([]byte{1}, quarantine.KeySize), 0)
+			require.NoError(t, err)
+			h.Quarantine = store
+
+			resp := scanFile(t, h, ScenarioHeuristicFound, "secret.zip")
+
+			// Only infected files are quarantined
+			items, err := store.List()
+			require.NoError(t, err)
+			if resp.VirusFound {
+				require.Len(t, items, 1)
+				assert.Equal(t, items[0].ID, resp.QuarantineID)
+				resp.QuarantineID = "*"
+			} else {
+				assert.Empty(t, items)
+			}
+			b, err := json.Marshal(resp)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.wantBody, string(b))
+
+			rec := sink.lastRecord(t)
+			assert.Equal(t, tt.wantRecord.Verdict, rec.Verdict)
+			assert.Equal(t, tt.wantRecord.Signature, rec.Signature)
+		})
+	}
+}
+
+func TestHandlerInStreamPolicy(t *testing.T) {
+	engine, err := policy.Parse([]byte(`
+principals:
+  partner: strict
+policies:
+  default:
+    rules:
+      - name: allow-test
+        signatures: ["*.Test.*"]
+        action: allow
+  strict:
+    rules:
+      - name: block-executables
+        file_types: ["*.exe"]
+        action: block
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		principal   string
+		scenario    MockScenario
+		filename    string
+		wantVerdict string
+		wantRule    string
+		quarantined bool
+	}{
+		{name: "clean", scenario: ScenarioNoError, filename: "file.exe", wantVerdict: "allow"},
+		{name: "allowed detection", scenario: ScenarioErrVirusFound, filename: "eicar.com", wantVerdict: "allow", wantRule: "allow-test"},
+		{name: "blocked detection", principal: "partner", scenario: ScenarioErrVirusFound, filename: "eicar.com", wantVerdict: "block", quarantined: true},
+		{name: "blocked file type", principal: "partner", scenario: ScenarioNoError, filename: "setup.EXE", wantVerdict: "block", wantRule: "block-executables"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, sink := newAuditedHandler(t)
+			h.Policy = engine
+			store, err := quarantine.New(t.TempDir(), bytes.Repeat([]byte{1}, quarantine.KeySize), 0)
+			require.NoError(t, err)
+			h.Quarantine = store
+
+			b := &bytes.Buffer{}
+			writer := multipart.NewWriter(b)
+			part, _ := writer.CreateFormFile("file", tt.filename)
+			_, _ = part.Write([]byte("content"))
+			_ = writer.Close()
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.scenario)
+			if tt.principal != "" {
+				ctx = WithPrincipal(ctx, tt.principal)
+			}
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan", b)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.InStream).ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var resp InStreamResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantVerdict, resp.Verdict)
+			assert.Equal(t, tt.wantRule, resp.PolicyRule)
+			// The verdict policy doesn't change what clamd reported
+			assert.Equal(t, tt.scenario == ScenarioErrVirusFound, resp.VirusFound)
+			// Files the verdict policy allows aren't quarantined
+			assert.Equal(t, tt.quarantined, resp.QuarantineID != "")
+
+			rec := sink.lastRecord(t)
+			assert.Equal(t, tt.wantVerdict, rec.PolicyVerdict)
+			assert.Equal(t, tt.wantRule, rec.PolicyRule)
+		})
+	}
+}
+
+func TestHandlerInStreamFileType(t *testing.T) {
+	detector, err := filetype.New(filetype.Config{Deny: []string{"executable"}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		filename     string
+		content      string
+		wantStatus   int
+		wantMIME     string
+		wantMismatch bool
+		wantVerdict  string
+	}{
+		{name: "pdf", filename: "invoice.pdf", content: "%PDF-1.7\n", wantStatus: http.StatusOK, wantMIME: "application/pdf", wantVerdict: audit.VerdictClean},
+		{name: "mismatch", filename: "invoice.jpg", content: "%PDF-1.7\n", wantStatus: http.StatusOK, wantMIME: "application/pdf", wantMismatch: true, wantVerdict: audit.VerdictClean},
+		{name: "denied", filename: "invoice.pdf", content: "MZ\x90\x00\x03", wantStatus: http.StatusUnsupportedMediaType, wantVerdict: audit.VerdictRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, sink := newAuditedHandler(t)
+			h.FileTypes = detector
+
+			b := &bytes.Buffer{}
+			writer := multipart.NewWriter(b)
+			part, _ := writer.CreateFormFile("file", tt.filename)
+			_, _ = part.Write([]byte(tt.content))
+			_ = writer.Close()
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan", b)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			req.Header.Set("Accept", ContentTypeProblemJSON)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.InStream).ServeHTTP(rr, req)
+			require.Equal(t, tt.wantStatus, rr.Code)
+
+			if tt.wantStatus == http.StatusOK {
+				var resp InStreamResponse
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantMIME, resp.MIMEType)
+				assert.Equal(t, tt.wantMismatch, resp.ExtensionMismatch)
+			} else {
+				var p Problem
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+				assert.Equal(t, CodeFileTypeNotAllowed, p.Code)
+			}
+
+			rec := sink.lastRecord(t)
+			assert.Equal(t, tt.wantVerdict, rec.Verdict)
+		})
+	}
+}
+
+func TestHandlerInStreamPolicyFileType(t *testing.T) {
+	engine, err := policy.Parse([]byte(`
+policies:
+  default:
+    rules:
+      - name: block-executables
+        mime_types: ["executable"]
+        action: block
+`))
+	require.NoError(t, err)
+	detector, err := filetype.New(filetype.Config{})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		content     string
+		wantVerdict string
+		wantRule    string
+	}{
+		{name: "pdf", content: "%PDF-1.7\n", wantVerdict: "allow"},
+		{name: "executable named as a pdf", content: "MZ\x90\x00\x03", wantVerdict: "block", wantRule: "block-executables"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, sink := newAuditedHandler(t)
+			h.Policy = engine
+			h.FileTypes = detector
+
+			b := &bytes.Buffer{}
+			writer := multipart.NewWriter(b)
+			part, _ := writer.CreateFormFile("file", "invoice.pdf")
+			_, _ = part.Write([]byte(tt.content))
+			_ = writer.Close()
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan", b)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.InStream).ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var resp InStreamResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantVerdict, resp.Verdict)
+			assert.Equal(t, tt.wantRule, resp.PolicyRule)
+
+			rec := sink.lastRecord(t)
+			assert.Equal(t, tt.wantVerdict, rec.PolicyVerdict)
+			assert.Equal(t, tt.wantRule, rec.PolicyRule)
+		})
+	}
+}
+
+func TestHandlerInStreamReputation(t *testing.T) {
+	dir := t.TempDir()
+	deny := filepath.Join(dir, "deny.txt")
+	allow := filepath.Join(dir, "allow.txt")
+	// MD5 of "bad" and SHA-256 of "good"
+	require.NoError(t, os.WriteFile(deny, []byte("bae60998ffe4923b131e3d6e4c19993e Win.Trojan.Bad\n"), 0o600))
+	require.NoError(t, os.WriteFile(allow, []byte("770e607624d689265ca6c44884d0807d9b054d23c473c106c72be9de08b7376c\n"), 0o600))
+	store, err := reputation.Load(reputation.Config{AllowFiles: []string{allow}, DenyFiles: []string{deny}})
+	require.NoError(t, err)
+
+	h, sink := newAuditedHandler(t)
+	h.Reputation = store
+
+	// Listed files aren't sent to clamd, which is unreachable here
+	resp := scanFile(t, h, ScenarioNetError, "bad")
+	assert.True(t, resp.VirusFound)
+	assert.Equal(t, "Win.Trojan.Bad", resp.Signature)
+	assert.Equal(t, &ReputationResponse{List: "deny", Source: "deny.txt", Hash: "md5:bae60998ffe4923b131e3d6e4c19993e", Name: "Win.Trojan.Bad"}, resp.Reputation)
+	rec := sink.lastRecord(t)
+	assert.Equal(t, audit.VerdictInfected, rec.Verdict)
+	assert.Equal(t, "Win.Trojan.Bad", rec.Signature)
+
+	resp = scanFile(t, h, ScenarioNetError, "good")
+	assert.False(t, resp.VirusFound)
+	assert.Equal(t, "noerror", resp.Status)
+	assert.Equal(t, "allow", resp.Reputation.List)
+	assert.Equal(t, "allow.txt", resp.Reputation.Source)
+	assert.Equal(t, audit.VerdictClean, sink.lastRecord(t).Verdict)
+
+	// Unlisted files are scanned
+	resp = scanFile(t, h, ScenarioErrVirusFound, "other")
+	assert.True(t, resp.VirusFound)
+	assert.Nil(t, resp.Reputation)
+}
+
 func TestHandlerParseSignature(t *testing.T) {
 	type fields struct {
 		Clamav clamav.Clamaver
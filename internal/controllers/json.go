@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/lescactus/clamav-api-go/internal/jsonfile"
+	"github.com/rs/zerolog/hlog"
+)
+
+// JSONScanRequest represents a file of the json request of the /scan/json
+// endpoint. The request is either a file or an array of files.
+type JSONScanRequest struct {
+	FileName      string `json:"filename,omitempty"`
+	ContentBase64 string `json:"content_base64"`
+}
+
+// JSONScanResponse represents the json response of the /scan/json endpoint
+// for a file. The response is an array when the request is.
+type JSONScanResponse struct {
+	InStreamResponse
+
+	FileName string `json:"filename"`
+}
+
+// ScanJSON handles the scan of files sent base64-encoded in a json body.
+// The content is decoded and streamed to clamd as the body is read.
+func (h *Handler) ScanJSON(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	dec := jsonfile.NewDecoder(r.Body)
+
+	var results []JSONScanResponse
+	for {
+		var resp JSONScanResponse
+		var scanned bool
+		digest := sha256.New()
+
+		var fileType filetype.Result
+		file, err := dec.Next(func(content io.Reader) error {
+			scanned = true
+
+			// The file name may come after the content
+			var body io.Reader
+			var err error
+			fileType, body, err = h.detectType(r, io.TeeReader(content, digest), "")
+			if err != nil {
+				return err
+			}
+
+			inStream, err := h.Clamav.InStream(r.Context(), body, -1)
+			switch {
+			case errors.Is(err, clamav.ErrVirusFound):
+				resp.InStreamResponse = h.foundResponse(inStream)
+			case err != nil:
+				return err
+			default:
+				resp.InStreamResponse = InStreamResponse{
+					Status:     "noerror",
+					Msg:        string(clamav.RespScan),
+					Signature:  "",
+					VirusFound: false,
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if errors.Is(err, jsonfile.ErrInvalid) {
+				err = fmt.Errorf("%w: %w", ErrInvalidBody, err)
+			}
+			h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("error while scanning json file")
+
+			if scanned {
+				verdict := audit.VerdictError
+				if errors.Is(err, filetype.ErrDenied) {
+					verdict = audit.VerdictRejected
+				}
+				h.auditLog(r, audit.Record{
+					Action:   audit.ActionScan,
+					FileName: file.FileName,
+					FileSize: file.Size,
+					Verdict:  verdict,
+					Error:    err.Error(),
+				})
+			}
+
+			SetErrorResponse(w, r, err)
+			return
+		}
+
+		resp.FileName = file.FileName
+		if h.FileTypes != nil {
+			fileType.ExtensionMismatch = filetype.Mismatch(fileType.Type, file.FileName)
+			resp.setType(fileType)
+		}
+
+		rec := audit.Record{
+			Action:   audit.ActionScan,
+			FileName: file.FileName,
+			FileSize: file.Size,
+			SHA256:   hex.EncodeToString(digest.Sum(nil)),
+		}
+		rec.Verdict, rec.Signature = resp.AuditVerdict()
+		h.applyPolicy(r, &resp.InStreamResponse, file.FileName, fileType.Type, &rec)
+		h.auditLog(r, rec)
+
+		h.Logger.Debug().
+			Str("req_id", reqID.String()).
+			Str("file_name", file.FileName).
+			Int64("file_size", file.Size).
+			Bool("virus_found", resp.VirusFound).
+			Msg("json file scanned successfully")
+
+		results = append(results, resp)
+	}
+
+	if dec.Batch() {
+		h.writeJSON(w, r, results)
+		return
+	}
+	h.writeJSON(w, r, results[0])
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerScanJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		scenario   MockScenario
+		body       string
+		maxSize    int64
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "clean",
+			scenario:   ScenarioNoError,
+			body:       `{"filename":"file.txt","content_base64":"Zm9vYmFy"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"filename":"file.txt"}`,
+		},
+		{
+			name:       "infected",
+			scenario:   ScenarioErrVirusFound,
+			body:       `{"filename":"eicar.com","content_base64":"Zm9vYmFy"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"filename":"eicar.com"}`,
+		},
+		{
+			name:       "array",
+			scenario:   ScenarioNoError,
+			body:       `[{"filename":"a.txt","content_base64":"Zm9v"},{"filename":"b.txt","content_base64":"YmFy"}]`,
+			wantStatus: http.StatusOK,
+			wantBody: `[{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"filename":"a.txt"},` +
+				`{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"filename":"b.txt"}]`,
+		},
+		{
+			name:       "invalid json",
+			scenario:   ScenarioNoError,
+			body:       `{"filename":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing content",
+			scenario:   ScenarioNoError,
+			body:       `{"filename":"file.txt"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"status":"error","msg":"bad request: invalid request body: invalid json file: missing field \"content_base64\""}`,
+		},
+		{
+			name:       "invalid base64",
+			scenario:   ScenarioNoError,
+			body:       `{"filename":"file.txt","content_base64":"Zm9v!mFy"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "request too large",
+			scenario:   ScenarioNoError,
+			body:       `{"filename":"file.txt","content_base64":"` + strings.Repeat("Zm9v", 100) + `"}`,
+			maxSize:    64,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "clamd error",
+			scenario:   ScenarioNetError,
+			body:       `{"filename":"file.txt","content_base64":"Zm9vYmFy"}`,
+			wantStatus: http.StatusBadGateway,
+			wantBody:   `{"status":"error","msg":"something wrong happened while communicating with clamav"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.New(io.Discard)
+			h := NewHandler(&logger, &MockClamav{})
+
+			var handler http.Handler = http.HandlerFunc(h.ScanJSON)
+			if tt.maxSize > 0 {
+				handler = MaxReqSize(tt.maxSize)(handler)
+			}
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.scenario)
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/json", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuditScanJSON(t *testing.T) {
+	h, sink := newAuditedHandler(t)
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioErrVirusFound)
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/json",
+		strings.NewReader(`[{"filename":"a.txt","content_base64":"Zm9v"},{"filename":"eicar.com","content_base64":"Zm9vYmFy"}]`))
+	h.ScanJSON(httptest.NewRecorder(), req)
+
+	// Every file is audited
+	lines := strings.Split(strings.TrimRight(sink.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	var rec audit.Record
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	assert.Equal(t, "a.txt", rec.FileName)
+	assert.Equal(t, int64(3), rec.FileSize)
+
+	rec = sink.lastRecord(t)
+	assert.Equal(t, audit.ActionScan, rec.Action)
+	assert.Equal(t, "eicar.com", rec.FileName)
+	assert.Equal(t, int64(6), rec.FileSize)
+	assert.Equal(t, audit.VerdictInfected, rec.Verdict)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", rec.Signature)
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/mirror"
+	"github.com/rs/zerolog/hlog"
+)
+
+// MirrorPath is the path the virus databases of the mirror are served on,
+// configured as the PrivateMirror of freshclam. It's public: freshclam
+// can't authenticate.
+const MirrorPath = "/mirror/"
+
+// MirrorListResponse represents the json response of the list of the files
+// of the mirror.
+type MirrorListResponse struct {
+	Items []mirror.File `json:"items"`
+}
+
+// MirrorFile handles requests to download a file of the mirror. The
+// conditional (If-None-Match, If-Modified-Since) and range requests of
+// freshclam are supported.
+func (h *Handler) MirrorFile(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName("file")
+	f, file, err := h.Mirror.Open(name)
+	if err != nil {
+		if errors.Is(err, mirror.ErrNotFound) {
+			h.Logger.Debug().Str("req_id", reqID.String()).Str("file", name).Msg("mirror file not found")
+
+			SetErrorResponse(w, r, err)
+			return
+		}
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while opening mirror file: %v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("ETag", file.ETag)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	// Caches must revalidate: the databases are replaced under the same name
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, file.Name, file.ModifiedAt, f)
+}
+
+// MirrorList handles requests to list the files of the mirror.
+func (h *Handler) MirrorList(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	items, err := h.Mirror.List()
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while listing mirror files: %v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, MirrorListResponse{Items: items})
+}
+
+// MirrorUpload handles requests to import a .cvd or .cdiff file into the
+// mirror, replacing the file of the same name. The file is streamed from the
+// multipart body into the mirror, without being buffered.
+func (h *Handler) MirrorUpload(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	part, err := mirrorFilePart(r)
+	if err != nil {
+		e := fmt.Errorf("%w: %w", ErrFormFile, err)
+		h.Logger.Debug().Str("req_id", reqID.String()).Msgf("%v", e)
+
+		SetErrorResponse(w, r, e)
+		return
+	}
+	defer part.Close()
+
+	name := filepath.Base(part.FileName())
+	counter := &countingReader{r: part}
+	file, err := h.Mirror.Put(name, counter)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Str("file", name).Err(err).Msg("error while importing mirror file")
+		if !errors.Is(err, mirror.ErrInvalid) {
+			h.auditLog(r, audit.Record{Action: audit.ActionMirrorUpload, FileName: name, FileSize: counter.n, Verdict: audit.VerdictFailure, Error: err.Error()})
+		}
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.auditLog(r, audit.Record{
+		Action:   audit.ActionMirrorUpload,
+		FileName: file.Name,
+		FileSize: file.Size,
+		SHA256:   file.SHA256,
+		Verdict:  audit.VerdictSuccess,
+	})
+
+	h.Logger.Info().
+		Str("req_id", reqID.String()).
+		Str("file", file.Name).
+		Int("version", file.Version).
+		Msg("mirror file imported")
+
+	h.writeJSON(w, r, file)
+}
+
+// mirrorFilePart returns the part of the multipart body of r holding the
+// file to import, the "file" field, skipping the parts before it.
+func mirrorFilePart(r *http.Request) (*multipart.Part, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/databases"
+	"github.com/lescactus/clamav-api-go/internal/mirror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCVD returns a CVD file of the given version.
+func testCVD(version int) string {
+	sum := md5.Sum([]byte("signatures"))
+	header := "ClamAV-VDB:06 Jul 2023 07-29 +0000:" + strconv.Itoa(version) + ":2038531:90:" + hex.EncodeToString(sum[:]) + ":dsig:raynman:1688628578"
+	return header + strings.Repeat(" ", databases.HeaderSize-len(header)) + "signatures"
+}
+
+// testCDiff returns a CDIFF file of script.
+func testCDiff(script string) string {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	_, _ = zw.Write([]byte(script))
+	_ = zw.Close()
+	return b.String()
+}
+
+// newMirrorHandler returns an audited handler serving the mirror of a
+// temporary directory.
+func newMirrorHandler(t *testing.T) (*Handler, *auditSink) {
+	t.Helper()
+	h, sink := newAuditedHandler(t)
+	store, err := mirror.New(t.TempDir())
+	require.NoError(t, err)
+	h.Mirror = store
+	return h, sink
+}
+
+// newMirrorBody returns a multipart body uploading content as the file name.
+func newMirrorBody(name, content string) (*bytes.Buffer, string) {
+	b := &bytes.Buffer{}
+	writer := multipart.NewWriter(b)
+	part, _ := writer.CreateFormFile("file", name)
+	_, _ = part.Write([]byte(content))
+	_ = writer.Close()
+	return b, writer.FormDataContentType()
+}
+
+// serveMirror serves req with the routes of the mirror.
+func serveMirror(h *Handler, req *http.Request) *httptest.ResponseRecorder {
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodGet, MirrorPath+":file", h.MirrorFile)
+	router.HandlerFunc(http.MethodGet, "/rest/v1/mirror", h.MirrorList)
+	router.HandlerFunc(http.MethodPost, "/rest/v1/mirror", h.MirrorUpload)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// uploadMirror uploads content as the file name of the mirror.
+func uploadMirror(h *Handler, name, content string) *httptest.ResponseRecorder {
+	b, contentType := newMirrorBody(name, content)
+	req := httptest.NewRequest(http.MethodPost, "/rest/v1/mirror", b)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", ContentTypeProblemJSON)
+	return serveMirror(h, req)
+}
+
+func TestMirrorUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		filename   string
+		content    string
+		wantStatus int
+		wantCode   string
+		wantAudit  bool
+	}{
+		{name: "cvd", filename: "daily.cvd", content: testCVD(26961), wantStatus: http.StatusOK, wantAudit: true},
+		{name: "cdiff", filename: "daily-26962.cdiff", content: testCDiff("ClamAV-Diff:26962:\nCLOSE\n"), wantStatus: http.StatusOK, wantAudit: true},
+		{name: "path in file name", filename: "../../daily.cvd", content: testCVD(26961), wantStatus: http.StatusOK, wantAudit: true},
+		{name: "invalid name", filename: "daily.cld", content: testCVD(26961), wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "invalid database", filename: "daily.cvd", content: "truncated", wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "tampered database", filename: "daily.cvd", content: testCVD(26961) + "tampered", wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "invalid diff", filename: "daily-26962.cdiff", content: "cdiff", wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "outdated", filename: "main.cvd", content: testCVD(61), wantStatus: http.StatusConflict, wantCode: CodeConflict, wantAudit: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, sink := newMirrorHandler(t)
+			_, err := h.Mirror.Put("main.cvd", strings.NewReader(testCVD(62)))
+			require.NoError(t, err)
+
+			records := sink.Len()
+			rr := uploadMirror(h, tt.filename, tt.content)
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+
+			if tt.wantCode != "" {
+				var problem Problem
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+				assert.Equal(t, tt.wantCode, problem.Code)
+			}
+
+			if !tt.wantAudit {
+				assert.Equal(t, records, sink.Len())
+				return
+			}
+			rec := sink.lastRecord(t)
+			assert.Equal(t, audit.ActionMirrorUpload, rec.Action)
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, audit.VerdictFailure, rec.Verdict)
+				return
+			}
+			var file mirror.File
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &file))
+			assert.Equal(t, audit.VerdictSuccess, rec.Verdict)
+			assert.Equal(t, file.Name, rec.FileName)
+			assert.Equal(t, file.SHA256, rec.SHA256)
+		})
+	}
+}
+
+func TestMirrorUploadForm(t *testing.T) {
+	tests := []struct {
+		name       string
+		fields     []string
+		file       bool
+		maxSize    int64
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "file after other fields", fields: []string{"comment"}, file: true, maxSize: 1 << 20, wantStatus: http.StatusOK},
+		{name: "missing file", fields: []string{"comment"}, maxSize: 1 << 20, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "too large", file: true, maxSize: databases.HeaderSize, wantStatus: http.StatusRequestEntityTooLarge, wantCode: CodeRequestTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newMirrorHandler(t)
+
+			b := &bytes.Buffer{}
+			writer := multipart.NewWriter(b)
+			for _, field := range tt.fields {
+				_ = writer.WriteField(field, "value")
+			}
+			if tt.file {
+				part, _ := writer.CreateFormFile("file", "daily.cvd")
+				_, _ = part.Write([]byte(testCVD(26961)))
+			}
+			_ = writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/rest/v1/mirror", b)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			req.Header.Set("Accept", ContentTypeProblemJSON)
+			rr := httptest.NewRecorder()
+			MaxReqSizeByPath(10, map[string]int64{"/rest/v1/mirror": tt.maxSize})(http.HandlerFunc(h.MirrorUpload)).ServeHTTP(rr, req)
+			require.Equal(t, tt.wantStatus, rr.Code, rr.Body.String())
+
+			if tt.wantCode != "" {
+				var problem Problem
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+				assert.Equal(t, tt.wantCode, problem.Code)
+				return
+			}
+			files, err := h.Mirror.List()
+			require.NoError(t, err)
+			require.Len(t, files, 1)
+			assert.Equal(t, 26961, files[0].Version)
+		})
+	}
+}
+
+func TestMirrorList(t *testing.T) {
+	h, _ := newMirrorHandler(t)
+	require.Equal(t, http.StatusOK, uploadMirror(h, "daily.cvd", testCVD(26961)).Code)
+	require.Equal(t, http.StatusOK, uploadMirror(h, "daily-26962.cdiff", testCDiff("ClamAV-Diff:26962:\nCLOSE\n")).Code)
+
+	rr := serveMirror(h, httptest.NewRequest(http.MethodGet, "/rest/v1/mirror", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp MirrorListResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Len(t, resp.Items, 2)
+	assert.Equal(t, "daily-26962.cdiff", resp.Items[0].Name)
+	assert.Equal(t, "daily.cvd", resp.Items[1].Name)
+	assert.Equal(t, 26961, resp.Items[1].Version)
+}
+
+func TestMirrorFile(t *testing.T) {
+	h, _ := newMirrorHandler(t)
+	content := testCVD(26961)
+	require.Equal(t, http.StatusOK, uploadMirror(h, "daily.cvd", content).Code)
+
+	rr := serveMirror(h, httptest.NewRequest(http.MethodGet, "/mirror/daily.cvd", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, content, rr.Body.String())
+	assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "Thu, 06 Jul 2023 07:29:38 GMT", rr.Header().Get("Last-Modified"))
+	etag := rr.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	t.Run("if none match", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/mirror/daily.cvd", nil)
+		req.Header.Set("If-None-Match", etag)
+		rr := serveMirror(h, req)
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("if modified since", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/mirror/daily.cvd", nil)
+		req.Header.Set("If-Modified-Since", "Thu, 06 Jul 2023 07:29:38 GMT")
+		assert.Equal(t, http.StatusNotModified, serveMirror(h, req).Code)
+	})
+
+	t.Run("range of the header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/mirror/daily.cvd", nil)
+		req.Header.Set("Range", "bytes=0-"+strconv.Itoa(databases.HeaderSize-1))
+		rr := serveMirror(h, req)
+		assert.Equal(t, http.StatusPartialContent, rr.Code)
+		assert.Equal(t, content[:databases.HeaderSize], rr.Body.String())
+	})
+
+	t.Run("replaced", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, uploadMirror(h, "daily.cvd", testCVD(26962)).Code)
+		req := httptest.NewRequest(http.MethodGet, "/mirror/daily.cvd", nil)
+		req.Header.Set("If-None-Match", etag)
+		rr := serveMirror(h, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, testCVD(26962), rr.Body.String())
+	})
+
+	for _, name := range []string{"main.cvd", "freshclam.dat", "..%2Fdaily.cvd"} {
+		t.Run("not found "+name, func(t *testing.T) {
+			rr := serveMirror(h, httptest.NewRequest(http.MethodGet, "/mirror/"+name, nil))
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,433 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/lescactus/clamav-api-go/internal/freshclam"
+	"github.com/lescactus/clamav-api-go/internal/mirror"
+	"github.com/lescactus/clamav-api-go/internal/openapi"
+	"github.com/lescactus/clamav-api-go/internal/rules"
+	"github.com/lescactus/clamav-api-go/internal/signatures"
+	"github.com/lescactus/clamav-api-go/pkg/signing"
+)
+
+// Paths of the API documentation.
+const (
+	OpenAPIPath   = "/openapi.json"
+	SwaggerUIPath = "/docs"
+)
+
+// NewOpenAPIDocument returns the OpenAPI document of the API. apiKeyHeader
+// is the name of the header holding the API key.
+func NewOpenAPIDocument(apiKeyHeader string) *openapi.Document {
+	d := openapi.New(openapi.Info{
+		Title:       "ClamAV API",
+		Description: "REST API wrapper for the ClamAV daemon. Authentication only applies when enabled.",
+		Version:     "1",
+	})
+
+	d.Components.SecuritySchemes["apiKey"] = &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        apiKeyHeader,
+		Description: "Static API key, when AUTH_API_KEY is set.",
+	}
+	d.Components.SecuritySchemes["hmac"] = &openapi.SecurityScheme{
+		Type: "apiKey",
+		In:   "header",
+		Name: signing.HeaderSignature,
+		Description: fmt.Sprintf("%s request signature, when AUTH_HMAC_KEYS is set. Requires the %s, %s, %s and %s headers, see docs/API_AUTHENTICATION.md.",
+			signing.Algorithm, signing.HeaderKeyID, signing.HeaderTimestamp, signing.HeaderNonce, signing.HeaderContentSHA256),
+	}
+	d.Security = []openapi.SecurityRequirement{{"apiKey": {}}, {"hmac": {}}}
+	public := []openapi.SecurityRequirement{}
+
+	// Health & Monitoring
+	ping := responses(d, "clamd is reachable", PingResponse{}, clamdErrors...)
+	delete(ping, strconv.Itoa(http.StatusUnauthorized))
+	d.AddOperation(http.MethodGet, "/rest/v1/ping", &openapi.Operation{
+		OperationID: "ping",
+		Summary:     "Health check and ClamAV connectivity",
+		Tags:        []string{"health"},
+		Responses:   ping,
+		Security:    public,
+	})
+	d.AddOperation(http.MethodGet, "/rest/v1/version", &openapi.Operation{
+		OperationID: "version",
+		Summary:     "ClamAV version information",
+		Tags:        []string{"health"},
+		Responses:   responses(d, "ClamAV version", VersionResponse{}, clamdErrors...),
+	})
+	d.AddOperation(http.MethodGet, "/rest/v1/stats", &openapi.Operation{
+		OperationID: "stats",
+		Summary:     "ClamAV daemon statistics",
+		Tags:        []string{"health"},
+		Responses:   responses(d, "ClamAV statistics", StatsResponse{}, clamdErrors...),
+	})
+	d.AddOperation(http.MethodGet, "/rest/v1/versioncommands", &openapi.Operation{
+		OperationID: "versionCommands",
+		Summary:     "Available ClamAV commands",
+		Tags:        []string{"health"},
+		Responses:   responses(d, "ClamAV version and commands", VersionCommandsResponse{}, clamdErrors...),
+	})
+	d.AddOperation(http.MethodGet, "/rest/v1/databases", &openapi.Operation{
+		OperationID: "databases",
+		Summary:     "Virus databases",
+		Description: "Returns the version of the databases loaded by clamd, whether they are stale, and the databases of the database directory if configured.",
+		Tags:        []string{"health"},
+		Responses:   responses(d, "Virus databases", DatabasesResponse{}, clamdErrors...),
+	})
+	d.AddOperation(http.MethodGet, "/metrics", &openapi.Operation{
+		OperationID: "metrics",
+		Summary:     "Prometheus metrics",
+		Tags:        []string{"health"},
+		Responses: map[string]*openapi.Response{
+			"200": {
+				Description: "Metrics in the Prometheus text exposition format",
+				Content:     map[string]openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}},
+			},
+		},
+	})
+
+	// Virus Scanning
+	d.AddOperation(http.MethodPost, "/rest/v1/scan", &openapi.Operation{
+		OperationID: "scan",
+		Summary:     "Scan an uploaded file",
+		Tags:        []string{"scanning"},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{
+				"multipart/form-data": {Schema: &openapi.Schema{
+					Type:       "object",
+					Properties: map[string]*openapi.Schema{"file": {Type: "string", ContentMediaType: "application/octet-stream"}},
+					Required:   []string{"file"},
+				}},
+			},
+		},
+		Responses: responses(d, "Scan result, infected or not", InStreamResponse{},
+			append([]int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusServiceUnavailable}, clamdErrors...)...),
+	})
+
+	scanJSON := responses(d, "", nil,
+		append([]int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusServiceUnavailable}, clamdErrors...)...)
+	scanJSON[strconv.Itoa(http.StatusOK)] = &openapi.Response{
+		Description: "Scan results, infected or not",
+		Content:     d.OneOf(JSONScanResponse{}, []JSONScanResponse{}),
+	}
+	d.AddOperation(http.MethodPost, "/rest/v1/scan/json", &openapi.Operation{
+		OperationID: "scanJSON",
+		Summary:     "Scan base64-encoded files of a JSON body",
+		Description: "For the clients which can't send multipart requests. The body is either a file or an array of files, and so is the response.",
+		Tags:        []string{"scanning"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: d.OneOf(JSONScanRequest{}, []JSONScanRequest{})},
+		Responses:   scanJSON,
+	})
+	d.AddOperation(http.MethodPost, "/rest/v1/scan/s3", &openapi.Operation{
+		OperationID: "scanS3",
+		Summary:     "Scan an object of the object storage",
+		Description: "Available when S3_ENDPOINT is set. The verdict is written back as object tags when S3_TAG_VERDICT is enabled.",
+		Tags:        []string{"scanning"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: d.JSON(S3ScanRequest{})},
+		Responses: responses(d, "Scan result, infected or not", S3ScanResponse{},
+			append([]int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusServiceUnavailable}, clamdErrors...)...),
+	})
+	d.AddOperation(http.MethodPost, "/rest/v1/scan/url", &openapi.Operation{
+		OperationID: "scanURL",
+		Summary:     "Fetch a URL and scan the content",
+		Description: "Available when URL_SCAN_ENABLED is set. URLs resolving to internal addresses are refused, including after redirects.",
+		Tags:        []string{"scanning"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: d.JSON(URLScanRequest{})},
+		Responses: responses(d, "Scan result, infected or not", URLScanResponse{},
+			append([]int{http.StatusBadRequest, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusServiceUnavailable}, clamdErrors...)...),
+	})
+
+	// Management Operations
+	d.AddOperation(http.MethodPost, "/rest/v1/reload", &openapi.Operation{
+		OperationID: "reload",
+		Summary:     "Reload ClamAV configuration and databases",
+		Tags:        []string{"management"},
+		Responses:   responses(d, "Reload started", ReloadResponse{}, clamdErrors...),
+	})
+	d.AddOperation(http.MethodPost, "/rest/v1/shutdown", &openapi.Operation{
+		OperationID: "shutdown",
+		Summary:     "Shutdown the ClamAV daemon",
+		Tags:        []string{"management"},
+		Responses:   responses(d, "Shutdown started", ShutdownResponse{}, clamdErrors...),
+	})
+	update := responses(d, "", nil)
+	update[strconv.Itoa(http.StatusAccepted)] = &openapi.Response{
+		Description: "Update started, or already running",
+		Content:     d.JSON(freshclam.Job{}),
+	}
+	d.AddOperation(http.MethodPost, "/rest/v1/freshclam", &openapi.Operation{
+		OperationID: "freshclam",
+		Summary:     "Update virus definitions",
+		Description: "freshclam runs in the background. A request made while an update is running gets the running update.",
+		Tags:        []string{"management"},
+		Responses:   update,
+	})
+	d.AddOperation(http.MethodGet, "/rest/v1/freshclam", &openapi.Operation{
+		OperationID: "freshclamStatus",
+		Summary:     "Get the running and recent virus definitions updates",
+		Tags:        []string{"management"},
+		Responses:   responses(d, "Running update and recent updates, newest first", FreshClamStatusResponse{}),
+	})
+	d.AddOperation(http.MethodGet, "/rest/v1/freshclam/jobs/:id", &openapi.Operation{
+		OperationID: "getFreshclamJob",
+		Summary:     "Get a virus definitions update",
+		Tags:        []string{"management"},
+		Parameters:  []openapi.Parameter{{Name: "id", In: "path", Required: true, Description: "Update id", Schema: &openapi.Schema{Type: "string"}}},
+		Responses:   responses(d, "Update", freshclam.Job{}, http.StatusNotFound),
+	})
+	d.AddOperation(http.MethodGet, "/rest/v1/freshclam/config", &openapi.Operation{
+		OperationID: "getFreshclamConfig",
+		Summary:     "Get the freshclam settings managed through the API",
+		Description: "Available when FRESHCLAM_CONFIG_TEMPLATE is set. The password of the proxy isn't returned.",
+		Tags:        []string{"management"},
+		Responses:   responses(d, "freshclam settings", freshclam.Settings{}),
+	})
+	d.AddOperation(http.MethodPut, "/rest/v1/freshclam/config", &openapi.Operation{
+		OperationID: "updateFreshclamConfig",
+		Summary:     "Replace the freshclam settings managed through the API",
+		Description: "Available when FRESHCLAM_CONFIG_TEMPLATE is set. The settings are rendered with the template into FRESHCLAM_CONFIG_FILE and apply to the next update. The password of the proxy is kept when it isn't given and the username is unchanged.",
+		Tags:        []string{"management"},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]openapi.MediaType{ContentTypeApplicationJSON: {Schema: d.Schema(freshclam.Settings{})}},
+		},
+		Responses: responses(d, "freshclam settings updated", freshclam.Settings{},
+			http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusInternalServerError),
+	})
+
+	// Quarantine
+	idParam := openapi.Parameter{Name: "id", In: "path", Required: true, Description: "Quarantined item id", Schema: &openapi.Schema{Type: "string"}}
+	d.AddOperation(http.MethodGet, "/rest/v1/quarantine", &openapi.Operation{
+		OperationID: "listQuarantine",
+		Summary:     "List quarantined files",
+		Description: "Available when QUARANTINE_DIR is set.",
+		Tags:        []string{"quarantine"},
+		Responses:   responses(d, "Quarantined files, oldest first", QuarantineListResponse{}),
+	})
+	d.AddOperation(http.MethodDelete, "/rest/v1/quarantine", &openapi.Operation{
+		OperationID: "purgeQuarantine",
+		Summary:     "Purge quarantined files",
+		Description: "Available when QUARANTINE_DIR is set.",
+		Tags:        []string{"quarantine"},
+		Parameters: []openapi.Parameter{{
+			Name: "older_than", In: "query", Description: "Only purge files quarantined for longer than this duration, such as 72h",
+			Schema: &openapi.Schema{Type: "string"},
+		}},
+		Responses: responses(d, "Number of purged files", QuarantinePurgeResponse{}, http.StatusBadRequest),
+	})
+	download := responses(d, "", nil, http.StatusBadRequest, http.StatusNotFound)
+	download[strconv.Itoa(http.StatusOK)] = &openapi.Response{
+		Description: "ZIP archive protected by QUARANTINE_ARCHIVE_PASSWORD",
+		Content:     map[string]openapi.MediaType{"application/zip": {Schema: &openapi.Schema{Type: "string", ContentMediaType: "application/zip"}}},
+	}
+	d.AddOperation(http.MethodGet, "/rest/v1/quarantine/:id", &openapi.Operation{
+		OperationID: "downloadQuarantine",
+		Summary:     "Download a quarantined file",
+		Description: "Available when QUARANTINE_DIR is set.",
+		Tags:        []string{"quarantine"},
+		Parameters:  []openapi.Parameter{idParam},
+		Responses:   download,
+	})
+	d.AddOperation(http.MethodDelete, "/rest/v1/quarantine/:id", &openapi.Operation{
+		OperationID: "deleteQuarantine",
+		Summary:     "Delete a quarantined file",
+		Description: "Available when QUARANTINE_DIR is set.",
+		Tags:        []string{"quarantine"},
+		Parameters:  []openapi.Parameter{idParam},
+		Responses:   responses(d, "File deleted", QuarantinePurgeResponse{}, http.StatusBadRequest, http.StatusNotFound),
+	})
+
+	// Custom Signatures
+	d.AddOperation(http.MethodGet, "/rest/v1/signatures", &openapi.Operation{
+		OperationID: "listSignatures",
+		Summary:     "List custom hash signatures",
+		Description: "Available when SIGNATURES_DB_DIR is set.",
+		Tags:        []string{"signatures"},
+		Responses:   responses(d, "Custom signatures, MD5 signatures first", SignatureListResponse{}),
+	})
+	d.AddOperation(http.MethodPost, "/rest/v1/signatures", &openapi.Operation{
+		OperationID: "addSignature",
+		Summary:     "Add a custom hash signature and reload clamd",
+		Description: "Available when SIGNATURES_DB_DIR is set. The signature is generated from an uploaded file, hashed with the algorithm given, SHA-256 by default, or given as a hash and a size.",
+		Tags:        []string{"signatures"},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{
+				"multipart/form-data": {Schema: &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"file":      {Type: "string", ContentMediaType: "application/octet-stream"},
+						"name":      {Type: "string"},
+						"algorithm": {Type: "string", Description: "md5, sha1 or sha256"},
+					},
+					Required: []string{"file", "name"},
+				}},
+				ContentTypeApplicationJSON: {Schema: d.Schema(SignatureRequest{})},
+			},
+		},
+		Responses: responses(d, "Signature added", signatures.Signature{},
+			append([]int{http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge}, clamdErrors...)...),
+	})
+	d.AddOperation(http.MethodDelete, "/rest/v1/signatures/:hash", &openapi.Operation{
+		OperationID: "deleteSignature",
+		Summary:     "Delete a custom hash signature and reload clamd",
+		Description: "Available when SIGNATURES_DB_DIR is set.",
+		Tags:        []string{"signatures"},
+		Parameters: []openapi.Parameter{{
+			Name: "hash", In: "path", Required: true, Description: "Hash of the signature", Schema: &openapi.Schema{Type: "string"},
+		}},
+		Responses: responses(d, "Signature deleted", signatures.Signature{}, append([]int{http.StatusNotFound}, clamdErrors...)...),
+	})
+
+	// Custom Rules
+	ruleParam := openapi.Parameter{Name: "name", In: "path", Required: true, Description: "Name of the rule file, eg. phishing.yar", Schema: &openapi.Schema{Type: "string"}}
+	d.AddOperation(http.MethodGet, "/rest/v1/rules", &openapi.Operation{
+		OperationID: "listRules",
+		Summary:     "List custom rule files",
+		Description: "Available when RULES_DIR is set.",
+		Tags:        []string{"rules"},
+		Responses:   responses(d, "Custom rule files, sorted by name", RuleListResponse{}),
+	})
+	d.AddOperation(http.MethodPost, "/rest/v1/rules", &openapi.Operation{
+		OperationID: "uploadRule",
+		Summary:     "Upload a custom YARA or logical signature rule file and reload clamd",
+		Description: "Available when RULES_DIR is set. The name of the uploaded file, ending with .yar, .yara or .ldb, is the name of the rule file: uploading it again adds a version. The change is rolled back if clamd fails to reload it.",
+		Tags:        []string{"rules"},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{
+				"multipart/form-data": {Schema: &openapi.Schema{
+					Type:       "object",
+					Properties: map[string]*openapi.Schema{"file": {Type: "string", ContentMediaType: "text/plain"}},
+					Required:   []string{"file"},
+				}},
+			},
+		},
+		Responses: responses(d, "Rule file uploaded", rules.Rule{},
+			http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusInternalServerError, http.StatusBadGateway),
+	})
+	d.AddOperation(http.MethodGet, "/rest/v1/rules/:name", &openapi.Operation{
+		OperationID: "getRule",
+		Summary:     "Get a custom rule file and its versions",
+		Description: "Available when RULES_DIR is set.",
+		Tags:        []string{"rules"},
+		Parameters:  []openapi.Parameter{ruleParam},
+		Responses:   responses(d, "Rule file", rules.Rule{}, http.StatusNotFound),
+	})
+	d.AddOperation(http.MethodDelete, "/rest/v1/rules/:name", &openapi.Operation{
+		OperationID: "deleteRule",
+		Summary:     "Remove a custom rule file and reload clamd",
+		Description: "Available when RULES_DIR is set. The removal is rolled back if clamd fails to reload.",
+		Tags:        []string{"rules"},
+		Parameters:  []openapi.Parameter{ruleParam},
+		Responses:   responses(d, "Rule file removed", rules.Rule{}, http.StatusNotFound, http.StatusInternalServerError, http.StatusBadGateway),
+	})
+
+	// Mirror
+	mirrorFile := responses(d, "", nil, http.StatusNotFound, http.StatusInternalServerError)
+	delete(mirrorFile, strconv.Itoa(http.StatusUnauthorized))
+	mirrorContent := map[string]openapi.MediaType{"application/octet-stream": {Schema: &openapi.Schema{Type: "string", ContentMediaType: "application/octet-stream"}}}
+	mirrorFile[strconv.Itoa(http.StatusOK)] = &openapi.Response{
+		Description: "Database file",
+		Headers: map[string]openapi.Header{
+			"ETag":          {Description: "Changes when the file is replaced", Schema: &openapi.Schema{Type: "string"}},
+			"Last-Modified": {Description: "Build time of the database of a .cvd file", Schema: &openapi.Schema{Type: "string"}},
+		},
+		Content: mirrorContent,
+	}
+	mirrorFile[strconv.Itoa(http.StatusPartialContent)] = &openapi.Response{Description: "Range of the database file", Content: mirrorContent}
+	mirrorFile[strconv.Itoa(http.StatusNotModified)] = &openapi.Response{Description: "Not modified since If-None-Match or If-Modified-Since"}
+	d.AddOperation(http.MethodGet, MirrorPath+":file", &openapi.Operation{
+		OperationID: "getMirrorFile",
+		Summary:     "Download a virus database file of the mirror",
+		Description: "Available when MIRROR_DIR is set. Serves the .cvd and .cdiff files in the layout freshclam expects from a PrivateMirror, with conditional and range requests.",
+		Tags:        []string{"mirror"},
+		Parameters:  []openapi.Parameter{{Name: "file", In: "path", Required: true, Description: "Name of the .cvd or .cdiff file", Schema: &openapi.Schema{Type: "string"}}},
+		Responses:   mirrorFile,
+		Security:    public,
+	})
+	d.AddOperation(http.MethodGet, "/rest/v1/mirror", &openapi.Operation{
+		OperationID: "listMirror",
+		Summary:     "List the virus database files of the mirror",
+		Description: "Available when MIRROR_DIR is set.",
+		Tags:        []string{"mirror"},
+		Responses:   responses(d, "Database files, sorted by name", MirrorListResponse{}, http.StatusInternalServerError),
+	})
+	d.AddOperation(http.MethodPost, "/rest/v1/mirror", &openapi.Operation{
+		OperationID: "uploadMirror",
+		Summary:     "Import a virus database file into the mirror",
+		Description: "Available when MIRROR_DIR is set. The name of the uploaded file, eg. daily.cvd or daily-27432.cdiff, is the name of the file it replaces. A .cvd file older than the one it replaces is rejected. Limited to MIRROR_MAX_UPLOAD_SIZE.",
+		Tags:        []string{"mirror"},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{
+				"multipart/form-data": {Schema: &openapi.Schema{
+					Type:       "object",
+					Properties: map[string]*openapi.Schema{"file": {Type: "string", ContentMediaType: "application/octet-stream"}},
+					Required:   []string{"file"},
+				}},
+			},
+		},
+		Responses: responses(d, "Database file imported", mirror.File{},
+			http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusInternalServerError),
+	})
+
+	// Documentation
+	d.AddOperation(http.MethodGet, OpenAPIPath, &openapi.Operation{
+		OperationID: "openapi",
+		Summary:     "This OpenAPI document",
+		Tags:        []string{"documentation"},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "OpenAPI document", Content: map[string]openapi.MediaType{"application/json": {Schema: &openapi.Schema{Type: "object"}}}},
+		},
+		Security: public,
+	})
+	d.AddOperation(http.MethodGet, SwaggerUIPath, &openapi.Operation{
+		OperationID: "swaggerUI",
+		Summary:     "Swagger UI rendering this document",
+		Description: "Available when SERVER_SWAGGER_UI is enabled.",
+		Tags:        []string{"documentation"},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "HTML page", Content: map[string]openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}}},
+		},
+		Security: public,
+	})
+
+	return d
+}
+
+// clamdErrors are the statuses of the errors of the operations talking to clamd,
+// including 501 when clamd doesn't support the command.
+var clamdErrors = []int{http.StatusInternalServerError, http.StatusNotImplemented, http.StatusBadGateway, http.StatusGatewayTimeout}
+
+// responses returns the responses of an operation: the successful response
+// holding body, if not nil, and the given error statuses. The errors common
+// to all the operations, authentication and rate limiting, are added.
+func responses(d *openapi.Document, description string, body any, errorStatuses ...int) map[string]*openapi.Response {
+	resps := make(map[string]*openapi.Response)
+	if body != nil {
+		resps[strconv.Itoa(http.StatusOK)] = &openapi.Response{Description: description, Content: d.JSON(body)}
+	}
+
+	errorContent := map[string]openapi.MediaType{
+		ContentTypeApplicationJSON: {Schema: d.Schema(ErrorResponse{})},
+		ContentTypeProblemJSON:     {Schema: d.Schema(Problem{})},
+	}
+
+	statuses := append([]int{http.StatusUnauthorized, http.StatusTooManyRequests}, errorStatuses...)
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		resps[strconv.Itoa(status)] = &openapi.Response{
+			Description: http.StatusText(status) + ", see docs/ERRORS.md",
+			Content:     errorContent,
+		}
+	}
+	return resps
+}
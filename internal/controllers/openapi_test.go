@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/lescactus/clamav-api-go/internal/freshclam"
+	"github.com/lescactus/clamav-api-go/internal/mirror"
+	"github.com/lescactus/clamav-api-go/internal/openapi"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/internal/rules"
+	"github.com/lescactus/clamav-api-go/internal/signatures"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOpenAPIResponses checks that the responses actually written by the
+// handlers match the schemas of the OpenAPI document.
+func TestOpenAPIResponses(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	h := NewHandler(&logger, &MockClamav{})
+	store, err := quarantine.New(filepath.Join(t.TempDir(), "quarantine"), bytes.Repeat([]byte{1}, quarantine.KeySize), 0)
+	require.NoError(t, err)
+	h.Quarantine = store
+	h.ObjectStore = &mockObjectStore{objects: map[string]string{"file.txt": "foobar"}}
+	h.URLFetcher = newTestFetcher()
+	h.FileTypes, err = filetype.New(filetype.Config{Deny: []string{"executable"}})
+	require.NoError(t, err)
+	h.Signatures, err = signatures.New(t.TempDir(), signatures.DefaultDatabaseName)
+	require.NoError(t, err)
+	h.Rules, err = rules.New(rules.Config{Dir: t.TempDir(), CheckDuration: time.Millisecond}, h.Clamav)
+	require.NoError(t, err)
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("foobar"))
+	}))
+	defer remote.Close()
+
+	item, err := store.Put(bytes.NewReader([]byte("infected")), quarantine.Item{FileName: "eicar.com"})
+	require.NoError(t, err)
+
+	h.FreshClamJobs = freshclam.New(h.Clamav.FreshClam, freshclam.Config{})
+	h.FreshClamSchedule = freshclam.NewScheduler(h.FreshClamJobs, freshclam.ScheduleConfig{Interval: time.Hour})
+	h.FreshClamSchedule.RunOnce(context.WithValue(context.Background(), MockScenario(""), ScenarioNoError), &logger)
+	job, _ := h.FreshClamJobs.Start(context.WithValue(context.Background(), MockScenario(""), ScenarioNoError), nil)
+	job, err = h.FreshClamJobs.Wait(context.Background(), job.ID)
+	require.NoError(t, err)
+	template := filepath.Join(t.TempDir(), "freshclam.conf")
+	require.NoError(t, os.WriteFile(template, []byte("DatabaseMirror database.clamav.net\n"), 0o600))
+	h.FreshClamSettings, err = freshclam.NewSettingsStore(template, filepath.Join(t.TempDir(), "freshclam.conf"))
+	require.NoError(t, err)
+	h.Mirror, err = mirror.New(t.TempDir())
+	require.NoError(t, err)
+
+	doc := NewOpenAPIDocument("X-API-Key")
+
+	newRuleUpload := func() (io.Reader, string) {
+		b := &bytes.Buffer{}
+		writer := multipart.NewWriter(b)
+		part, _ := writer.CreateFormFile("file", "test.yar")
+		_, _ = part.Write([]byte("rule Test { condition: true }"))
+		_ = writer.Close()
+		return b, writer.FormDataContentType()
+	}
+
+	newScanBody := func() (io.Reader, string) {
+		b := &bytes.Buffer{}
+		writer := multipart.NewWriter(b)
+		part, _ := writer.CreateFormFile("file", "file.txt")
+		_, _ = part.Write([]byte("foobar"))
+		_ = writer.Close()
+		return b, writer.FormDataContentType()
+	}
+
+	tests := []struct {
+		method   string
+		route    string
+		target   string
+		handler  http.HandlerFunc
+		scenario MockScenario
+		accept   string
+		scan     bool
+		rule     bool
+		mirror   bool
+		json     string
+		status   int
+	}{
+		{method: http.MethodGet, route: "/rest/v1/ping", handler: h.Ping, scenario: ScenarioNoError, status: http.StatusOK},
+		{method: http.MethodGet, route: "/rest/v1/ping", handler: h.Ping, scenario: ScenarioNetError, status: http.StatusBadGateway},
+		{method: http.MethodGet, route: "/rest/v1/ping", handler: h.Ping, scenario: ScenarioNetError, accept: ContentTypeProblemJSON, status: http.StatusBadGateway},
+		{method: http.MethodGet, route: "/rest/v1/version", handler: h.Version, scenario: ScenarioNoError, status: http.StatusOK},
+		{method: http.MethodGet, route: "/rest/v1/stats", handler: h.Stats, scenario: ScenarioNoError, status: http.StatusOK},
+		{method: http.MethodGet, route: "/rest/v1/stats", handler: h.Stats, scenario: ScenarioErrUnsupportedCommand, status: http.StatusNotImplemented},
+		{method: http.MethodGet, route: "/rest/v1/versioncommands", handler: h.VersionCommands, scenario: ScenarioNoError, status: http.StatusOK},
+		{method: http.MethodGet, route: "/rest/v1/databases", handler: h.Databases, scenario: ScenarioNoError, status: http.StatusOK},
+		{method: http.MethodGet, route: "/rest/v1/databases", handler: h.Databases, scenario: ScenarioNetError, status: http.StatusBadGateway},
+		{method: http.MethodPost, route: "/rest/v1/reload", handler: h.Reload, scenario: ScenarioNoError, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/shutdown", handler: h.Shutdown, scenario: ScenarioNoError, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/freshclam", handler: h.FreshClam, scenario: ScenarioNoError, status: http.StatusAccepted},
+		{method: http.MethodGet, route: "/rest/v1/freshclam", handler: h.FreshClamStatus, status: http.StatusOK},
+		{method: http.MethodGet, route: "/rest/v1/freshclam/jobs/:id", target: "/rest/v1/freshclam/jobs/" + job.ID, handler: h.FreshClamJob, status: http.StatusOK},
+		{method: http.MethodGet, route: "/rest/v1/freshclam/jobs/:id", target: "/rest/v1/freshclam/jobs/unknown", handler: h.FreshClamJob, accept: ContentTypeProblemJSON, status: http.StatusNotFound},
+		{method: http.MethodPut, route: "/rest/v1/freshclam/config", handler: h.FreshClamConfigUpdate, json: `{"private_mirrors":["mirror.example.com"],"proxy":{"server":"proxy.example.com","port":3128,"username":"user","password":"secret"}}`, status: http.StatusOK},
+		{method: http.MethodPut, route: "/rest/v1/freshclam/config", handler: h.FreshClamConfigUpdate, json: `{"private_mirrors":["ftp://mirror.example.com"]}`, accept: ContentTypeProblemJSON, status: http.StatusBadRequest},
+		{method: http.MethodGet, route: "/rest/v1/freshclam/config", handler: h.FreshClamConfig, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/scan", handler: h.InStream, scenario: ScenarioNoError, scan: true, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/scan", handler: h.InStream, scenario: ScenarioErrVirusFound, scan: true, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/scan", handler: h.InStream, scenario: ScenarioHeuristicFound, scan: true, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/scan", handler: h.InStream, scenario: ScenarioNoError, status: http.StatusBadRequest},
+		{method: http.MethodPost, route: "/rest/v1/scan/json", handler: h.ScanJSON, scenario: ScenarioNoError, json: `{"filename":"file.txt","content_base64":"Zm9vYmFy"}`, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/scan/json", handler: h.ScanJSON, scenario: ScenarioErrVirusFound, json: `[{"filename":"file.txt","content_base64":"Zm9vYmFy"}]`, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/scan/json", handler: h.ScanJSON, scenario: ScenarioNoError, json: `{"filename":"file.txt"}`, status: http.StatusBadRequest},
+		{method: http.MethodPost, route: "/rest/v1/scan/json", handler: h.ScanJSON, scenario: ScenarioNoError, json: `{"filename":"file.pdf","content_base64":"TVqQAAM="}`, accept: ContentTypeProblemJSON, status: http.StatusUnsupportedMediaType},
+		{method: http.MethodPost, route: "/rest/v1/scan/s3", handler: h.ScanS3, scenario: ScenarioErrVirusFound, json: `{"bucket":"uploads","key":"file.txt"}`, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/scan/s3", handler: h.ScanS3, scenario: ScenarioNoError, json: `{"bucket":"private","key":"file.txt"}`, status: http.StatusForbidden},
+		{method: http.MethodPost, route: "/rest/v1/scan/url", handler: h.ScanURL, scenario: ScenarioNoError, json: `{"url":"` + remote.URL + `"}`, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/scan/url", handler: h.ScanURL, scenario: ScenarioNoError, json: `{"url":"http://169.254.169.254/"}`, status: http.StatusForbidden},
+		{method: http.MethodGet, route: "/rest/v1/quarantine", handler: h.QuarantineList, status: http.StatusOK},
+		{method: http.MethodDelete, route: "/rest/v1/quarantine", target: "/rest/v1/quarantine?older_than=1h", handler: h.QuarantinePurge, status: http.StatusOK},
+		{method: http.MethodDelete, route: "/rest/v1/quarantine/:id", target: "/rest/v1/quarantine/" + item.ID, handler: h.QuarantineDelete, status: http.StatusOK},
+		{method: http.MethodDelete, route: "/rest/v1/quarantine/:id", target: "/rest/v1/quarantine/" + item.ID, handler: h.QuarantineDelete, accept: ContentTypeProblemJSON, status: http.StatusNotFound},
+		{method: http.MethodPost, route: "/rest/v1/signatures", handler: h.SignatureAdd, scenario: ScenarioNoError, json: `{"name":"Win.Trojan.Foobar","hash":"3858f62230ac3c915f300c664312c63f","size":6}`, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/signatures", handler: h.SignatureAdd, scenario: ScenarioNoError, json: `{"name":"Win.Trojan.Foobar","hash":"3858f62230ac3c915f300c664312c63f","size":6}`, accept: ContentTypeProblemJSON, status: http.StatusConflict},
+		{method: http.MethodGet, route: "/rest/v1/signatures", handler: h.SignatureList, status: http.StatusOK},
+		{method: http.MethodDelete, route: "/rest/v1/signatures/:hash", target: "/rest/v1/signatures/3858f62230ac3c915f300c664312c63f", handler: h.SignatureDelete, scenario: ScenarioNoError, status: http.StatusOK},
+		{method: http.MethodDelete, route: "/rest/v1/signatures/:hash", target: "/rest/v1/signatures/3858f62230ac3c915f300c664312c63f", handler: h.SignatureDelete, scenario: ScenarioNoError, status: http.StatusNotFound},
+		{method: http.MethodPost, route: "/rest/v1/rules", handler: h.RuleUpload, scenario: ScenarioNoError, rule: true, status: http.StatusOK},
+		{method: http.MethodPost, route: "/rest/v1/rules", handler: h.RuleUpload, scenario: ScenarioNetError, rule: true, accept: ContentTypeProblemJSON, status: http.StatusBadGateway},
+		{method: http.MethodGet, route: "/rest/v1/rules", handler: h.RuleList, status: http.StatusOK},
+		{method: http.MethodGet, route: "/rest/v1/rules/:name", target: "/rest/v1/rules/test.yar", handler: h.RuleGet, status: http.StatusOK},
+		{method: http.MethodDelete, route: "/rest/v1/rules/:name", target: "/rest/v1/rules/test.yar", handler: h.RuleDelete, scenario: ScenarioNoError, status: http.StatusOK},
+		{method: http.MethodGet, route: "/rest/v1/rules/:name", target: "/rest/v1/rules/test.yar", handler: h.RuleGet, status: http.StatusNotFound},
+		{method: http.MethodPost, route: "/rest/v1/mirror", handler: h.MirrorUpload, mirror: true, status: http.StatusOK},
+		{method: http.MethodGet, route: "/rest/v1/mirror", handler: h.MirrorList, status: http.StatusOK},
+		{method: http.MethodGet, route: "/mirror/:file", target: "/mirror/main.cvd", handler: h.MirrorFile, accept: ContentTypeProblemJSON, status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.route+" "+strconv.Itoa(tt.status), func(t *testing.T) {
+			op := doc.Operation(tt.method, tt.route)
+			require.NotNil(t, op, "operation isn't documented")
+
+			target := tt.target
+			if target == "" {
+				target = tt.route
+			}
+			var body io.Reader
+			var contentType string
+			if tt.scan {
+				body, contentType = newScanBody()
+			}
+			if tt.rule {
+				body, contentType = newRuleUpload()
+			}
+			if tt.mirror {
+				body, contentType = newMirrorBody("daily.cvd", testCVD(27432))
+			}
+			if tt.json != "" {
+				body, contentType = strings.NewReader(tt.json), ContentTypeApplicationJSON
+			}
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.scenario)
+			req := httptest.NewRequestWithContext(ctx, tt.method, target, body)
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			router := httprouter.New()
+			router.Handler(tt.method, tt.route, tt.handler)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			require.Equal(t, tt.status, rr.Code)
+
+			resp, ok := op.Responses[strconv.Itoa(rr.Code)]
+			require.True(t, ok, "status %d isn't documented", rr.Code)
+
+			mediaType, ok := resp.Content[rr.Header().Get("Content-Type")]
+			require.True(t, ok, "content type %q isn't documented", rr.Header().Get("Content-Type"))
+			assert.NoError(t, doc.Validate(mediaType.Schema, rr.Body.Bytes()))
+		})
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	doc := NewOpenAPIDocument("X-API-Key")
+
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			assert.NotEmpty(t, op.OperationID, "%s %s", method, path)
+			assert.NotEmpty(t, op.Responses, "%s %s", method, path)
+		}
+	}
+
+	// Public operations don't require authentication
+	assert.Equal(t, []openapi.SecurityRequirement{}, doc.Operation(http.MethodGet, "/rest/v1/ping").Security)
+	assert.Nil(t, doc.Operation(http.MethodPost, "/rest/v1/scan").Security)
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			assert.Equal(t, IsPublicEndpoint(path), op.Security != nil, "%s %s", method, path)
+		}
+	}
+}
@@ -10,6 +10,9 @@ import (
 // PingResponse represents the json response of a /ping endpoint
 type PingResponse struct {
 	Ping string `json:"ping"`
+	// SignatureUpdates is the health of the scheduled updates of the virus
+	// definitions ("pending", "ok" or "failing"), if enabled.
+	SignatureUpdates string `json:"signature_updates,omitempty"`
 }
 
 // Ping handles ping requests to test ClamAV connectivity.
@@ -23,7 +26,7 @@ func (h *Handler) Ping(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending ping command: %v", err)
 
-		SetErrorResponse(w, err)
+		SetErrorResponse(w, r, err)
 		return
 	}
 
@@ -32,6 +35,9 @@ func (h *Handler) Ping(w http.ResponseWriter, r *http.Request) {
 	p := PingResponse{
 		Ping: string(ping),
 	}
+	if h.FreshClamSchedule != nil {
+		p.SignatureUpdates = h.FreshClamSchedule.Status().Health
+	}
 
 	resp, err := json.Marshal(&p)
 	if err != nil {
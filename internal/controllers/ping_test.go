@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/lescactus/clamav-api-go/internal/freshclam"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
@@ -83,7 +85,7 @@ func TestHandlerPing(t *testing.T) {
 				scenario: ScenarioErrScanFileSizeLimitExceeded,
 			},
 			want: want{
-				status: http.StatusInternalServerError,
+				status: http.StatusRequestEntityTooLarge,
 				body:   []byte(`{"status":"error","msg":"clamav: size limit exceeded"}`),
 			},
 		},
@@ -111,3 +113,23 @@ func TestHandlerPing(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlerPingSignatureUpdates(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	h := NewHandler(&logger, &MockClamav{})
+	h.FreshClamJobs = freshclam.New(h.Clamav.FreshClam, freshclam.Config{})
+	h.FreshClamSchedule = freshclam.NewScheduler(h.FreshClamJobs, freshclam.ScheduleConfig{Interval: time.Hour})
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+	rr := httptest.NewRecorder()
+	h.Ping(rr, httptest.NewRequestWithContext(ctx, http.MethodGet, "/rest/v1/ping", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"ping":"PONG","signature_updates":"pending"}`, rr.Body.String())
+
+	// Scheduled updates failing don't fail the ping, clamd being reachable
+	h.FreshClamSchedule.RunOnce(context.WithValue(context.Background(), MockScenario(""), ScenarioNetError), &logger)
+	rr = httptest.NewRecorder()
+	h.Ping(rr, httptest.NewRequestWithContext(ctx, http.MethodGet, "/rest/v1/ping", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"ping":"PONG","signature_updates":"failing"}`, rr.Body.String())
+}
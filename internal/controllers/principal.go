@@ -0,0 +1,28 @@
+package controllers
+
+import "context"
+
+// principalCtxKey is the context key under which the authenticated
+// principal of a request is stored.
+type principalCtxKey struct{}
+
+const (
+	// PrincipalAnonymous is the principal of unauthenticated requests.
+	PrincipalAnonymous = "anonymous"
+	// PrincipalAPIKey is the principal of requests authenticated with the static API key.
+	PrincipalAPIKey = "api-key"
+)
+
+// WithPrincipal returns a copy of ctx carrying the given principal.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal stored in ctx by the authentication
+// middlewares, or PrincipalAnonymous if the request was not authenticated.
+func PrincipalFromContext(ctx context.Context) string {
+	if p, ok := ctx.Value(principalCtxKey{}).(string); ok && p != "" {
+		return p
+	}
+	return PrincipalAnonymous
+}
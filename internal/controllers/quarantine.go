@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/rs/zerolog/hlog"
+)
+
+// ErrInvalidQueryParam indicates a malformed query parameter.
+var ErrInvalidQueryParam = errors.New("invalid query parameter")
+
+// QuarantineListResponse represents the json response of the /quarantine endpoint.
+type QuarantineListResponse struct {
+	Items []quarantine.Item `json:"items"`
+}
+
+// QuarantinePurgeResponse represents the json response of the quarantine deletion endpoints.
+type QuarantinePurgeResponse struct {
+	Status string `json:"status"`
+	Purged int    `json:"purged"`
+}
+
+// QuarantineList handles requests to list the quarantined items.
+func (h *Handler) QuarantineList(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	items, err := h.Quarantine.List()
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while listing quarantined items: %v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, QuarantineListResponse{Items: items})
+}
+
+// QuarantineDownload handles requests to download a quarantined item, as a
+// password-protected ZIP archive.
+func (h *Handler) QuarantineDownload(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	item, err := h.Quarantine.Get(id)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Msgf("error while getting quarantined item: %v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	aw := &archiveResponseWriter{ResponseWriter: w, name: item.ID + ".zip"}
+	err = h.Quarantine.WriteArchive(aw, item.ID, h.QuarantineArchivePassword)
+
+	rec := audit.Record{
+		Action:    audit.ActionQuarantineDownload,
+		FileName:  item.FileName,
+		FileSize:  item.Size,
+		SHA256:    item.SHA256,
+		Signature: item.Signature,
+		Verdict:   audit.VerdictSuccess,
+	}
+	if err != nil {
+		rec.Verdict = audit.VerdictFailure
+		rec.Error = err.Error()
+	}
+	h.auditLog(r, rec)
+
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while writing quarantine archive: %v", err)
+
+		// Once the archive has started to be sent, the status can't be changed anymore
+		if !aw.started {
+			SetErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	h.Logger.Debug().Str("req_id", reqID.String()).Str("quarantine_id", item.ID).Msg("quarantined item downloaded")
+}
+
+// archiveResponseWriter sets the headers of the archive response on the first write.
+type archiveResponseWriter struct {
+	http.ResponseWriter
+	name    string
+	started bool
+}
+
+func (w *archiveResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", w.name))
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// QuarantineDelete handles requests to delete a quarantined item.
+func (h *Handler) QuarantineDelete(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	item, err := h.Quarantine.Get(id)
+	if err == nil {
+		err = h.Quarantine.Delete(id)
+	}
+	if err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Msgf("error while deleting quarantined item: %v", err)
+		if !errors.Is(err, quarantine.ErrNotFound) && !errors.Is(err, quarantine.ErrInvalidID) {
+			h.auditLog(r, audit.Record{Action: audit.ActionQuarantineDelete, Verdict: audit.VerdictFailure, Error: err.Error()})
+		}
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.auditLog(r, audit.Record{
+		Action:   audit.ActionQuarantineDelete,
+		FileName: item.FileName,
+		FileSize: item.Size,
+		SHA256:   item.SHA256,
+		Verdict:  audit.VerdictSuccess,
+	})
+
+	h.Logger.Debug().Str("req_id", reqID.String()).Str("quarantine_id", item.ID).Msg("quarantined item deleted")
+
+	h.writeJSON(w, r, QuarantinePurgeResponse{Status: "purged", Purged: 1})
+}
+
+// QuarantinePurge handles requests to delete all the quarantined items or,
+// with the "older_than" query parameter, those older than the given duration.
+func (h *Handler) QuarantinePurge(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	before := time.Now().Add(time.Second)
+	if s := r.URL.Query().Get("older_than"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			SetErrorResponse(w, r, fmt.Errorf("%w: older_than must be a positive duration", ErrInvalidQueryParam))
+			return
+		}
+		before = time.Now().Add(-d)
+	}
+
+	n, err := h.Quarantine.Purge(before)
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while purging quarantined items: %v", err)
+		h.auditLog(r, audit.Record{Action: audit.ActionQuarantinePurge, Verdict: audit.VerdictFailure, Error: err.Error()})
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.auditLog(r, audit.Record{Action: audit.ActionQuarantinePurge, Verdict: audit.VerdictSuccess})
+
+	h.Logger.Debug().Str("req_id", reqID.String()).Int("purged", n).Msg("quarantined items purged")
+
+	h.writeJSON(w, r, QuarantinePurgeResponse{Status: "purged", Purged: n})
+}
+
+// writeJSON writes v as the json response, with the status 200.
+func (h *Handler) writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	h.writeJSONStatus(w, r, http.StatusOK, v)
+}
+
+// writeJSONStatus writes v as the json response, with the given status.
+func (h *Handler) writeJSONStatus(w http.ResponseWriter, r *http.Request, status int, v any) {
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	resp, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(status)
+	if _, err := w.Write(resp); err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("failed to write response: %v", err)
+	}
+}
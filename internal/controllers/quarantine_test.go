@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newQuarantineHandler(t *testing.T) (*Handler, http.Handler) {
+	t.Helper()
+	logger := zerolog.New(io.Discard)
+	store, err := quarantine.New(filepath.Join(t.TempDir(), "quarantine"), bytes.Repeat([]byte{0x42}, quarantine.KeySize), 0)
+	require.NoError(t, err)
+
+	h := NewHandler(&logger, &MockClamav{})
+	h.Quarantine = store
+	h.QuarantineArchivePassword = "infected"
+
+	r := httprouter.New()
+	r.HandlerFunc(http.MethodGet, "/rest/v1/quarantine", h.QuarantineList)
+	r.HandlerFunc(http.MethodDelete, "/rest/v1/quarantine", h.QuarantinePurge)
+	r.HandlerFunc(http.MethodGet, "/rest/v1/quarantine/:id", h.QuarantineDownload)
+	r.HandlerFunc(http.MethodDelete, "/rest/v1/quarantine/:id", h.QuarantineDelete)
+	return h, r
+}
+
+func scanFile(t *testing.T, h *Handler, scenario MockScenario, content string) InStreamResponse {
+	t.Helper()
+	b := &bytes.Buffer{}
+	writer := multipart.NewWriter(b)
+	part, _ := writer.CreateFormFile("file", "eicar.com")
+	_, _ = part.Write([]byte(content))
+	_ = writer.Close()
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), scenario)
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan", b)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.InStream).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp InStreamResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestQuarantineInStream(t *testing.T) {
+	h, _ := newQuarantineHandler(t)
+
+	// Clean files aren't quarantined
+	resp := scanFile(t, h, ScenarioNoError, "clean")
+	assert.Empty(t, resp.QuarantineID)
+
+	resp = scanFile(t, h, ScenarioErrVirusFound, "infected")
+	assert.True(t, resp.VirusFound)
+	require.NotEmpty(t, resp.QuarantineID)
+
+	item, err := h.Quarantine.Get(resp.QuarantineID)
+	require.NoError(t, err)
+	assert.Equal(t, "eicar.com", item.FileName)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", item.Signature)
+	assert.Equal(t, PrincipalAnonymous, item.Principal)
+
+	var payload bytes.Buffer
+	require.NoError(t, h.Quarantine.Extract(item.ID, &payload))
+	assert.Equal(t, "infected", payload.String())
+}
+
+func TestQuarantineEndpoints(t *testing.T) {
+	h, router := newQuarantineHandler(t)
+	first := scanFile(t, h, ScenarioErrVirusFound, "first").QuarantineID
+	second := scanFile(t, h, ScenarioErrVirusFound, "second").QuarantineID
+
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		return rr
+	}
+
+	// List
+	rr := do(http.MethodGet, "/rest/v1/quarantine")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var list QuarantineListResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Len(t, list.Items, 2)
+
+	// Download
+	rr = do(http.MethodGet, "/rest/v1/quarantine/"+first)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="`+first+`.zip"`, rr.Header().Get("Content-Disposition"))
+	assert.True(t, strings.HasPrefix(rr.Body.String(), "PK\x03\x04"))
+
+	rr = do(http.MethodGet, "/rest/v1/quarantine/0123456789abcdef0123456789abcdef")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"quarantined item not found"}`, rr.Body.String())
+
+	rr = do(http.MethodGet, "/rest/v1/quarantine/not-an-id")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Delete
+	rr = do(http.MethodDelete, "/rest/v1/quarantine/"+first)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"status":"purged","purged":1}`, rr.Body.String())
+
+	rr = do(http.MethodDelete, "/rest/v1/quarantine/"+first)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// Purge
+	rr = do(http.MethodDelete, "/rest/v1/quarantine?older_than=1h")
+	assert.Equal(t, `{"status":"purged","purged":0}`, rr.Body.String())
+
+	rr = do(http.MethodDelete, "/rest/v1/quarantine?older_than=yesterday")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"bad request: invalid query parameter: older_than must be a positive duration"}`, rr.Body.String())
+
+	rr = do(http.MethodDelete, "/rest/v1/quarantine")
+	assert.Equal(t, `{"status":"purged","purged":1}`, rr.Body.String())
+
+	_, err := h.Quarantine.Get(second)
+	assert.ErrorIs(t, err, quarantine.ErrNotFound)
+}
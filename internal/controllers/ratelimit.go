@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/metrics"
+	"github.com/lescactus/clamav-api-go/internal/ratelimit"
+	"github.com/rs/zerolog/hlog"
+)
+
+// RateLimit returns a middleware enforcing per-client rate limits and
+// concurrency quotas. limiters are indexed by route, as registered on the
+// router: "/rest/v1/quarantine/:id" limits the requests to every quarantined
+// item. Requests to routes without a limiter are not limited.
+//
+// Clients are identified by their HMAC key id when authenticated with one,
+// and by their IP address (see RealIP) otherwise: the static API key is
+// shared by all the clients. The middleware must therefore be registered
+// after the authentication middlewares.
+//
+// Rejected requests are answered with a 429 status code and a Retry-After header.
+func RateLimit(limiters map[string]*ratelimit.Limiter) func(next http.Handler) http.Handler {
+	// Routes with parameters are matched segment by segment
+	var patterns []string
+	for route := range limiters {
+		if strings.ContainsAny(route, ":*") {
+			patterns = append(patterns, route)
+		}
+	}
+	sort.Strings(patterns)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := r.URL.Path
+			l, ok := limiters[route]
+			if !ok {
+				for _, pattern := range patterns {
+					if routeMatches(pattern, r.URL.Path) {
+						route, l, ok = pattern, limiters[pattern], true
+						break
+					}
+				}
+			}
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := rateLimitKey(r)
+			release, retryAfter, err := l.Acquire(key, time.Now())
+			if err != nil {
+				reqID, _ := hlog.IDFromCtx(r.Context())
+				hlog.FromRequest(r).Warn().Str("req_id", reqID.String()).
+					Str("route", route).
+					Str("client", key).
+					Err(err).
+					Msg("request rejected by rate limiter")
+
+				reason := "rate"
+				if errors.Is(err, ratelimit.ErrConcurrencyLimited) {
+					reason = "concurrency"
+				}
+				metrics.RateLimitRejections.WithLabelValues(route, reason).Inc()
+				observeRateLimitUsage(route, l)
+
+				w.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfterSeconds(retryAfter)))
+				SetErrorResponse(w, r, err)
+				return
+			}
+			observeRateLimitUsage(route, l)
+
+			defer func() {
+				release()
+				observeRateLimitUsage(route, l)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// routeMatches returns true if path matches the route pattern of the router,
+// whose ":name" segments match any segment and "*name" segment matches the
+// rest of the path.
+func routeMatches(pattern, path string) bool {
+	patternSegments := strings.Split(pattern, "/")
+	pathSegments := strings.Split(path, "/")
+	for i, p := range patternSegments {
+		if strings.HasPrefix(p, "*") {
+			return i < len(pathSegments)
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if strings.HasPrefix(p, ":") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != pathSegments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
+
+// rateLimitKey returns the key identifying the client of r for rate limiting
+// purposes. The clients of the static API key, which share its principal,
+// are told apart by their IP address.
+func rateLimitKey(r *http.Request) string {
+	if p := PrincipalFromContext(r.Context()); p != PrincipalAnonymous && p != PrincipalAPIKey {
+		return "principal:" + p
+	}
+	return "ip:" + ClientIP(r)
+}
+
+// observeRateLimitUsage exports the current usage of l to the metrics.
+func observeRateLimitUsage(route string, l *ratelimit.Limiter) {
+	u := l.Usage()
+	metrics.RateLimitInFlight.WithLabelValues(route).Set(float64(u.InFlight))
+	metrics.RateLimitClients.WithLabelValues(route).Set(float64(u.Clients))
+}
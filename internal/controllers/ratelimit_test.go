@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/ratelimit"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	limiters := map[string]*ratelimit.Limiter{
+		"/rest/v1/scan":           ratelimit.NewLimiter(ratelimit.Rule{Rate: 0.001, Burst: 1}),
+		"/rest/v1/quarantine/:id": ratelimit.NewLimiter(ratelimit.Rule{Rate: 0.001, Burst: 1}),
+	}
+
+	handler := RateLimit(limiters)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	newRequest := func(path, remoteAddr, principal string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = remoteAddr
+		logger := zerolog.New(io.Discard)
+		ctx := logger.WithContext(context.Background())
+		if principal != "" {
+			ctx = WithPrincipal(ctx, principal)
+		}
+		return req.WithContext(ctx)
+	}
+
+	tests := []struct {
+		name           string
+		req            *http.Request
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "first request of a client",
+			req:            newRequest("/rest/v1/scan", "192.0.2.1:1234", ""),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "second request of the same client",
+			req:            newRequest("/rest/v1/scan", "192.0.2.1:5678", ""),
+			expectedStatus: http.StatusTooManyRequests,
+			expectedBody:   `{"status":"error","msg":"rate limit exceeded"}`,
+		},
+		{
+			name:           "request of another client",
+			req:            newRequest("/rest/v1/scan", "192.0.2.2:1234", ""),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "authenticated client is keyed by principal",
+			req:            newRequest("/rest/v1/scan", "192.0.2.1:1234", "client-a"),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "second request of the authenticated client",
+			req:            newRequest("/rest/v1/scan", "192.0.2.3:1234", "client-a"),
+			expectedStatus: http.StatusTooManyRequests,
+			expectedBody:   `{"status":"error","msg":"rate limit exceeded"}`,
+		},
+		{
+			name:           "static api key client is keyed by ip",
+			req:            newRequest("/rest/v1/scan", "192.0.2.4:1234", PrincipalAPIKey),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "another static api key client",
+			req:            newRequest("/rest/v1/scan", "192.0.2.5:1234", PrincipalAPIKey),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "second request of the static api key client",
+			req:            newRequest("/rest/v1/scan", "192.0.2.4:5678", PrincipalAPIKey),
+			expectedStatus: http.StatusTooManyRequests,
+			expectedBody:   `{"status":"error","msg":"rate limit exceeded"}`,
+		},
+		{
+			name:           "route with parameters",
+			req:            newRequest("/rest/v1/quarantine/a", "192.0.2.1:1234", ""),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "same route with other parameters",
+			req:            newRequest("/rest/v1/quarantine/b", "192.0.2.1:1234", ""),
+			expectedStatus: http.StatusTooManyRequests,
+			expectedBody:   `{"status":"error","msg":"rate limit exceeded"}`,
+		},
+		{
+			name:           "route without limits",
+			req:            newRequest("/rest/v1/version", "192.0.2.1:1234", ""),
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	// Test cases are run in order and share the same limiters
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, tt.req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusTooManyRequests {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+				assert.Equal(t, "1000", rr.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "/rest/v1/quarantine/:id", path: "/rest/v1/quarantine/abc", want: true},
+		{pattern: "/rest/v1/quarantine/:id", path: "/rest/v1/quarantine/", want: false},
+		{pattern: "/rest/v1/quarantine/:id", path: "/rest/v1/quarantine", want: false},
+		{pattern: "/rest/v1/quarantine/:id", path: "/rest/v1/quarantine/abc/def", want: false},
+		{pattern: "/mirror/:file", path: "/mirror/daily.cvd", want: true},
+		{pattern: "/rest/v1/rules/:name", path: "/rest/v1/signatures/abc", want: false},
+		{pattern: "/static/*path", path: "/static/css/main.css", want: true},
+		{pattern: "/static/*path", path: "/other/css", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, routeMatches(tt.pattern, tt.path))
+		})
+	}
+}
+
+func TestRateLimitConcurrency(t *testing.T) {
+	l := ratelimit.NewLimiter(ratelimit.Rule{MaxConcurrent: 1})
+	limiters := map[string]*ratelimit.Limiter{"/rest/v1/scan": l}
+
+	inner := make(chan struct{})
+	done := make(chan struct{})
+	handler := RateLimit(limiters)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		inner <- struct{}{}
+		<-done
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/rest/v1/scan", nil)
+		logger := zerolog.New(io.Discard)
+		return req.WithContext(logger.WithContext(context.Background()))
+	}
+
+	// First request is in-flight
+	first := httptest.NewRecorder()
+	go handler.ServeHTTP(first, newRequest())
+	<-inner
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest())
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"too many concurrent requests"}`, rr.Body.String())
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	// Once the first request is complete, the slot is released
+	close(done)
+	assert.Eventually(t, func() bool { return l.Usage().InFlight == 0 }, time.Second, 10*time.Millisecond)
+
+	go func() { <-inner }()
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest())
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
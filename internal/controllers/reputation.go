@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/reputation"
+	"github.com/rs/zerolog/hlog"
+)
+
+// ReputationResponse describes the listing of a file by the hash lists,
+// which decided the verdict without a scan by clamd.
+type ReputationResponse struct {
+	// List is the kind of the list: allow or deny.
+	List string `json:"list"`
+	// Source is the name of the list file.
+	Source string `json:"source"`
+	// Hash is the listed hash, prefixed with its algorithm, eg. "sha256:...".
+	Hash string `json:"hash"`
+	// Name is the name given to the hash by the list, if any.
+	Name string `json:"name,omitempty"`
+}
+
+// reputationSum returns the hashes of the content of f looked up in
+// the hash lists, and rewinds it.
+func reputationSum(f io.ReadSeeker) (reputation.Hashes, error) {
+	hashes, err := reputation.Sum(f)
+	if err != nil {
+		return hashes, fmt.Errorf("error while hashing file: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return hashes, fmt.Errorf("error while rewinding file: %w", err)
+	}
+	return hashes, nil
+}
+
+// lookupReputation looks the hashes of a file up in the hash lists, if
+// enabled. It returns the response to the file if it is listed, in which
+// case it doesn't need to be scanned.
+func (h *Handler) lookupReputation(r *http.Request, hashes reputation.Hashes) (InStreamResponse, bool) {
+	if h.Reputation == nil {
+		return InStreamResponse{}, false
+	}
+	m, ok := h.Reputation.Lookup(hashes)
+	if !ok {
+		return InStreamResponse{}, false
+	}
+
+	reqID, _ := hlog.IDFromCtx(r.Context())
+	h.Logger.Info().
+		Str("req_id", reqID.String()).
+		Str("list", string(m.List)).
+		Str("source", m.Source).
+		Str("hash", m.Hash).
+		Msg("file listed by hash lists")
+
+	rep := &ReputationResponse{List: string(m.List), Source: m.Source, Hash: m.Hash, Name: m.Name}
+	if m.List == reputation.ListAllow {
+		return InStreamResponse{Status: "noerror", Msg: string(clamav.RespScan), Reputation: rep}, true
+	}
+
+	signature := m.Name
+	if signature == "" {
+		signature = "Reputation." + m.Source
+	}
+	return InStreamResponse{
+		Status:     "error",
+		Msg:        clamav.ErrVirusFound.Error(),
+		Signature:  signature,
+		VirusFound: true,
+		Reputation: rep,
+	}, true
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/rules"
+	"github.com/rs/zerolog/hlog"
+)
+
+// RuleListResponse represents the json response listing the custom rule files.
+type RuleListResponse struct {
+	Items []rules.Rule `json:"items"`
+}
+
+// RuleUpload handles requests to upload a custom rule file, as the "file"
+// field of a multipart form. The name of the file, ending with .yar, .yara
+// or .ldb, is the name of the rule file. An existing rule file is replaced
+// by a new version.
+func (h *Handler) RuleUpload(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	f, hd, err := r.FormFile("file")
+	if err != nil {
+		e := fmt.Errorf("%w: %w", ErrFormFile, err)
+		h.Logger.Debug().Str("req_id", reqID.String()).Msgf("%v", e)
+
+		SetErrorResponse(w, r, e)
+		return
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		e := fmt.Errorf("%w: %w", ErrOpenFileHeaders, err)
+		h.Logger.Debug().Str("req_id", reqID.String()).Msgf("%v", e)
+
+		SetErrorResponse(w, r, e)
+		return
+	}
+
+	name := filepath.Base(hd.Filename)
+	rule, err := h.Rules.Put(r.Context(), name, content)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Str("rule", name).Err(err).Msg("error while uploading rule file")
+		if !errors.Is(err, rules.ErrInvalid) {
+			h.auditLog(r, audit.Record{Action: audit.ActionRuleUpload, FileName: name, FileSize: hd.Size, Verdict: audit.VerdictFailure, Error: err.Error()})
+		}
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.auditLog(r, audit.Record{
+		Action:   audit.ActionRuleUpload,
+		FileName: rule.Name,
+		FileSize: rule.Size,
+		SHA256:   rule.SHA256,
+		Verdict:  audit.VerdictSuccess,
+	})
+
+	h.Logger.Info().
+		Str("req_id", reqID.String()).
+		Str("rule", rule.Name).
+		Int("version", rule.Version.Version).
+		Msg("rule file uploaded")
+
+	h.writeJSON(w, r, rule)
+}
+
+// RuleList handles requests to list the custom rule files.
+func (h *Handler) RuleList(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	items, err := h.Rules.List()
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while listing rule files: %v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, RuleListResponse{Items: items})
+}
+
+// RuleGet handles requests to get a custom rule file and its versions.
+func (h *Handler) RuleGet(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+
+	rule, err := h.Rules.Get(name)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Msgf("error while getting rule file: %v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, rule)
+}
+
+// RuleDelete handles requests to remove a custom rule file and its versions.
+func (h *Handler) RuleDelete(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+
+	rule, err := h.Rules.Delete(r.Context(), name)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Msgf("error while removing rule file: %v", err)
+		if !errors.Is(err, rules.ErrNotFound) {
+			h.auditLog(r, audit.Record{Action: audit.ActionRuleDelete, FileName: name, Verdict: audit.VerdictFailure, Error: err.Error()})
+		}
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.auditLog(r, audit.Record{
+		Action:   audit.ActionRuleDelete,
+		FileName: rule.Name,
+		FileSize: rule.Size,
+		SHA256:   rule.SHA256,
+		Verdict:  audit.VerdictSuccess,
+	})
+
+	h.Logger.Info().Str("req_id", reqID.String()).Str("rule", rule.Name).Msg("rule file removed")
+
+	h.writeJSON(w, r, rule)
+}
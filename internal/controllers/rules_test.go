@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testYARARule = "rule Test_Sample { strings: $a = \"foobar\" condition: $a }\n"
+
+// newRulesHandler returns an audited handler managing the custom rule files
+// of a temporary directory.
+func newRulesHandler(t *testing.T) (*Handler, *auditSink) {
+	t.Helper()
+	h, sink := newAuditedHandler(t)
+	store, err := rules.New(rules.Config{Dir: t.TempDir(), CheckDuration: 10 * time.Millisecond, CheckInterval: 5 * time.Millisecond}, h.Clamav)
+	require.NoError(t, err)
+	h.Rules = store
+	return h, sink
+}
+
+// newRuleBody returns a multipart body uploading content as the rule file name.
+func newRuleBody(name, content string) (*bytes.Buffer, string) {
+	b := &bytes.Buffer{}
+	writer := multipart.NewWriter(b)
+	part, _ := writer.CreateFormFile("file", name)
+	_, _ = part.Write([]byte(content))
+	_ = writer.Close()
+	return b, writer.FormDataContentType()
+}
+
+// serveRules serves req with the routes of the custom rule files.
+func serveRules(h *Handler, req *http.Request) *httptest.ResponseRecorder {
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodGet, "/rest/v1/rules", h.RuleList)
+	router.HandlerFunc(http.MethodPost, "/rest/v1/rules", h.RuleUpload)
+	router.HandlerFunc(http.MethodGet, "/rest/v1/rules/:name", h.RuleGet)
+	router.HandlerFunc(http.MethodDelete, "/rest/v1/rules/:name", h.RuleDelete)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRuleUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		scenario   MockScenario
+		filename   string
+		content    string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "uploaded", scenario: ScenarioNoError, filename: "test.yar", content: testYARARule, wantStatus: http.StatusOK},
+		{name: "invalid name", scenario: ScenarioNoError, filename: "test.txt", content: testYARARule, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "invalid syntax", scenario: ScenarioNoError, filename: "test.yar", content: "rule Test_Sample {", wantStatus: http.StatusBadRequest, wantCode: CodeInvalidRequest},
+		{name: "rolled back", scenario: ScenarioNetError, filename: "test.yar", content: testYARARule, wantStatus: http.StatusBadGateway, wantCode: CodeReloadFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newRulesHandler(t)
+
+			b, contentType := newRuleBody(tt.filename, tt.content)
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.scenario)
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/rules", b)
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("Accept", ContentTypeProblemJSON)
+			rr := serveRules(h, req)
+			require.Equal(t, tt.wantStatus, rr.Code)
+
+			if tt.wantCode != "" {
+				var p Problem
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+				assert.Equal(t, tt.wantCode, p.Code)
+				return
+			}
+			var rule rules.Rule
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rule))
+			assert.Equal(t, "test.yar", rule.Name)
+			assert.Equal(t, 1, rule.Version.Version)
+		})
+	}
+}
+
+func TestRuleListGetDelete(t *testing.T) {
+	h, sink := newRulesHandler(t)
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+
+	for range 2 {
+		b, contentType := newRuleBody("test.yar", testYARARule)
+		req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/rules", b)
+		req.Header.Set("Content-Type", contentType)
+		require.Equal(t, http.StatusOK, serveRules(h, req).Code)
+	}
+	rec := sink.lastRecord(t)
+	assert.Equal(t, audit.ActionRuleUpload, rec.Action)
+	assert.Equal(t, "test.yar", rec.FileName)
+
+	rr := serveRules(h, httptest.NewRequestWithContext(ctx, http.MethodGet, "/rest/v1/rules", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var list RuleListResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, 2, list.Items[0].Version.Version)
+
+	rr = serveRules(h, httptest.NewRequestWithContext(ctx, http.MethodGet, "/rest/v1/rules/test.yar", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var rule rules.Rule
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rule))
+	assert.Len(t, rule.Versions, 2)
+
+	rr = serveRules(h, httptest.NewRequestWithContext(ctx, http.MethodDelete, "/rest/v1/rules/test.yar", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, audit.ActionRuleDelete, sink.lastRecord(t).Action)
+
+	rr = serveRules(h, httptest.NewRequestWithContext(ctx, http.MethodGet, "/rest/v1/rules/test.yar", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
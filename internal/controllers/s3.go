@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/objectstore"
+	"github.com/rs/zerolog/hlog"
+)
+
+// Tags written on the scanned objects when tagging is enabled.
+const (
+	TagVerdict   = "clamav-verdict"
+	TagSignature = "clamav-signature"
+	TagScannedAt = "clamav-scanned-at"
+	// TagPolicyVerdict is only written when a verdict policy is configured.
+	TagPolicyVerdict = "clamav-policy-verdict"
+)
+
+// S3ScanRequest represents the json request of the /scan/s3 endpoint.
+type S3ScanRequest struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// VersionID is the version of the object to scan, the latest one when empty.
+	VersionID string `json:"version_id,omitempty"`
+}
+
+// S3ScanResponse represents the json response of the /scan/s3 endpoint.
+type S3ScanResponse struct {
+	InStreamResponse
+
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// VersionID is the version of the scanned object, when the bucket is versioned.
+	VersionID string `json:"version_id,omitempty"`
+	// Tagged is true if the verdict was written back as object tags.
+	Tagged bool `json:"tagged"`
+}
+
+// ScanS3 streams an object of the object storage to clamd
+// and optionally tags it with the verdict.
+func (h *Handler) ScanS3(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	var req S3ScanRequest
+	if err := decodeJSON(r, &req); err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Msgf("%v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	ref := objectstore.Ref{Bucket: req.Bucket, Key: req.Key, VersionID: req.VersionID}
+	rec := audit.Record{
+		Action:   audit.ActionScan,
+		FileName: ref.String(),
+	}
+
+	obj, err := h.ObjectStore.Get(r.Context(), ref)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("error while getting object")
+
+		rec.Verdict = audit.VerdictError
+		rec.Error = err.Error()
+		h.auditLog(r, rec)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	defer func() {
+		if err := obj.Body.Close(); err != nil {
+			h.Logger.Error().Str("req_id", reqID.String()).Msgf("failed to close object: %v", err)
+		}
+	}()
+
+	// Tag the version actually scanned, even if a newer one was uploaded since
+	ref.VersionID = obj.VersionID
+	rec.FileName = ref.String()
+	rec.FileSize = obj.Size
+
+	h.Logger.Debug().
+		Str("req_id", reqID.String()).
+		Str("object", ref.String()).
+		Int64("file_size", obj.Size).
+		Msg("object opened successfully")
+
+	digest := sha256.New()
+	fileType, body, err := h.detectType(r, io.TeeReader(obj.Body, digest), ref.Key)
+	if err != nil {
+		h.rejectType(w, r, rec, err)
+		return
+	}
+
+	inStream, err := h.Clamav.InStream(r.Context(), body, streamSize(obj.Size))
+
+	resp := S3ScanResponse{
+		Bucket:    ref.Bucket,
+		Key:       ref.Key,
+		VersionID: ref.VersionID,
+	}
+	tags := map[string]string{TagScannedAt: time.Now().UTC().Format(time.RFC3339)}
+
+	if err != nil {
+		if errors.Is(err, clamav.ErrVirusFound) {
+			h.Logger.Debug().Str("req_id", reqID.String()).Msg(err.Error())
+
+			resp.InStreamResponse = h.foundResponse(inStream)
+			rec.Verdict, rec.Signature = resp.AuditVerdict()
+			tags[TagVerdict] = rec.Verdict
+			tags[TagSignature] = rec.Signature
+		} else {
+			h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("error while scanning object")
+
+			rec.Verdict = audit.VerdictError
+			rec.Error = err.Error()
+			h.auditLog(r, rec)
+
+			SetErrorResponse(w, r, err)
+			return
+		}
+	} else {
+		resp.InStreamResponse = InStreamResponse{
+			Status:     "noerror",
+			Msg:        string(clamav.RespScan),
+			Signature:  "",
+			VirusFound: false,
+		}
+		rec.Verdict = audit.VerdictClean
+		tags[TagVerdict] = audit.VerdictClean
+		// Clear the signature of a previous scan
+		tags[TagSignature] = ""
+	}
+
+	resp.setType(fileType)
+	h.applyPolicy(r, &resp.InStreamResponse, ref.Key, fileType.Type, &rec)
+	if resp.Verdict != "" {
+		tags[TagPolicyVerdict] = resp.Verdict
+	}
+
+	rec.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	h.auditLog(r, rec)
+
+	h.Logger.Debug().Str("req_id", reqID.String()).Msg("object scanned successfully")
+
+	// The scan result is returned regardless of the outcome of the tagging
+	if h.ObjectStoreTagVerdict {
+		if err := h.ObjectStore.SetTags(r.Context(), ref, tags); err != nil {
+			h.Logger.Error().Str("req_id", reqID.String()).Err(err).Msg("error while tagging object")
+		} else {
+			resp.Tagged = true
+		}
+	}
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("failed to write response: %v", err)
+	}
+}
+
+// decodeJSON decodes the JSON body of r into v.
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		// Let the size limit of the request be reported as such
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrInvalidBody, err)
+	}
+	return nil
+}
+
+// streamSize returns the size of the content to stream to clamd, -1 when
+// unknown. Empty content is streamed as content of unknown size, as clamd
+// can't be announced a stream of zero bytes.
+func streamSize(size int64) int64 {
+	if size <= 0 {
+		return -1
+	}
+	return size
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/objectstore"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockObjectStore is an objectstore.Store serving the objects of the
+// "uploads" bucket, version "v1".
+type mockObjectStore struct {
+	objects map[string]string
+	tagErr  error
+
+	tagged objectstore.Ref
+	tags   map[string]string
+}
+
+func (m *mockObjectStore) Get(_ context.Context, ref objectstore.Ref) (*objectstore.Object, error) {
+	if ref.Bucket == "" || ref.Key == "" {
+		return nil, objectstore.ErrInvalidRef
+	}
+	if ref.Bucket != "uploads" {
+		return nil, objectstore.ErrBucketNotAllowed
+	}
+	if ref.Key == "unreachable" {
+		return nil, errors.Join(objectstore.ErrStorage, errors.New("connection refused"))
+	}
+	data, ok := m.objects[ref.Key]
+	if !ok || (ref.VersionID != "" && ref.VersionID != "v1") {
+		return nil, objectstore.ErrNotFound
+	}
+	return &objectstore.Object{
+		Body:      io.NopCloser(strings.NewReader(data)),
+		Size:      int64(len(data)),
+		VersionID: "v1",
+	}, nil
+}
+
+func (m *mockObjectStore) SetTags(_ context.Context, ref objectstore.Ref, tags map[string]string) error {
+	if m.tagErr != nil {
+		return m.tagErr
+	}
+	m.tagged = ref
+	m.tags = tags
+	return nil
+}
+
+// sizeClamav records the size of the streams it scans.
+type sizeClamav struct {
+	MockClamav
+	size int64
+}
+
+func (m *sizeClamav) InStream(ctx context.Context, r io.Reader, size int64) ([]byte, error) {
+	m.size = size
+	return m.MockClamav.InStream(ctx, r, size)
+}
+
+func TestHandlerScanS3EmptyObject(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mock := &sizeClamav{}
+	h := NewHandler(&logger, mock)
+	h.ObjectStore = &mockObjectStore{objects: map[string]string{"empty.txt": ""}}
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/s3", strings.NewReader(`{"bucket":"uploads","key":"empty.txt"}`))
+	rr := httptest.NewRecorder()
+	h.ScanS3(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"bucket":"uploads","key":"empty.txt","version_id":"v1","tagged":false}`, rr.Body.String())
+	// A size of zero is refused by the client
+	assert.Equal(t, int64(-1), mock.size)
+}
+
+func TestHandlerScanS3(t *testing.T) {
+	tests := []struct {
+		name       string
+		scenario   MockScenario
+		body       string
+		tag        bool
+		tagErr     error
+		wantStatus int
+		wantBody   string
+		wantTags   map[string]string
+	}{
+		{
+			name:       "clean",
+			scenario:   ScenarioNoError,
+			body:       `{"bucket":"uploads","key":"docs/report.pdf"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"bucket":"uploads","key":"docs/report.pdf","version_id":"v1","tagged":false}`,
+		},
+		{
+			name:       "clean tagged",
+			scenario:   ScenarioNoError,
+			body:       `{"bucket":"uploads","key":"docs/report.pdf","version_id":"v1"}`,
+			tag:        true,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"bucket":"uploads","key":"docs/report.pdf","version_id":"v1","tagged":true}`,
+			wantTags:   map[string]string{TagVerdict: "clean", TagSignature: ""},
+		},
+		{
+			name:       "infected tagged",
+			scenario:   ScenarioErrVirusFound,
+			body:       `{"bucket":"uploads","key":"docs/report.pdf"}`,
+			tag:        true,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"bucket":"uploads","key":"docs/report.pdf","version_id":"v1","tagged":true}`,
+			wantTags:   map[string]string{TagVerdict: "infected", TagSignature: "Win.Test.EICAR_HDB-1"},
+		},
+		{
+			name:       "tagging error",
+			scenario:   ScenarioErrVirusFound,
+			body:       `{"bucket":"uploads","key":"docs/report.pdf"}`,
+			tag:        true,
+			tagErr:     objectstore.ErrStorage,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"bucket":"uploads","key":"docs/report.pdf","version_id":"v1","tagged":false}`,
+		},
+		{
+			name:       "invalid json",
+			scenario:   ScenarioNoError,
+			body:       `{"bucket":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown field",
+			scenario:   ScenarioNoError,
+			body:       `{"bucket":"uploads","key":"docs/report.pdf","foo":"bar"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing key",
+			scenario:   ScenarioNoError,
+			body:       `{"bucket":"uploads"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "bucket not allowed",
+			scenario:   ScenarioNoError,
+			body:       `{"bucket":"private","key":"secret.txt"}`,
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"status":"error","msg":"bucket not allowed"}`,
+		},
+		{
+			name:       "object not found",
+			scenario:   ScenarioNoError,
+			body:       `{"bucket":"uploads","key":"docs/report.pdf","version_id":"v0"}`,
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"status":"error","msg":"object not found"}`,
+		},
+		{
+			name:       "storage error",
+			scenario:   ScenarioNoError,
+			body:       `{"bucket":"uploads","key":"unreachable"}`,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "clamd error",
+			scenario:   ScenarioNetError,
+			body:       `{"bucket":"uploads","key":"docs/report.pdf"}`,
+			tag:        true,
+			wantStatus: http.StatusBadGateway,
+			wantBody:   `{"status":"error","msg":"something wrong happened while communicating with clamav"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.New(io.Discard)
+			store := &mockObjectStore{objects: map[string]string{"docs/report.pdf": "report", "unreachable": ""}, tagErr: tt.tagErr}
+			h := NewHandler(&logger, &MockClamav{})
+			h.ObjectStore = store
+			h.ObjectStoreTagVerdict = tt.tag
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.scenario)
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/s3", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			h.ScanS3(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rr.Body.String())
+			}
+
+			if tt.wantTags == nil {
+				assert.Nil(t, store.tags)
+				return
+			}
+			assert.Equal(t, objectstore.Ref{Bucket: "uploads", Key: "docs/report.pdf", VersionID: "v1"}, store.tagged)
+			assert.NotEmpty(t, store.tags[TagScannedAt])
+			delete(store.tags, TagScannedAt)
+			assert.Equal(t, tt.wantTags, store.tags)
+		})
+	}
+}
+
+func TestAuditScanS3(t *testing.T) {
+	h, sink := newAuditedHandler(t)
+	h.ObjectStore = &mockObjectStore{objects: map[string]string{"docs/report.pdf": "report"}}
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioErrVirusFound)
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/s3",
+		strings.NewReader(`{"bucket":"uploads","key":"docs/report.pdf"}`))
+	h.ScanS3(httptest.NewRecorder(), req)
+
+	rec := sink.lastRecord(t)
+	assert.Equal(t, audit.ActionScan, rec.Action)
+	assert.Equal(t, "s3://uploads/docs/report.pdf?versionId=v1", rec.FileName)
+	assert.Equal(t, int64(6), rec.FileSize)
+	assert.Equal(t, audit.VerdictInfected, rec.Verdict)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", rec.Signature)
+
+	// Objects which can't be read are audited too
+	req = httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/s3",
+		strings.NewReader(`{"bucket":"uploads","key":"missing"}`))
+	h.ScanS3(httptest.NewRecorder(), req)
+
+	rec = sink.lastRecord(t)
+	assert.Equal(t, "s3://uploads/missing", rec.FileName)
+	assert.Equal(t, audit.VerdictError, rec.Verdict)
+	require.NotEmpty(t, rec.Error)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/lescactus/clamav-api-go/internal/audit"
 	"github.com/rs/zerolog/hlog"
 )
 
@@ -22,11 +23,14 @@ func (h *Handler) Shutdown(w http.ResponseWriter, r *http.Request) {
 	err := h.Clamav.Shutdown(ctx)
 	if err != nil {
 		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending shutdown command: %v", err)
+		h.auditLog(r, audit.Record{Action: audit.ActionShutdown, Verdict: audit.VerdictFailure, Error: err.Error()})
 
-		SetErrorResponse(w, err)
+		SetErrorResponse(w, r, err)
 		return
 	}
 
+	h.auditLog(r, audit.Record{Action: audit.ActionShutdown, Verdict: audit.VerdictSuccess})
+
 	h.Logger.Debug().Str("req_id", reqID.String()).Msg("shutdown command sent successfully")
 
 	sr := ShutdownResponse{
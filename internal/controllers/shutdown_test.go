@@ -83,7 +83,7 @@ func TestHandlerShutdown(t *testing.T) {
 				scenario: ScenarioErrScanFileSizeLimitExceeded,
 			},
 			want: want{
-				status: http.StatusInternalServerError,
+				status: http.StatusRequestEntityTooLarge,
 				body:   []byte(`{"status":"error","msg":"clamav: size limit exceeded"}`),
 			},
 		},
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/reputation"
+	"github.com/lescactus/clamav-api-go/internal/rules"
+	"github.com/lescactus/clamav-api-go/internal/signatures"
+	"github.com/rs/zerolog/hlog"
+)
+
+// SignatureRequest represents the json request of the /signatures endpoint,
+// adding the signature of a file from its hash and size.
+type SignatureRequest struct {
+	// Name is the malware name reported by clamd, eg. "Win.Trojan.Agent-1".
+	Name string `json:"name"`
+	// Hash is the MD5, SHA-1 or SHA-256 of the file, in hexadecimal.
+	Hash string `json:"hash"`
+	// Size is the size of the file in bytes.
+	Size int64 `json:"size"`
+}
+
+// SignatureListResponse represents the json response listing the custom signatures.
+type SignatureListResponse struct {
+	Items []signatures.Signature `json:"items"`
+}
+
+// SignatureAdd handles requests to add a custom hash signature, then reloads
+// clamd. The signature is removed again if clamd fails to reload. The signature is either generated from a file uploaded as the "file"
+// field of a multipart form, along with the "name" field and the optional
+// "algorithm" field, or given as a SignatureRequest.
+func (h *Handler) SignatureAdd(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	sig, err := h.parseSignatureRequest(r)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("invalid signature request")
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	added, err := h.Signatures.Add(sig)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("error while adding signature")
+		if !errors.Is(err, signatures.ErrInvalid) {
+			h.auditSignature(r, audit.ActionSignatureAdd, sig, err)
+		}
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+	sig = added
+
+	h.Logger.Info().
+		Str("req_id", reqID.String()).
+		Str("signature", sig.Name).
+		Str("hash", sig.Hash).
+		Str("database", sig.Database).
+		Msg("signature added")
+
+	err = h.Clamav.Reload(r.Context())
+	if err != nil {
+		err = h.rollbackSignature(r.Context(), func() error {
+			_, err := h.Signatures.Delete(sig.Hash)
+			return err
+		}, err)
+	}
+	h.auditSignature(r, audit.ActionSignatureAdd, sig, err)
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending reload command: %v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, sig)
+}
+
+// parseSignatureRequest parses the signature to add from the request.
+func (h *Handler) parseSignatureRequest(r *http.Request) (signatures.Signature, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		var req SignatureRequest
+		if err := decodeJSON(r, &req); err != nil {
+			return signatures.Signature{}, err
+		}
+		return signatures.Signature{Name: req.Name, Hash: req.Hash, Size: req.Size}, nil
+	}
+
+	_, hd, err := r.FormFile("file")
+	if err != nil {
+		return signatures.Signature{}, fmt.Errorf("%w: %w", ErrFormFile, err)
+	}
+	f, err := hd.Open()
+	if err != nil {
+		return signatures.Signature{}, fmt.Errorf("%w: %w", ErrOpenFileHeaders, err)
+	}
+	defer f.Close()
+
+	hashes, err := reputation.Sum(f)
+	if err != nil {
+		return signatures.Signature{}, fmt.Errorf("error while hashing file: %w", err)
+	}
+
+	sig := signatures.Signature{Name: r.FormValue("name"), Size: hd.Size}
+	switch alg := r.FormValue("algorithm"); alg {
+	case signatures.AlgorithmSHA256, "":
+		sig.Hash = hashes.SHA256
+	case signatures.AlgorithmSHA1:
+		sig.Hash = hashes.SHA1
+	case signatures.AlgorithmMD5:
+		sig.Hash = hashes.MD5
+	default:
+		return signatures.Signature{}, fmt.Errorf("%w: unknown algorithm %q", signatures.ErrInvalid, alg)
+	}
+	return sig, nil
+}
+
+// SignatureList handles requests to list the custom hash signatures.
+func (h *Handler) SignatureList(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	sigs, err := h.Signatures.List()
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while listing signatures: %v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+	if sigs == nil {
+		sigs = []signatures.Signature{}
+	}
+
+	h.writeJSON(w, r, SignatureListResponse{Items: sigs})
+}
+
+// SignatureDelete handles requests to delete the custom hash signature of a
+// hash, then reloads clamd. The signature is added back if clamd fails to reload.
+func (h *Handler) SignatureDelete(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	hash := httprouter.ParamsFromContext(r.Context()).ByName("hash")
+
+	sig, err := h.Signatures.Delete(hash)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("error while deleting signature")
+		if !errors.Is(err, signatures.ErrNotFound) {
+			h.auditSignature(r, audit.ActionSignatureDelete, signatures.Signature{Hash: hash}, err)
+		}
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.Logger.Info().
+		Str("req_id", reqID.String()).
+		Str("signature", sig.Name).
+		Str("hash", sig.Hash).
+		Str("database", sig.Database).
+		Msg("signature deleted")
+
+	err = h.Clamav.Reload(r.Context())
+	if err != nil {
+		err = h.rollbackSignature(r.Context(), func() error {
+			_, err := h.Signatures.Add(sig)
+			return err
+		}, err)
+	}
+	h.auditSignature(r, audit.ActionSignatureDelete, sig, err)
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending reload command: %v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, sig)
+}
+
+// rollbackSignature undoes the change of the custom signatures clamd failed to
+// reload, as the rule files are rolled back, and reloads clamd again.
+// It returns the error to report.
+func (h *Handler) rollbackSignature(ctx context.Context, undo func() error, cause error) error {
+	if err := undo(); err != nil {
+		return fmt.Errorf("%w: %w (rollback failed: %v)", rules.ErrRolledBack, cause, err)
+	}
+
+	// The request may have been cancelled: the previous signatures must be
+	// reloaded anyway
+	if err := h.Clamav.Reload(context.WithoutCancel(ctx)); err != nil {
+		return fmt.Errorf("%w: %w (reload after rollback failed: %v)", rules.ErrRolledBack, cause, err)
+	}
+	return fmt.Errorf("%w: %w", rules.ErrRolledBack, cause)
+}
+
+// auditSignature records the change of the signature sig in the audit log.
+func (h *Handler) auditSignature(r *http.Request, action string, sig signatures.Signature, err error) {
+	rec := audit.Record{
+		Action:    action,
+		FileSize:  sig.Size,
+		Signature: sig.Name,
+		Verdict:   audit.VerdictSuccess,
+	}
+	if sig.Algorithm == signatures.AlgorithmSHA256 {
+		rec.SHA256 = sig.Hash
+	}
+	if err != nil {
+		rec.Verdict = audit.VerdictFailure
+		rec.Error = err.Error()
+	}
+	h.auditLog(r, rec)
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/signatures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSignaturesHandler returns an audited handler managing the custom
+// signatures of a temporary database directory.
+func newSignaturesHandler(t *testing.T) (*Handler, *auditSink, string) {
+	t.Helper()
+	h, sink := newAuditedHandler(t)
+	dir := t.TempDir()
+	store, err := signatures.New(dir, signatures.DefaultDatabaseName)
+	require.NoError(t, err)
+	h.Signatures = store
+	return h, sink, dir
+}
+
+// serveSignatures serves req with the routes of the custom signatures.
+func serveSignatures(h *Handler, scenario MockScenario, method, target string, body io.Reader, contentType string) *httptest.ResponseRecorder {
+	ctx := context.WithValue(context.Background(), MockScenario(""), scenario)
+	req := httptest.NewRequestWithContext(ctx, method, target, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodGet, "/rest/v1/signatures", h.SignatureList)
+	router.HandlerFunc(http.MethodPost, "/rest/v1/signatures", h.SignatureAdd)
+	router.HandlerFunc(http.MethodDelete, "/rest/v1/signatures/:hash", h.SignatureDelete)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestSignatureAddFile(t *testing.T) {
+	h, sink, dir := newSignaturesHandler(t)
+
+	b := &bytes.Buffer{}
+	writer := multipart.NewWriter(b)
+	_ = writer.WriteField("name", "Win.Trojan.Foobar")
+	_ = writer.WriteField("algorithm", "md5")
+	part, _ := writer.CreateFormFile("file", "sample.exe")
+	_, _ = part.Write([]byte("foobar"))
+	_ = writer.Close()
+
+	rr := serveSignatures(h, ScenarioNoError, http.MethodPost, "/rest/v1/signatures", b, writer.FormDataContentType())
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var sig signatures.Signature
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sig))
+	assert.Equal(t, signatures.Signature{
+		Name:      "Win.Trojan.Foobar",
+		Hash:      "3858f62230ac3c915f300c664312c63f",
+		Algorithm: signatures.AlgorithmMD5,
+		Size:      6,
+		Database:  "clamav-api-go.hdb",
+	}, sig)
+
+	content, err := os.ReadFile(filepath.Join(dir, "clamav-api-go.hdb"))
+	require.NoError(t, err)
+	assert.Equal(t, "3858f62230ac3c915f300c664312c63f:6:Win.Trojan.Foobar\n", string(content))
+
+	rec := sink.lastRecord(t)
+	assert.Equal(t, audit.ActionSignatureAdd, rec.Action)
+	assert.Equal(t, audit.VerdictSuccess, rec.Verdict)
+	assert.Equal(t, "Win.Trojan.Foobar", rec.Signature)
+}
+
+func TestSignatureAddHash(t *testing.T) {
+	const hash = "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2"
+
+	tests := []struct {
+		name       string
+		scenario   MockScenario
+		body       string
+		wantStatus int
+	}{
+		{name: "added", scenario: ScenarioNoError, body: `{"name":"Win.Trojan.Foobar","hash":"` + hash + `","size":6}`, wantStatus: http.StatusOK},
+		{name: "invalid hash", scenario: ScenarioNoError, body: `{"name":"Win.Trojan.Foobar","hash":"foobar","size":6}`, wantStatus: http.StatusBadRequest},
+		{name: "missing size", scenario: ScenarioNoError, body: `{"name":"Win.Trojan.Foobar","hash":"` + hash + `"}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown field", scenario: ScenarioNoError, body: `{"name":"Win.Trojan.Foobar","sha256":"` + hash + `","size":6}`, wantStatus: http.StatusBadRequest},
+		{name: "reload failure", scenario: ScenarioNetError, body: `{"name":"Win.Trojan.Foobar","hash":"` + hash + `","size":6}`, wantStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, _ := newSignaturesHandler(t)
+
+			rr := serveSignatures(h, tt.scenario, http.MethodPost, "/rest/v1/signatures", strings.NewReader(tt.body), ContentTypeApplicationJSON)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+
+	// The same hash can't be added twice
+	h, _, _ := newSignaturesHandler(t)
+	body := `{"name":"Win.Trojan.Foobar","hash":"` + hash + `","size":6}`
+	rr := serveSignatures(h, ScenarioNoError, http.MethodPost, "/rest/v1/signatures", strings.NewReader(body), ContentTypeApplicationJSON)
+	require.Equal(t, http.StatusOK, rr.Code)
+	rr = serveSignatures(h, ScenarioNoError, http.MethodPost, "/rest/v1/signatures", strings.NewReader(body), ContentTypeApplicationJSON)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestSignatureListDelete(t *testing.T) {
+	const hash = "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2"
+	h, sink, _ := newSignaturesHandler(t)
+
+	rr := serveSignatures(h, ScenarioNoError, http.MethodGet, "/rest/v1/signatures", nil, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"items":[]}`, rr.Body.String())
+
+	_, err := h.Signatures.Add(signatures.Signature{Name: "Win.Trojan.Foobar", Hash: hash, Size: 6})
+	require.NoError(t, err)
+
+	rr = serveSignatures(h, ScenarioNoError, http.MethodGet, "/rest/v1/signatures", nil, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var list SignatureListResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, hash, list.Items[0].Hash)
+
+	rr = serveSignatures(h, ScenarioNoError, http.MethodDelete, "/rest/v1/signatures/"+hash, nil, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	rec := sink.lastRecord(t)
+	assert.Equal(t, audit.ActionSignatureDelete, rec.Action)
+	assert.Equal(t, hash, rec.SHA256)
+
+	rr = serveSignatures(h, ScenarioNoError, http.MethodDelete, "/rest/v1/signatures/"+hash, nil, "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestSignatureRollback(t *testing.T) {
+	const hash = "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2"
+	body := `{"name":"Win.Trojan.Foobar","hash":"` + hash + `","size":6}`
+
+	t.Run("add", func(t *testing.T) {
+		h, sink, _ := newSignaturesHandler(t)
+
+		rr := serveSignatures(h, ScenarioNetError, http.MethodPost, "/rest/v1/signatures", strings.NewReader(body), ContentTypeApplicationJSON)
+		assert.Equal(t, http.StatusBadGateway, rr.Code)
+		assert.Contains(t, rr.Body.String(), "rolled back")
+
+		sigs, err := h.Signatures.List()
+		require.NoError(t, err)
+		assert.Empty(t, sigs)
+		assert.Equal(t, audit.VerdictFailure, sink.lastRecord(t).Verdict)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		h, sink, _ := newSignaturesHandler(t)
+		_, err := h.Signatures.Add(signatures.Signature{Name: "Win.Trojan.Foobar", Hash: hash, Size: 6})
+		require.NoError(t, err)
+
+		rr := serveSignatures(h, ScenarioNetError, http.MethodDelete, "/rest/v1/signatures/"+hash, nil, "")
+		assert.Equal(t, http.StatusBadGateway, rr.Code)
+		assert.Contains(t, rr.Body.String(), "rolled back")
+
+		sigs, err := h.Signatures.List()
+		require.NoError(t, err)
+		require.Len(t, sigs, 1)
+		assert.Equal(t, hash, sigs[0].Hash)
+		assert.Equal(t, audit.VerdictFailure, sink.lastRecord(t).Verdict)
+	})
+}
@@ -38,7 +38,7 @@ func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending stats command: %v", err)
 
-		SetErrorResponse(w, err)
+		SetErrorResponse(w, r, err)
 		return
 	}
 
@@ -48,7 +48,7 @@ func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while marshalling stats: %v", err)
 
-		SetErrorResponse(w, err)
+		SetErrorResponse(w, r, err)
 		return
 	}
 
@@ -67,6 +67,11 @@ func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ParseStats parses the reply of a 'STATS' command into a *StatsResponse.
+func ParseStats(s string) (*StatsResponse, error) {
+	return statsMarshall(s)
+}
+
 // statsMarshall will marshall the string s
 // into a *StatsResponse.
 //
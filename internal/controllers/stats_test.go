@@ -79,13 +79,23 @@ func TestHandlerStats(t *testing.T) {
 				body:   []byte(`{"status":"error","msg":"unexpected response from clamav"}`),
 			},
 		},
+		{
+			name: "error is ErrUnsupported",
+			args: args{
+				scenario: ScenarioErrUnsupportedCommand,
+			},
+			want: want{
+				status: http.StatusNotImplemented,
+				body:   []byte(`{"status":"error","msg":"command not supported by clamd: STATS"}`),
+			},
+		},
 		{
 			name: "error is ErrScanFileSizeLimitExceeded",
 			args: args{
 				scenario: ScenarioErrScanFileSizeLimitExceeded,
 			},
 			want: want{
-				status: http.StatusInternalServerError,
+				status: http.StatusRequestEntityTooLarge,
 				body:   []byte(`{"status":"error","msg":"clamav: size limit exceeded"}`),
 			},
 		},
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/rs/zerolog/hlog"
+)
+
+// URLScanRequest represents the json request of the /scan/url endpoint.
+type URLScanRequest struct {
+	URL string `json:"url"`
+}
+
+// URLScanResponse represents the json response of the /scan/url endpoint.
+type URLScanResponse struct {
+	InStreamResponse
+
+	// FinalURL is the URL the content was fetched from, after the redirects.
+	FinalURL string `json:"final_url"`
+	// StatusCode is the status code of the fetch.
+	StatusCode int `json:"status_code"`
+	// Headers are the headers of the fetched response.
+	Headers http.Header `json:"headers"`
+}
+
+// ScanURL fetches a URL and streams the content to clamd.
+func (h *Handler) ScanURL(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	reqID, _ := hlog.IDFromCtx(r.Context())
+
+	var req URLScanRequest
+	if err := decodeJSON(r, &req); err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Msgf("%v", err)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	rec := audit.Record{
+		Action:   audit.ActionScan,
+		FileName: req.URL,
+	}
+
+	fetched, err := h.URLFetcher.Fetch(r.Context(), req.URL)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("error while fetching url")
+
+		rec.Verdict = audit.VerdictError
+		rec.Error = err.Error()
+		h.auditLog(r, rec)
+
+		SetErrorResponse(w, r, err)
+		return
+	}
+
+	defer func() {
+		if err := fetched.Body.Close(); err != nil {
+			h.Logger.Error().Str("req_id", reqID.String()).Msgf("failed to close fetched content: %v", err)
+		}
+	}()
+
+	rec.FileName = fetched.URL
+
+	h.Logger.Debug().
+		Str("req_id", reqID.String()).
+		Str("url", fetched.URL).
+		Int64("file_size", fetched.Size).
+		Msg("url fetched successfully")
+
+	digest := sha256.New()
+	counter := &countingReader{r: io.TeeReader(fetched.Body, digest)}
+	fileType, body, err := h.detectType(r, counter, urlFileName(fetched.URL))
+	if err != nil {
+		rec.FileSize = counter.n
+		h.rejectType(w, r, rec, err)
+		return
+	}
+
+	inStream, err := h.Clamav.InStream(r.Context(), body, streamSize(fetched.Size))
+	rec.FileSize = counter.n
+
+	resp := URLScanResponse{
+		FinalURL:   fetched.URL,
+		StatusCode: fetched.StatusCode,
+		Headers:    fetched.Header,
+	}
+
+	if err != nil {
+		if errors.Is(err, clamav.ErrVirusFound) {
+			h.Logger.Debug().Str("req_id", reqID.String()).Msg(err.Error())
+
+			resp.InStreamResponse = h.foundResponse(inStream)
+			rec.Verdict, rec.Signature = resp.AuditVerdict()
+		} else {
+			h.Logger.Debug().Str("req_id", reqID.String()).Err(err).Msg("error while scanning url")
+
+			rec.Verdict = audit.VerdictError
+			rec.Error = err.Error()
+			h.auditLog(r, rec)
+
+			SetErrorResponse(w, r, err)
+			return
+		}
+	} else {
+		resp.InStreamResponse = InStreamResponse{
+			Status:     "noerror",
+			Msg:        string(clamav.RespScan),
+			Signature:  "",
+			VirusFound: false,
+		}
+		rec.Verdict = audit.VerdictClean
+	}
+
+	resp.setType(fileType)
+	h.applyPolicy(r, &resp.InStreamResponse, urlFileName(fetched.URL), fileType.Type, &rec)
+
+	rec.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	h.auditLog(r, rec)
+
+	h.Logger.Debug().Str("req_id", reqID.String()).Msg("url scanned successfully")
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		h.Logger.Error().Str("req_id", reqID.String()).Msgf("failed to write response: %v", err)
+	}
+}
+
+// urlFileName returns the path of rawURL, the name the file types
+// of the verdict policy are matched against.
+func urlFileName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/urlfetch"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFetcher returns a fetcher allowed to fetch from the loopback
+// address of the test servers.
+func newTestFetcher() *urlfetch.Fetcher {
+	return urlfetch.New(urlfetch.Config{
+		AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+		MaxSize:         1024,
+		MaxRedirects:    2,
+	})
+}
+
+func newRemote(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file.txt", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("foobar"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/file.txt", http.StatusFound)
+	})
+	mux.HandleFunc("/metadata", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	})
+	mux.HandleFunc("/empty.txt", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("a", 2048)))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHandlerScanURL(t *testing.T) {
+	remote := newRemote(t)
+
+	tests := []struct {
+		name       string
+		scenario   MockScenario
+		body       string
+		wantStatus int
+		wantBody   string
+		wantURL    string
+	}{
+		{
+			name:       "clean",
+			scenario:   ScenarioNoError,
+			body:       `{"url":"` + remote.URL + `/file.txt"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false}`,
+			wantURL:    remote.URL + "/file.txt",
+		},
+		{
+			name:       "infected after redirect",
+			scenario:   ScenarioErrVirusFound,
+			body:       `{"url":"` + remote.URL + `/redirect"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true}`,
+			wantURL:    remote.URL + "/file.txt",
+		},
+		{
+			name:       "invalid json",
+			scenario:   ScenarioNoError,
+			body:       `{"url":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid url",
+			scenario:   ScenarioNoError,
+			body:       `{"url":"file.txt"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "no host",
+			scenario:   ScenarioNoError,
+			body:       `{"url":"file:///etc/passwd"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "scheme not allowed",
+			scenario:   ScenarioNoError,
+			body:       `{"url":"ftp://example.com/file.txt"}`,
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"status":"error","msg":"url not allowed: scheme \"ftp\" isn't allowed"}`,
+		},
+		{
+			name:       "metadata address",
+			scenario:   ScenarioNoError,
+			body:       `{"url":"http://169.254.169.254/latest/meta-data/"}`,
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"status":"error","msg":"url not allowed: address 169.254.169.254 is blocked"}`,
+		},
+		{
+			name:       "redirect to metadata address",
+			scenario:   ScenarioNoError,
+			body:       `{"url":"` + remote.URL + `/metadata"}`,
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"status":"error","msg":"url not allowed: address 169.254.169.254 is blocked"}`,
+		},
+		{
+			name:       "not found",
+			scenario:   ScenarioNoError,
+			body:       `{"url":"` + remote.URL + `/missing"}`,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "too large",
+			scenario:   ScenarioNoError,
+			body:       `{"url":"` + remote.URL + `/large"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "clamd error",
+			scenario:   ScenarioNetError,
+			body:       `{"url":"` + remote.URL + `/file.txt"}`,
+			wantStatus: http.StatusBadGateway,
+			wantBody:   `{"status":"error","msg":"something wrong happened while communicating with clamav"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.New(io.Discard)
+			h := NewHandler(&logger, &MockClamav{})
+			h.URLFetcher = newTestFetcher()
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.scenario)
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/url", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			h.ScanURL(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantURL == "" {
+				if tt.wantBody != "" {
+					assert.JSONEq(t, tt.wantBody, rr.Body.String())
+				}
+				return
+			}
+
+			var resp URLScanResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantURL, resp.FinalURL)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "text/plain", resp.Headers.Get("Content-Type"))
+
+			b, err := json.Marshal(resp.InStreamResponse)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.wantBody, string(b))
+		})
+	}
+}
+
+func TestHandlerScanURLEmpty(t *testing.T) {
+	remote := newRemote(t)
+
+	logger := zerolog.New(io.Discard)
+	mock := &sizeClamav{}
+	h := NewHandler(&logger, mock)
+	h.URLFetcher = newTestFetcher()
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/url", strings.NewReader(`{"url":"`+remote.URL+`/empty.txt"}`))
+	rr := httptest.NewRecorder()
+	h.ScanURL(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp URLScanResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, remote.URL+"/empty.txt", resp.FinalURL)
+	assert.Equal(t, "stream: OK", resp.Msg)
+	// A size of zero is refused by the client
+	assert.Equal(t, int64(-1), mock.size)
+}
+
+func TestAuditScanURL(t *testing.T) {
+	remote := newRemote(t)
+
+	h, sink := newAuditedHandler(t)
+	h.URLFetcher = newTestFetcher()
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioErrVirusFound)
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/url",
+		strings.NewReader(`{"url":"`+remote.URL+`/redirect"}`))
+	h.ScanURL(httptest.NewRecorder(), req)
+
+	rec := sink.lastRecord(t)
+	assert.Equal(t, audit.ActionScan, rec.Action)
+	assert.Equal(t, remote.URL+"/file.txt", rec.FileName)
+	assert.Equal(t, audit.VerdictInfected, rec.Verdict)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", rec.Signature)
+
+	// URLs which can't be fetched are audited too
+	req = httptest.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/url",
+		strings.NewReader(`{"url":"http://169.254.169.254/"}`))
+	h.ScanURL(httptest.NewRecorder(), req)
+
+	rec = sink.lastRecord(t)
+	assert.Equal(t, "http://169.254.169.254/", rec.FileName)
+	assert.Equal(t, audit.VerdictError, rec.Verdict)
+	require.NotEmpty(t, rec.Error)
+}
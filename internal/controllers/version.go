@@ -3,13 +3,51 @@ package controllers
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
+	"github.com/lescactus/clamav-api-go/internal/clamav"
 	"github.com/rs/zerolog/hlog"
 )
 
+// VersionDetails represents the version of clamd and of its databases,
+// parsed from the reply of the VERSION command.
+type VersionDetails struct {
+	EngineVersion   string     `json:"engine_version,omitempty"`
+	DatabaseVersion int        `json:"database_version,omitempty"`
+	DatabaseDate    *time.Time `json:"database_date,omitempty"`
+	// DatabaseAgeSeconds is the time elapsed since the build of the
+	// databases, nil if their date is unknown.
+	DatabaseAgeSeconds *int64 `json:"database_age_seconds,omitempty"`
+}
+
+// newVersionDetails returns the details of the version v of clamd at t.
+func newVersionDetails(v clamav.VersionInfo, t time.Time) VersionDetails {
+	d := VersionDetails{EngineVersion: v.Engine, DatabaseVersion: v.Database}
+	if !v.DatabaseDate.IsZero() {
+		d.DatabaseDate = &v.DatabaseDate
+		age := int64(t.Sub(v.DatabaseDate).Seconds())
+		d.DatabaseAgeSeconds = &age
+	}
+	return d
+}
+
+// parseVersionDetails parses the version of clamd from the reply of the
+// VERSION or VERSIONCOMMANDS command. The details are empty if the reply
+// can't be parsed, so that the raw version is still returned.
+func (h *Handler) parseVersionDetails(r *http.Request, reply []byte) VersionDetails {
+	v, err := clamav.ParseVersion(reply)
+	if err != nil {
+		reqID, _ := hlog.IDFromCtx(r.Context())
+		h.Logger.Warn().Str("req_id", reqID.String()).Msgf("error while parsing version: %v", err)
+		return VersionDetails{}
+	}
+	return newVersionDetails(v, h.now())
+}
+
 // VersionResponse represents the json response of a /version endpoint.
 type VersionResponse struct {
 	Version string `json:"clamav_version"`
+	VersionDetails
 }
 
 // Version handles requests for ClamAV version information.
@@ -23,14 +61,15 @@ func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending version command: %v", err)
 
-		SetErrorResponse(w, err)
+		SetErrorResponse(w, r, err)
 		return
 	}
 
 	h.Logger.Debug().Str("req_id", reqID.String()).Msg("version command sent successfully")
 
 	v := VersionResponse{
-		Version: string(version),
+		Version:        string(version),
+		VersionDetails: h.parseVersionDetails(r, version),
 	}
 
 	resp, err := json.Marshal(&v)
@@ -2,18 +2,27 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// fixedNow returns a clock of the handlers always returning tm.
+func fixedNow(tm time.Time) func() time.Time {
+	return func() time.Time { return tm }
+}
+
 func TestHandlerVersion(t *testing.T) {
 	logger := zerolog.New(io.Discard)
 	mockClamav := &MockClamav{}
+	now := fixedNow(time.Date(2023, time.July, 7, 7, 29, 38, 0, time.UTC))
 
 	type args struct {
 		scenario MockScenario
@@ -34,7 +43,7 @@ func TestHandlerVersion(t *testing.T) {
 			},
 			want: want{
 				status: http.StatusOK,
-				body:   []byte(`{"clamav_version":"ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023"}`),
+				body:   []byte(`{"clamav_version":"ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023","engine_version":"1.0.1","database_version":26961,"database_date":"2023-07-06T07:29:38Z","database_age_seconds":86400}`),
 			},
 		},
 		{
@@ -83,7 +92,7 @@ func TestHandlerVersion(t *testing.T) {
 				scenario: ScenarioErrScanFileSizeLimitExceeded,
 			},
 			want: want{
-				status: http.StatusInternalServerError,
+				status: http.StatusRequestEntityTooLarge,
 				body:   []byte(`{"status":"error","msg":"clamav: size limit exceeded"}`),
 			},
 		},
@@ -91,6 +100,7 @@ func TestHandlerVersion(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := NewHandler(&logger, mockClamav)
+			h.Now = now
 			rr := httptest.NewRecorder()
 			handler := http.HandlerFunc(h.Version)
 
@@ -111,3 +121,25 @@ func TestHandlerVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlerParseVersionDetails(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	h := NewHandler(&logger, &MockClamav{})
+	h.Now = fixedNow(time.Date(2023, time.February, 6, 9, 47, 7, 0, time.UTC))
+	req := httptest.NewRequest(http.MethodGet, "/rest/v1/version", nil)
+
+	date := time.Date(2023, time.February, 6, 8, 47, 7, 0, time.UTC)
+	age := int64(3600)
+	assert.Equal(t, VersionDetails{EngineVersion: "1.0.0", DatabaseVersion: 26804, DatabaseDate: &date, DatabaseAgeSeconds: &age},
+		h.parseVersionDetails(req, []byte("ClamAV 1.0.0/26804/Mon Feb  6 08:47:07 2023\n")))
+
+	// Databases built just now are zero seconds old
+	h.Now = fixedNow(date)
+	b, err := json.Marshal(h.parseVersionDetails(req, []byte("ClamAV 1.0.0/26804/Mon Feb  6 08:47:07 2023\n")))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"engine_version":"1.0.0","database_version":26804,"database_date":"2023-02-06T08:47:07Z","database_age_seconds":0}`, string(b))
+
+	assert.Equal(t, VersionDetails{EngineVersion: "1.0.0"}, h.parseVersionDetails(req, []byte("ClamAV 1.0.0")))
+	// The raw version is still returned
+	assert.Equal(t, VersionDetails{}, h.parseVersionDetails(req, []byte("unparsable version")))
+}
@@ -13,7 +13,8 @@ import (
 // It represents the version of Clamav, followed by "| COMMANDS:" and a
 // space-delimited list of supported commands.
 type VersionCommandsResponse struct {
-	Version  string   `json:"clamav_version"`
+	Version string `json:"clamav_version"`
+	VersionDetails
 	Commands []string `json:"commands"`
 }
 
@@ -28,7 +29,7 @@ func (h *Handler) VersionCommands(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending versioncommands command: %v", err)
 
-		SetErrorResponse(w, err)
+		SetErrorResponse(w, r, err)
 		return
 	}
 
@@ -38,12 +39,14 @@ func (h *Handler) VersionCommands(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		h.Logger.Error().Str("req_id", reqID.String()).Msgf("error while marshalling versioncommands: %v", err)
 
-		SetErrorResponse(w, err)
+		SetErrorResponse(w, r, err)
 		return
 	}
 
 	h.Logger.Debug().Str("req_id", reqID.String()).Msg("versioncommands marshalled successfully")
 
+	v.VersionDetails = h.parseVersionDetails(r, []byte(v.Version))
+
 	resp, err := json.Marshal(&v)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -2,19 +2,27 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/lescactus/clamav-api-go/internal/capabilities"
+	"github.com/lescactus/clamav-api-go/internal/clamav"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHandlerVersionCommands(t *testing.T) {
 	logger := zerolog.New(io.Discard)
 	mockClamav := &MockClamav{}
+	now := fixedNow(time.Date(2023, time.July, 8, 8, 27, 53, 0, time.UTC))
 
 	type args struct {
 		scenario MockScenario
@@ -35,7 +43,7 @@ func TestHandlerVersionCommands(t *testing.T) {
 			},
 			want: want{
 				status: http.StatusOK,
-				body:   []byte(`{"clamav_version":"ClamAV 1.0.1/26963/Sat Jul  8 07:27:53 2023","commands":["SCAN","QUIT","RELOAD","PING","CONTSCAN","VERSIONCOMMANDS","VERSION","END","SHUTDOWN","MULTISCAN","FILDES","STATS","IDSESSION","INSTREAM","DETSTATSCLEAR","DETSTATS","ALLMATCHSCAN"]}`),
+				body:   []byte(`{"clamav_version":"ClamAV 1.0.1/26963/Sat Jul  8 07:27:53 2023","engine_version":"1.0.1","database_version":26963,"database_date":"2023-07-08T07:27:53Z","database_age_seconds":3600,"commands":["SCAN","QUIT","RELOAD","PING","CONTSCAN","VERSIONCOMMANDS","VERSION","END","SHUTDOWN","MULTISCAN","FILDES","STATS","IDSESSION","INSTREAM","DETSTATSCLEAR","DETSTATS","ALLMATCHSCAN"]}`),
 			},
 		},
 		{
@@ -84,7 +92,7 @@ func TestHandlerVersionCommands(t *testing.T) {
 				scenario: ScenarioErrScanFileSizeLimitExceeded,
 			},
 			want: want{
-				status: http.StatusInternalServerError,
+				status: http.StatusRequestEntityTooLarge,
 				body:   []byte(`{"status":"error","msg":"clamav: size limit exceeded"}`),
 			},
 		},
@@ -102,6 +110,7 @@ func TestHandlerVersionCommands(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := NewHandler(&logger, mockClamav)
+			h.Now = now
 			rr := httptest.NewRecorder()
 			handler := http.HandlerFunc(h.VersionCommands)
 
@@ -123,6 +132,58 @@ func TestHandlerVersionCommands(t *testing.T) {
 	}
 }
 
+// reloadingClamd loads a newer version of the databases on each reload.
+type reloadingClamd struct {
+	clamav.Clamaver
+
+	mu      sync.Mutex
+	version int
+}
+
+func (c *reloadingClamd) Reload(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	return nil
+}
+
+func (c *reloadingClamd) Version(context.Context) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Appendf(nil, "ClamAV 1.4.2/%d/Sat Oct 17 07:26:00 2026", c.version), nil
+}
+
+func (c *reloadingClamd) VersionCommands(ctx context.Context) ([]byte, error) {
+	reply, _ := c.Version(ctx)
+	return append(reply, "| COMMANDS: PING VERSION VERSIONCOMMANDS RELOAD INSTREAM"...), nil
+}
+
+func TestVersionCommandsAfterReload(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	clamd := &reloadingClamd{version: 27431}
+	caps := capabilities.New(clamd, time.Hour)
+	require.NoError(t, caps.Refresh(context.Background()))
+	h := NewHandler(&logger, caps.Client(clamd))
+	h.Now = fixedNow(time.Date(2026, time.October, 17, 8, 26, 0, 0, time.UTC))
+
+	get := func(handler http.HandlerFunc, target string) VersionDetails {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var v VersionDetails
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &v))
+		return v
+	}
+
+	require.NoError(t, h.Clamav.Reload(context.Background()))
+
+	// Both endpoints report the databases loaded by the reload
+	version := get(h.Version, "/rest/v1/version")
+	commands := get(h.VersionCommands, "/rest/v1/versioncommands")
+	assert.Equal(t, 27432, version.DatabaseVersion)
+	assert.Equal(t, version, commands)
+}
+
 func TestVersionCommandsMarshall(t *testing.T) {
 	type args struct {
 		v string
@@ -0,0 +1,241 @@
+// Package databases inspects the virus databases of a clamd database
+// directory: the headers of the official CVD and CLD databases, and the
+// custom databases, such as hash signatures and YARA rules.
+package databases
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeaderSize is the size of the header of the CVD and CLD files.
+const HeaderSize = 512
+
+// headerMagic starts the header of the CVD and CLD files.
+const headerMagic = "ClamAV-VDB:"
+
+// headerTimeLayout is the layout of the build time of the header.
+const headerTimeLayout = "02 Jan 2006 15-04 -0700"
+
+// ErrInvalidHeader indicates a file doesn't start with a CVD header.
+var ErrInvalidHeader = errors.New("invalid database header")
+
+// Header is the header of a CVD or CLD file:
+//
+//	ClamAV-VDB:build time:version:signatures:functionality level:MD5:digital signature:builder:build time in seconds
+type Header struct {
+	Version            int
+	Signatures         int
+	FunctionalityLevel int
+	// MD5 is the MD5 of the content after the header of a CVD file, in hexadecimal.
+	MD5       string
+	Builder   string
+	BuildTime time.Time
+}
+
+// ReadHeader reads the header of a CVD or CLD file from r.
+func ReadHeader(r io.Reader) (Header, error) {
+	b := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return Header{}, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+	return ParseHeader(b)
+}
+
+// ParseHeader parses the header of a CVD or CLD file.
+func ParseHeader(b []byte) (Header, error) {
+	s := strings.TrimRight(string(b), " \x00\n")
+	if !strings.HasPrefix(s, headerMagic) {
+		return Header{}, fmt.Errorf("%w: missing %q", ErrInvalidHeader, headerMagic)
+	}
+	fields := strings.Split(s, ":")
+	if len(fields) < 8 {
+		return Header{}, fmt.Errorf("%w: expected at least 8 fields, got %d", ErrInvalidHeader, len(fields))
+	}
+
+	var h Header
+	var err error
+	if h.Version, err = strconv.Atoi(fields[2]); err != nil {
+		return Header{}, fmt.Errorf("%w: invalid version %q", ErrInvalidHeader, fields[2])
+	}
+	if h.Signatures, err = strconv.Atoi(fields[3]); err != nil {
+		return Header{}, fmt.Errorf("%w: invalid number of signatures %q", ErrInvalidHeader, fields[3])
+	}
+	if h.FunctionalityLevel, err = strconv.Atoi(fields[4]); err != nil {
+		return Header{}, fmt.Errorf("%w: invalid functionality level %q", ErrInvalidHeader, fields[4])
+	}
+	h.MD5 = fields[5]
+	h.Builder = fields[7]
+
+	// The build time in seconds is more precise than the formatted one,
+	// missing from the oldest databases
+	if len(fields) > 8 {
+		if sec, err := strconv.ParseInt(strings.TrimSpace(fields[8]), 10, 64); err == nil {
+			h.BuildTime = time.Unix(sec, 0).UTC()
+			return h, nil
+		}
+	}
+	if t, err := time.Parse(headerTimeLayout, fields[1]); err == nil {
+		h.BuildTime = t.UTC()
+	}
+	return h, nil
+}
+
+// Formats of the official databases.
+const (
+	FormatCVD = "cvd"
+	FormatCLD = "cld"
+	FormatCUD = "cud"
+)
+
+// customFormats are the extensions of the custom databases loaded by clamd.
+var customFormats = map[string]bool{
+	"hdb": true, "hdu": true, "hsb": true, "hsu": true, "mdb": true, "mdu": true, "msb": true, "msu": true,
+	"ndb": true, "ndu": true, "ldb": true, "ldu": true, "idb": true, "cdb": true, "crb": true,
+	"pdb": true, "gdb": true, "wdb": true, "ftm": true, "ign": true, "ign2": true, "fp": true, "sfp": true,
+	"cat": true, "imp": true, "pwdb": true, "yar": true, "yara": true,
+}
+
+// Database is a database of the directory.
+type Database struct {
+	// Name is the name of the database, the name of its file without extension, eg. "daily".
+	Name string `json:"name"`
+	File string `json:"file"`
+	// Format is the extension of the file, eg. "cld" or "hsb".
+	Format string `json:"format"`
+	// Custom is true for the databases which aren't CVD, CLD or CUD files.
+	Custom             bool       `json:"custom"`
+	Version            int        `json:"version,omitempty"`
+	Signatures         int        `json:"signatures"`
+	FunctionalityLevel int        `json:"functionality_level,omitempty"`
+	Builder            string     `json:"builder,omitempty"`
+	BuildTime          *time.Time `json:"build_time,omitempty"`
+	Size               int64      `json:"size"`
+	ModifiedAt         time.Time  `json:"modified_at"`
+	// Error is the error which prevented the inspection of the file, if any,
+	// without the path of the file.
+	Error string `json:"error,omitempty"`
+	// Err is the error behind Error, to be logged.
+	Err error `json:"-"`
+}
+
+// List returns the databases of dir, sorted by name and file. Hidden files
+// and files which aren't databases are ignored.
+func List(dir string) ([]Database, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading database directory: %w", err)
+	}
+
+	dbs := []Database{}
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := strings.TrimPrefix(filepath.Ext(name), ".")
+		official := ext == FormatCVD || ext == FormatCLD || ext == FormatCUD
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !official && !customFormats[ext] {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since listed, such as a temporary file of freshclam
+			continue
+		}
+		db := Database{
+			Name:       strings.TrimSuffix(name, "."+ext),
+			File:       name,
+			Format:     ext,
+			Custom:     !official,
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime().UTC(),
+		}
+		if err := inspect(filepath.Join(dir, name), &db); err != nil {
+			db.Err = err
+			db.Error = errorMessage(err)
+		}
+		dbs = append(dbs, db)
+	}
+
+	sort.Slice(dbs, func(i, j int) bool {
+		if dbs[i].Name != dbs[j].Name {
+			return dbs[i].Name < dbs[j].Name
+		}
+		return dbs[i].File < dbs[j].File
+	})
+	return dbs, nil
+}
+
+// errorMessage returns the message of err, without the path of the file
+// of a *fs.PathError so that the directory of clamd isn't disclosed.
+func errorMessage(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// inspect reads the header of the official database path, or counts the
+// signatures of the custom one.
+func inspect(path string, db *Database) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if !db.Custom {
+		h, err := ReadHeader(f)
+		if err != nil {
+			return err
+		}
+		db.Version = h.Version
+		db.Signatures = h.Signatures
+		db.FunctionalityLevel = h.FunctionalityLevel
+		db.Builder = h.Builder
+		if !h.BuildTime.IsZero() {
+			db.BuildTime = &h.BuildTime
+		}
+		return nil
+	}
+
+	if db.Format == "yar" || db.Format == "yara" {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		db.Signatures = len(yaraRuleRegexp.FindAll(b, -1))
+		return nil
+	}
+	db.Signatures, err = countSignatures(f)
+	return err
+}
+
+// yaraRuleRegexp matches the declarations of YARA rules.
+var yaraRuleRegexp = regexp.MustCompile(`(?m)^\s*(?:(?:private|global)\s+)*rule\s+[A-Za-z_]`)
+
+// countSignatures counts the signatures of a line-oriented database: its
+// lines which are neither empty nor comments.
+func countSignatures(r io.Reader) (int, error) {
+	var n int
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) > 0 && line[0] != '#' {
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
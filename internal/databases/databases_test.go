@@ -0,0 +1,118 @@
+package databases
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// header returns a CVD header padded to HeaderSize.
+func header(s string) []byte {
+	return []byte(s + strings.Repeat(" ", HeaderSize-len(s)))
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []byte
+		want    Header
+		wantErr bool
+	}{
+		{
+			name:   "daily",
+			header: header("ClamAV-VDB:17 Oct 2026 07-26 +0000:27432:2070134:90:3b1f1e2d6c4a5b7e8f9a0b1c2d3e4f50:dsig:raynman:1792221960"),
+			want:   Header{Version: 27432, Signatures: 2070134, FunctionalityLevel: 90, MD5: "3b1f1e2d6c4a5b7e8f9a0b1c2d3e4f50", Builder: "raynman", BuildTime: time.Unix(1792221960, 0).UTC()},
+		},
+		{
+			name:   "no build time in seconds",
+			header: header("ClamAV-VDB:16 Sep 2021 08-32 -0400:62:6647427:90:md5:dsig:sigmgr"),
+			want:   Header{Version: 62, Signatures: 6647427, FunctionalityLevel: 90, MD5: "md5", Builder: "sigmgr", BuildTime: time.Date(2021, time.September, 16, 12, 32, 0, 0, time.UTC)},
+		},
+		{name: "not a database", header: header("rule Test { condition: true }"), wantErr: true},
+		{name: "missing fields", header: header("ClamAV-VDB:16 Sep 2021 08-32 -0400:62"), wantErr: true},
+		{name: "invalid version", header: header("ClamAV-VDB:16 Sep 2021 08-32 -0400:main:6647427:90:md5:dsig:sigmgr"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHeader(tt.header)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidHeader)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	write("daily.cld", string(header("ClamAV-VDB:17 Oct 2026 07-26 +0000:27432:2070134:90:md5:dsig:raynman:1792221960"))+"signatures")
+	write("main.cvd", string(header("ClamAV-VDB:16 Sep 2021 08-32 -0400:62:6647427:90:md5:dsig:sigmgr:1631795520")))
+	write("broken.cvd", "truncated")
+	write("clamav-api-go.hsb", "# custom signatures\n3858f62230ac3c915f300c664312c63f:6:Win.Trojan.Foobar\n\nc3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2:6:Win.Trojan.Foobar\n")
+	write("custom.yar", "rule A { condition: true }\nprivate rule B { condition: true }\n")
+	write("freshclam.dat", "state")
+	write(".hidden.ldb", "Test.Sig;Target:0;0;41\n")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "tmp.ldb"), 0o700))
+
+	dbs, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, dbs, 5)
+
+	assert.Equal(t, "broken", dbs[0].Name)
+	assert.Contains(t, dbs[0].Error, ErrInvalidHeader.Error())
+
+	assert.Equal(t, "clamav-api-go", dbs[1].Name)
+	assert.Equal(t, "hsb", dbs[1].Format)
+	assert.True(t, dbs[1].Custom)
+	assert.Equal(t, 2, dbs[1].Signatures)
+
+	assert.Equal(t, "custom.yar", dbs[2].File)
+	assert.Equal(t, 2, dbs[2].Signatures)
+
+	assert.Equal(t, "daily", dbs[3].Name)
+	assert.Equal(t, "cld", dbs[3].Format)
+	assert.False(t, dbs[3].Custom)
+	assert.Equal(t, 27432, dbs[3].Version)
+	assert.Equal(t, 2070134, dbs[3].Signatures)
+	assert.Equal(t, "raynman", dbs[3].Builder)
+	require.NotNil(t, dbs[3].BuildTime)
+	assert.Equal(t, time.Unix(1792221960, 0).UTC(), *dbs[3].BuildTime)
+	assert.Equal(t, int64(HeaderSize+len("signatures")), dbs[3].Size)
+
+	assert.Equal(t, "main", dbs[4].Name)
+	assert.Equal(t, 62, dbs[4].Version)
+
+	_, err = List(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestListUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Symlink(filepath.Join(dir, "missing.cvd"), filepath.Join(dir, "dangling.cvd")))
+	if os.Geteuid() != 0 {
+		// root reads the file anyway
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "unreadable.cld"), []byte("signatures"), 0o000))
+	}
+
+	dbs, err := List(dir)
+	require.NoError(t, err)
+	require.NotEmpty(t, dbs)
+	for _, db := range dbs {
+		assert.Error(t, db.Err)
+		assert.NotContains(t, db.Error, dir)
+	}
+	assert.Equal(t, "no such file or directory", dbs[0].Error)
+	if len(dbs) > 1 {
+		assert.Equal(t, "permission denied", dbs[1].Error)
+	}
+}
@@ -0,0 +1,267 @@
+package filetype
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Types detected from their magic bytes.
+var (
+	TypePE       = Type{MIME: "application/vnd.microsoft.portable-executable", Category: CategoryExecutable, Extensions: []string{"exe", "dll", "sys", "scr", "cpl", "ocx", "com", "drv", "efi", "mui"}}
+	TypeELF      = Type{MIME: "application/x-elf", Category: CategoryExecutable, Extensions: []string{"so", "o", "elf", "bin", "out"}}
+	TypeMachO    = Type{MIME: "application/x-mach-binary", Category: CategoryExecutable, Extensions: []string{"dylib", "bundle", "o"}}
+	TypeJavaVM   = Type{MIME: "application/java-vm", Category: CategoryExecutable, Extensions: []string{"class"}}
+	TypeJAR      = Type{MIME: "application/java-archive", Category: CategoryExecutable, Extensions: []string{"jar", "war", "ear"}}
+	TypeAPK      = Type{MIME: "application/vnd.android.package-archive", Category: CategoryExecutable, Extensions: []string{"apk"}}
+	TypeScript   = Type{MIME: "text/x-shellscript", Category: CategoryScript, Extensions: []string{"sh", "bash", "zsh", "ksh", "csh", "py", "pl", "rb", "php", "cgi", "command"}}
+	TypePDF      = Type{MIME: "application/pdf", Category: CategoryDocument, Extensions: []string{"pdf"}}
+	TypeRTF      = Type{MIME: "application/rtf", Category: CategoryDocument, Extensions: []string{"rtf", "doc"}}
+	TypeOLE      = Type{MIME: "application/x-ole-storage", Category: CategoryDocument, Extensions: []string{"doc", "dot", "xls", "xlt", "ppt", "pot", "pps", "msg", "msi", "vsd", "pub"}}
+	TypeOLEMacro = Type{MIME: "application/x-ole-storage", Category: CategoryMacro, Extensions: TypeOLE.Extensions}
+	TypeDOCX     = Type{MIME: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", Category: CategoryDocument, Extensions: []string{"docx", "dotx"}}
+	TypeDOCM     = Type{MIME: "application/vnd.ms-word.document.macroEnabled.12", Category: CategoryMacro, Extensions: []string{"docm", "dotm"}}
+	TypeXLSX     = Type{MIME: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Category: CategoryDocument, Extensions: []string{"xlsx", "xltx"}}
+	TypeXLSM     = Type{MIME: "application/vnd.ms-excel.sheet.macroEnabled.12", Category: CategoryMacro, Extensions: []string{"xlsm", "xltm", "xlam"}}
+	TypePPTX     = Type{MIME: "application/vnd.openxmlformats-officedocument.presentationml.presentation", Category: CategoryDocument, Extensions: []string{"pptx", "potx", "ppsx"}}
+	TypePPTM     = Type{MIME: "application/vnd.ms-powerpoint.presentation.macroEnabled.12", Category: CategoryMacro, Extensions: []string{"pptm", "potm", "ppsm", "ppam"}}
+	TypeZIP      = Type{MIME: "application/zip", Category: CategoryArchive, Extensions: []string{"zip"}}
+	TypeGzip     = Type{MIME: "application/gzip", Category: CategoryArchive, Extensions: []string{"gz", "tgz"}}
+	TypeBzip2    = Type{MIME: "application/x-bzip2", Category: CategoryArchive, Extensions: []string{"bz2", "tbz2"}}
+	TypeXZ       = Type{MIME: "application/x-xz", Category: CategoryArchive, Extensions: []string{"xz", "txz"}}
+	Type7z       = Type{MIME: "application/x-7z-compressed", Category: CategoryArchive, Extensions: []string{"7z"}}
+	TypeRAR      = Type{MIME: "application/vnd.rar", Category: CategoryArchive, Extensions: []string{"rar"}}
+	TypeTar      = Type{MIME: "application/x-tar", Category: CategoryArchive, Extensions: []string{"tar"}}
+	TypeCAB      = Type{MIME: "application/vnd.ms-cab-compressed", Category: CategoryArchive, Extensions: []string{"cab"}}
+	TypePNG      = Type{MIME: "image/png", Category: CategoryImage, Extensions: []string{"png"}}
+	TypeJPEG     = Type{MIME: "image/jpeg", Category: CategoryImage, Extensions: []string{"jpg", "jpeg", "jpe", "jfif"}}
+	TypeGIF      = Type{MIME: "image/gif", Category: CategoryImage, Extensions: []string{"gif"}}
+	TypeWebP     = Type{MIME: "image/webp", Category: CategoryImage, Extensions: []string{"webp"}}
+	TypeTIFF     = Type{MIME: "image/tiff", Category: CategoryImage, Extensions: []string{"tif", "tiff"}}
+	TypeBMP      = Type{MIME: "image/bmp", Category: CategoryImage, Extensions: []string{"bmp", "dib"}}
+)
+
+// magic associates a type to a prefix at an offset of the content.
+type magic struct {
+	offset int
+	prefix string
+	t      Type
+}
+
+var magics = []magic{
+	{0, "MZ", TypePE},
+	{0, "\x7fELF", TypeELF},
+	{0, "\xfe\xed\xfa\xce", TypeMachO},
+	{0, "\xfe\xed\xfa\xcf", TypeMachO},
+	{0, "\xce\xfa\xed\xfe", TypeMachO},
+	{0, "\xcf\xfa\xed\xfe", TypeMachO},
+	{0, "\xca\xfe\xba\xbe", TypeJavaVM},
+	{0, "#!", TypeScript},
+	{0, "%PDF-", TypePDF},
+	{0, "{\\rtf", TypeRTF},
+	{0, "\x1f\x8b", TypeGzip},
+	{0, "BZh", TypeBzip2},
+	{0, "\xfd7zXZ\x00", TypeXZ},
+	{0, "7z\xbc\xaf\x27\x1c", Type7z},
+	{0, "Rar!\x1a\x07", TypeRAR},
+	{257, "ustar", TypeTar},
+	{0, "MSCF\x00\x00\x00\x00", TypeCAB},
+	{0, "\x89PNG\r\n\x1a\n", TypePNG},
+	{0, "\xff\xd8\xff", TypeJPEG},
+	{0, "GIF87a", TypeGIF},
+	{0, "GIF89a", TypeGIF},
+	{0, "II*\x00", TypeTIFF},
+	{0, "MM\x00*", TypeTIFF},
+}
+
+// Detect returns the type of the content starting with head.
+func Detect(head []byte) Type {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return detectZIP(head)
+	case bytes.HasPrefix(head, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")):
+		return detectOLE(head)
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return TypeWebP
+	case len(head) >= 10 && string(head[:2]) == "BM" && binary.LittleEndian.Uint32(head[6:]) == 0:
+		// The reserved bytes tell bitmaps from text starting with "BM"
+		return TypeBMP
+	}
+
+	for _, m := range magics {
+		if len(head) >= m.offset && bytes.HasPrefix(head[m.offset:], []byte(m.prefix)) {
+			return m.t
+		}
+	}
+
+	// Let the sniffing algorithm of the standard library tell text from binary content
+	mime, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	if mime == TypeBMP.MIME {
+		// Its check of bitmaps is weaker than ours
+		mime = "application/octet-stream"
+		if isText(head) {
+			mime = "text/plain"
+		}
+	}
+	switch {
+	case mime == "application/octet-stream":
+		return Type{MIME: mime, Category: CategoryUnknown}
+	case strings.HasPrefix(mime, "text/"):
+		return Type{MIME: mime, Category: CategoryText}
+	case strings.HasPrefix(mime, "image/"):
+		return Type{MIME: mime, Category: CategoryImage}
+	case mime == "application/zip" || mime == "application/x-gzip" || mime == "application/x-rar-compressed":
+		return Type{MIME: mime, Category: CategoryArchive}
+	case mime == "application/pdf" || mime == "application/postscript":
+		return Type{MIME: mime, Category: CategoryDocument}
+	default:
+		return Type{MIME: mime, Category: CategoryUnknown}
+	}
+}
+
+// isText returns true if head is UTF-8 text without control characters
+// other than white spaces.
+func isText(head []byte) bool {
+	for len(head) > 0 {
+		r, size := utf8.DecodeRune(head)
+		if r == utf8.RuneError && size <= 1 && len(head) >= utf8.UTFMax {
+			return false
+		}
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f' {
+			return false
+		}
+		head = head[size:]
+	}
+	return true
+}
+
+// zipEntry is an entry of a ZIP archive, read from its local file header.
+type zipEntry struct {
+	name   string
+	method uint16
+	data   []byte // The data of the entry within head, maybe truncated
+}
+
+// zipEntries returns the entries of the ZIP archive whose local file
+// headers are within head.
+func zipEntries(head []byte) []zipEntry {
+	var entries []zipEntry
+	for off := 0; ; {
+		i := bytes.Index(head[off:], []byte("PK\x03\x04"))
+		if i < 0 {
+			return entries
+		}
+		off += i
+		if len(head) < off+30 {
+			return entries
+		}
+		h := head[off : off+30]
+		method := binary.LittleEndian.Uint16(h[8:])
+		nameLen := int(binary.LittleEndian.Uint16(h[26:]))
+		extraLen := int(binary.LittleEndian.Uint16(h[28:]))
+		start := off + 30 + nameLen + extraLen
+		if len(head) < off+30+nameLen {
+			return entries
+		}
+		entry := zipEntry{name: string(head[off+30 : off+30+nameLen]), method: method}
+		if start <= len(head) {
+			entry.data = head[start:]
+		}
+		entries = append(entries, entry)
+		// The next header is searched for, as the size of the data isn't
+		// known if written after it
+		off += 4
+	}
+}
+
+// contents returns the content of e, maybe truncated.
+func (e zipEntry) contents() []byte {
+	switch e.method {
+	case 0: // Stored
+		return e.data
+	case 8: // Deflated
+		b, _ := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(e.data)), 64*1024))
+		return b
+	default:
+		return nil
+	}
+}
+
+// detectZIP returns the type of the ZIP archive starting with head:
+// an Office document, a Java or Android package, or a mere ZIP archive.
+func detectZIP(head []byte) Type {
+	var word, excel, powerpoint, macros, jar, apk bool
+	for _, e := range zipEntries(head) {
+		switch {
+		case strings.HasPrefix(e.name, "word/"):
+			word = true
+		case strings.HasPrefix(e.name, "xl/"):
+			excel = true
+		case strings.HasPrefix(e.name, "ppt/"):
+			powerpoint = true
+		case e.name == "META-INF/MANIFEST.MF":
+			jar = true
+		case e.name == "AndroidManifest.xml" || e.name == "classes.dex":
+			apk = true
+		case e.name == "[Content_Types].xml":
+			// Usually the first entry, it tells the type of the document
+			content := e.contents()
+			word = word || bytes.Contains(content, []byte("/word/"))
+			excel = excel || bytes.Contains(content, []byte("/xl/"))
+			powerpoint = powerpoint || bytes.Contains(content, []byte("/ppt/"))
+			macros = macros || bytes.Contains(content, []byte("macroEnabled")) || bytes.Contains(content, []byte("vbaProject"))
+		}
+		if strings.HasSuffix(e.name, "vbaProject.bin") {
+			macros = true
+		}
+	}
+
+	switch {
+	case word && macros:
+		return TypeDOCM
+	case excel && macros:
+		return TypeXLSM
+	case powerpoint && macros:
+		return TypePPTM
+	case word:
+		return TypeDOCX
+	case excel:
+		return TypeXLSX
+	case powerpoint:
+		return TypePPTX
+	case apk:
+		return TypeAPK
+	case jar:
+		return TypeJAR
+	default:
+		return TypeZIP
+	}
+}
+
+// oleMacroStreams are the names of the storages of the macros of the
+// Office documents in the OLE format.
+var oleMacroStreams = []string{"_VBA_PROJECT", "Macros"}
+
+// detectOLE returns the type of the OLE compound file starting with head,
+// looking for the names of the storages of macros, encoded in UTF-16.
+func detectOLE(head []byte) Type {
+	for _, name := range oleMacroStreams {
+		if bytes.Contains(head, utf16LE(name)) {
+			return TypeOLEMacro
+		}
+	}
+	return TypeOLE
+}
+
+func utf16LE(s string) []byte {
+	var b []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, r)
+	}
+	return b
+}
@@ -0,0 +1,171 @@
+// Package filetype detects the type of files from their content, their magic
+// bytes, rather than from the name or the Content-Type given by the client,
+// and rejects the types which aren't allowed.
+//
+// Only the first bytes of the files are read, so that files can be inspected
+// while being streamed. The detection is best effort: the macros of Office
+// documents, for instance, are only detected if their traces are within the
+// peeked bytes.
+package filetype
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefaultPeekSize is the default number of bytes peeked at to detect the type of files.
+const DefaultPeekSize = 64 * 1024
+
+// ErrDenied indicates the type of the file isn't allowed.
+var ErrDenied = errors.New("file type not allowed")
+
+// Category is a class of file types, which the allow and deny lists can refer to.
+type Category string
+
+// Categories of file types.
+const (
+	CategoryExecutable Category = "executable"
+	CategoryScript     Category = "script"
+	// CategoryMacro is the category of the Office documents with macros.
+	CategoryMacro    Category = "macro"
+	CategoryDocument Category = "document"
+	CategoryArchive  Category = "archive"
+	CategoryImage    Category = "image"
+	CategoryText     Category = "text"
+	CategoryUnknown  Category = "unknown"
+)
+
+var categories = []Category{
+	CategoryExecutable, CategoryScript, CategoryMacro, CategoryDocument,
+	CategoryArchive, CategoryImage, CategoryText, CategoryUnknown,
+}
+
+// Type is the type of a file.
+type Type struct {
+	MIME     string
+	Category Category
+	// Extensions are the usual extensions of the files of this type, without
+	// the dot. Empty if the type doesn't have usual extensions.
+	Extensions []string
+}
+
+// Result is the result of the inspection of a file.
+type Result struct {
+	Type
+	// ExtensionMismatch is true if the extension of the file name isn't one
+	// of the usual extensions of its type.
+	ExtensionMismatch bool
+}
+
+// Config is the configuration of a Detector.
+type Config struct {
+	// Allow, if not empty, lists the only types allowed, as categories or
+	// glob patterns of MIME types, eg. "image/*".
+	Allow []string
+	// Deny lists the types denied, as categories or glob patterns of MIME types.
+	// Deny takes precedence over Allow.
+	Deny []string
+	// PeekSize is the number of bytes peeked at. Zero means DefaultPeekSize.
+	PeekSize int
+}
+
+// Detector detects the type of files and enforces the allow and deny lists.
+type Detector struct {
+	allow    []string
+	deny     []string
+	peekSize int
+}
+
+// New returns a Detector configured with cfg.
+func New(cfg Config) (*Detector, error) {
+	for _, entry := range slices.Concat(cfg.Allow, cfg.Deny) {
+		if err := ValidateEntry(entry); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.PeekSize < 0 {
+		return nil, errors.New("peek size must not be negative")
+	}
+	if cfg.PeekSize == 0 {
+		cfg.PeekSize = DefaultPeekSize
+	}
+	return &Detector{allow: cfg.Allow, deny: cfg.Deny, peekSize: cfg.PeekSize}, nil
+}
+
+// ValidateEntry returns an error if entry is neither a category nor a valid
+// glob pattern of MIME types.
+func ValidateEntry(entry string) error {
+	if !strings.Contains(entry, "/") {
+		if !slices.Contains(categories, Category(entry)) {
+			return fmt.Errorf("unknown file type category %q", entry)
+		}
+		return nil
+	}
+	if _, err := path.Match(entry, ""); err != nil {
+		return fmt.Errorf("invalid MIME type pattern %q: %v", entry, err)
+	}
+	return nil
+}
+
+// Inspect peeks at the first bytes of r to detect the type of the file
+// filename. It returns a reader of the whole content of r, peeked bytes
+// included, to read in place of r.
+//
+// The error wraps ErrDenied if the type isn't allowed, in which case the
+// result is returned anyway.
+func (d *Detector) Inspect(r io.Reader, filename string) (Result, io.Reader, error) {
+	br := bufio.NewReaderSize(r, d.peekSize)
+	head, err := br.Peek(d.peekSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return Result{}, nil, err
+	}
+
+	t := Detect(head)
+	res := Result{Type: t, ExtensionMismatch: Mismatch(t, filename)}
+	if !d.allowed(t) {
+		return res, br, fmt.Errorf("%w: %s", ErrDenied, t.MIME)
+	}
+	return res, br, nil
+}
+
+// allowed returns true if t is allowed by the allow and deny lists.
+func (d *Detector) allowed(t Type) bool {
+	if matchAny(d.deny, t) {
+		return false
+	}
+	return len(d.allow) == 0 || matchAny(d.allow, t)
+}
+
+func matchAny(entries []string, t Type) bool {
+	for _, entry := range entries {
+		if t.Match(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns true if t is of the category entry, or if its MIME type
+// matches the glob pattern entry.
+func (t Type) Match(entry string) bool {
+	if !strings.Contains(entry, "/") {
+		return Category(entry) == t.Category
+	}
+	ok, _ := path.Match(entry, t.MIME)
+	return ok
+}
+
+// Mismatch returns true if the extension of filename isn't one of the usual
+// extensions of t. File names without extension never mismatch.
+func Mismatch(t Type, filename string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(filename), "."))
+	if ext == "" || len(t.Extensions) == 0 {
+		return false
+	}
+	return !slices.Contains(t.Extensions, ext)
+}
@@ -0,0 +1,119 @@
+package filetype
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newZIP returns a ZIP archive of files, written in order.
+func newZIP(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for _, f := range files {
+		fw, err := w.Create(f[0])
+		require.NoError(t, err)
+		_, err = io.WriteString(fw, f[1])
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+const contentTypes = `<?xml version="1.0"?><Types><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`
+
+const contentTypesMacro = `<?xml version="1.0"?><Types><Override PartName="/word/document.xml" ContentType="application/vnd.ms-word.document.macroEnabled.main+xml"/></Types>`
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    Type
+	}{
+		{name: "pe", content: []byte("MZ\x90\x00\x03\x00\x00\x00"), want: TypePE},
+		{name: "elf", content: []byte("\x7fELF\x02\x01\x01"), want: TypeELF},
+		{name: "script", content: []byte("#!/bin/sh\necho hello\n"), want: TypeScript},
+		{name: "pdf", content: []byte("%PDF-1.7\n"), want: TypePDF},
+		{name: "png", content: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), want: TypePNG},
+		{name: "bmp", content: []byte("BM\x46\x00\x00\x00\x00\x00\x00\x00\x36\x00"), want: TypeBMP},
+		{name: "tar", content: append(make([]byte, 257), "ustar\x0000"...), want: TypeTar},
+		{name: "ole", content: []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00\x00"), want: TypeOLE},
+		{name: "ole with macros", content: append([]byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00\x00"), utf16LE("_VBA_PROJECT_CUR")...), want: TypeOLEMacro},
+		{name: "zip", content: newZIP(t, [2]string{"file.txt", "hello"}), want: TypeZIP},
+		{name: "docx", content: newZIP(t, [2]string{"[Content_Types].xml", contentTypes}, [2]string{"word/document.xml", "<w:document/>"}), want: TypeDOCX},
+		{name: "docm", content: newZIP(t, [2]string{"[Content_Types].xml", contentTypesMacro}), want: TypeDOCM},
+		{name: "xlsm", content: newZIP(t, [2]string{"xl/workbook.xml", "<workbook/>"}, [2]string{"xl/vbaProject.bin", "vba"}), want: TypeXLSM},
+		{name: "jar", content: newZIP(t, [2]string{"META-INF/MANIFEST.MF", "Manifest-Version: 1.0"}), want: TypeJAR},
+		{name: "text", content: []byte("BMW annual report"), want: Type{MIME: "text/plain", Category: CategoryText}},
+		{name: "html", content: []byte("<!DOCTYPE html><html></html>"), want: Type{MIME: "text/html", Category: CategoryText}},
+		{name: "binary", content: []byte{0x00, 0x01, 0x02, 0x03}, want: Type{MIME: "application/octet-stream", Category: CategoryUnknown}},
+		{name: "empty", content: nil, want: Type{MIME: "text/plain", Category: CategoryText}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Detect(tt.content))
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	d, err := New(Config{Deny: []string{"executable", "macro"}, PeekSize: 16})
+	require.NoError(t, err)
+
+	content := "%PDF-1.7\n" + strings.Repeat("a", 100)
+	res, r, err := d.Inspect(strings.NewReader(content), "report.PDF")
+	require.NoError(t, err)
+	assert.Equal(t, TypePDF, res.Type)
+	assert.False(t, res.ExtensionMismatch)
+
+	// The peeked bytes are read again
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(b))
+
+	res, _, err = d.Inspect(strings.NewReader("%PDF-1.7\n"), "invoice.jpg")
+	require.NoError(t, err)
+	assert.True(t, res.ExtensionMismatch)
+
+	res, _, err = d.Inspect(strings.NewReader("MZ\x90\x00"), "invoice.pdf")
+	assert.ErrorIs(t, err, ErrDenied)
+	assert.Equal(t, TypePE, res.Type)
+	assert.True(t, res.ExtensionMismatch)
+}
+
+func TestDetectorAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   Config
+		t     Type
+		want  bool
+		error bool
+	}{
+		{name: "no list", t: TypePE, want: true},
+		{name: "denied category", cfg: Config{Deny: []string{"executable"}}, t: TypePE, want: false},
+		{name: "denied mime type", cfg: Config{Deny: []string{"application/*.macroEnabled.*"}}, t: TypeXLSM, want: false},
+		{name: "not denied", cfg: Config{Deny: []string{"executable"}}, t: TypePDF, want: true},
+		{name: "allowed", cfg: Config{Allow: []string{"image/*", "document"}}, t: TypePDF, want: true},
+		{name: "not allowed", cfg: Config{Allow: []string{"image/*", "document"}}, t: TypeZIP, want: false},
+		{name: "deny takes precedence", cfg: Config{Allow: []string{"document"}, Deny: []string{"application/pdf"}}, t: TypePDF, want: false},
+		{name: "unknown category", cfg: Config{Deny: []string{"binaries"}}, error: true},
+		{name: "invalid pattern", cfg: Config{Allow: []string{"image/["}}, error: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := New(tt.cfg)
+			if tt.error {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, d.allowed(tt.t))
+		})
+	}
+}
@@ -0,0 +1,292 @@
+// Package freshclam runs freshclam, the updater of the virus databases, as
+// background jobs.
+//
+// A single update runs at a time: starting an update while another one is
+// running returns the running one. The finished updates are kept in a
+// bounded history, with the result of each database parsed from the output
+// of freshclam.
+package freshclam
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// Default configuration of a Runner.
+const (
+	DefaultTimeout     = 10 * time.Minute
+	DefaultHistorySize = 10
+)
+
+// ErrNotFound indicates the job doesn't exist or is no longer in the history.
+var ErrNotFound = errors.New("freshclam job not found")
+
+// State is the state of a job.
+type State string
+
+// States of a job.
+const (
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+)
+
+// Results of the update of a database.
+const (
+	DatabaseUpdated  = "updated"
+	DatabaseUpToDate = "up_to_date"
+	DatabaseFailed   = "failed"
+)
+
+// Database is the result of the update of a database, eg. "daily".
+type Database struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Version is the version of the database after the update, if known.
+	Version int `json:"version,omitempty"`
+}
+
+// Job is a run of freshclam.
+type Job struct {
+	ID         string     `json:"id"`
+	State      State      `json:"state"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Databases  []Database `json:"databases,omitempty"`
+	// DatabaseVersion is the version of the databases reported by clamd once
+	// reloaded, if a database has been updated.
+	DatabaseVersion int `json:"database_version,omitempty"`
+	// Output is the combined stdout and stderr of freshclam.
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// UpdateFunc runs freshclam and returns its output, such as
+// clamav.Client.FreshClam.
+type UpdateFunc func(ctx context.Context) ([]byte, error)
+
+// Config is the configuration of a Runner.
+type Config struct {
+	// Timeout is the maximum duration of an update. Zero defaults to DefaultTimeout.
+	Timeout time.Duration
+	// HistorySize is the number of finished jobs kept. Zero defaults to DefaultHistorySize.
+	HistorySize int
+	// OnDone, if not nil, is called with each finished job, whoever started
+	// it, such as Reloader.Reload to reload clamd. Its error fails the job.
+	OnDone func(ctx context.Context, job *Job) error
+}
+
+// Runner runs the updates in the background, one at a time.
+// It is safe for concurrent use.
+type Runner struct {
+	update      UpdateFunc
+	timeout     time.Duration
+	historySize int
+	onDone      func(ctx context.Context, job *Job) error
+	now         func() time.Time
+
+	mu      sync.Mutex
+	current *run
+	// history holds the finished jobs, newest first.
+	history []Job
+}
+
+// run is the running job.
+type run struct {
+	job    Job
+	onDone func(Job)
+	done   chan struct{}
+}
+
+// New returns a Runner running the updates with update.
+func New(update UpdateFunc, cfg Config) *Runner {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.HistorySize <= 0 {
+		cfg.HistorySize = DefaultHistorySize
+	}
+	return &Runner{
+		update:      update,
+		timeout:     cfg.Timeout,
+		historySize: cfg.HistorySize,
+		onDone:      cfg.OnDone,
+		now:         time.Now,
+	}
+}
+
+// Start starts an update in the background and returns its job, or returns
+// the running job if an update is already running. started tells whether
+// the job has been started by this call, in which case onDone, if not nil,
+// is called with the finished job after the OnDone hook of the Runner and
+// before the job is moved to the history.
+//
+// The update outlives ctx, whose values are kept but not its cancellation.
+func (r *Runner) Start(ctx context.Context, onDone func(Job)) (job Job, started bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != nil {
+		return r.current.job, false
+	}
+
+	cur := &run{
+		job:    Job{ID: xid.New().String(), State: StateRunning, StartedAt: r.now()},
+		onDone: onDone,
+		done:   make(chan struct{}),
+	}
+	r.current = cur
+	go r.run(context.WithoutCancel(ctx), cur)
+
+	return cur.job, true
+}
+
+func (r *Runner) run(ctx context.Context, cur *run) {
+	updateCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	output, err := r.update(updateCtx)
+
+	job := cur.job
+	job.Output = string(output)
+	job.Databases = ParseOutput(job.Output)
+	job.State = StateSucceeded
+	if err != nil {
+		job.State = StateFailed
+		job.Error = err.Error()
+	}
+
+	// The hook isn't bound by the timeout of freshclam
+	if r.onDone != nil {
+		if err := r.onDone(ctx, &job); err != nil {
+			job.State = StateFailed
+			if job.Error != "" {
+				job.Error += "; "
+			}
+			job.Error += err.Error()
+		}
+	}
+	finished := r.now()
+	job.FinishedAt = &finished
+
+	if cur.onDone != nil {
+		cur.onDone(job)
+	}
+
+	r.mu.Lock()
+	cur.job = job
+	r.current = nil
+	r.history = append([]Job{job}, r.history...)
+	if len(r.history) > r.historySize {
+		r.history = r.history[:r.historySize]
+	}
+	r.mu.Unlock()
+
+	close(cur.done)
+}
+
+// Wait waits for the job id to finish and returns it.
+func (r *Runner) Wait(ctx context.Context, id string) (Job, error) {
+	var done chan struct{}
+	r.mu.Lock()
+	if r.current != nil && r.current.job.ID == id {
+		done = r.current.done
+	}
+	r.mu.Unlock()
+
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return Job{}, ctx.Err()
+		}
+	}
+
+	job, ok := r.Get(id)
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+// Get returns the job id, running or in the history.
+func (r *Runner) Get(id string) (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != nil && r.current.job.ID == id {
+		return r.current.job, true
+	}
+	for _, job := range r.history {
+		if job.ID == id {
+			return job, true
+		}
+	}
+	return Job{}, false
+}
+
+// Running returns the running job, if any.
+func (r *Runner) Running() (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current == nil {
+		return Job{}, false
+	}
+	return r.current.job, true
+}
+
+// History returns the finished jobs, newest first.
+func (r *Runner) History() []Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Job{}, r.history...)
+}
+
+var (
+	// daily.cld updated (version: 27001, sigs: 2070000, f-level: 90, builder: raynman)
+	updatedRegexp = regexp.MustCompile(`\b([A-Za-z0-9_-]+)\.c[lv]d updated \(version: ([0-9]+)`)
+	// main.cvd database is up-to-date (version: 62, ...), or with freshclam
+	// before 0.103: main.cvd is up to date (version: 62, ...)
+	upToDateRegexp = regexp.MustCompile(`\b([A-Za-z0-9_-]+)\.c[lv]d (?:database )?is up[- ]to[- ]date \(version: ([0-9]+)`)
+	// ERROR: Update failed for database: daily
+	failedRegexp = regexp.MustCompile(`[Uu]pdate failed for database: ([A-Za-z0-9_-]+)`)
+)
+
+// ParseOutput returns the result of each database reported by the output of
+// freshclam, in the order they are reported. A database reported several
+// times, such as when freshclam retries, has its last result.
+func ParseOutput(output string) []Database {
+	var dbs []Database
+	index := make(map[string]int)
+
+	add := func(db Database) {
+		if i, ok := index[db.Name]; ok {
+			dbs[i] = db
+			return
+		}
+		index[db.Name] = len(dbs)
+		dbs = append(dbs, db)
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if m := updatedRegexp.FindStringSubmatch(line); m != nil {
+			version, _ := strconv.Atoi(m[2])
+			add(Database{Name: m[1], Status: DatabaseUpdated, Version: version})
+		} else if m := upToDateRegexp.FindStringSubmatch(line); m != nil {
+			version, _ := strconv.Atoi(m[2])
+			add(Database{Name: m[1], Status: DatabaseUpToDate, Version: version})
+		} else if m := failedRegexp.FindStringSubmatch(line); m != nil {
+			add(Database{Name: m[1], Status: DatabaseFailed})
+		}
+	}
+	return dbs
+}
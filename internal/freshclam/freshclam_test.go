@@ -0,0 +1,159 @@
+package freshclam
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const output = `ClamAV update process started at Sat Oct 17 10:00:00 2026
+daily database available for update (local version: 27000, remote version: 27001)
+Testing database: '/var/lib/clamav/tmp.4c2a1/clamav-0e1f.tmp-daily.cld' ...
+Database test passed.
+daily.cld updated (version: 27001, sigs: 2070000, f-level: 90, builder: raynman)
+main.cvd database is up-to-date (version: 62, sigs: 6647427, f-level: 90, builder: sigmgr)
+bytecode.cvd is up to date (version: 335, sigs: 86, f-level: 90, builder: raynman)
+`
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []Database
+	}{
+		{
+			name:   "updated",
+			output: output,
+			want: []Database{
+				{Name: "daily", Status: DatabaseUpdated, Version: 27001},
+				{Name: "main", Status: DatabaseUpToDate, Version: 62},
+				{Name: "bytecode", Status: DatabaseUpToDate, Version: 335},
+			},
+		},
+		{
+			name:   "failed",
+			output: "Sat Oct 17 10:00:00 2026 -> ERROR: Update failed for database: daily\r\nSat Oct 17 10:00:01 2026 -> main.cvd database is up-to-date (version: 62)\r\n",
+			want: []Database{
+				{Name: "daily", Status: DatabaseFailed},
+				{Name: "main", Status: DatabaseUpToDate, Version: 62},
+			},
+		},
+		{
+			name:   "retried",
+			output: "ERROR: Update failed for database: daily\ndaily.cld updated (version: 27001, sigs: 2070000)\n",
+			want:   []Database{{Name: "daily", Status: DatabaseUpdated, Version: 27001}},
+		},
+		{name: "empty", output: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseOutput(tt.output))
+		})
+	}
+}
+
+func TestRunner(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	r := New(func(ctx context.Context) ([]byte, error) {
+		calls.Add(1)
+		<-release
+		return []byte(output), nil
+	}, Config{})
+
+	// Concurrent starts share the running job
+	var finished Job
+	job, started := r.Start(context.Background(), func(job Job) { finished = job })
+	require.True(t, started)
+	assert.Equal(t, StateRunning, job.State)
+	other, started := r.Start(context.Background(), nil)
+	assert.False(t, started)
+	assert.Equal(t, job.ID, other.ID)
+
+	running, ok := r.Running()
+	require.True(t, ok)
+	assert.Equal(t, job.ID, running.ID)
+	assert.Empty(t, r.History())
+
+	close(release)
+	job, err := r.Wait(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StateSucceeded, job.State)
+	assert.NotNil(t, job.FinishedAt)
+	assert.Len(t, job.Databases, 3)
+	assert.Equal(t, output, job.Output)
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, job, finished)
+
+	_, ok = r.Running()
+	assert.False(t, ok)
+	got, ok := r.Get(job.ID)
+	require.True(t, ok)
+	assert.Equal(t, job, got)
+
+	// Finished jobs can be waited for
+	got, err = r.Wait(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, job, got)
+	_, err = r.Wait(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRunnerHistory(t *testing.T) {
+	fail := true
+	r := New(func(ctx context.Context) ([]byte, error) {
+		if fail {
+			return []byte("ERROR: Update failed for database: daily\n"), errors.New("freshclam command failed: exit status 1")
+		}
+		return []byte(output), nil
+	}, Config{HistorySize: 2})
+
+	var ids []string
+	for i := range 3 {
+		fail = i == 0
+		job, started := r.Start(context.Background(), nil)
+		require.True(t, started)
+		job, err := r.Wait(context.Background(), job.ID)
+		require.NoError(t, err)
+		ids = append(ids, job.ID)
+
+		if i == 0 {
+			assert.Equal(t, StateFailed, job.State)
+			assert.Equal(t, "freshclam command failed: exit status 1", job.Error)
+			assert.Equal(t, []Database{{Name: "daily", Status: DatabaseFailed}}, job.Databases)
+		}
+	}
+
+	history := r.History()
+	require.Len(t, history, 2)
+	assert.Equal(t, ids[2], history[0].ID)
+	assert.Equal(t, ids[1], history[1].ID)
+	_, ok := r.Get(ids[0])
+	assert.False(t, ok)
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	type key struct{}
+	r := New(func(ctx context.Context) ([]byte, error) {
+		if ctx.Value(key{}) != "value" {
+			return nil, errors.New("missing context value")
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, Config{Timeout: 10 * time.Millisecond})
+
+	// The job outlives the context it is started with, not its timeout
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+	job, _ := r.Start(ctx, nil)
+	cancel()
+
+	job, err := r.Wait(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StateFailed, job.State)
+	assert.Equal(t, context.DeadlineExceeded.Error(), job.Error)
+}
@@ -0,0 +1,96 @@
+package freshclam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+)
+
+// Clamd reloads clamd and reports the version of its databases.
+type Clamd interface {
+	Reload(ctx context.Context) error
+	Version(ctx context.Context) ([]byte, error)
+}
+
+// Reloader reloads clamd once a database has been updated, until clamd
+// reports the new version of the databases.
+type Reloader struct {
+	clamd           Clamd
+	confirmTimeout  time.Duration
+	confirmInterval time.Duration
+}
+
+// NewReloader returns a Reloader reloading clamd, which is given
+// confirmTimeout to report the new version of the databases. Zero defaults
+// to DefaultConfirmTimeout.
+func NewReloader(clamd Clamd, confirmTimeout time.Duration) *Reloader {
+	if confirmTimeout <= 0 {
+		confirmTimeout = DefaultConfirmTimeout
+	}
+	return &Reloader{
+		clamd:           clamd,
+		confirmTimeout:  confirmTimeout,
+		confirmInterval: time.Second,
+	}
+}
+
+// Reload reloads clamd if a database of job has been updated, even by a
+// failed update, and sets the DatabaseVersion of job to the version reported
+// by clamd. It is meant as the OnDone hook of a Runner.
+func (rl *Reloader) Reload(ctx context.Context, job *Job) error {
+	var changed bool
+	var want int
+	for _, db := range job.Databases {
+		changed = changed || db.Status == DatabaseUpdated
+		want = max(want, db.Version)
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := rl.clamd.Reload(ctx); err != nil {
+		return fmt.Errorf("error while reloading clamd: %w", err)
+	}
+	version, err := rl.confirm(ctx, want)
+	if err != nil {
+		return err
+	}
+	job.DatabaseVersion = version
+	return nil
+}
+
+// confirm waits for clamd, which reloads its databases in the background,
+// to report the version want of the databases, and returns the reported version.
+func (rl *Reloader) confirm(ctx context.Context, want int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, rl.confirmTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(rl.confirmInterval)
+	defer ticker.Stop()
+
+	var got int
+	for {
+		reply, err := rl.clamd.Version(ctx)
+		if err == nil {
+			var v clamav.VersionInfo
+			if v, err = clamav.ParseVersion(reply); err == nil {
+				got = v.Database
+				if got >= want {
+					return got, nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+				return 0, fmt.Errorf("error while confirming the version of the databases: %w", err)
+			}
+			return 0, fmt.Errorf("clamd reports the version %d of the databases instead of %d after the reload", got, want)
+		case <-ticker.C:
+		}
+	}
+}
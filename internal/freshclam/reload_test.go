@@ -0,0 +1,117 @@
+package freshclam
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClamd reports the version of the databases once reloaded, after
+// versionDelay calls to Version.
+type fakeClamd struct {
+	mu           sync.Mutex
+	reloads      int
+	reloadErr    error
+	version      string
+	reloaded     string
+	versionDelay int
+}
+
+func (f *fakeClamd) Reload(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reloads++
+	return f.reloadErr
+}
+
+func (f *fakeClamd) Version(context.Context) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.reloads > 0 && f.versionDelay == 0 {
+		return []byte(f.reloaded), nil
+	}
+	f.versionDelay--
+	return []byte(f.version), nil
+}
+
+// newTestReloader returns a Reloader of clamd polling it every millisecond.
+func newTestReloader(clamd Clamd) *Reloader {
+	rl := NewReloader(clamd, 50*time.Millisecond)
+	rl.confirmInterval = time.Millisecond
+	return rl
+}
+
+func TestReloaderRunner(t *testing.T) {
+	const updated = "daily.cld updated (version: 27001, sigs: 2070000)\nmain.cvd database is up-to-date (version: 62, sigs: 6647427)\n"
+	const upToDate = "daily.cld database is up-to-date (version: 27000, sigs: 2069000)\n"
+
+	tests := []struct {
+		name        string
+		output      string
+		updateErr   error
+		clamd       *fakeClamd
+		wantReloads int
+		wantState   State
+		wantVersion int
+		wantErr     string
+	}{
+		{
+			name:        "updated",
+			output:      updated,
+			clamd:       &fakeClamd{version: "ClamAV 1.4.2/27000/Fri Oct 16 08:00:00 2026", reloaded: "ClamAV 1.4.2/27001/Sat Oct 17 08:00:00 2026", versionDelay: 1},
+			wantReloads: 1,
+			wantState:   StateSucceeded,
+			wantVersion: 27001,
+		},
+		{
+			name:      "up to date",
+			output:    upToDate,
+			clamd:     &fakeClamd{},
+			wantState: StateSucceeded,
+		},
+		{
+			name:        "partly failed update",
+			output:      updated + "ERROR: Update failed for database: bytecode\n",
+			updateErr:   errors.New("freshclam command failed: exit status 1"),
+			clamd:       &fakeClamd{reloaded: "ClamAV 1.4.2/27001/Sat Oct 17 08:00:00 2026"},
+			wantReloads: 1,
+			wantState:   StateFailed,
+			wantVersion: 27001,
+			wantErr:     "freshclam command failed: exit status 1",
+		},
+		{
+			name:        "reload failure",
+			output:      updated,
+			clamd:       &fakeClamd{reloadErr: errors.New("connection refused")},
+			wantReloads: 1,
+			wantState:   StateFailed,
+			wantErr:     "error while reloading clamd: connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(func(context.Context) ([]byte, error) {
+				return []byte(tt.output), tt.updateErr
+			}, Config{OnDone: newTestReloader(tt.clamd).Reload})
+
+			// A job started through the API reloads clamd as well, before
+			// its own callback
+			var done Job
+			job, started := r.Start(context.Background(), func(job Job) { done = job })
+			require.True(t, started)
+			job, err := r.Wait(context.Background(), job.ID)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantReloads, tt.clamd.reloads)
+			assert.Equal(t, tt.wantState, job.State)
+			assert.Equal(t, tt.wantVersion, job.DatabaseVersion)
+			assert.Equal(t, tt.wantErr, job.Error)
+			assert.Equal(t, job, done)
+		})
+	}
+}
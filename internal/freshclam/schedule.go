@@ -0,0 +1,200 @@
+package freshclam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/metrics"
+	"github.com/rs/zerolog"
+)
+
+// Default configuration of a Scheduler.
+const (
+	DefaultJitter         = 5 * time.Minute
+	DefaultBackoff        = time.Minute
+	DefaultMaxBackoff     = time.Hour
+	DefaultConfirmTimeout = 2 * time.Minute
+)
+
+// Health of the scheduled updates.
+const (
+	// HealthPending is the health until the first scheduled update finishes.
+	HealthPending = "pending"
+	HealthOK      = "ok"
+	HealthFailing = "failing"
+)
+
+// ScheduleConfig is the configuration of a Scheduler.
+type ScheduleConfig struct {
+	// Interval is the interval between two successful updates.
+	Interval time.Duration
+	// Jitter is the maximum random delay added to each delay, so that the
+	// instances started together don't update together. Zero disables it.
+	Jitter time.Duration
+	// Backoff is the delay before retrying a failed update, doubled after
+	// each failure up to MaxBackoff. Zero defaults to DefaultBackoff.
+	Backoff time.Duration
+	// MaxBackoff is the maximum delay before retrying a failed update.
+	// Zero defaults to DefaultMaxBackoff.
+	MaxBackoff time.Duration
+}
+
+// ScheduleStatus is the status of the scheduled updates.
+type ScheduleStatus struct {
+	Health              string     `json:"health"`
+	NextRun             *time.Time `json:"next_run,omitempty"`
+	LastRun             *time.Time `json:"last_run,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastJobID           string     `json:"last_job_id,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	// DatabaseVersion is the version of the databases reported by clamd
+	// after the last reload.
+	DatabaseVersion int `json:"database_version,omitempty"`
+}
+
+// Scheduler runs the updates of a Runner on an interval. The failed updates,
+// including the failed reloads of clamd by the OnDone hook of the Runner,
+// are retried with an exponential backoff.
+type Scheduler struct {
+	runner *Runner
+	cfg    ScheduleConfig
+	now    func() time.Time
+	jitter func(limit time.Duration) time.Duration
+
+	mu     sync.Mutex
+	status ScheduleStatus
+}
+
+// NewScheduler returns a Scheduler running the updates of runner.
+func NewScheduler(runner *Runner, cfg ScheduleConfig) *Scheduler {
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	return &Scheduler{
+		runner: runner,
+		cfg:    cfg,
+		now:    time.Now,
+		jitter: func(limit time.Duration) time.Duration {
+			if limit <= 0 {
+				return 0
+			}
+			return rand.N(limit)
+		},
+		status: ScheduleStatus{Health: HealthPending},
+	}
+}
+
+// Status returns the status of the scheduled updates.
+func (s *Scheduler) Status() ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.status
+}
+
+// Run runs the updates until ctx is done, the first one after the jitter.
+func (s *Scheduler) Run(ctx context.Context, logger *zerolog.Logger) {
+	delay := s.jitter(s.cfg.Jitter)
+	for {
+		next := s.now().Add(delay)
+		s.mu.Lock()
+		s.status.NextRun = &next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		delay = s.RunOnce(ctx, logger)
+	}
+}
+
+// RunOnce runs an update and returns the delay before the next update. An update already running, such
+// as one requested through the API, is waited for instead of starting another.
+func (s *Scheduler) RunOnce(ctx context.Context, logger *zerolog.Logger) time.Duration {
+	started := s.now()
+	job, changed, version, err := s.update(ctx)
+	finished := s.now()
+	if ctx.Err() != nil {
+		// Shutting down
+		return 0
+	}
+
+	s.mu.Lock()
+	s.status.LastRun = &started
+	s.status.LastJobID = job.ID
+	if err != nil {
+		s.status.Health = HealthFailing
+		s.status.ConsecutiveFailures++
+		s.status.LastError = err.Error()
+	} else {
+		s.status.Health = HealthOK
+		s.status.ConsecutiveFailures = 0
+		s.status.LastError = ""
+		s.status.LastSuccess = &finished
+		if version > 0 {
+			s.status.DatabaseVersion = version
+		}
+	}
+	failures := s.status.ConsecutiveFailures
+	s.mu.Unlock()
+
+	metrics.FreshClamConsecutiveFailures.Set(float64(failures))
+
+	if err != nil {
+		metrics.FreshClamUpdates.WithLabelValues(DatabaseFailed).Inc()
+
+		delay := s.backoff(failures) + s.jitter(s.cfg.Jitter)
+		logger.Error().Err(err).Str("job_id", job.ID).Int("failures", failures).Dur("retry_in", delay).Msg("scheduled freshclam update failed")
+		return delay
+	}
+
+	metrics.FreshClamLastSuccess.Set(float64(finished.Unix()))
+	if !changed {
+		metrics.FreshClamUpdates.WithLabelValues(DatabaseUpToDate).Inc()
+		logger.Debug().Str("job_id", job.ID).Msg("virus databases are up to date")
+	} else {
+		metrics.FreshClamUpdates.WithLabelValues(DatabaseUpdated).Inc()
+		metrics.ClamdDatabaseVersion.Set(float64(version))
+		logger.Info().Str("job_id", job.ID).Int("database_version", version).Msg("virus databases updated and reloaded")
+	}
+	return s.cfg.Interval + s.jitter(s.cfg.Jitter)
+}
+
+// update runs an update, reporting whether a database has been updated.
+// version is the version of the databases reported by clamd after the reload.
+func (s *Scheduler) update(ctx context.Context) (job Job, changed bool, version int, err error) {
+	job, _ = s.runner.Start(ctx, nil)
+	job, err = s.runner.Wait(ctx, job.ID)
+	if err != nil {
+		return job, false, 0, fmt.Errorf("error while waiting for freshclam: %w", err)
+	}
+	for _, db := range job.Databases {
+		changed = changed || db.Status == DatabaseUpdated
+	}
+	if job.State == StateFailed {
+		return job, changed, 0, errors.New(job.Error)
+	}
+	return job, changed, job.DatabaseVersion, nil
+}
+
+// backoff returns the delay before retrying after failures consecutive failures.
+func (s *Scheduler) backoff(failures int) time.Duration {
+	delay := s.cfg.Backoff
+	for i := 1; i < failures && delay < s.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, s.cfg.MaxBackoff)
+}
@@ -0,0 +1,159 @@
+package freshclam
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestScheduler(update UpdateFunc, clamd Clamd) *Scheduler {
+	return NewScheduler(New(update, Config{OnDone: newTestReloader(clamd).Reload}), ScheduleConfig{
+		Interval:   time.Hour,
+		Backoff:    time.Minute,
+		MaxBackoff: 5 * time.Minute,
+	})
+}
+
+func TestSchedulerRunOnce(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	const upToDate = "daily.cld database is up-to-date (version: 27000, sigs: 2069000)\nmain.cvd database is up-to-date (version: 62, sigs: 6647427)\n"
+	const updated = "daily.cld updated (version: 27001, sigs: 2070000)\nmain.cvd database is up-to-date (version: 62, sigs: 6647427)\n"
+
+	tests := []struct {
+		name        string
+		output      string
+		updateErr   error
+		clamd       *fakeClamd
+		wantReloads int
+		wantHealth  string
+		wantVersion int
+		wantErr     string
+	}{
+		{
+			name:       "up to date",
+			output:     upToDate,
+			clamd:      &fakeClamd{version: "ClamAV 1.4.2/27000/Fri Oct 16 08:00:00 2026"},
+			wantHealth: HealthOK,
+		},
+		{
+			name:        "updated",
+			output:      updated,
+			clamd:       &fakeClamd{version: "ClamAV 1.4.2/27000/Fri Oct 16 08:00:00 2026", reloaded: "ClamAV 1.4.2/27001/Sat Oct 17 08:00:00 2026", versionDelay: 2},
+			wantReloads: 1,
+			wantHealth:  HealthOK,
+			wantVersion: 27001,
+		},
+		{
+			name:       "freshclam failure",
+			output:     "ERROR: Update failed for database: daily\n",
+			updateErr:  errors.New("freshclam command failed: exit status 1"),
+			clamd:      &fakeClamd{},
+			wantHealth: HealthFailing,
+			wantErr:    "freshclam command failed: exit status 1",
+		},
+		{
+			name:        "reload failure",
+			output:      updated,
+			clamd:       &fakeClamd{reloadErr: errors.New("connection refused")},
+			wantReloads: 1,
+			wantHealth:  HealthFailing,
+			wantErr:     "error while reloading clamd: connection refused",
+		},
+		{
+			name:        "version not confirmed",
+			output:      updated,
+			clamd:       &fakeClamd{version: "ClamAV 1.4.2/27000/Fri Oct 16 08:00:00 2026", reloaded: "ClamAV 1.4.2/27000/Fri Oct 16 08:00:00 2026"},
+			wantReloads: 1,
+			wantHealth:  HealthFailing,
+			wantErr:     "clamd reports the version 27000 of the databases instead of 27001 after the reload",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScheduler(func(context.Context) ([]byte, error) {
+				return []byte(tt.output), tt.updateErr
+			}, tt.clamd)
+
+			delay := s.RunOnce(context.Background(), &logger)
+			assert.Equal(t, tt.wantReloads, tt.clamd.reloads)
+
+			status := s.Status()
+			assert.Equal(t, tt.wantHealth, status.Health)
+			assert.Equal(t, tt.wantVersion, status.DatabaseVersion)
+			assert.Equal(t, tt.wantErr, status.LastError)
+			assert.NotEmpty(t, status.LastJobID)
+			assert.NotNil(t, status.LastRun)
+			if tt.wantErr != "" {
+				assert.Equal(t, 1, status.ConsecutiveFailures)
+				assert.Nil(t, status.LastSuccess)
+				assert.Equal(t, time.Minute, delay)
+			} else {
+				assert.Equal(t, 0, status.ConsecutiveFailures)
+				assert.NotNil(t, status.LastSuccess)
+				assert.Equal(t, time.Hour, delay)
+			}
+		})
+	}
+}
+
+func TestSchedulerBackoff(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	fail := true
+	s := newTestScheduler(func(context.Context) ([]byte, error) {
+		if fail {
+			return nil, errors.New("freshclam command failed: exit status 1")
+		}
+		return []byte("daily.cld database is up-to-date (version: 27000)\n"), nil
+	}, &fakeClamd{})
+
+	var delays []time.Duration
+	for range 5 {
+		delays = append(delays, s.RunOnce(context.Background(), &logger))
+	}
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}, delays)
+	assert.Equal(t, 5, s.Status().ConsecutiveFailures)
+
+	// A success resets the backoff
+	fail = false
+	assert.Equal(t, time.Hour, s.RunOnce(context.Background(), &logger))
+	assert.Equal(t, 0, s.Status().ConsecutiveFailures)
+	fail = true
+	assert.Equal(t, time.Minute, s.RunOnce(context.Background(), &logger))
+}
+
+func TestSchedulerRun(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	runs := make(chan struct{}, 10)
+	s := newTestScheduler(func(context.Context) ([]byte, error) {
+		runs <- struct{}{}
+		return []byte("daily.cld database is up-to-date (version: 27000)\n"), nil
+	}, &fakeClamd{})
+	s.cfg.Interval = time.Millisecond
+
+	assert.Equal(t, HealthPending, s.Status().Health)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx, &logger)
+		close(done)
+	}()
+
+	for range 3 {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatal("update not run")
+		}
+	}
+	cancel()
+	<-done
+
+	require.NotNil(t, s.Status().NextRun)
+}
@@ -0,0 +1,350 @@
+package freshclam
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidSettings indicates settings which can't be written to the
+// configuration file of freshclam.
+var ErrInvalidSettings = errors.New("invalid freshclam settings")
+
+// Directives of the configuration file of freshclam managed by a SettingsStore.
+const (
+	directivePrivateMirror     = "PrivateMirror"
+	directiveDatabaseCustomURL = "DatabaseCustomURL"
+	directiveProxyServer       = "HTTPProxyServer"
+	directiveProxyPort         = "HTTPProxyPort"
+	directiveProxyUsername     = "HTTPProxyUsername"
+	directiveProxyPassword     = "HTTPProxyPassword"
+)
+
+var managedDirectives = []string{
+	directivePrivateMirror,
+	directiveDatabaseCustomURL,
+	directiveProxyServer,
+	directiveProxyPort,
+	directiveProxyUsername,
+	directiveProxyPassword,
+}
+
+// managedHeader starts the block of the managed directives of the configuration file.
+const managedHeader = "# Managed by clamav-api-go through /rest/v1/freshclam/config, changes are overwritten"
+
+// Settings are the settings of freshclam managed through the API.
+type Settings struct {
+	// PrivateMirrors are the mirrors used instead of the official ones,
+	// as hostnames or http(s) URLs.
+	PrivateMirrors []string `json:"private_mirrors"`
+	// DatabaseCustomURLs are the URLs of the extra databases.
+	DatabaseCustomURLs []string `json:"database_custom_urls"`
+	// Proxy is the HTTP proxy freshclam connects through, if any.
+	Proxy *Proxy `json:"proxy,omitempty"`
+}
+
+// Proxy is the HTTP proxy freshclam connects through.
+type Proxy struct {
+	Server   string `json:"server"`
+	Port     int    `json:"port"`
+	Username string `json:"username,omitempty"`
+	// Password is never returned by the API: PasswordSet tells whether it's set.
+	Password    string `json:"password,omitempty"`
+	PasswordSet bool   `json:"password_set"`
+}
+
+// Redacted returns s without the password of the proxy.
+func (s Settings) Redacted() Settings {
+	if s.Proxy != nil {
+		p := *s.Proxy
+		p.PasswordSet = p.Password != ""
+		p.Password = ""
+		s.Proxy = &p
+	}
+	return s
+}
+
+// normalized returns s with empty lists instead of nil ones.
+func (s Settings) normalized() Settings {
+	if s.PrivateMirrors == nil {
+		s.PrivateMirrors = []string{}
+	}
+	if s.DatabaseCustomURLs == nil {
+		s.DatabaseCustomURLs = []string{}
+	}
+	return s
+}
+
+// hostnameRegexp matches hostnames, with an optional port.
+var hostnameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,62}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,62}[A-Za-z0-9])?)*(:[0-9]{1,5})?$`)
+
+// Validate returns an error wrapping ErrInvalidSettings if s can't be
+// written to the configuration file.
+func (s Settings) Validate() error {
+	for _, m := range s.PrivateMirrors {
+		if err := validateHost(m, "http", "https"); err != nil {
+			return fmt.Errorf("%w: private mirror %q: %w", ErrInvalidSettings, m, err)
+		}
+	}
+	for _, u := range s.DatabaseCustomURLs {
+		if err := validateDatabaseURL(u); err != nil {
+			return fmt.Errorf("%w: database custom url %q: %w", ErrInvalidSettings, u, err)
+		}
+	}
+	if p := s.Proxy; p != nil {
+		if err := validateHost(p.Server, "http", "https"); err != nil {
+			return fmt.Errorf("%w: proxy server %q: %w", ErrInvalidSettings, p.Server, err)
+		}
+		if p.Port < 1 || p.Port > 65535 {
+			return fmt.Errorf("%w: proxy port must be between 1 and 65535", ErrInvalidSettings)
+		}
+		if !validValue(p.Username) || !validValue(p.Password) {
+			return fmt.Errorf("%w: proxy credentials must not contain spaces or control characters", ErrInvalidSettings)
+		}
+		if p.Password != "" && p.Username == "" {
+			return fmt.Errorf("%w: proxy password requires a username", ErrInvalidSettings)
+		}
+	}
+	return nil
+}
+
+// validateHost validates a hostname, with an optional port, or a URL of
+// one of the schemes.
+func validateHost(s string, schemes ...string) error {
+	if !strings.Contains(s, "://") {
+		if !hostnameRegexp.MatchString(s) {
+			return errors.New("must be a hostname or a url")
+		}
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || !validValue(s) {
+		return errors.New("must be a valid url")
+	}
+	if !slices.Contains(schemes, u.Scheme) {
+		return fmt.Errorf("scheme must be one of %s", strings.Join(schemes, ", "))
+	}
+	if u.Host == "" || !hostnameRegexp.MatchString(u.Host) && net.ParseIP(u.Hostname()) == nil {
+		return errors.New("must have a valid host")
+	}
+	return nil
+}
+
+// validateDatabaseURL validates the URL of an extra database. Local files
+// aren't allowed: they would let clients load any file readable by freshclam.
+func validateDatabaseURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || !validValue(s) {
+		return errors.New("must be a valid url")
+	}
+	switch u.Scheme {
+	case "http", "https", "ftp", "ftps":
+		if u.Host == "" {
+			return errors.New("must have a host")
+		}
+	default:
+		return errors.New("scheme must be one of http, https, ftp, ftps")
+	}
+	if name := filepath.Base(u.Path); !strings.Contains(name, ".") || strings.HasPrefix(name, ".") {
+		return errors.New("must end with the file name of a database")
+	}
+	return nil
+}
+
+// validValue returns true if s holds no space or control character, which
+// would break the line of its directive.
+func validValue(s string) bool {
+	return !strings.ContainsFunc(s, func(r rune) bool { return r <= ' ' || r == 0x7f })
+}
+
+// SettingsStore renders the settings managed through the API, along the
+// directives of a template, into the configuration file of freshclam.
+// It is safe for concurrent use.
+type SettingsStore struct {
+	template string
+	path     string
+
+	mu       sync.Mutex
+	settings Settings
+}
+
+// NewSettingsStore returns a SettingsStore rendering the template into path.
+// The settings are loaded from path, if it exists, so that they survive
+// restarts, and the configuration file is rendered again so that the
+// changes of the template apply.
+func NewSettingsStore(template, path string) (*SettingsStore, error) {
+	s := &SettingsStore{template: template, path: path}
+	if b, err := os.ReadFile(path); err == nil {
+		s.settings, err = parseSettings(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("error while loading freshclam settings: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error while loading freshclam settings: %w", err)
+	}
+	s.settings = s.settings.normalized()
+	if err := s.render(s.settings); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the path of the rendered configuration file.
+func (s *SettingsStore) Path() string {
+	return s.path
+}
+
+// Settings returns the current settings.
+func (s *SettingsStore) Settings() Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.settings
+}
+
+// Update validates settings, which replace the current ones, and renders
+// the configuration file. The password of the proxy is kept if it isn't
+// given and the proxy username is unchanged.
+func (s *SettingsStore) Update(settings Settings) (Settings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if settings.Proxy != nil {
+		p := *settings.Proxy
+		p.PasswordSet = false
+		if cur := s.settings.Proxy; cur != nil && p.Password == "" && p.Username == cur.Username {
+			p.Password = cur.Password
+		}
+		settings.Proxy = &p
+	}
+	settings = settings.normalized()
+	if err := settings.Validate(); err != nil {
+		return Settings{}, err
+	}
+	if err := s.render(settings); err != nil {
+		return Settings{}, err
+	}
+	s.settings = settings
+	return settings, nil
+}
+
+// render writes the template without its managed directives, followed by
+// the settings, to the configuration file. The file is replaced atomically,
+// so that freshclam never reads it half written.
+func (s *SettingsStore) render(settings Settings) error {
+	tmpl, err := os.ReadFile(s.template)
+	if err != nil {
+		return fmt.Errorf("error while reading freshclam configuration template: %w", err)
+	}
+
+	var b strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(string(tmpl)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == managedHeader {
+			break
+		}
+		if fields := strings.Fields(line); len(fields) > 0 && slices.Contains(managedDirectives, fields[0]) {
+			continue
+		}
+		b.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error while reading freshclam configuration template: %w", err)
+	}
+
+	b.WriteString("\n" + managedHeader + "\n")
+	for _, m := range settings.PrivateMirrors {
+		fmt.Fprintf(&b, "%s %s\n", directivePrivateMirror, m)
+	}
+	for _, u := range settings.DatabaseCustomURLs {
+		fmt.Fprintf(&b, "%s %s\n", directiveDatabaseCustomURL, u)
+	}
+	if p := settings.Proxy; p != nil {
+		fmt.Fprintf(&b, "%s %s\n%s %d\n", directiveProxyServer, p.Server, directiveProxyPort, p.Port)
+		if p.Username != "" {
+			fmt.Fprintf(&b, "%s %s\n", directiveProxyUsername, p.Username)
+		}
+		if p.Password != "" {
+			fmt.Fprintf(&b, "%s %s\n", directiveProxyPassword, p.Password)
+		}
+	}
+
+	// The file may hold the password of the proxy
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".tmp-"+filepath.Base(s.path))
+	if err != nil {
+		return fmt.Errorf("error while writing freshclam configuration: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error while writing freshclam configuration: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error while writing freshclam configuration: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("error while writing freshclam configuration: %w", err)
+	}
+	return nil
+}
+
+// parseSettings parses the managed directives of a rendered configuration file.
+func parseSettings(conf string) (Settings, error) {
+	var s Settings
+	var managed bool
+	scanner := bufio.NewScanner(strings.NewReader(conf))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == managedHeader {
+			managed = true
+			continue
+		}
+		directive, value, _ := strings.Cut(line, " ")
+		if !managed || !slices.Contains(managedDirectives, directive) {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch directive {
+		case directivePrivateMirror:
+			s.PrivateMirrors = append(s.PrivateMirrors, value)
+		case directiveDatabaseCustomURL:
+			s.DatabaseCustomURLs = append(s.DatabaseCustomURLs, value)
+		default:
+			if s.Proxy == nil {
+				s.Proxy = &Proxy{}
+			}
+			switch directive {
+			case directiveProxyServer:
+				s.Proxy.Server = value
+			case directiveProxyPort:
+				port, err := strconv.Atoi(value)
+				if err != nil {
+					return Settings{}, fmt.Errorf("%w: invalid proxy port %q", ErrInvalidSettings, value)
+				}
+				s.Proxy.Port = port
+			case directiveProxyUsername:
+				s.Proxy.Username = value
+			case directiveProxyPassword:
+				s.Proxy.Password = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Settings{}, err
+	}
+	if err := s.Validate(); err != nil {
+		return Settings{}, err
+	}
+	return s, nil
+}
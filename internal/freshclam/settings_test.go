@@ -0,0 +1,108 @@
+package freshclam
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettingsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		wantErr  bool
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			settings: Settings{
+				PrivateMirrors:     []string{"mirror.example.com", "https://mirror.example.com:8443/clamav", "10.0.0.1:8080", "http://[::1]:8080"},
+				DatabaseCustomURLs: []string{"https://example.com/sigs/custom.ndb", "ftp://example.com/sigs/custom.hdb"},
+				Proxy:              &Proxy{Server: "proxy.example.com", Port: 3128, Username: "user", Password: "secret"},
+			},
+		},
+		{name: "mirror with space", settings: Settings{PrivateMirrors: []string{"mirror.example.com OnUpdateExecute"}}, wantErr: true},
+		{name: "mirror with newline", settings: Settings{PrivateMirrors: []string{"https://mirror.example.com\nOnUpdateExecute /bin/sh"}}, wantErr: true},
+		{name: "mirror with invalid scheme", settings: Settings{PrivateMirrors: []string{"ftp://mirror.example.com"}}, wantErr: true},
+		{name: "custom url with invalid scheme", settings: Settings{DatabaseCustomURLs: []string{"gopher://example.com/custom.ndb"}}, wantErr: true},
+		{name: "custom url of a local file", settings: Settings{DatabaseCustomURLs: []string{"file:///opt/sigs/local.hdb"}}, wantErr: true},
+		{name: "custom url without database", settings: Settings{DatabaseCustomURLs: []string{"https://example.com/"}}, wantErr: true},
+		{name: "custom url without host", settings: Settings{DatabaseCustomURLs: []string{"https:///custom.ndb"}}, wantErr: true},
+		{name: "proxy without port", settings: Settings{Proxy: &Proxy{Server: "proxy.example.com"}}, wantErr: true},
+		{name: "proxy with invalid server", settings: Settings{Proxy: &Proxy{Server: "proxy example", Port: 3128}}, wantErr: true},
+		{name: "proxy password without username", settings: Settings{Proxy: &Proxy{Server: "proxy.example.com", Port: 3128, Password: "secret"}}, wantErr: true},
+		{name: "proxy password with newline", settings: Settings{Proxy: &Proxy{Server: "proxy.example.com", Port: 3128, Username: "user", Password: "a\nb"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settings.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidSettings)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSettingsStore(t *testing.T) {
+	dir := t.TempDir()
+	template := filepath.Join(dir, "freshclam.conf.template")
+	path := filepath.Join(dir, "freshclam.conf")
+	require.NoError(t, os.WriteFile(template, []byte("DatabaseDirectory /var/lib/clamav\nDatabaseMirror database.clamav.net\n# PrivateMirror mirror.example.com\nHTTPProxyServer template-proxy\n"), 0o600))
+
+	s, err := NewSettingsStore(template, path)
+	require.NoError(t, err)
+	assert.Equal(t, path, s.Path())
+	assert.Equal(t, Settings{PrivateMirrors: []string{}, DatabaseCustomURLs: []string{}}, s.Settings())
+
+	conf, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "DatabaseDirectory /var/lib/clamav\nDatabaseMirror database.clamav.net\n# PrivateMirror mirror.example.com\n\n"+managedHeader+"\n", string(conf))
+
+	_, err = s.Update(Settings{PrivateMirrors: []string{"mirror.example.com OnUpdateExecute"}})
+	require.ErrorIs(t, err, ErrInvalidSettings)
+
+	updated, err := s.Update(Settings{
+		PrivateMirrors:     []string{"mirror.example.com"},
+		DatabaseCustomURLs: []string{"https://example.com/custom.ndb"},
+		Proxy:              &Proxy{Server: "proxy.example.com", Port: 3128, Username: "user", Password: "secret"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "secret", updated.Proxy.Password)
+	assert.Equal(t, &Proxy{Server: "proxy.example.com", Port: 3128, Username: "user", PasswordSet: true}, updated.Redacted().Proxy)
+
+	conf, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "DatabaseDirectory /var/lib/clamav\nDatabaseMirror database.clamav.net\n# PrivateMirror mirror.example.com\n\n"+managedHeader+"\n"+
+		"PrivateMirror mirror.example.com\nDatabaseCustomURL https://example.com/custom.ndb\n"+
+		"HTTPProxyServer proxy.example.com\nHTTPProxyPort 3128\nHTTPProxyUsername user\nHTTPProxyPassword secret\n", string(conf))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// The password is kept while the username is unchanged
+	updated, err = s.Update(Settings{Proxy: &Proxy{Server: "proxy.example.com", Port: 8080, Username: "user"}})
+	require.NoError(t, err)
+	assert.Equal(t, "secret", updated.Proxy.Password)
+	updated, err = s.Update(Settings{Proxy: &Proxy{Server: "proxy.example.com", Port: 8080, Username: "other"}})
+	require.NoError(t, err)
+	assert.Empty(t, updated.Proxy.Password)
+
+	// The settings are loaded again on restart
+	_, err = s.Update(Settings{PrivateMirrors: []string{"https://mirror.example.com"}, Proxy: &Proxy{Server: "proxy.example.com", Port: 3128, Username: "user", Password: "secret"}})
+	require.NoError(t, err)
+	s, err = NewSettingsStore(template, path)
+	require.NoError(t, err)
+	assert.Equal(t, Settings{PrivateMirrors: []string{"https://mirror.example.com"}, DatabaseCustomURLs: []string{}, Proxy: &Proxy{Server: "proxy.example.com", Port: 3128, Username: "user", Password: "secret"}}, s.Settings())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	_, err = NewSettingsStore(filepath.Join(dir, "missing"), path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,129 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"github.com/lescactus/clamav-api-go/internal/controllers"
+	clamavv1 "github.com/lescactus/clamav-api-go/pkg/pb/clamav/v1"
+	"github.com/lescactus/clamav-api-go/pkg/signing"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"google.golang.org/grpc/metadata"
+)
+
+// publicMethods can be called without authentication,
+// like the health check endpoints of the REST API.
+var publicMethods = map[string]bool{
+	clamavv1.ClamAV_Ping_FullMethodName: true,
+}
+
+// Authenticator authenticates RPCs with the same credentials as the REST API.
+// The zero value accepts all RPCs.
+type Authenticator struct {
+	// APIKey is the static API key. Empty disables API key authentication.
+	APIKey string
+	// APIKeyHeader is the name of the metadata entry carrying the API key.
+	APIKeyHeader string
+	// HMAC, when not nil, verifies the RPCs signed with the scheme of pkg/signing.
+	// RPCs which don't carry a signature fall back to the API key authentication
+	// when enabled.
+	HMAC *controllers.HMACVerifier
+}
+
+// authenticate checks the credentials of a call to fullMethod and returns
+// a copy of ctx carrying the authenticated principal.
+func (a *Authenticator) authenticate(ctx context.Context, logger *zerolog.Logger, fullMethod string) (context.Context, error) {
+	if a == nil || publicMethods[fullMethod] {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	switch {
+	case a.HMAC != nil && (len(md.Get(signing.HeaderSignature)) > 0 || a.APIKey == ""):
+		return a.verifySignature(ctx, logger, md, fullMethod)
+	case a.APIKey != "":
+		return a.verifyAPIKey(ctx, logger, md, fullMethod)
+	default:
+		return ctx, nil
+	}
+}
+
+// verifyAPIKey checks the API key carried by md.
+func (a *Authenticator) verifyAPIKey(ctx context.Context, logger *zerolog.Logger, md metadata.MD, fullMethod string) (context.Context, error) {
+	reqID, _ := hlog.IDFromCtx(ctx)
+
+	var providedKey string
+	if v := md.Get(a.APIKeyHeader); len(v) > 0 {
+		providedKey = v[0]
+	}
+	if providedKey == "" {
+		logger.Warn().Str("req_id", reqID.String()).
+			Str("method", fullMethod).
+			Str("expected_header", strings.ToLower(a.APIKeyHeader)).
+			Msg("API key authentication required but no key provided")
+
+		return nil, unauthenticated(ctx, "API key required")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(providedKey), []byte(a.APIKey)) != 1 {
+		logger.Warn().Str("req_id", reqID.String()).
+			Str("method", fullMethod).
+			Str("client_ip", clientIP(ctx)).
+			Msg("Invalid API key provided")
+
+		return nil, unauthenticated(ctx, "Invalid API key")
+	}
+
+	logger.Debug().Str("req_id", reqID.String()).
+		Msg("API key authentication successful")
+
+	return controllers.WithPrincipal(ctx, controllers.PrincipalAPIKey), nil
+}
+
+// verifySignature checks the HMAC signature carried by md.
+//
+// The messages of a call aren't covered by the signature, which is computed
+// as for a POST request to fullMethod with an empty body.
+func (a *Authenticator) verifySignature(ctx context.Context, logger *zerolog.Logger, md metadata.MD, fullMethod string) (context.Context, error) {
+	reqID, _ := hlog.IDFromCtx(ctx)
+
+	r := &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Path: fullMethod},
+		Header: make(http.Header, len(md)),
+	}
+	for name, values := range md {
+		r.Header[textproto.CanonicalMIMEHeaderKey(name)] = values
+	}
+
+	keyID, err := a.HMAC.Verify(r)
+	if err == nil && r.Header.Get(signing.HeaderContentSHA256) != signing.EmptyBodyDigest {
+		err = controllers.ErrBodyDigestMismatch
+	}
+	if err != nil {
+		logger.Warn().Str("req_id", reqID.String()).
+			Str("method", fullMethod).
+			Str("client_ip", clientIP(ctx)).
+			Str("key_id", r.Header.Get(signing.HeaderKeyID)).
+			Err(err).
+			Msg("HMAC signature authentication failed")
+
+		return nil, unauthenticated(ctx, err.Error())
+	}
+
+	logger.Debug().Str("req_id", reqID.String()).
+		Str("key_id", keyID).
+		Msg("HMAC signature authentication successful")
+
+	return controllers.WithPrincipal(ctx, keyID), nil
+}
+
+// unauthenticated returns an Unauthenticated status error with the given message.
+func unauthenticated(ctx context.Context, msg string) error {
+	return newStatus(ctx, http.StatusUnauthorized, controllers.CodeUnauthorized, msg, 0)
+}
@@ -0,0 +1,141 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/controllers"
+	clamavv1 "github.com/lescactus/clamav-api-go/pkg/pb/clamav/v1"
+	"github.com/lescactus/clamav-api-go/pkg/signing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	client := newTestClient(t, newTestServer(&fakeClamav{}), &Authenticator{APIKey: "secret123", APIKeyHeader: "X-API-Key"})
+
+	tests := []struct {
+		name     string
+		key      string
+		wantCode codes.Code
+		wantMsg  string
+	}{
+		{
+			name:     "valid api key",
+			key:      "secret123",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "missing api key",
+			key:      "",
+			wantCode: codes.Unauthenticated,
+			wantMsg:  "API key required",
+		},
+		{
+			name:     "invalid api key",
+			key:      "wrong-key",
+			wantCode: codes.Unauthenticated,
+			wantMsg:  "Invalid API key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.key != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", tt.key)
+			}
+
+			_, err := client.Version(ctx, &clamavv1.VersionRequest{})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode != codes.OK {
+				assert.Equal(t, tt.wantMsg, status.Convert(err).Message())
+				assert.Equal(t, controllers.CodeUnauthorized, errorInfo(t, err).GetReason())
+			}
+
+			// Scans are authenticated as well
+			_, err = scan(ctx, client, "file.txt", "foobar", 64)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+
+	t.Run("ping is public", func(t *testing.T) {
+		_, err := client.Ping(context.Background(), &clamavv1.PingRequest{})
+		assert.NoError(t, err)
+	})
+}
+
+func TestHMACAuth(t *testing.T) {
+	verifier := controllers.NewHMACVerifier(map[string]string{"backend": "shared-secret"}, time.Minute)
+	signer := signing.NewSigner("backend", []byte("shared-secret"))
+
+	// sign returns a context carrying the signature of a call to fullMethod
+	sign := func(t *testing.T, s *signing.Signer, fullMethod string) context.Context {
+		t.Helper()
+		md, err := s.SignRPC(fullMethod)
+		require.NoError(t, err)
+		return metadata.NewOutgoingContext(context.Background(), metadata.New(md))
+	}
+
+	t.Run("hmac only", func(t *testing.T) {
+		client := newTestClient(t, newTestServer(&fakeClamav{}), &Authenticator{HMAC: verifier})
+
+		_, err := client.Version(sign(t, signer, clamavv1.ClamAV_Version_FullMethodName), &clamavv1.VersionRequest{})
+		assert.NoError(t, err)
+
+		_, err = scan(sign(t, signer, clamavv1.ClamAV_Scan_FullMethodName), client, "file.txt", "foobar", 64)
+		assert.NoError(t, err)
+
+		// Unsigned calls are rejected
+		_, err = client.Version(context.Background(), &clamavv1.VersionRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Equal(t, controllers.ErrSignatureRequired.Error(), status.Convert(err).Message())
+
+		// The signature is bound to the method
+		_, err = client.Stats(sign(t, signer, clamavv1.ClamAV_Version_FullMethodName), &clamavv1.StatsRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Equal(t, controllers.ErrSignatureInvalid.Error(), status.Convert(err).Message())
+
+		// Wrong secret
+		_, err = client.Version(sign(t, signing.NewSigner("backend", []byte("wrong")), clamavv1.ClamAV_Version_FullMethodName), &clamavv1.VersionRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		// Replays are rejected
+		ctx := sign(t, signer, clamavv1.ClamAV_Version_FullMethodName)
+		_, err = client.Version(ctx, &clamavv1.VersionRequest{})
+		assert.NoError(t, err)
+		_, err = client.Version(ctx, &clamavv1.VersionRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Equal(t, controllers.ErrSignatureReplayed.Error(), status.Convert(err).Message())
+
+		// The signature must be computed with the digest of an empty body
+		md, err := signer.SignRPC(clamavv1.ClamAV_Version_FullMethodName)
+		require.NoError(t, err)
+		md["x-content-sha256"] = signing.BodyDigest([]byte("foobar"))
+		_, err = client.Version(metadata.NewOutgoingContext(context.Background(), metadata.New(md)), &clamavv1.VersionRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("hmac with api key fallback", func(t *testing.T) {
+		client := newTestClient(t, newTestServer(&fakeClamav{}), &Authenticator{
+			APIKey:       "secret123",
+			APIKeyHeader: "X-API-Key",
+			HMAC:         verifier,
+		})
+
+		_, err := client.Version(sign(t, signer, clamavv1.ClamAV_Version_FullMethodName), &clamavv1.VersionRequest{})
+		assert.NoError(t, err)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "secret123")
+		_, err = client.Version(ctx, &clamavv1.VersionRequest{})
+		assert.NoError(t, err)
+
+		_, err = client.Version(context.Background(), &clamavv1.VersionRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Equal(t, "API key required", status.Convert(err).Message())
+	})
+}
@@ -0,0 +1,81 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/controllers"
+	"github.com/rs/zerolog/hlog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ErrorDomain is the domain of the google.rpc.ErrorInfo details of the errors.
+// Their reason is the stable error code of the REST API, see docs/ERRORS.md.
+const ErrorDomain = "clamav-api-go"
+
+// toStatus converts err into a gRPC status error carrying the same error code
+// and message as the REST API would.
+// When retryAfter is positive, the status advises clients when to retry.
+func toStatus(ctx context.Context, err error, retryAfter time.Duration) error {
+	// Errors of the stream itself, eg. a client cancellation, are already statuses
+	if st, ok := status.FromError(err); ok {
+		return st.Err()
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, err.Error())
+	}
+
+	httpStatus, code, msg := controllers.ClassifyError(err)
+	return newStatus(ctx, httpStatus, code, msg, retryAfter)
+}
+
+// newStatus builds a status error with the gRPC code matching httpStatus,
+// detailed with the error code, the request id and the retry delay.
+func newStatus(ctx context.Context, httpStatus int, code, msg string, retryAfter time.Duration) error {
+	st := status.New(grpcCode(httpStatus), msg)
+
+	details := []protoadapt.MessageV1{
+		&errdetails.ErrorInfo{Reason: code, Domain: ErrorDomain},
+	}
+	if id, ok := hlog.IDFromCtx(ctx); ok {
+		details = append(details, &errdetails.RequestInfo{RequestId: id.String()})
+	}
+	if retryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	}
+
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// grpcCode returns the gRPC code equivalent to the given HTTP status code.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
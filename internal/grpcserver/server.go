@@ -0,0 +1,407 @@
+// Package grpcserver exposes the clamd daemon over gRPC, alongside the REST API.
+// See proto/clamav/v1/clamav.proto for the definition of the service.
+package grpcserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/admission"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/controllers"
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/lescactus/clamav-api-go/internal/heuristics"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	clamavv1 "github.com/lescactus/clamav-api-go/pkg/pb/clamav/v1"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// errScanEnded indicates clamd replied before the whole file was streamed.
+var errScanEnded = errors.New("scan ended")
+
+// Server implements the clamav.v1.ClamAV gRPC service.
+type Server struct {
+	clamavv1.UnimplementedClamAVServer
+
+	Logger *zerolog.Logger
+	Clamav clamav.Clamaver
+
+	// MaxScanSize is the maximum size of a scanned file. Zero means no limit.
+	MaxScanSize int64
+	// Admission, when not nil, admits the scans like on the REST API.
+	Admission *admission.Controller
+	// Audit, when not nil, records the scans and reloads in the audit log.
+	Audit *audit.Logger
+	// HeuristicsPolicy decides how the archive heuristics reported
+	// by clamd are reported. Nil reports them as infected.
+	HeuristicsPolicy heuristics.Policy
+	// Policy, when not nil, decides the verdict of the scans
+	// like on the REST API.
+	Policy *policy.Engine
+	// FileTypes, when not nil, detects the types of the scanned files and
+	// rejects those which aren't allowed, like on the REST API.
+	FileTypes *filetype.Detector
+}
+
+// New creates a new Server.
+func New(logger *zerolog.Logger, clamav clamav.Clamaver) *Server {
+	return &Server{
+		Logger: logger,
+		Clamav: clamav,
+	}
+}
+
+// NewGRPCServer returns a gRPC server serving s. Calls are given a request id,
+// authenticated by auth, logged and recovered from panics.
+func NewGRPCServer(s *Server, auth *Authenticator, opts ...grpc.ServerOption) *grpc.Server {
+	i := &interceptor{logger: s.Logger, auth: auth}
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(i.unary),
+		grpc.ChainStreamInterceptor(i.stream),
+	)
+
+	gs := grpc.NewServer(opts...)
+	clamavv1.RegisterClamAVServer(gs, s)
+	return gs
+}
+
+// Scan streams the received chunks to clamd as they arrive.
+func (s *Server) Scan(stream clamavv1.ClamAV_ScanServer) error {
+	ctx := stream.Context()
+	reqID, _ := hlog.IDFromCtx(ctx)
+
+	if s.Admission != nil {
+		release, err := s.Admission.Acquire(ctx)
+		if err != nil {
+			s.Logger.Warn().Str("req_id", reqID.String()).
+				Err(err).
+				Msg("scan rejected by admission control")
+
+			return toStatus(ctx, err, s.Admission.RetryAfter())
+		}
+		defer release()
+	}
+
+	// The first message carries the file name
+	req, err := stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return newStatus(ctx, http.StatusBadRequest, controllers.CodeInvalidRequest, "bad request: no file sent", 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	pr, pw := io.Pipe()
+
+	type result struct {
+		resp     []byte
+		err      error
+		fileType filetype.Result
+	}
+	done := make(chan result, 1)
+	go func() {
+		var body io.Reader = pr
+		var fileType filetype.Result
+		if s.FileTypes != nil {
+			var err error
+			fileType, body, err = s.FileTypes.Inspect(pr, req.GetFileName())
+			if err != nil {
+				// The file is rejected before its scan
+				_ = pr.CloseWithError(errScanEnded)
+				done <- result{err: err, fileType: fileType}
+				return
+			}
+		}
+
+		resp, err := s.Clamav.InStream(ctx, body, -1)
+		// Unblock the reception if clamd replied early, eg. because the file is too large
+		_ = pr.CloseWithError(errScanEnded)
+		done <- result{resp, err, fileType}
+	}()
+
+	size, err := s.receive(stream, req, pw, h)
+	_ = pw.CloseWithError(err)
+	res := <-done
+
+	s.Logger.Debug().
+		Str("req_id", reqID.String()).
+		Str("file_name", req.GetFileName()).
+		Int64("file_size", size).
+		Msg("file streamed successfully")
+
+	rec := audit.Record{
+		Action:   audit.ActionScan,
+		FileName: req.GetFileName(),
+		FileSize: size,
+	}
+	if err == nil {
+		rec.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+
+	var found controllers.InStreamResponse
+	switch {
+	case res.err == nil:
+		found = controllers.InStreamResponse{
+			Status: "noerror",
+			Msg:    string(clamav.RespScan),
+		}
+	case errors.Is(res.err, clamav.ErrVirusFound):
+		s.Logger.Debug().Str("req_id", reqID.String()).Msg(res.err.Error())
+
+		found = controllers.FoundResponse(s.HeuristicsPolicy, res.resp)
+	default:
+		s.Logger.Debug().Str("req_id", reqID.String()).Err(res.err).Msg("error while scanning file")
+
+		rec.Verdict = audit.VerdictError
+		if errors.Is(res.err, filetype.ErrDenied) {
+			rec.Verdict = audit.VerdictRejected
+		}
+		rec.Error = res.err.Error()
+		s.auditLog(ctx, rec)
+
+		return toStatus(ctx, res.err, 0)
+	}
+
+	rec.Verdict, rec.Signature = found.AuditVerdict()
+	if d, ok := controllers.ApplyPolicy(s.Policy, controllers.PrincipalFromContext(ctx), req.GetFileName(), res.fileType.Type, &found); ok {
+		rec.PolicyVerdict, rec.PolicyRule = string(d.Verdict), d.Rule
+		s.Logger.Info().
+			Str("req_id", reqID.String()).
+			Str("file_name", req.GetFileName()).
+			Str("signature", rec.Signature).
+			Str("policy", d.Policy).
+			Str("policy_rule", d.Rule).
+			Str("verdict", string(d.Verdict)).
+			Msg("verdict policy applied")
+	}
+
+	resp := &clamavv1.ScanResponse{
+		Status:            found.Status,
+		Msg:               found.Msg,
+		Signature:         found.Signature,
+		VirusFound:        found.VirusFound,
+		Verdict:           found.Verdict,
+		PolicyRule:        found.PolicyRule,
+		MimeType:          res.fileType.MIME,
+		ExtensionMismatch: res.fileType.ExtensionMismatch,
+	}
+	if found.Heuristic != nil {
+		resp.Heuristic = &clamavv1.Heuristic{
+			Category:  found.Heuristic.Category,
+			Signature: found.Heuristic.Signature,
+			Verdict:   found.Heuristic.Verdict,
+		}
+	}
+
+	s.auditLog(ctx, rec)
+
+	s.Logger.Debug().Str("req_id", reqID.String()).Msg("file scanned successfully")
+
+	return stream.SendAndClose(resp)
+}
+
+// receive writes the chunk of req and of the following messages of stream
+// to w and h, until the end of the stream. It returns the size of the file.
+func (s *Server) receive(stream clamavv1.ClamAV_ScanServer, req *clamavv1.ScanRequest, w io.Writer, h hash.Hash) (int64, error) {
+	var size int64
+	for {
+		chunk := req.GetChunk()
+		size += int64(len(chunk))
+		if s.MaxScanSize > 0 && size > s.MaxScanSize {
+			return size, &http.MaxBytesError{Limit: s.MaxScanSize}
+		}
+
+		if _, err := w.Write(chunk); err != nil {
+			return size, err
+		}
+		h.Write(chunk)
+
+		var err error
+		req, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+	}
+}
+
+// Ping sends the PING command to clamd.
+func (s *Server) Ping(ctx context.Context, _ *clamavv1.PingRequest) (*clamavv1.PingResponse, error) {
+	reqID, _ := hlog.IDFromCtx(ctx)
+
+	ping, err := s.Clamav.Ping(ctx)
+	if err != nil {
+		s.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending ping command: %v", err)
+		return nil, toStatus(ctx, err, 0)
+	}
+
+	s.Logger.Debug().Str("req_id", reqID.String()).Msg("ping command sent successfully")
+
+	return &clamavv1.PingResponse{Ping: string(ping)}, nil
+}
+
+// Version sends the VERSION command to clamd.
+func (s *Server) Version(ctx context.Context, _ *clamavv1.VersionRequest) (*clamavv1.VersionResponse, error) {
+	reqID, _ := hlog.IDFromCtx(ctx)
+
+	version, err := s.Clamav.Version(ctx)
+	if err != nil {
+		s.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending version command: %v", err)
+		return nil, toStatus(ctx, err, 0)
+	}
+
+	s.Logger.Debug().Str("req_id", reqID.String()).Msg("version command sent successfully")
+
+	return &clamavv1.VersionResponse{ClamavVersion: string(version)}, nil
+}
+
+// Stats sends the STATS command to clamd.
+func (s *Server) Stats(ctx context.Context, _ *clamavv1.StatsRequest) (*clamavv1.StatsResponse, error) {
+	reqID, _ := hlog.IDFromCtx(ctx)
+
+	stats, err := s.Clamav.Stats(ctx)
+	if err != nil {
+		s.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending stats command: %v", err)
+		return nil, toStatus(ctx, err, 0)
+	}
+
+	st, err := controllers.ParseStats(string(stats))
+	if err != nil {
+		s.Logger.Error().Str("req_id", reqID.String()).Msgf("error while marshalling stats: %v", err)
+		return nil, toStatus(ctx, err, 0)
+	}
+
+	s.Logger.Debug().Str("req_id", reqID.String()).Msg("stats command sent successfully")
+
+	return &clamavv1.StatsResponse{
+		Pools:    int32(st.Pools), //nolint:gosec // the number of pools is small
+		State:    st.State,
+		Threads:  st.Threads,
+		Queue:    st.Queue,
+		Memstats: st.Memstats,
+	}, nil
+}
+
+// Reload sends the RELOAD command to clamd.
+func (s *Server) Reload(ctx context.Context, _ *clamavv1.ReloadRequest) (*clamavv1.ReloadResponse, error) {
+	reqID, _ := hlog.IDFromCtx(ctx)
+
+	if err := s.Clamav.Reload(ctx); err != nil {
+		s.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending reload command: %v", err)
+		s.auditLog(ctx, audit.Record{Action: audit.ActionReload, Verdict: audit.VerdictFailure, Error: err.Error()})
+		return nil, toStatus(ctx, err, 0)
+	}
+
+	s.auditLog(ctx, audit.Record{Action: audit.ActionReload, Verdict: audit.VerdictSuccess})
+
+	s.Logger.Debug().Str("req_id", reqID.String()).Msg("reload command sent successfully")
+
+	return &clamavv1.ReloadResponse{Status: "Reloading"}, nil
+}
+
+// auditLog records rec in the audit log, if enabled, after completing it
+// with the principal, client IP address and ID of the call.
+func (s *Server) auditLog(ctx context.Context, rec audit.Record) {
+	reqID, _ := hlog.IDFromCtx(ctx)
+	audit.LogRequest(s.Audit, s.Logger, rec, controllers.PrincipalFromContext(ctx), clientIP(ctx), reqID.String())
+}
+
+// clientIP returns the IP address of the peer of the call.
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// interceptor gives each call a request id, authenticates it,
+// logs it and recovers from panics.
+type interceptor struct {
+	logger *zerolog.Logger
+	auth   *Authenticator
+}
+
+func (i *interceptor) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	ctx = i.begin(ctx)
+	defer i.end(ctx, info.FullMethod, time.Now(), &err)
+
+	ctx, err = i.auth.authenticate(ctx, i.logger, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (i *interceptor) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx := i.begin(ss.Context())
+	defer i.end(ctx, info.FullMethod, time.Now(), &err)
+
+	ctx, err = i.auth.authenticate(ctx, i.logger, info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+// begin gives the call a request id, sent back to the client in the
+// x-request-id header.
+func (i *interceptor) begin(ctx context.Context) context.Context {
+	id := xid.New()
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id.String()))
+	return hlog.CtxWithID(ctx, id)
+}
+
+// end recovers from a panic of the call and logs it.
+func (i *interceptor) end(ctx context.Context, method string, start time.Time, err *error) {
+	reqID, _ := hlog.IDFromCtx(ctx)
+
+	if p := recover(); p != nil {
+		i.logger.Error().Str("req_id", reqID.String()).
+			Str("method", method).
+			Interface("panic", p).
+			Msg("recovered from panic")
+		*err = status.Error(codes.Internal, "internal error")
+	}
+
+	i.logger.Info().
+		Str("req_id", reqID.String()).
+		Str("method", method).
+		Str("code", status.Code(*err).String()).
+		Str("remote_client", clientIP(ctx)).
+		Dur("duration", time.Since(start)).
+		Msg("")
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the stream.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
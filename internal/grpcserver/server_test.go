@@ -0,0 +1,476 @@
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/admission"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/controllers"
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/lescactus/clamav-api-go/internal/heuristics"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	clamavv1 "github.com/lescactus/clamav-api-go/pkg/pb/clamav/v1"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// encrypted is reported by fakeClamav as an encrypted archive.
+const encrypted = "encrypted archive"
+
+// fakeClamav is a Clamaver replying successfully to all commands,
+// unless err is set. InStream reports the EICAR test file as infected.
+type fakeClamav struct {
+	err error
+
+	mu      sync.Mutex
+	scanned []byte
+}
+
+var _ clamav.Clamaver = (*fakeClamav)(nil)
+
+func (f *fakeClamav) Ping(context.Context) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte("PONG"), nil
+}
+
+func (f *fakeClamav) Version(context.Context) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte("ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023"), nil
+}
+
+func (f *fakeClamav) Reload(context.Context) error {
+	return f.err
+}
+
+func (f *fakeClamav) Stats(context.Context) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte(`POOLS: 1
+
+STATE: VALID PRIMARY
+THREADS: live 1  idle 0 max 10 idle-timeout 30
+QUEUE: 0 items
+	STATS 0.000086
+
+MEMSTATS: heap N/A mmap N/A used N/A free N/A releasable N/A pools 1 pools_used 1306.837M pools_total 1306.882M
+END`), nil
+}
+
+func (f *fakeClamav) VersionCommands(context.Context) ([]byte, error) {
+	return nil, clamav.ErrUnknownCommand
+}
+
+func (f *fakeClamav) Shutdown(context.Context) error {
+	return clamav.ErrUnknownCommand
+}
+
+func (f *fakeClamav) FreshClam(context.Context) ([]byte, error) {
+	return nil, clamav.ErrUnknownCommand
+}
+
+func (f *fakeClamav) InStream(_ context.Context, r io.Reader, size int64) ([]byte, error) {
+	if size >= 0 {
+		return nil, errors.New("size of a gRPC scan should be unknown")
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.scanned = b
+	f.mu.Unlock()
+
+	if bytes.Contains(b, []byte(eicar)) {
+		return []byte("stream: Win.Test.EICAR_HDB-1 FOUND"), clamav.ErrVirusFound
+	}
+	if bytes.Equal(b, []byte(encrypted)) {
+		return []byte("stream: Heuristics.Encrypted.Zip FOUND"), clamav.ErrVirusFound
+	}
+	return clamav.RespScan, nil
+}
+
+// newTestClient starts s on an in-process listener and returns a client connected to it.
+func newTestClient(t *testing.T, s *Server, auth *Authenticator) clamavv1.ClamAVClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	gs := NewGRPCServer(s, auth)
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return clamavv1.NewClamAVClient(conn)
+}
+
+func newTestServer(c clamav.Clamaver) *Server {
+	logger := zerolog.New(io.Discard)
+	return New(&logger, c)
+}
+
+// scan sends content in chunks of chunkSize bytes.
+func scan(ctx context.Context, client clamavv1.ClamAVClient, fileName, content string, chunkSize int) (*clamavv1.ScanResponse, error) {
+	stream, err := client.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	first := true
+	for first || content != "" {
+		n := min(chunkSize, len(content))
+		req := &clamavv1.ScanRequest{Chunk: []byte(content[:n])}
+		if first {
+			req.FileName = fileName
+			first = false
+		}
+		if err := stream.Send(req); err != nil {
+			// The actual error is returned by CloseAndRecv
+			break
+		}
+		content = content[n:]
+	}
+
+	return stream.CloseAndRecv()
+}
+
+// errorInfo returns the ErrorInfo detail of err.
+func errorInfo(t *testing.T, err error) *errdetails.ErrorInfo {
+	t.Helper()
+
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	t.Fatalf("no ErrorInfo in %v", err)
+	return nil
+}
+
+func TestScan(t *testing.T) {
+	fake := &fakeClamav{}
+	s := newTestServer(fake)
+	s.MaxScanSize = 1024
+	s.HeuristicsPolicy = heuristics.Policy{heuristics.CategoryEncrypted: heuristics.VerdictSuspicious}
+	client := newTestClient(t, s, nil)
+	ctx := context.Background()
+
+	t.Run("clean file", func(t *testing.T) {
+		resp, err := scan(ctx, client, "file.txt", strings.Repeat("a", 1000), 64)
+		require.NoError(t, err)
+		assert.Equal(t, "noerror", resp.GetStatus())
+		assert.Equal(t, string(clamav.RespScan), resp.GetMsg())
+		assert.False(t, resp.GetVirusFound())
+
+		fake.mu.Lock()
+		assert.Equal(t, strings.Repeat("a", 1000), string(fake.scanned))
+		fake.mu.Unlock()
+	})
+
+	t.Run("infected file", func(t *testing.T) {
+		resp, err := scan(ctx, client, "eicar.com", eicar, 8)
+		require.NoError(t, err)
+		assert.Equal(t, "error", resp.GetStatus())
+		assert.Equal(t, clamav.ErrVirusFound.Error(), resp.GetMsg())
+		assert.Equal(t, "Win.Test.EICAR_HDB-1", resp.GetSignature())
+		assert.True(t, resp.GetVirusFound())
+	})
+
+	t.Run("archive heuristic", func(t *testing.T) {
+		resp, err := scan(ctx, client, "secret.zip", encrypted, 8)
+		require.NoError(t, err)
+		assert.Equal(t, "noerror", resp.GetStatus())
+		assert.Equal(t, controllers.MsgSuspicious, resp.GetMsg())
+		assert.Empty(t, resp.GetSignature())
+		assert.False(t, resp.GetVirusFound())
+		assert.Equal(t, "encrypted", resp.GetHeuristic().GetCategory())
+		assert.Equal(t, "Heuristics.Encrypted.Zip", resp.GetHeuristic().GetSignature())
+		assert.Equal(t, "suspicious", resp.GetHeuristic().GetVerdict())
+	})
+
+	t.Run("file too large", func(t *testing.T) {
+		_, err := scan(ctx, client, "large.bin", strings.Repeat("a", 2048), 64)
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		assert.Equal(t, controllers.CodeRequestTooLarge, errorInfo(t, err).GetReason())
+	})
+
+	t.Run("no file", func(t *testing.T) {
+		stream, err := client.Scan(ctx)
+		require.NoError(t, err)
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.Equal(t, controllers.CodeInvalidRequest, errorInfo(t, err).GetReason())
+	})
+}
+
+func TestScanPolicy(t *testing.T) {
+	s := newTestServer(&fakeClamav{})
+	engine, err := policy.Parse([]byte(`
+policies:
+  default:
+    rules:
+      - name: warn-test
+        signatures: ["*.Test.*"]
+        action: warn
+      - name: block-executables
+        file_types: ["*.exe"]
+        action: block
+`))
+	require.NoError(t, err)
+	s.Policy = engine
+	client := newTestClient(t, s, nil)
+	ctx := context.Background()
+
+	resp, err := scan(ctx, client, "eicar.com", eicar, 8)
+	require.NoError(t, err)
+	assert.True(t, resp.GetVirusFound())
+	assert.Equal(t, "warn", resp.GetVerdict())
+	assert.Equal(t, "warn-test", resp.GetPolicyRule())
+
+	resp, err = scan(ctx, client, "setup.exe", "clean", 8)
+	require.NoError(t, err)
+	assert.False(t, resp.GetVirusFound())
+	assert.Equal(t, "block", resp.GetVerdict())
+	assert.Equal(t, "block-executables", resp.GetPolicyRule())
+}
+
+func TestScanFileType(t *testing.T) {
+	s := newTestServer(&fakeClamav{})
+	detector, err := filetype.New(filetype.Config{Deny: []string{"executable"}})
+	require.NoError(t, err)
+	s.FileTypes = detector
+	client := newTestClient(t, s, nil)
+	ctx := context.Background()
+
+	resp, err := scan(ctx, client, "invoice.jpg", "%PDF-1.7\n"+strings.Repeat("a", 100), 8)
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", resp.GetMimeType())
+	assert.True(t, resp.GetExtensionMismatch())
+
+	_, err = scan(ctx, client, "setup.exe", "MZ\x90\x00\x03"+strings.Repeat("a", 100), 8)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, controllers.CodeFileTypeNotAllowed, errorInfo(t, err).GetReason())
+}
+
+func TestScanClamdErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode codes.Code
+		wantErr  string
+	}{
+		{
+			name:     "clamd unreachable",
+			err:      &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+			wantCode: codes.Unavailable,
+			wantErr:  controllers.CodeClamdUnreachable,
+		},
+		{
+			name:     "clamd timeout",
+			err:      context.DeadlineExceeded,
+			wantCode: codes.DeadlineExceeded,
+			wantErr:  controllers.CodeClamdTimeout,
+		},
+		{
+			name:     "clamd size limit",
+			err:      clamav.ErrScanFileSizeLimitExceeded,
+			wantCode: codes.ResourceExhausted,
+			wantErr:  controllers.CodeFileTooLarge,
+		},
+		{
+			name:     "unknown error",
+			err:      errors.New("unknown error"),
+			wantCode: codes.Internal,
+			wantErr:  controllers.CodeInternalError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, newTestServer(&fakeClamav{err: tt.err}), nil)
+
+			_, err := scan(context.Background(), client, "file.txt", "foobar", 64)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+
+			info := errorInfo(t, err)
+			assert.Equal(t, tt.wantErr, info.GetReason())
+			assert.Equal(t, ErrorDomain, info.GetDomain())
+
+			var reqInfo *errdetails.RequestInfo
+			for _, d := range status.Convert(err).Details() {
+				if ri, ok := d.(*errdetails.RequestInfo); ok {
+					reqInfo = ri
+				}
+			}
+			require.NotNil(t, reqInfo)
+			assert.NotEmpty(t, reqInfo.GetRequestId())
+		})
+	}
+}
+
+func TestScanAdmission(t *testing.T) {
+	ac := admission.New(admission.Config{MaxInFlight: 1, QueueTimeout: time.Second})
+	s := newTestServer(&fakeClamav{})
+	s.Admission = ac
+	client := newTestClient(t, s, nil)
+
+	// Hold the only scan slot
+	release, err := ac.Acquire(context.Background())
+	require.NoError(t, err)
+
+	_, err = scan(context.Background(), client, "file.txt", "foobar", 64)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, controllers.CodeOverloaded, errorInfo(t, err).GetReason())
+
+	var retry *errdetails.RetryInfo
+	for _, d := range status.Convert(err).Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			retry = ri
+		}
+	}
+	require.NotNil(t, retry)
+	assert.Positive(t, retry.GetRetryDelay().AsDuration())
+
+	release()
+	_, err = scan(context.Background(), client, "file.txt", "foobar", 64)
+	assert.NoError(t, err)
+}
+
+// auditSink is an audit.Sink keeping the records in memory.
+type auditSink struct {
+	mu    sync.Mutex
+	lines [][]byte
+}
+
+func (s *auditSink) WriteRecord(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, append([]byte(nil), line...))
+	return nil
+}
+
+func (s *auditSink) Close() error { return nil }
+
+// lastRecord returns the last record written to the sink.
+func (s *auditSink) lastRecord(t *testing.T) audit.Record {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rec audit.Record
+	require.NoError(t, json.Unmarshal(s.lines[len(s.lines)-1], &rec))
+	return rec
+}
+
+func TestScanAudit(t *testing.T) {
+	sink := &auditSink{}
+	logger, err := audit.New(sink, nil)
+	require.NoError(t, err)
+
+	s := newTestServer(&fakeClamav{})
+	s.Audit = logger
+	client := newTestClient(t, s, &Authenticator{APIKey: "secret", APIKeyHeader: "X-API-Key"})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "secret")
+
+	_, err = scan(ctx, client, "eicar.com", eicar, 16)
+	require.NoError(t, err)
+
+	rec := sink.lastRecord(t)
+	assert.Equal(t, audit.ActionScan, rec.Action)
+	assert.Equal(t, controllers.PrincipalAPIKey, rec.Principal)
+	assert.NotEmpty(t, rec.RequestID)
+	assert.Equal(t, "eicar.com", rec.FileName)
+	assert.EqualValues(t, len(eicar), rec.FileSize)
+	assert.Equal(t, "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f", rec.SHA256)
+	assert.Equal(t, audit.VerdictInfected, rec.Verdict)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", rec.Signature)
+
+	_, err = client.Reload(ctx, &clamavv1.ReloadRequest{})
+	require.NoError(t, err)
+	rec = sink.lastRecord(t)
+	assert.Equal(t, audit.ActionReload, rec.Action)
+	assert.Equal(t, audit.VerdictSuccess, rec.Verdict)
+}
+
+func TestUnaryRPCs(t *testing.T) {
+	client := newTestClient(t, newTestServer(&fakeClamav{}), nil)
+	ctx := context.Background()
+
+	ping, err := client.Ping(ctx, &clamavv1.PingRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "PONG", ping.GetPing())
+
+	version, err := client.Version(ctx, &clamavv1.VersionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023", version.GetClamavVersion())
+
+	stats, err := client.Stats(ctx, &clamavv1.StatsRequest{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, stats.GetPools())
+	assert.Equal(t, "VALID PRIMARY", stats.GetState())
+	assert.Equal(t, "live 1  idle 0 max 10 idle-timeout 30", stats.GetThreads())
+
+	reload, err := client.Reload(ctx, &clamavv1.ReloadRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "Reloading", reload.GetStatus())
+}
+
+func TestUnaryRPCsErrors(t *testing.T) {
+	client := newTestClient(t, newTestServer(&fakeClamav{err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}), nil)
+	ctx := context.Background()
+
+	_, err := client.Ping(ctx, &clamavv1.PingRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = client.Version(ctx, &clamavv1.VersionRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = client.Stats(ctx, &clamavv1.StatsRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = client.Reload(ctx, &clamavv1.ReloadRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, controllers.CodeClamdUnreachable, errorInfo(t, err).GetReason())
+}
+
+func TestRequestID(t *testing.T) {
+	client := newTestClient(t, newTestServer(&fakeClamav{}), nil)
+
+	var header metadata.MD
+	_, err := client.Version(context.Background(), &clamavv1.VersionRequest{}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Len(t, header.Get("x-request-id"), 1)
+}
@@ -0,0 +1,143 @@
+// Package heuristics tells the archive heuristics reported by clamd from
+// the virus signatures, and decides how they are reported.
+//
+// When scanning archives and other containers, clamd reports the files it
+// couldn't fully scan with signatures such as Heuristics.Encrypted.Zip or
+// Heuristics.Limits.Exceeded.MaxRecursion, provided the matching Alert*
+// options are enabled in clamd.conf. Those files aren't known to be
+// malicious, so a Policy decides whether they are reported as infected,
+// suspicious or clean.
+package heuristics
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Category is a category of archive heuristics.
+type Category string
+
+// Categories of archive heuristics.
+const (
+	// CategoryEncrypted is an encrypted archive or document, whose content
+	// couldn't be scanned (AlertEncrypted).
+	CategoryEncrypted Category = "encrypted"
+	// CategoryLimitsExceeded is a file exceeding one of the scan limits,
+	// such as MaxRecursion, MaxFiles or MaxScanSize (AlertExceedsMax).
+	CategoryLimitsExceeded Category = "limits_exceeded"
+	// CategoryBrokenExecutable is a malformed executable (AlertBrokenExecutables).
+	CategoryBrokenExecutable Category = "broken_executable"
+)
+
+// Categories are the categories of archive heuristics.
+var Categories = []Category{CategoryEncrypted, CategoryLimitsExceeded, CategoryBrokenExecutable}
+
+// prefixes maps the prefixes of the signatures to their category.
+// Older clamd versions don't prefix some of them with "Heuristics.".
+var prefixes = []struct {
+	prefix   string
+	category Category
+}{
+	{"Heuristics.Encrypted.", CategoryEncrypted},
+	{"Heuristics.Limits.Exceeded", CategoryLimitsExceeded},
+	{"Heuristics.Broken.Executable", CategoryBrokenExecutable},
+	{"Broken.Executable", CategoryBrokenExecutable},
+}
+
+// Categorize returns the category of signature, and false if it
+// isn't an archive heuristic.
+func Categorize(signature string) (Category, bool) {
+	for _, p := range prefixes {
+		if strings.HasPrefix(signature, p.prefix) {
+			return p.category, true
+		}
+	}
+	return "", false
+}
+
+// Verdict is how an archive heuristic is reported.
+type Verdict string
+
+// Verdicts of archive heuristics.
+const (
+	VerdictInfected   Verdict = "infected"
+	VerdictSuspicious Verdict = "suspicious"
+	VerdictClean      Verdict = "clean"
+)
+
+// Policy maps the categories of archive heuristics to their verdict.
+// Categories without a verdict are reported as infected, as clamd does.
+type Policy map[Category]Verdict
+
+// ParsePolicy parses a comma-separated list of "category=verdict" pairs.
+// A verdict alone applies to all the categories, eg. "suspicious".
+func ParsePolicy(s string) (Policy, error) {
+	p := make(Policy)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			v, err := parseVerdict(entry)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range Categories {
+				p[c] = v
+			}
+			continue
+		}
+
+		c := Category(strings.TrimSpace(name))
+		if !validCategory(c) {
+			return nil, fmt.Errorf("unknown archive heuristics category %q", c)
+		}
+		v, err := parseVerdict(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		p[c] = v
+	}
+	return p, nil
+}
+
+func parseVerdict(s string) (Verdict, error) {
+	switch v := Verdict(s); v {
+	case VerdictInfected, VerdictSuspicious, VerdictClean:
+		return v, nil
+	}
+	return "", fmt.Errorf("invalid archive heuristics verdict %q: must be %q, %q or %q", s, VerdictInfected, VerdictSuspicious, VerdictClean)
+}
+
+func validCategory(c Category) bool {
+	for _, known := range Categories {
+		if c == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Detection is an archive heuristic reported by clamd.
+type Detection struct {
+	Category  Category
+	Signature string
+	Verdict   Verdict
+}
+
+// Detect returns the detection of signature, and false if it isn't
+// an archive heuristic.
+func (p Policy) Detect(signature string) (Detection, bool) {
+	c, ok := Categorize(signature)
+	if !ok {
+		return Detection{}, false
+	}
+	v, ok := p[c]
+	if !ok {
+		v = VerdictInfected
+	}
+	return Detection{Category: c, Signature: signature, Verdict: v}, true
+}
@@ -0,0 +1,95 @@
+package heuristics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategorize(t *testing.T) {
+	tests := []struct {
+		signature string
+		want      Category
+		wantOK    bool
+	}{
+		{signature: "Heuristics.Encrypted.Zip", want: CategoryEncrypted, wantOK: true},
+		{signature: "Heuristics.Encrypted.PDF", want: CategoryEncrypted, wantOK: true},
+		{signature: "Heuristics.Limits.Exceeded.MaxRecursion", want: CategoryLimitsExceeded, wantOK: true},
+		{signature: "Heuristics.Limits.Exceeded", want: CategoryLimitsExceeded, wantOK: true},
+		{signature: "Heuristics.Broken.Executable", want: CategoryBrokenExecutable, wantOK: true},
+		{signature: "Broken.Executable", want: CategoryBrokenExecutable, wantOK: true},
+		{signature: "Win.Test.EICAR_HDB-1"},
+		{signature: "Heuristics.Phishing.Email.SpoofedDomain"},
+		{signature: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.signature, func(t *testing.T) {
+			got, ok := Categorize(tt.signature)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Policy
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			s:    "",
+			want: Policy{},
+		},
+		{
+			name: "per category",
+			s:    "encrypted=suspicious, limits_exceeded = clean",
+			want: Policy{CategoryEncrypted: VerdictSuspicious, CategoryLimitsExceeded: VerdictClean},
+		},
+		{
+			name: "all categories",
+			s:    "suspicious,broken_executable=infected",
+			want: Policy{CategoryEncrypted: VerdictSuspicious, CategoryLimitsExceeded: VerdictSuspicious, CategoryBrokenExecutable: VerdictInfected},
+		},
+		{
+			name:    "unknown category",
+			s:       "phishing=clean",
+			wantErr: true,
+		},
+		{
+			name:    "invalid verdict",
+			s:       "encrypted=ignore",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePolicy(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPolicyDetect(t *testing.T) {
+	p := Policy{CategoryEncrypted: VerdictSuspicious}
+
+	d, ok := p.Detect("Heuristics.Encrypted.Zip")
+	assert.True(t, ok)
+	assert.Equal(t, Detection{Category: CategoryEncrypted, Signature: "Heuristics.Encrypted.Zip", Verdict: VerdictSuspicious}, d)
+
+	// Categories without a verdict are infected
+	d, ok = p.Detect("Heuristics.Limits.Exceeded.MaxFiles")
+	assert.True(t, ok)
+	assert.Equal(t, VerdictInfected, d.Verdict)
+
+	_, ok = Policy(nil).Detect("Win.Test.EICAR_HDB-1")
+	assert.False(t, ok)
+}
@@ -0,0 +1,33 @@
+package icap
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+)
+
+//go:embed blocked.html
+var blockedHTML string
+
+var blockedTemplate = template.Must(template.New("blocked").Parse(blockedHTML))
+
+// blockResponse returns the response replacing an infected HTTP message
+// with a "403 Forbidden" page.
+func blockResponse(signature, url, reqID string) (*response, error) {
+	var page bytes.Buffer
+	err := blockedTemplate.Execute(&page, struct{ Signature, URL, RequestID string }{signature, url, reqID})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := newResponse(StatusOK)
+	resp.resHdr = fmt.Appendf(nil, "HTTP/1.1 403 Forbidden\r\n"+
+		"Content-Type: text/html; charset=utf-8\r\n"+
+		"Content-Length: %d\r\n"+
+		"Cache-Control: no-store\r\n"+
+		"Connection: close\r\n"+
+		"\r\n", page.Len())
+	resp.body = &page
+	return resp, nil
+}
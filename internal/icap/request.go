@@ -0,0 +1,347 @@
+package icap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ICAP methods.
+const (
+	MethodOptions = "OPTIONS"
+	MethodREQMOD  = "REQMOD"
+	MethodRESPMOD = "RESPMOD"
+)
+
+// Names of the sections of the Encapsulated header.
+const (
+	sectionReqHdr  = "req-hdr"
+	sectionResHdr  = "res-hdr"
+	sectionReqBody = "req-body"
+	sectionResBody = "res-body"
+	sectionOptBody = "opt-body"
+	sectionNull    = "null-body"
+)
+
+// maxHeaderSectionSize is the maximum size of an encapsulated HTTP header.
+const maxHeaderSectionSize = 64 * 1024
+
+// errMalformedChunk indicates the encapsulated body isn't properly chunked.
+var errMalformedChunk = errors.New("malformed chunked encoding")
+
+// statusError is an error answered to the client with the given ICAP status code.
+type statusError struct {
+	status int
+	msg    string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, a ...any) error {
+	return &statusError{status: StatusBadRequest, msg: fmt.Sprintf(format, a...)}
+}
+
+// Request is an ICAP request.
+type Request struct {
+	Method string
+	URL    *url.URL
+	Header textproto.MIMEHeader
+
+	// ReqHdr and ResHdr are the encapsulated HTTP request and response headers,
+	// as sent by the client.
+	ReqHdr []byte
+	ResHdr []byte
+
+	// Body is the decoded encapsulated body, nil when the message has none.
+	// Reading past the preview asks the client for the rest of the body.
+	Body *body
+}
+
+// allow204 returns true if the client accepts a 204 response
+// outside of the preview.
+func (r *Request) allow204() bool {
+	for _, v := range strings.Split(r.Header.Get("Allow"), ",") {
+		if strings.TrimSpace(v) == "204" {
+			return true
+		}
+	}
+	return false
+}
+
+// keepAlive returns true if the connection can be reused after the request.
+func (r *Request) keepAlive() bool {
+	return !strings.EqualFold(r.Header.Get("Connection"), "close")
+}
+
+// httpURL returns the URL of the encapsulated HTTP request, if any.
+func (r *Request) httpURL() string {
+	line, _, _ := strings.Cut(string(r.ReqHdr), "\r\n")
+	parts := strings.Fields(line)
+	if len(parts) != 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+// section is an entry of the Encapsulated header.
+type section struct {
+	name   string
+	offset int
+}
+
+// parseEncapsulated parses the value of an Encapsulated header, such as
+// "req-hdr=0, res-hdr=137, res-body=296".
+func parseEncapsulated(v string) ([]section, error) {
+	var sections []section
+	for _, entry := range strings.Split(v, ",") {
+		name, off, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, badRequest("invalid Encapsulated header %q", v)
+		}
+		offset, err := strconv.Atoi(off)
+		if err != nil || offset < 0 {
+			return nil, badRequest("invalid Encapsulated header %q", v)
+		}
+		if n := len(sections); n > 0 && offset < sections[n-1].offset {
+			return nil, badRequest("invalid Encapsulated header %q", v)
+		}
+
+		switch name {
+		case sectionReqHdr, sectionResHdr:
+			if n := len(sections); n > 0 && strings.HasSuffix(sections[n-1].name, "-body") {
+				return nil, badRequest("invalid Encapsulated header %q", v)
+			}
+		case sectionReqBody, sectionResBody, sectionOptBody, sectionNull:
+		default:
+			return nil, badRequest("unknown Encapsulated section %q", name)
+		}
+		sections = append(sections, section{name: name, offset: offset})
+	}
+
+	if last := sections[len(sections)-1]; !strings.HasSuffix(last.name, "-body") {
+		return nil, badRequest("invalid Encapsulated header %q", v)
+	}
+	return sections, nil
+}
+
+// readRequest reads an ICAP request from br. Its body, if any, must be
+// consumed before reading the next request.
+// continueFn is called to ask the client for the rest of the body after the preview.
+func readRequest(br *bufio.Reader, continueFn func() error) (*Request, error) {
+	tp := textproto.NewReader(br)
+
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	method, rest, ok1 := strings.Cut(line, " ")
+	rawURL, proto, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 {
+		return nil, badRequest("malformed request line %q", line)
+	}
+	if proto != "ICAP/1.0" {
+		return nil, &statusError{status: StatusVersionNotSupported, msg: "unsupported protocol " + proto}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, badRequest("invalid request URI %q", rawURL)
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, badRequest("malformed headers: %v", err)
+	}
+
+	req := &Request{Method: method, URL: u, Header: header}
+
+	enc := header.Get("Encapsulated")
+	if enc == "" {
+		if method == MethodREQMOD || method == MethodRESPMOD {
+			return nil, badRequest("missing Encapsulated header")
+		}
+		return req, nil
+	}
+
+	sections, err := parseEncapsulated(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, s := range sections[:len(sections)-1] {
+		size := sections[i+1].offset - s.offset
+		if size > maxHeaderSectionSize {
+			return nil, badRequest("encapsulated %s too large", s.name)
+		}
+		b := make([]byte, size)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, badRequest("error while reading encapsulated %s: %v", s.name, err)
+		}
+
+		switch s.name {
+		case sectionReqHdr:
+			req.ReqHdr = b
+		case sectionResHdr:
+			req.ResHdr = b
+		}
+	}
+
+	switch sections[len(sections)-1].name {
+	case sectionReqBody, sectionResBody, sectionOptBody:
+		req.Body = &body{
+			chunks:       &chunkedReader{r: br},
+			preview:      header.Get("Preview") != "",
+			sendContinue: continueFn,
+		}
+	}
+
+	return req, nil
+}
+
+// body is the encapsulated body of an ICAP request.
+type body struct {
+	chunks *chunkedReader
+	// preview is true while the preview is being read.
+	preview bool
+	// continued is true once the client was asked for the rest of the body.
+	continued    bool
+	sendContinue func() error
+}
+
+// Read reads the decoded body. Once the preview is consumed, the client is
+// asked for the rest of the body, unless the preview holds all of it.
+func (b *body) Read(p []byte) (int, error) {
+	for {
+		n, err := b.chunks.Read(p)
+		if !errors.Is(err, io.EOF) || !b.preview {
+			return n, err
+		}
+
+		b.preview = false
+		if b.chunks.ieof {
+			return n, io.EOF
+		}
+
+		b.continued = true
+		if err := b.sendContinue(); err != nil {
+			return n, err
+		}
+		b.chunks.eof = false
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// complete returns true once the whole body has been read.
+func (b *body) complete() bool {
+	return b.chunks.eof && !b.preview
+}
+
+// previewOnly returns true if the whole body was sent in the preview, in which
+// case a 204 response is allowed even if the client didn't advertise it.
+func (b *body) previewOnly() bool {
+	return b.chunks.ieof && !b.continued
+}
+
+// chunkedReader decodes an HTTP/1.1 chunked body, as used by ICAP.
+type chunkedReader struct {
+	r *bufio.Reader
+	// n is the number of bytes left in the current chunk.
+	n int64
+	// eof is true once the last chunk has been read.
+	eof bool
+	// ieof is true if the last chunk carried the ieof extension,
+	// ie. the preview holds the whole body.
+	ieof bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for c.n == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+		if err := c.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > c.n {
+		p = p[:c.n]
+	}
+	n, err := c.r.Read(p)
+	c.n -= int64(n)
+	if c.n == 0 && err == nil {
+		err = c.readCRLF()
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// nextChunk reads the size line of the next chunk.
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+
+	size, ext, _ := strings.Cut(line, ";")
+	n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+	if err != nil || n < 0 {
+		return errMalformedChunk
+	}
+
+	if n == 0 {
+		c.eof = true
+		c.ieof = strings.TrimSpace(ext) == "ieof"
+		// Skip the trailer
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "" {
+				break
+			}
+		}
+	}
+
+	c.n = n
+	return nil
+}
+
+// readLine reads a CRLF terminated line.
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", errMalformedChunk
+	}
+	if errors.Is(err, io.EOF) {
+		return "", io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// readCRLF reads the CRLF following the data of a chunk.
+func (c *chunkedReader) readCRLF() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return errMalformedChunk
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package icap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEncapsulated(t *testing.T) {
+	tests := []struct {
+		desc    string
+		value   string
+		want    []section
+		wantErr bool
+	}{
+		{
+			desc:  "reqmod",
+			value: "req-hdr=0, req-body=412",
+			want:  []section{{sectionReqHdr, 0}, {sectionReqBody, 412}},
+		},
+		{
+			desc:  "respmod",
+			value: "req-hdr=0, res-hdr=137, res-body=296",
+			want:  []section{{sectionReqHdr, 0}, {sectionResHdr, 137}, {sectionResBody, 296}},
+		},
+		{
+			desc:  "null body",
+			value: "null-body=0",
+			want:  []section{{sectionNull, 0}},
+		},
+		{desc: "no body", value: "req-hdr=0", wantErr: true},
+		{desc: "decreasing offsets", value: "req-hdr=10, req-body=0", wantErr: true},
+		{desc: "header after body", value: "req-body=0, res-hdr=10", wantErr: true},
+		{desc: "unknown section", value: "foo=0", wantErr: true},
+		{desc: "invalid offset", value: "req-hdr=a, req-body=1", wantErr: true},
+		{desc: "missing offset", value: "null-body", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := parseEncapsulated(test.value)
+			if test.wantErr {
+				var se *statusError
+				require.ErrorAs(t, err, &se)
+				assert.Equal(t, StatusBadRequest, se.status)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestChunkedReader(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		want     string
+		wantErr  error
+		wantIEOF bool
+	}{
+		{desc: "empty", input: "0\r\n\r\n", want: ""},
+		{desc: "chunks", input: "5\r\nhello\r\n1;foo=bar\r\n \r\n5\r\nworld\r\n0\r\n\r\n", want: "hello world"},
+		{desc: "ieof", input: "5\r\nhello\r\n0; ieof\r\n\r\n", want: "hello", wantIEOF: true},
+		{desc: "trailer", input: "2\r\nhi\r\n0\r\nX-Foo: bar\r\n\r\n", want: "hi"},
+		{desc: "invalid size", input: "zz\r\nhello\r\n0\r\n\r\n", wantErr: errMalformedChunk},
+		{desc: "missing crlf", input: "2\r\nhello\r\n0\r\n\r\n", wantErr: errMalformedChunk},
+		{desc: "truncated", input: "5\r\nhel", wantErr: io.ErrUnexpectedEOF},
+		{desc: "no last chunk", input: "5\r\nhello\r\n", wantErr: io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			c := &chunkedReader{r: bufio.NewReader(strings.NewReader(test.input))}
+			got, err := io.ReadAll(c)
+			if test.wantErr != nil {
+				assert.True(t, errors.Is(err, test.wantErr), "got error %v", err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, string(got))
+			assert.Equal(t, test.wantIEOF, c.ieof)
+		})
+	}
+}
+
+func TestReadRequest(t *testing.T) {
+	reqHdr := "GET http://example.com/file HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	raw := "REQMOD icap://icap.example.com/reqmod ICAP/1.0\r\n" +
+		"Host: icap.example.com\r\n" +
+		"Allow: 204\r\n" +
+		"Encapsulated: req-hdr=0, req-body=" + strconv.Itoa(len(reqHdr)) + "\r\n" +
+		"\r\n" +
+		reqHdr +
+		"4\r\nbody\r\n0\r\n\r\n"
+
+	req, err := readRequest(bufio.NewReader(strings.NewReader(raw)), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, MethodREQMOD, req.Method)
+	assert.Equal(t, PathREQMOD, req.URL.Path)
+	assert.Equal(t, reqHdr, string(req.ReqHdr))
+	assert.Nil(t, req.ResHdr)
+	assert.True(t, req.allow204())
+	assert.True(t, req.keepAlive())
+	assert.Equal(t, "http://example.com/file", req.httpURL())
+
+	b, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "body", string(b))
+	assert.True(t, req.Body.complete())
+}
+
+func TestReadRequestPreview(t *testing.T) {
+	raw := "RESPMOD icap://icap.example.com/respmod ICAP/1.0\r\n" +
+		"Preview: 4\r\n" +
+		"Encapsulated: res-hdr=0, res-body=19\r\n" +
+		"\r\n" +
+		"HTTP/1.1 200 OK\r\n\r\n" +
+		"4\r\nbody\r\n0\r\n\r\n" +
+		"4\r\nrest\r\n0\r\n\r\n"
+
+	continued := 0
+	req, err := readRequest(bufio.NewReader(strings.NewReader(raw)), func() error {
+		continued++
+		return nil
+	})
+	require.NoError(t, err)
+
+	b, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "bodyrest", string(b))
+	assert.Equal(t, 1, continued)
+	assert.True(t, req.Body.complete())
+	assert.False(t, req.Body.previewOnly())
+}
+
+func TestReadRequestErrors(t *testing.T) {
+	tests := []struct {
+		desc   string
+		raw    string
+		status int
+	}{
+		{
+			desc:   "malformed request line",
+			raw:    "OPTIONS\r\n\r\n",
+			status: StatusBadRequest,
+		},
+		{
+			desc:   "unsupported version",
+			raw:    "OPTIONS icap://localhost/reqmod ICAP/2.0\r\n\r\n",
+			status: StatusVersionNotSupported,
+		},
+		{
+			desc:   "missing encapsulated",
+			raw:    "REQMOD icap://localhost/reqmod ICAP/1.0\r\n\r\n",
+			status: StatusBadRequest,
+		},
+		{
+			desc:   "truncated header",
+			raw:    "REQMOD icap://localhost/reqmod ICAP/1.0\r\nEncapsulated: req-hdr=0, null-body=100\r\n\r\nGET / HTTP/1.1\r\n",
+			status: StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := readRequest(bufio.NewReader(strings.NewReader(test.raw)), nil)
+			var se *statusError
+			require.ErrorAs(t, err, &se)
+			assert.Equal(t, test.status, se.status)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package icap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ICAP status codes.
+const (
+	StatusContinue            = 100
+	StatusOK                  = 200
+	StatusNoContent           = 204
+	StatusBadRequest          = 400
+	StatusNotFound            = 404
+	StatusMethodNotAllowed    = 405
+	StatusInternalError       = 500
+	StatusNotImplemented      = 501
+	StatusServiceOverloaded   = 503
+	StatusVersionNotSupported = 505
+)
+
+var statusText = map[int]string{
+	StatusContinue:            "Continue",
+	StatusOK:                  "OK",
+	StatusNoContent:           "No Content",
+	StatusBadRequest:          "Bad Request",
+	StatusNotFound:            "ICAP Service Not Found",
+	StatusMethodNotAllowed:    "Method Not Allowed For Service",
+	StatusInternalError:       "Server Error",
+	StatusNotImplemented:      "Method Not Implemented",
+	StatusServiceOverloaded:   "Service Overloaded",
+	StatusVersionNotSupported: "ICAP Version Not Supported",
+}
+
+// StatusText returns a text for the ICAP status code.
+func StatusText(code int) string {
+	return statusText[code]
+}
+
+// response is an ICAP response.
+type response struct {
+	status int
+	header textproto.MIMEHeader
+
+	// resHdr is the encapsulated HTTP header, if any.
+	resHdr []byte
+	// reqHdr is the encapsulated HTTP request header, returned instead
+	// of resHdr when echoing a REQMOD request.
+	reqHdr []byte
+	// body is the encapsulated body, sent chunked, if any.
+	body io.Reader
+	// cleanup, when not nil, is called once the response is written.
+	cleanup func()
+}
+
+func newResponse(status int) *response {
+	return &response{status: status, header: make(textproto.MIMEHeader)}
+}
+
+// write writes the response to w.
+func (r *response) write(w *bufio.Writer) error {
+	r.header.Set("Date", time.Now().UTC().Format(time.RFC1123))
+	r.header.Set("Encapsulated", r.encapsulated())
+
+	fmt.Fprintf(w, "ICAP/1.0 %d %s\r\n", r.status, StatusText(r.status))
+
+	names := make([]string, 0, len(r.header))
+	for name := range r.header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range r.header[name] {
+			fmt.Fprintf(w, "%s: %s\r\n", name, v)
+		}
+	}
+	w.WriteString("\r\n")
+
+	w.Write(r.reqHdr)
+	w.Write(r.resHdr)
+
+	if r.body != nil {
+		if err := writeChunked(w, r.body); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// encapsulated returns the value of the Encapsulated header of the response.
+func (r *response) encapsulated() string {
+	var sections []string
+	offset := 0
+	if r.reqHdr != nil {
+		sections = append(sections, sectionReqHdr+"=0")
+		offset = len(r.reqHdr)
+	}
+	if r.resHdr != nil {
+		sections = append(sections, sectionResHdr+"="+strconv.Itoa(offset))
+		offset += len(r.resHdr)
+	}
+
+	switch {
+	case r.body == nil:
+		sections = append(sections, sectionNull+"="+strconv.Itoa(offset))
+	case r.resHdr == nil && r.reqHdr != nil:
+		sections = append(sections, sectionReqBody+"="+strconv.Itoa(offset))
+	default:
+		sections = append(sections, sectionResBody+"="+strconv.Itoa(offset))
+	}
+	return strings.Join(sections, ", ")
+}
+
+// writeChunked writes the content of r to w with the chunked encoding.
+func writeChunked(w *bufio.Writer, r io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(w, "%x\r\n", n)
+			w.Write(buf[:n])
+			w.WriteString("\r\n")
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error while writing encapsulated body: %w", err)
+		}
+	}
+	_, err := w.WriteString("0\r\n\r\n")
+	return err
+}
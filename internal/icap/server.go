@@ -0,0 +1,576 @@
+// Package icap exposes the clamd daemon over ICAP (RFC 3507), so that proxies
+// and DLP appliances can have the HTTP messages they relay scanned.
+//
+// The REQMOD and RESPMOD services stream the encapsulated HTTP body to clamd.
+// Clean messages are answered with 204, infected ones, or those the verdict
+// policy blocks, with a blocking page.
+package icap
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/admission"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/controllers"
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/lescactus/clamav-api-go/internal/heuristics"
+	"github.com/lescactus/clamav-api-go/internal/metrics"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/lescactus/clamav-api-go/internal/ratelimit"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+)
+
+// Paths of the ICAP services.
+const (
+	PathREQMOD  = "/reqmod"
+	PathRESPMOD = "/respmod"
+)
+
+// ServiceName is the name of the service sent in the OPTIONS responses.
+const ServiceName = "clamav-api-go"
+
+// defaultISTag is the ISTag used until the version of clamd is known.
+const defaultISTag = "clamav-api-go"
+
+// ErrServerClosed is returned by Serve after a call to Shutdown.
+var ErrServerClosed = errors.New("icap: server closed")
+
+// Server is an ICAP server.
+type Server struct {
+	Logger *zerolog.Logger
+	Clamav clamav.Clamaver
+
+	// Admission, when not nil, admits the scans like on the REST API.
+	Admission *admission.Controller
+	// Audit, when not nil, records the scans in the audit log.
+	Audit *audit.Logger
+	// IdleTimeout is the maximum time to wait for the client on a connection.
+	// Zero means no timeout.
+	IdleTimeout time.Duration
+	// HeuristicsPolicy decides how the archive heuristics reported by clamd
+	// are reported. Nil reports them as infected. Only infected files are
+	// blocked, unless Policy is set.
+	HeuristicsPolicy heuristics.Policy
+	// Policy, when not nil, decides which files are blocked: those it
+	// blocks are, those it allows or warns about aren't.
+	Policy *policy.Engine
+	// FileTypes, when not nil, detects the types of the files and blocks
+	// those which aren't allowed, without scanning them.
+	FileTypes *filetype.Detector
+	// TrustedProxies are the proxies whose X-Client-IP header is trusted as
+	// the IP address of the HTTP client. The address of the other proxies is
+	// recorded instead.
+	TrustedProxies []netip.Prefix
+
+	istag atomic.Value
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool // connections, and whether they are serving a request
+	closed   bool
+}
+
+// New creates a new Server.
+func New(logger *zerolog.Logger, clamav clamav.Clamaver) *Server {
+	return &Server{
+		Logger: logger,
+		Clamav: clamav,
+	}
+}
+
+// Serve accepts the connections of l and serves them. It always returns
+// a non-nil error, ErrServerClosed after a call to Shutdown.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		if !s.track(c) {
+			c.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(c)
+	}
+}
+
+// Shutdown stops accepting connections, closes the idle ones and waits for
+// the requests in progress to be answered. When ctx expires first,
+// the remaining connections are closed and the error of ctx is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for c := range s.conns {
+				c.Close()
+			}
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// track registers the connection c. It returns false if the server is closed.
+func (s *Server) track(c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]bool)
+	}
+	s.conns[c] = false
+	return true
+}
+
+// setActive marks c as serving a request or not. It returns false when
+// the connection must not serve any more requests as the server is closed.
+func (s *Server) setActive(c net.Conn, active bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed && !active {
+		return false
+	}
+	s.conns[c] = active
+	return true
+}
+
+// closeIdleConns closes the idle connections and returns true if none is left.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c, active := range s.conns {
+		if !active {
+			c.Close()
+			delete(s.conns, c)
+		}
+	}
+	return len(s.conns) == 0
+}
+
+// serveConn serves the requests sent on c until the client closes it.
+func (s *Server) serveConn(c net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	br := bufio.NewReader(&deadlineReader{conn: c, timeout: s.IdleTimeout})
+	bw := bufio.NewWriter(c)
+	remote := remoteHost(c)
+
+	for {
+		req, err := readRequest(br, func() error {
+			if _, err := bw.WriteString("ICAP/1.0 100 Continue\r\n\r\n"); err != nil {
+				return err
+			}
+			return bw.Flush()
+		})
+		if err != nil {
+			var se *statusError
+			if errors.As(err, &se) {
+				s.Logger.Debug().Str("remote_client", remote).Msgf("bad icap request: %v", err)
+				metrics.ICAPRequests.WithLabelValues("", strconv.Itoa(se.status)).Inc()
+				_ = newResponse(se.status).write(bw)
+			}
+			return
+		}
+
+		if !s.setActive(c, true) {
+			return
+		}
+		keepAlive := s.serveRequest(bw, req, remote)
+		if !keepAlive || !req.keepAlive() || !s.setActive(c, false) {
+			return
+		}
+	}
+}
+
+// serveRequest answers req. It returns false if the connection can't be reused.
+func (s *Server) serveRequest(bw *bufio.Writer, req *Request, remote string) bool {
+	start := time.Now()
+	reqID := xid.New()
+	ctx := hlog.CtxWithID(context.Background(), reqID)
+
+	resp, keepAlive := s.handle(ctx, req, remote)
+	resp.header.Set("ISTag", strconv.Quote(s.ISTag()))
+	resp.header.Set("X-Request-Id", reqID.String())
+	if !keepAlive {
+		resp.header.Set("Connection", "close")
+	}
+
+	if err := resp.write(bw); err != nil {
+		s.Logger.Debug().Str("req_id", reqID.String()).Msgf("error while writing icap response: %v", err)
+		keepAlive = false
+	}
+	if resp.cleanup != nil {
+		resp.cleanup()
+	}
+
+	metrics.ICAPRequests.WithLabelValues(req.Method, strconv.Itoa(resp.status)).Inc()
+	metrics.ICAPRequestDuration.WithLabelValues(req.Method).Observe(time.Since(start).Seconds())
+
+	s.Logger.Info().
+		Str("req_id", reqID.String()).
+		Str("method", req.Method).
+		Str("url", req.URL.String()).
+		Int("status", resp.status).
+		Str("remote_client", remote).
+		Dur("duration", time.Since(start)).
+		Msg("")
+
+	return keepAlive
+}
+
+// handle routes req to its service.
+func (s *Server) handle(ctx context.Context, req *Request, remote string) (*response, bool) {
+	var method string
+	switch req.URL.Path {
+	case PathREQMOD:
+		method = MethodREQMOD
+	case PathRESPMOD:
+		method = MethodRESPMOD
+	default:
+		return newResponse(StatusNotFound), req.Body == nil
+	}
+
+	switch req.Method {
+	case MethodOptions:
+		return s.options(ctx, method), req.Body == nil
+	case MethodREQMOD, MethodRESPMOD:
+		if req.Method != method {
+			return newResponse(StatusMethodNotAllowed), req.Body == nil
+		}
+		return s.scan(ctx, req, remote)
+	default:
+		return newResponse(StatusNotImplemented), req.Body == nil
+	}
+}
+
+// options answers an OPTIONS request for the service of the given method.
+func (s *Server) options(ctx context.Context, method string) *response {
+	s.refreshISTag(ctx)
+
+	resp := newResponse(StatusOK)
+	resp.header.Set("Methods", method)
+	resp.header.Set("Service", ServiceName)
+	resp.header.Set("Allow", "204")
+	resp.header.Set("Options-TTL", "3600")
+	return resp
+}
+
+// ISTag returns the tag of the service, which changes with the version
+// of the virus databases loaded by clamd.
+func (s *Server) ISTag() string {
+	if tag, ok := s.istag.Load().(string); ok {
+		return tag
+	}
+	return defaultISTag
+}
+
+// refreshISTag computes the ISTag from the version of clamd. Failures are
+// logged and the previous tag is kept.
+func (s *Server) refreshISTag(ctx context.Context) {
+	reqID, _ := hlog.IDFromCtx(ctx)
+
+	version, err := s.Clamav.Version(ctx)
+	if err != nil {
+		s.Logger.Error().Str("req_id", reqID.String()).Msgf("error while sending version command: %v", err)
+		return
+	}
+
+	sum := sha256.Sum256(version)
+	// The ISTag is limited to 32 characters
+	s.istag.Store("clamav-" + hex.EncodeToString(sum[:])[:24])
+}
+
+// scan streams the body of req to clamd and answers according to the verdict.
+func (s *Server) scan(ctx context.Context, req *Request, remote string) (resp *response, keepAlive bool) {
+	reqID, _ := hlog.IDFromCtx(ctx)
+
+	if req.Body == nil {
+		return s.unmodified(req, nil), true
+	}
+
+	if s.Admission != nil {
+		release, err := s.Admission.Acquire(ctx)
+		if err != nil {
+			s.Logger.Warn().Str("req_id", reqID.String()).
+				Err(err).
+				Msg("scan rejected by admission control")
+
+			resp := newResponse(StatusServiceOverloaded)
+			if retry := s.Admission.RetryAfter(); retry > 0 {
+				resp.header.Set("Retry-After", strconv.Itoa(ratelimit.RetryAfterSeconds(retry)))
+			}
+			return resp, false
+		}
+		defer release()
+	}
+
+	cr := &countingReader{r: req.Body}
+	var r io.Reader = cr
+	var h hash.Hash
+	if s.Audit != nil {
+		h = sha256.New()
+		r = io.TeeReader(r, h)
+	}
+
+	// Without "Allow: 204", a clean message has to be sent back as is
+	var spool *os.File
+	if !req.allow204() {
+		var err error
+		spool, err = os.CreateTemp("", "clamav-api-icap-")
+		if err != nil {
+			s.Logger.Error().Str("req_id", reqID.String()).Msgf("error while creating spool file: %v", err)
+			return newResponse(StatusInternalError), false
+		}
+		defer func() {
+			// The spool file is removed once sent back, if it is
+			if resp == nil || resp.body != spool {
+				removeSpool(spool)
+			}
+		}()
+		r = io.TeeReader(r, spool)
+	}
+
+	var res []byte
+	var fileType filetype.Result
+	var err error
+	if s.FileTypes != nil {
+		fileType, r, err = s.FileTypes.Inspect(r, httpPath(req.httpURL()))
+	}
+	if err == nil {
+		res, err = s.Clamav.InStream(ctx, r, -1)
+	}
+	keepAlive = req.Body.complete()
+
+	rec := audit.Record{
+		Action:   audit.ActionScan,
+		FileName: req.httpURL(),
+		FileSize: cr.n,
+	}
+	if h != nil && keepAlive {
+		rec.SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+
+	var found controllers.InStreamResponse
+	if errors.Is(err, clamav.ErrVirusFound) {
+		found = controllers.FoundResponse(s.HeuristicsPolicy, res)
+		if !found.VirusFound {
+			// An archive heuristic the policy doesn't report as infected
+			err = nil
+		}
+	}
+	blocked := errors.Is(err, clamav.ErrVirusFound)
+	if errors.Is(err, filetype.ErrDenied) {
+		// Rejected before its scan
+		s.Logger.Info().Str("req_id", reqID.String()).Str("url", req.httpURL()).Err(err).Msg("file rejected")
+		rec.Verdict, rec.Error = audit.VerdictRejected, err.Error()
+		blocked, err = true, nil
+	} else if err == nil || blocked {
+		rec.Verdict, rec.Signature = found.AuditVerdict()
+		if d, ok := controllers.ApplyPolicy(s.Policy, controllers.PrincipalFromContext(ctx), httpPath(req.httpURL()), fileType.Type, &found); ok {
+			rec.PolicyVerdict, rec.PolicyRule = string(d.Verdict), d.Rule
+			s.Logger.Info().
+				Str("req_id", reqID.String()).
+				Str("url", req.httpURL()).
+				Str("signature", rec.Signature).
+				Str("policy", d.Policy).
+				Str("policy_rule", d.Rule).
+				Str("verdict", string(d.Verdict)).
+				Msg("verdict policy applied")
+
+			blocked = d.Verdict == policy.ActionBlock
+			err = nil
+		}
+	}
+
+	switch {
+	case err == nil && !blocked:
+		s.Logger.Debug().Str("req_id", reqID.String()).Msg("file scanned successfully")
+		s.auditLog(ctx, req, rec, remote)
+
+		if !keepAlive {
+			return newResponse(StatusInternalError), false
+		}
+		if req.allow204() || req.Body.previewOnly() {
+			return newResponse(StatusNoContent), true
+		}
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			s.Logger.Error().Str("req_id", reqID.String()).Msgf("error while reading spool file: %v", err)
+			return newResponse(StatusInternalError), false
+		}
+		resp = s.unmodified(req, spool)
+		resp.cleanup = func() { removeSpool(spool) }
+		return resp, true
+
+	case blocked:
+		s.Logger.Debug().Str("req_id", reqID.String()).Str("signature", found.Signature).Msg("file blocked")
+		signature := found.Signature
+		switch {
+		case rec.Verdict == audit.VerdictRejected:
+			signature = "FileType." + fileType.MIME
+		case signature == "":
+			// Blocked by a file type rule of the verdict policy
+			signature = "Policy." + found.PolicyRule
+		}
+		s.auditLog(ctx, req, rec, remote)
+
+		resp, err = blockResponse(signature, req.httpURL(), reqID.String())
+		if err != nil {
+			s.Logger.Error().Str("req_id", reqID.String()).Msgf("error while rendering block page: %v", err)
+			return newResponse(StatusInternalError), false
+		}
+		resp.header.Set("X-Infection-Found", fmt.Sprintf("Type=0; Resolution=2; Threat=%s;", signature))
+		resp.header.Set("X-Virus-ID", signature)
+		return resp, keepAlive
+
+	default:
+		s.Logger.Error().Str("req_id", reqID.String()).Msgf("error while scanning file: %v", err)
+		rec.Verdict = audit.VerdictError
+		rec.Error = err.Error()
+		s.auditLog(ctx, req, rec, remote)
+
+		return newResponse(StatusInternalError), false
+	}
+}
+
+// unmodified returns the response telling the client the message isn't
+// modified: 204 when allowed, the original message otherwise.
+func (s *Server) unmodified(req *Request, body io.Reader) *response {
+	if req.allow204() {
+		return newResponse(StatusNoContent)
+	}
+
+	resp := newResponse(StatusOK)
+	if req.Method == MethodREQMOD {
+		resp.reqHdr = req.ReqHdr
+	} else {
+		resp.resHdr = req.ResHdr
+	}
+	resp.body = body
+	return resp
+}
+
+// auditLog records rec in the audit log, if enabled, after completing it
+// with the client IP address and ID of the request.
+func (s *Server) auditLog(ctx context.Context, req *Request, rec audit.Record, remote string) {
+	reqID, _ := hlog.IDFromCtx(ctx)
+	audit.LogRequest(s.Audit, s.Logger, rec, controllers.PrincipalFromContext(ctx), s.clientIP(req, remote), reqID.String())
+}
+
+// clientIP returns the IP address of the HTTP client, given by the proxy
+// remote in the X-Client-IP header if it's one of the trusted proxies, or
+// the one of the proxy otherwise.
+func (s *Server) clientIP(req *Request, remote string) string {
+	if !controllers.IsTrusted(remote, s.TrustedProxies) {
+		return remote
+	}
+	ip := strings.TrimSpace(req.Header.Get("X-Client-IP"))
+	if _, err := netip.ParseAddr(ip); err != nil {
+		return remote
+	}
+	return ip
+}
+
+// httpPath returns the path of the URL of the HTTP request, the name the
+// file types of the verdict policy are matched against.
+func httpPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// removeSpool closes and removes the spool file f.
+func removeSpool(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// remoteHost returns the IP address of the peer of c.
+func remoteHost(c net.Conn) string {
+	host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+	if err != nil {
+		return c.RemoteAddr().String()
+	}
+	return host
+}
+
+// deadlineReader extends the read deadline of conn on each read.
+type deadlineReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	if d.timeout > 0 {
+		_ = d.conn.SetReadDeadline(time.Now().Add(d.timeout))
+	}
+	return d.conn.Read(p)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,623 @@
+package icap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/admission"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/lescactus/clamav-api-go/internal/heuristics"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// encrypted is reported by fakeClamav as an encrypted archive.
+const encrypted = "encrypted archive"
+
+// fakeClamav is a Clamaver replying successfully to all commands,
+// unless err is set. InStream reports the EICAR test file as infected.
+type fakeClamav struct {
+	err error
+
+	mu      sync.Mutex
+	scanned []byte
+	version string
+}
+
+var _ clamav.Clamaver = (*fakeClamav)(nil)
+
+func (f *fakeClamav) Ping(context.Context) ([]byte, error) {
+	return []byte("PONG"), f.err
+}
+
+func (f *fakeClamav) Version(context.Context) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.version == "" {
+		return []byte("ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023"), nil
+	}
+	return []byte(f.version), nil
+}
+
+func (f *fakeClamav) Reload(context.Context) error {
+	return f.err
+}
+
+func (f *fakeClamav) Stats(context.Context) ([]byte, error) {
+	return nil, clamav.ErrUnknownCommand
+}
+
+func (f *fakeClamav) VersionCommands(context.Context) ([]byte, error) {
+	return nil, clamav.ErrUnknownCommand
+}
+
+func (f *fakeClamav) Shutdown(context.Context) error {
+	return clamav.ErrUnknownCommand
+}
+
+func (f *fakeClamav) FreshClam(context.Context) ([]byte, error) {
+	return nil, clamav.ErrUnknownCommand
+}
+
+func (f *fakeClamav) InStream(_ context.Context, r io.Reader, size int64) ([]byte, error) {
+	if size >= 0 {
+		return nil, errors.New("size of an ICAP scan should be unknown")
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.scanned = b
+	f.mu.Unlock()
+
+	if bytes.Contains(b, []byte(eicar)) {
+		return []byte("stream: Win.Test.EICAR_HDB-1 FOUND"), clamav.ErrVirusFound
+	}
+	if bytes.Equal(b, []byte(encrypted)) {
+		return []byte("stream: Heuristics.Encrypted.Zip FOUND"), clamav.ErrVirusFound
+	}
+	return clamav.RespScan, nil
+}
+
+// newTestServer starts s on a local listener and returns a connection to it.
+func newTestServer(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = s.Shutdown(ctx)
+	})
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func newTestLogger() *zerolog.Logger {
+	logger := zerolog.Nop()
+	return &logger
+}
+
+// testResponse is an ICAP response read by readResponse.
+type testResponse struct {
+	status int
+	header textproto.MIMEHeader
+	// sections holds the encapsulated headers and body, by section name.
+	sections map[string]string
+}
+
+// readResponse reads an ICAP response from br.
+func readResponse(t *testing.T, br *bufio.Reader) *testResponse {
+	t.Helper()
+
+	tp := textproto.NewReader(br)
+	line, err := tp.ReadLine()
+	require.NoError(t, err)
+	parts := strings.SplitN(line, " ", 3)
+	require.Len(t, parts, 3)
+	require.Equal(t, "ICAP/1.0", parts[0])
+	status, err := strconv.Atoi(parts[1])
+	require.NoError(t, err)
+
+	resp := &testResponse{status: status, sections: make(map[string]string)}
+	if status == StatusContinue {
+		_, err := tp.ReadLine()
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp.header, err = tp.ReadMIMEHeader()
+	require.NoError(t, err)
+
+	sections, err := parseEncapsulated(resp.header.Get("Encapsulated"))
+	require.NoError(t, err)
+	for i, s := range sections[:len(sections)-1] {
+		b := make([]byte, sections[i+1].offset-s.offset)
+		_, err := io.ReadFull(br, b)
+		require.NoError(t, err)
+		resp.sections[s.name] = string(b)
+	}
+	if last := sections[len(sections)-1]; last.name != sectionNull {
+		b, err := io.ReadAll(&chunkedReader{r: br})
+		require.NoError(t, err)
+		resp.sections[last.name] = string(b)
+	}
+	return resp
+}
+
+// modRequest returns a REQMOD or RESPMOD request carrying body, chunked.
+func modRequest(method, service string, headers map[string]string, body string) string {
+	var b strings.Builder
+	b.WriteString(method + " icap://127.0.0.1" + service + " ICAP/1.0\r\n")
+	b.WriteString("Host: 127.0.0.1\r\n")
+	for k, v := range headers {
+		b.WriteString(k + ": " + v + "\r\n")
+	}
+
+	reqHdr := "GET http://example.com/file HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	resHdr := "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n\r\n"
+	if method == MethodREQMOD {
+		b.WriteString("Encapsulated: req-hdr=0, req-body=" + strconv.Itoa(len(reqHdr)) + "\r\n\r\n")
+		b.WriteString(reqHdr)
+	} else {
+		b.WriteString("Encapsulated: req-hdr=0, res-hdr=" + strconv.Itoa(len(reqHdr)) +
+			", res-body=" + strconv.Itoa(len(reqHdr)+len(resHdr)) + "\r\n\r\n")
+		b.WriteString(reqHdr + resHdr)
+	}
+
+	if body != "" {
+		b.WriteString(strconv.FormatInt(int64(len(body)), 16) + "\r\n" + body + "\r\n")
+	}
+	b.WriteString("0\r\n\r\n")
+	return b.String()
+}
+
+func TestOptions(t *testing.T) {
+	f := &fakeClamav{}
+	c := newTestServer(t, New(newTestLogger(), f))
+	br := bufio.NewReader(c)
+
+	_, err := io.WriteString(c, "OPTIONS icap://127.0.0.1/respmod ICAP/1.0\r\nHost: 127.0.0.1\r\n\r\n")
+	require.NoError(t, err)
+	resp := readResponse(t, br)
+
+	assert.Equal(t, StatusOK, resp.status)
+	assert.Equal(t, MethodRESPMOD, resp.header.Get("Methods"))
+	assert.Equal(t, "204", resp.header.Get("Allow"))
+	assert.Equal(t, "null-body=0", resp.header.Get("Encapsulated"))
+	assert.NotEmpty(t, resp.header.Get("Date"))
+	istag := resp.header.Get("ISTag")
+	assert.Regexp(t, `^"clamav-[0-9a-f]{24}"$`, istag)
+
+	// The ISTag changes with the virus databases
+	f.mu.Lock()
+	f.version = "ClamAV 1.0.1/26962/Fri Jul  7 07:29:38 2023"
+	f.mu.Unlock()
+
+	_, err = io.WriteString(c, "OPTIONS icap://127.0.0.1/reqmod ICAP/1.0\r\nHost: 127.0.0.1\r\n\r\n")
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+
+	assert.Equal(t, StatusOK, resp.status)
+	assert.Equal(t, MethodREQMOD, resp.header.Get("Methods"))
+	assert.NotEqual(t, istag, resp.header.Get("ISTag"))
+}
+
+func TestModify(t *testing.T) {
+	tests := []struct {
+		desc       string
+		method     string
+		service    string
+		headers    map[string]string
+		body       string
+		wantStatus int
+		wantBody   string
+		blocked    bool
+	}{
+		{
+			desc:       "reqmod clean",
+			method:     MethodREQMOD,
+			service:    PathREQMOD,
+			headers:    map[string]string{"Allow": "204"},
+			body:       "clean content",
+			wantStatus: StatusNoContent,
+		},
+		{
+			desc:       "respmod clean",
+			method:     MethodRESPMOD,
+			service:    PathRESPMOD,
+			headers:    map[string]string{"Allow": "204"},
+			body:       "clean content",
+			wantStatus: StatusNoContent,
+		},
+		{
+			desc:       "respmod clean without allow 204",
+			method:     MethodRESPMOD,
+			service:    PathRESPMOD,
+			body:       "clean content",
+			wantStatus: StatusOK,
+			wantBody:   "clean content",
+		},
+		{
+			desc:       "reqmod infected",
+			method:     MethodREQMOD,
+			service:    PathREQMOD,
+			headers:    map[string]string{"Allow": "204"},
+			body:       eicar,
+			wantStatus: StatusOK,
+			blocked:    true,
+		},
+		{
+			desc:       "respmod infected",
+			method:     MethodRESPMOD,
+			service:    PathRESPMOD,
+			body:       eicar,
+			wantStatus: StatusOK,
+			blocked:    true,
+		},
+		{
+			desc:       "complete preview",
+			method:     MethodRESPMOD,
+			service:    PathRESPMOD,
+			headers:    map[string]string{"Preview": "1024"},
+			wantStatus: StatusNoContent,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			f := &fakeClamav{}
+			c := newTestServer(t, New(newTestLogger(), f))
+			br := bufio.NewReader(c)
+
+			req := modRequest(test.method, test.service, test.headers, test.body)
+			if test.headers["Preview"] != "" {
+				req = strings.Replace(req, "0\r\n\r\n", "0; ieof\r\n\r\n", 1)
+			}
+			_, err := io.WriteString(c, req)
+			require.NoError(t, err)
+			resp := readResponse(t, br)
+
+			assert.Equal(t, test.wantStatus, resp.status)
+			assert.NotEmpty(t, resp.header.Get("ISTag"))
+			assert.NotEmpty(t, resp.header.Get("X-Request-Id"))
+			assert.Equal(t, test.body, string(f.scanned))
+
+			if test.wantBody != "" {
+				assert.Equal(t, test.wantBody, resp.sections[sectionResBody])
+				assert.Contains(t, resp.sections[sectionResHdr], "HTTP/1.1 200 OK")
+			}
+			if test.blocked {
+				assert.Contains(t, resp.sections[sectionResHdr], "HTTP/1.1 403 Forbidden")
+				assert.Contains(t, resp.sections[sectionResBody], "Win.Test.EICAR_HDB-1")
+				assert.Contains(t, resp.sections[sectionResBody], "http://example.com/file")
+				assert.Equal(t, "Win.Test.EICAR_HDB-1", resp.header.Get("X-Virus-ID"))
+				assert.Equal(t, "Type=0; Resolution=2; Threat=Win.Test.EICAR_HDB-1;", resp.header.Get("X-Infection-Found"))
+			}
+
+			// The connection is reused
+			_, err = io.WriteString(c, "OPTIONS icap://127.0.0.1/reqmod ICAP/1.0\r\n\r\n")
+			require.NoError(t, err)
+			assert.Equal(t, StatusOK, readResponse(t, br).status)
+		})
+	}
+}
+
+func TestModifyHeuristics(t *testing.T) {
+	tests := []struct {
+		desc    string
+		policy  heuristics.Policy
+		blocked bool
+	}{
+		{desc: "infected by default", blocked: true},
+		{desc: "suspicious", policy: heuristics.Policy{heuristics.CategoryEncrypted: heuristics.VerdictSuspicious}},
+		{desc: "clean", policy: heuristics.Policy{heuristics.CategoryEncrypted: heuristics.VerdictClean}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			s := New(newTestLogger(), &fakeClamav{})
+			s.HeuristicsPolicy = test.policy
+			c := newTestServer(t, s)
+
+			_, err := io.WriteString(c, modRequest(MethodRESPMOD, PathRESPMOD, map[string]string{"Allow": "204"}, encrypted))
+			require.NoError(t, err)
+			resp := readResponse(t, bufio.NewReader(c))
+
+			// Only infected files are blocked
+			if test.blocked {
+				assert.Equal(t, StatusOK, resp.status)
+				assert.Equal(t, "Heuristics.Encrypted.Zip", resp.header.Get("X-Virus-ID"))
+			} else {
+				assert.Equal(t, StatusNoContent, resp.status)
+			}
+		})
+	}
+}
+
+func TestModifyPolicy(t *testing.T) {
+	engine, err := policy.Parse([]byte(`
+policies:
+  default:
+    rules:
+      - name: allow-test
+        signatures: ["*.Test.*"]
+        action: allow
+      - name: block-file
+        file_types: ["file"]
+        action: block
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc      string
+		body      string
+		wantVirus string
+	}{
+		{desc: "allowed detection", body: eicar},
+		{desc: "blocked file type", body: "clean", wantVirus: "Policy.block-file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			s := New(newTestLogger(), &fakeClamav{})
+			s.Policy = engine
+			c := newTestServer(t, s)
+
+			_, err := io.WriteString(c, modRequest(MethodRESPMOD, PathRESPMOD, map[string]string{"Allow": "204"}, test.body))
+			require.NoError(t, err)
+			resp := readResponse(t, bufio.NewReader(c))
+
+			if test.wantVirus != "" {
+				assert.Equal(t, StatusOK, resp.status)
+				assert.Equal(t, test.wantVirus, resp.header.Get("X-Virus-ID"))
+			} else {
+				assert.Equal(t, StatusNoContent, resp.status)
+			}
+		})
+	}
+}
+
+func TestModifyFileType(t *testing.T) {
+	f := &fakeClamav{}
+	s := New(newTestLogger(), f)
+	detector, err := filetype.New(filetype.Config{Deny: []string{"executable"}})
+	require.NoError(t, err)
+	s.FileTypes = detector
+	c := newTestServer(t, s)
+
+	_, err = io.WriteString(c, modRequest(MethodRESPMOD, PathRESPMOD, map[string]string{"Allow": "204"}, "MZ\x90\x00\x03"))
+	require.NoError(t, err)
+	resp := readResponse(t, bufio.NewReader(c))
+
+	// Denied files are blocked without being scanned
+	assert.Equal(t, StatusOK, resp.status)
+	assert.Equal(t, "FileType.application/vnd.microsoft.portable-executable", resp.header.Get("X-Virus-ID"))
+	assert.Empty(t, f.scanned)
+}
+
+func TestModifyPreviewContinue(t *testing.T) {
+	f := &fakeClamav{}
+	c := newTestServer(t, New(newTestLogger(), f))
+	br := bufio.NewReader(c)
+
+	reqHdr := "GET http://example.com/file HTTP/1.1\r\n\r\n"
+	_, err := io.WriteString(c, "REQMOD icap://127.0.0.1/reqmod ICAP/1.0\r\n"+
+		"Allow: 204\r\n"+
+		"Preview: 4\r\n"+
+		"Encapsulated: req-hdr=0, req-body="+strconv.Itoa(len(reqHdr))+"\r\n\r\n"+
+		reqHdr+
+		"4\r\nX5O!\r\n0\r\n\r\n")
+	require.NoError(t, err)
+
+	// The rest of the body is sent once asked for
+	assert.Equal(t, StatusContinue, readResponse(t, br).status)
+	rest := eicar[4:]
+	_, err = io.WriteString(c, strconv.FormatInt(int64(len(rest)), 16)+"\r\n"+rest+"\r\n0\r\n\r\n")
+	require.NoError(t, err)
+
+	resp := readResponse(t, br)
+	assert.Equal(t, StatusOK, resp.status)
+	assert.Contains(t, resp.sections[sectionResHdr], "HTTP/1.1 403 Forbidden")
+	assert.Equal(t, eicar, string(f.scanned))
+}
+
+func TestModifyNullBody(t *testing.T) {
+	c := newTestServer(t, New(newTestLogger(), &fakeClamav{}))
+	br := bufio.NewReader(c)
+
+	reqHdr := "GET http://example.com/ HTTP/1.1\r\n\r\n"
+	_, err := io.WriteString(c, "REQMOD icap://127.0.0.1/reqmod ICAP/1.0\r\n"+
+		"Encapsulated: req-hdr=0, null-body="+strconv.Itoa(len(reqHdr))+"\r\n\r\n"+
+		reqHdr)
+	require.NoError(t, err)
+
+	// Without "Allow: 204", the request is sent back
+	resp := readResponse(t, br)
+	assert.Equal(t, StatusOK, resp.status)
+	assert.Equal(t, reqHdr, resp.sections[sectionReqHdr])
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		desc       string
+		clamavErr  error
+		req        string
+		wantStatus int
+	}{
+		{
+			desc:       "unknown service",
+			req:        "OPTIONS icap://127.0.0.1/foo ICAP/1.0\r\n\r\n",
+			wantStatus: StatusNotFound,
+		},
+		{
+			desc:       "wrong service",
+			req:        modRequest(MethodREQMOD, PathRESPMOD, nil, "content"),
+			wantStatus: StatusMethodNotAllowed,
+		},
+		{
+			desc:       "unknown method",
+			req:        "FOO icap://127.0.0.1/reqmod ICAP/1.0\r\n\r\n",
+			wantStatus: StatusNotImplemented,
+		},
+		{
+			desc:       "bad encapsulated header",
+			req:        "REQMOD icap://127.0.0.1/reqmod ICAP/1.0\r\nEncapsulated: foo\r\n\r\n",
+			wantStatus: StatusBadRequest,
+		},
+		{
+			desc:       "unsupported version",
+			req:        "OPTIONS icap://127.0.0.1/reqmod ICAP/0.9\r\n\r\n",
+			wantStatus: StatusVersionNotSupported,
+		},
+		{
+			desc:       "clamd error",
+			clamavErr:  errors.New("connection refused"),
+			req:        modRequest(MethodRESPMOD, PathRESPMOD, nil, "content"),
+			wantStatus: StatusInternalError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			c := newTestServer(t, New(newTestLogger(), &fakeClamav{err: test.clamavErr}))
+
+			_, err := io.WriteString(c, test.req)
+			require.NoError(t, err)
+			resp := readResponse(t, bufio.NewReader(c))
+			assert.Equal(t, test.wantStatus, resp.status)
+		})
+	}
+}
+
+func TestModifyAdmission(t *testing.T) {
+	ac := admission.New(admission.Config{MaxInFlight: 1})
+	release, err := ac.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	s := New(newTestLogger(), &fakeClamav{})
+	s.Admission = ac
+	c := newTestServer(t, s)
+
+	_, err = io.WriteString(c, modRequest(MethodREQMOD, PathREQMOD, nil, "content"))
+	require.NoError(t, err)
+	resp := readResponse(t, bufio.NewReader(c))
+	assert.Equal(t, StatusServiceOverloaded, resp.status)
+	assert.Equal(t, "1", resp.header.Get("Retry-After"))
+	assert.Equal(t, "close", resp.header.Get("Connection"))
+}
+
+// auditSink is an audit.Sink keeping the records in memory.
+type auditSink struct {
+	mu      sync.Mutex
+	records []audit.Record
+}
+
+func (a *auditSink) WriteRecord(b []byte) error {
+	var rec audit.Record
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.records = append(a.records, rec)
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *auditSink) Close() error { return nil }
+
+func TestModifyAudit(t *testing.T) {
+	tests := []struct {
+		name         string
+		trusted      []netip.Prefix
+		clientIP     string
+		wantClientIP string
+	}{
+		{name: "trusted proxy", trusted: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}, clientIP: "192.0.2.1", wantClientIP: "192.0.2.1"},
+		{name: "untrusted proxy", clientIP: "192.0.2.1", wantClientIP: "127.0.0.1"},
+		{name: "invalid client IP", trusted: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}, clientIP: "not an ip", wantClientIP: "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &auditSink{}
+			al, err := audit.New(sink, nil)
+			require.NoError(t, err)
+
+			s := New(newTestLogger(), &fakeClamav{})
+			s.Audit = al
+			s.TrustedProxies = tt.trusted
+			c := newTestServer(t, s)
+
+			_, err = io.WriteString(c, modRequest(MethodRESPMOD, PathRESPMOD, map[string]string{
+				"Allow":       "204",
+				"X-Client-IP": tt.clientIP,
+			}, eicar))
+			require.NoError(t, err)
+			readResponse(t, bufio.NewReader(c))
+
+			sink.mu.Lock()
+			defer sink.mu.Unlock()
+			require.Len(t, sink.records, 2)
+			rec := sink.records[1]
+			assert.Equal(t, audit.ActionScan, rec.Action)
+			assert.Equal(t, audit.VerdictInfected, rec.Verdict)
+			assert.Equal(t, "Win.Test.EICAR_HDB-1", rec.Signature)
+			assert.Equal(t, "http://example.com/file", rec.FileName)
+			assert.Equal(t, int64(len(eicar)), rec.FileSize)
+			assert.Equal(t, "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f", rec.SHA256)
+			assert.Equal(t, tt.wantClientIP, rec.ClientIP)
+			assert.NotEmpty(t, rec.RequestID)
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	s := New(newTestLogger(), &fakeClamav{})
+	c := newTestServer(t, s)
+
+	_, err := io.WriteString(c, "OPTIONS icap://127.0.0.1/reqmod ICAP/1.0\r\n\r\n")
+	require.NoError(t, err)
+	br := bufio.NewReader(c)
+	readResponse(t, br)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+
+	// The idle connection is closed
+	_, err = br.ReadByte()
+	assert.Error(t, err)
+}
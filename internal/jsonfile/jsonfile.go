@@ -0,0 +1,378 @@
+// Package jsonfile decodes files sent as base64 in JSON documents, for the
+// clients which can't send multipart requests.
+//
+// A document is either a file object or an array of file objects:
+//
+//	{"filename": "report.pdf", "content_base64": "JVBERi0xLjcK..."}
+//
+// The content is decoded while the document is read, so that neither the
+// encoded nor the decoded content is ever held in memory.
+package jsonfile
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Field names of a file object.
+const (
+	FieldFileName = "filename"
+	FieldContent  = "content_base64"
+)
+
+// maxStringLen is the maximum length of the strings other than the content.
+const maxStringLen = 1024
+
+// ErrInvalid indicates the document is malformed.
+var ErrInvalid = errors.New("invalid json file")
+
+// File describes a decoded file.
+type File struct {
+	FileName string
+	// Size is the size of the decoded content.
+	Size int64
+}
+
+// Decoder decodes the files of a document.
+type Decoder struct {
+	r *bufio.Reader
+
+	started bool
+	done    bool
+	batch   bool
+}
+
+// NewDecoder returns a Decoder reading the document from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Batch returns true if the document is an array of files.
+// It is only known once Next has been called.
+func (d *Decoder) Batch() bool {
+	return d.batch
+}
+
+// Next decodes the next file of the document, calling scan with a reader
+// of its decoded content. The content scan doesn't read is discarded.
+// Errors returned by scan are returned as is. Next returns io.EOF once
+// all the files are decoded.
+func (d *Decoder) Next(scan func(content io.Reader) error) (File, error) {
+	if d.done {
+		return File{}, io.EOF
+	}
+
+	if !d.started {
+		d.started = true
+		c, err := d.peek()
+		if err != nil {
+			return File{}, err
+		}
+		if c == '[' {
+			d.batch = true
+			d.r.ReadByte()
+			if c, err = d.peek(); err != nil {
+				return File{}, err
+			}
+			if c == ']' {
+				return File{}, invalid("no file in the array")
+			}
+		}
+	} else if err := d.expect(','); err != nil {
+		return File{}, err
+	}
+
+	f, err := d.file(scan)
+	if err != nil {
+		return f, err
+	}
+
+	if d.batch {
+		c, err := d.peek()
+		if err != nil {
+			return f, err
+		}
+		if c == ']' {
+			d.r.ReadByte()
+			d.done = true
+		}
+	} else {
+		d.done = true
+	}
+
+	if d.done {
+		if _, err := d.peek(); !errors.Is(err, io.EOF) {
+			if err == nil || errors.Is(err, ErrInvalid) {
+				err = invalid("unexpected data after the document")
+			}
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// file decodes a file object.
+func (d *Decoder) file(scan func(content io.Reader) error) (File, error) {
+	var f File
+	var seen = make(map[string]bool)
+
+	if err := d.expect('{'); err != nil {
+		return f, err
+	}
+	for {
+		c, err := d.peek()
+		if err != nil {
+			return f, err
+		}
+		if c == '}' && len(seen) == 0 {
+			d.r.ReadByte()
+			break
+		}
+		if len(seen) > 0 {
+			if err := d.expect(','); err != nil {
+				return f, err
+			}
+		}
+
+		key, err := d.string()
+		if err != nil {
+			return f, err
+		}
+		if seen[key] {
+			return f, invalid("duplicate field %q", key)
+		}
+		seen[key] = true
+		if err := d.expect(':'); err != nil {
+			return f, err
+		}
+
+		switch key {
+		case FieldFileName:
+			if f.FileName, err = d.string(); err != nil {
+				return f, err
+			}
+		case FieldContent:
+			if f.Size, err = d.content(scan); err != nil {
+				return f, err
+			}
+		default:
+			return f, invalid("unknown field %q", key)
+		}
+
+		if c, err = d.peek(); err != nil {
+			return f, err
+		}
+		if c == '}' {
+			d.r.ReadByte()
+			break
+		}
+	}
+
+	if !seen[FieldContent] {
+		return f, invalid("missing field %q", FieldContent)
+	}
+	return f, nil
+}
+
+// content decodes the base64 content, returning its decoded size.
+func (d *Decoder) content(scan func(content io.Reader) error) (int64, error) {
+	if err := d.expect('"'); err != nil {
+		return 0, err
+	}
+
+	sr := &stringReader{r: d.r}
+	cr := &contentReader{r: base64.NewDecoder(base64.StdEncoding, sr)}
+	if err := scan(cr); err != nil {
+		return cr.n, err
+	}
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return cr.n, err
+	}
+	return cr.n, nil
+}
+
+// string decodes a string, which must not be longer than maxStringLen.
+func (d *Decoder) string() (string, error) {
+	if err := d.expect('"'); err != nil {
+		return "", err
+	}
+	b, err := io.ReadAll(io.LimitReader(&stringReader{r: d.r}, maxStringLen+1))
+	if err != nil {
+		return "", err
+	}
+	if len(b) > maxStringLen {
+		return "", invalid("string longer than %d bytes", maxStringLen)
+	}
+	return string(b), nil
+}
+
+// peek skips the white spaces and returns the next byte, without reading it.
+func (d *Decoder) peek() (byte, error) {
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) && !d.done {
+				return 0, invalid("unexpected end of document")
+			}
+			return 0, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return c, d.r.UnreadByte()
+	}
+}
+
+// expect reads the next byte, skipping the white spaces, which must be c.
+func (d *Decoder) expect(c byte) error {
+	got, err := d.peek()
+	if err != nil {
+		return err
+	}
+	if got != c {
+		return invalid("expected %q, got %q", c, got)
+	}
+	d.r.ReadByte()
+	return nil
+}
+
+func invalid(format string, a ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, a...))
+}
+
+// stringReader reads the unescaped bytes of a string, up to its closing quote.
+type stringReader struct {
+	r   *bufio.Reader
+	eof bool
+	// pending holds the bytes of an escaped character left to read.
+	pending []byte
+}
+
+func (s *stringReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(s.pending) > 0 {
+			c := copy(p[n:], s.pending)
+			s.pending = s.pending[c:]
+			n += c
+			continue
+		}
+		if s.eof {
+			break
+		}
+		// Avoid blocking once some bytes are read
+		if n > 0 && s.r.Buffered() == 0 {
+			return n, nil
+		}
+
+		c, err := s.r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = invalid("unterminated string")
+			}
+			return n, err
+		}
+		switch {
+		case c == '"':
+			s.eof = true
+		case c == '\\':
+			if s.pending, err = s.escape(); err != nil {
+				return n, err
+			}
+		case c < 0x20:
+			return n, invalid("control character in string")
+		default:
+			p[n] = c
+			n++
+		}
+	}
+	if n == 0 && s.eof {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// escape decodes an escape sequence, returning the UTF-8 encoding
+// of the escaped character.
+func (s *stringReader) escape() ([]byte, error) {
+	c, err := s.r.ReadByte()
+	if err != nil {
+		return nil, invalid("unterminated string")
+	}
+	switch c {
+	case '"', '\\', '/':
+		return []byte{c}, nil
+	case 'b':
+		return []byte{'\b'}, nil
+	case 'f':
+		return []byte{'\f'}, nil
+	case 'n':
+		return []byte{'\n'}, nil
+	case 'r':
+		return []byte{'\r'}, nil
+	case 't':
+		return []byte{'\t'}, nil
+	case 'u':
+		r, err := s.hex()
+		if err != nil {
+			return nil, err
+		}
+		if utf16.IsSurrogate(r) {
+			// The second half of a surrogate pair must follow
+			var esc [2]byte
+			if _, err := io.ReadFull(s.r, esc[:]); err != nil || esc != [2]byte{'\\', 'u'} {
+				return nil, invalid("invalid surrogate pair")
+			}
+			r2, err := s.hex()
+			if err != nil {
+				return nil, err
+			}
+			if r = utf16.DecodeRune(r, r2); r == utf8.RuneError {
+				return nil, invalid("invalid surrogate pair")
+			}
+		}
+		return utf8.AppendRune(nil, r), nil
+	}
+	return nil, invalid("invalid escape sequence \\%c", c)
+}
+
+// hex decodes the 4 hexadecimal digits of a \u escape sequence.
+func (s *stringReader) hex() (rune, error) {
+	var hex [4]byte
+	if _, err := io.ReadFull(s.r, hex[:]); err != nil {
+		return 0, invalid("unterminated string")
+	}
+	r, err := strconv.ParseUint(string(hex[:]), 16, 16)
+	if err != nil {
+		return 0, invalid("invalid escape sequence \\u%s", hex[:])
+	}
+	return rune(r), nil
+}
+
+// contentReader counts the decoded bytes, and reports the invalid base64
+// as ErrInvalid.
+type contentReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *contentReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	var corrupt base64.CorruptInputError
+	switch {
+	case errors.As(err, &corrupt):
+		err = invalid("invalid base64 content at offset %d", int64(corrupt))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		err = invalid("truncated base64 content")
+	}
+	return n, err
+}
@@ -0,0 +1,163 @@
+package jsonfile
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeAll decodes all the files of doc, returning them with their content.
+func decodeAll(t *testing.T, doc string) ([]File, []string, bool, error) {
+	t.Helper()
+
+	// One byte at a time, to exercise the reads across the buffer boundaries
+	d := NewDecoder(iotest.OneByteReader(strings.NewReader(doc)))
+	var files []File
+	var contents []string
+	for {
+		var content []byte
+		f, err := d.Next(func(r io.Reader) error {
+			var err error
+			content, err = io.ReadAll(r)
+			return err
+		})
+		if errors.Is(err, io.EOF) {
+			return files, contents, d.Batch(), nil
+		}
+		if err != nil {
+			return files, contents, d.Batch(), err
+		}
+		files = append(files, f)
+		contents = append(contents, string(content))
+	}
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		name      string
+		doc       string
+		wantFiles []File
+		wantData  []string
+		wantBatch bool
+	}{
+		{
+			name:      "object",
+			doc:       `{"filename":"eicar.com","content_base64":"` + b64("foobar") + `"}`,
+			wantFiles: []File{{FileName: "eicar.com", Size: 6}},
+			wantData:  []string{"foobar"},
+		},
+		{
+			name:      "content first",
+			doc:       ` { "content_base64" : "` + b64("foo") + `" , "filename" : "a.txt" } ` + "\n",
+			wantFiles: []File{{FileName: "a.txt", Size: 3}},
+			wantData:  []string{"foo"},
+		},
+		{
+			name:      "no file name",
+			doc:       `{"content_base64":""}`,
+			wantFiles: []File{{}},
+			wantData:  []string{""},
+		},
+		{
+			name:      "array",
+			doc:       `[{"filename":"a","content_base64":"` + b64("foo") + `"},{"filename":"b","content_base64":"` + b64("barbaz") + `"}]`,
+			wantFiles: []File{{FileName: "a", Size: 3}, {FileName: "b", Size: 6}},
+			wantData:  []string{"foo", "barbaz"},
+			wantBatch: true,
+		},
+		{
+			name:      "escapes",
+			doc:       `{"filename":"café 😀\t\"q\".txt","content_base64":"` + strings.ReplaceAll(b64("\xff\xfe\xfd"), "/", `\/`) + `\n"}`,
+			wantFiles: []File{{FileName: "café 😀\t\"q\".txt", Size: 3}},
+			wantData:  []string{"\xff\xfe\xfd"},
+		},
+		{
+			name:      "utf-8 file name",
+			doc:       `{"filename":"résumé.pdf","content_base64":"` + b64("foo") + `"}`,
+			wantFiles: []File{{FileName: "résumé.pdf", Size: 3}},
+			wantData:  []string{"foo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, data, batch, err := decodeAll(t, tt.doc)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantFiles, files)
+			assert.Equal(t, tt.wantData, data)
+			assert.Equal(t, tt.wantBatch, batch)
+		})
+	}
+}
+
+func TestDecoderInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{name: "empty", doc: ``},
+		{name: "not an object", doc: `"foo"`},
+		{name: "empty object", doc: `{}`},
+		{name: "empty array", doc: `[]`},
+		{name: "missing content", doc: `{"filename":"a"}`},
+		{name: "unknown field", doc: `{"filename":"a","content_base64":"","size":1}`},
+		{name: "duplicate field", doc: `{"content_base64":"","content_base64":""}`},
+		{name: "not a string", doc: `{"filename":1,"content_base64":""}`},
+		{name: "invalid base64", doc: `{"content_base64":"Zm9v!"}`},
+		{name: "truncated base64", doc: `{"content_base64":"Zm9vY"}`},
+		{name: "unterminated string", doc: `{"content_base64":"Zm9v`},
+		{name: "unterminated object", doc: `{"content_base64":"Zm9v"`},
+		{name: "missing comma", doc: `{"filename":"a" "content_base64":""}`},
+		{name: "trailing comma", doc: `{"content_base64":"",}`},
+		{name: "unterminated array", doc: `[{"content_base64":""}`},
+		{name: "trailing data", doc: `{"content_base64":""} {}`},
+		{name: "control character", doc: "{\"filename\":\"a\nb\",\"content_base64\":\"\"}"},
+		{name: "invalid escape", doc: `{"filename":"\x","content_base64":""}`},
+		{name: "invalid surrogate pair", doc: `{"filename":"\ud83d","content_base64":""}`},
+		{name: "long file name", doc: `{"filename":"` + strings.Repeat("a", maxStringLen+1) + `","content_base64":""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := decodeAll(t, tt.doc)
+			assert.ErrorIs(t, err, ErrInvalid)
+		})
+	}
+}
+
+func TestDecoderUnreadContent(t *testing.T) {
+	// The content left unread by scan is discarded, and still validated
+	d := NewDecoder(strings.NewReader(`[{"content_base64":"` + b64("foobar") + `"},{"content_base64":"Zm9v!"}]`))
+	noop := func(io.Reader) error { return nil }
+
+	f, err := d.Next(noop)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), f.Size)
+
+	_, err = d.Next(noop)
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestDecoderErrors(t *testing.T) {
+	// Errors of scan and of the underlying reader are returned as is
+	errScan := errors.New("scan error")
+	d := NewDecoder(strings.NewReader(`{"content_base64":"` + b64("foobar") + `"}`))
+	_, err := d.Next(func(io.Reader) error { return errScan })
+	assert.Equal(t, errScan, err)
+
+	errRead := errors.New("read error")
+	d = NewDecoder(io.MultiReader(strings.NewReader(`{"content_base64":"Zm9v`), iotest.ErrReader(errRead)))
+	_, err = d.Next(func(r io.Reader) error {
+		_, err := io.ReadAll(r)
+		return err
+	})
+	assert.ErrorIs(t, err, errRead)
+}
@@ -0,0 +1,157 @@
+// Package metrics provides the Prometheus metrics exposed by the ClamAV API.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "clamav_api"
+
+// Registry is the registry holding every metric of the application.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// RateLimitInFlight is the number of in-flight requests tracked by the rate limiter, per route.
+	RateLimitInFlight = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ratelimit",
+		Name:      "inflight_requests",
+		Help:      "Number of in-flight requests tracked by the rate limiter.",
+	}, []string{"route"})
+
+	// RateLimitClients is the number of clients tracked by the rate limiter, per route.
+	RateLimitClients = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ratelimit",
+		Name:      "tracked_clients",
+		Help:      "Number of clients currently tracked by the rate limiter.",
+	}, []string{"route"})
+
+	// RateLimitRejections is the number of requests rejected by the rate limiter,
+	// per route and reason ("rate" or "concurrency").
+	RateLimitRejections = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ratelimit",
+		Name:      "rejected_requests_total",
+		Help:      "Number of requests rejected by the rate limiter.",
+	}, []string{"route", "reason"})
+
+	// AdmissionInFlight is the number of scans admitted by the admission control.
+	AdmissionInFlight = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "admission",
+		Name:      "inflight_scans",
+		Help:      "Number of in-flight scans admitted by the admission control.",
+	})
+
+	// AdmissionQueued is the number of scans waiting to be admitted.
+	AdmissionQueued = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "admission",
+		Name:      "queued_scans",
+		Help:      "Number of scans waiting to be admitted by the admission control.",
+	})
+
+	// AdmissionRejections is the number of scans rejected by the admission control,
+	// per reason ("queue_full" or "queue_timeout").
+	AdmissionRejections = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "admission",
+		Name:      "rejected_scans_total",
+		Help:      "Number of scans rejected by the admission control.",
+	}, []string{"reason"})
+
+	// ClamdQueueItems is the length of the clamd queue, as last reported by STATS.
+	ClamdQueueItems = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "clamd",
+		Name:      "queue_items",
+		Help:      "Number of items in the clamd queue, as last reported by STATS.",
+	})
+
+	// ClamdIdleThreads is the number of idle clamd threads, as last reported by STATS.
+	ClamdIdleThreads = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "clamd",
+		Name:      "idle_threads",
+		Help:      "Number of idle clamd threads, as last reported by STATS.",
+	})
+
+	// ClamdOverloaded is 1 when the clamd backlog exceeds the admission thresholds, 0 otherwise.
+	ClamdOverloaded = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "clamd",
+		Name:      "overloaded",
+		Help:      "Whether the clamd backlog exceeds the admission control thresholds.",
+	})
+
+	// FreshClamUpdates is the number of scheduled updates of the virus
+	// definitions, per result ("updated", "up_to_date" or "failed").
+	FreshClamUpdates = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "freshclam",
+		Name:      "scheduled_updates_total",
+		Help:      "Number of scheduled updates of the virus definitions.",
+	}, []string{"result"})
+
+	// FreshClamConsecutiveFailures is the number of scheduled updates failed in a row.
+	FreshClamConsecutiveFailures = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "freshclam",
+		Name:      "consecutive_failures",
+		Help:      "Number of scheduled updates of the virus definitions failed in a row.",
+	})
+
+	// FreshClamLastSuccess is the time of the last successful scheduled update, in seconds since the epoch.
+	FreshClamLastSuccess = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "freshclam",
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Time of the last successful scheduled update of the virus definitions.",
+	})
+
+	// ClamdDatabaseVersion is the version of the databases loaded by clamd,
+	// as last confirmed by VERSION.
+	ClamdDatabaseVersion = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "clamd",
+		Name:      "database_version",
+		Help:      "Version of the virus databases loaded by clamd, as last reported by VERSION.",
+	})
+
+	// ICAPRequests is the number of ICAP requests answered, per method and status code.
+	ICAPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "icap",
+		Name:      "requests_total",
+		Help:      "Number of ICAP requests answered.",
+	}, []string{"method", "status"})
+
+	// ICAPRequestDuration is the time taken to answer ICAP requests, per method.
+	ICAPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "icap",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to answer ICAP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler returns an http.Handler exposing the metrics of Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	RateLimitRejections.WithLabelValues("/rest/v1/scan", "rate").Inc()
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	Handler().ServeHTTP(rr, req)
+
+	body, _ := io.ReadAll(rr.Result().Body)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, string(body), `clamav_api_ratelimit_rejected_requests_total{reason="rate",route="/rest/v1/scan"} 1`)
+	assert.Contains(t, string(body), "go_goroutines")
+}
@@ -0,0 +1,270 @@
+// Package mirror serves the official virus databases of a directory in the
+// layout freshclam expects from a PrivateMirror, so that an instance with
+// access to the official mirrors can feed air-gapped ones:
+//
+//	<dir>/<name>.cvd            eg. main.cvd, daily.cvd, bytecode.cvd
+//	<dir>/<name>-<version>.cdiff  eg. daily-27432.cdiff
+//
+// The files are imported through Put, replaced atomically, so that they are
+// never served half written.
+package mirror
+
+import (
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/databases"
+)
+
+const tmpPrefix = ".tmp-"
+
+// diffMagic starts the decompressed content of a CDIFF file.
+const diffMagic = "ClamAV-Diff"
+
+var (
+	// ErrInvalid indicates an invalid file name or database.
+	ErrInvalid = errors.New("invalid mirror file")
+	// ErrNotFound indicates the requested file isn't in the mirror.
+	ErrNotFound = errors.New("mirror file not found")
+	// ErrOutdated indicates an imported database is older than the one of the mirror.
+	ErrOutdated = errors.New("mirror file outdated")
+)
+
+// nameRegexp matches the names of the CVD and CDIFF files.
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_]*(\.cvd|-[0-9]+\.cdiff)$`)
+
+// ValidName returns true if name is the name of a CVD or CDIFF file.
+func ValidName(name string) bool {
+	return nameRegexp.MatchString(name)
+}
+
+// File is a file of the mirror.
+type File struct {
+	Name string `json:"name"`
+	// Version is the version of the database of a CVD file.
+	Version int   `json:"version,omitempty"`
+	Size    int64 `json:"size"`
+	// ModifiedAt is the build time of the database of a CVD file, or the
+	// time a CDIFF file was imported.
+	ModifiedAt time.Time `json:"modified_at"`
+	ETag       string    `json:"etag"`
+	// SHA256 is the checksum of an imported file.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Store is a mirror of the databases of a directory.
+// It is safe for concurrent use.
+type Store struct {
+	// mu serializes the imports, which compare the versions of the databases
+	mu  sync.Mutex
+	dir string
+}
+
+// New returns a Store of the files of dir, which must exist.
+func New(dir string) (*Store, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening mirror directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("mirror directory %s isn't a directory", dir)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Open opens the file name of the mirror, to be served.
+func (s *Store) Open(name string) (*os.File, File, error) {
+	if !ValidName(name) {
+		return nil, File{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, File{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, File{}, fmt.Errorf("error while opening mirror file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, File{}, fmt.Errorf("error while opening mirror file: %w", err)
+	}
+	var version int
+	if strings.HasSuffix(name, ".cvd") {
+		if h, err := databases.ReadHeader(io.NewSectionReader(f, 0, databases.HeaderSize)); err == nil {
+			version = h.Version
+		}
+	}
+	return f, newFile(name, info, version), nil
+}
+
+// List returns the files of the mirror, sorted by name.
+func (s *Store) List() ([]File, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading mirror directory: %w", err)
+	}
+
+	files := []File{}
+	for _, entry := range entries {
+		if entry.IsDir() || !ValidName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Replaced since listed
+			continue
+		}
+		var version int
+		if strings.HasSuffix(entry.Name(), ".cvd") {
+			if h, err := readHeader(filepath.Join(s.dir, entry.Name())); err == nil {
+				version = h.Version
+			}
+		}
+		files = append(files, newFile(entry.Name(), info, version))
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// Put imports the file name from r, replacing the file of the same name.
+// The header of a CVD file is checked against its content, and its version
+// must not be lower than the version of the file it replaces. A CDIFF file
+// must be gzip compressed content starting with "ClamAV-Diff".
+func (s *Store) Put(name string, r io.Reader) (File, error) {
+	if !ValidName(name) {
+		return File{}, fmt.Errorf("%w: %q isn't a .cvd or .cdiff file name", ErrInvalid, name)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, tmpPrefix+name)
+	if err != nil {
+		return File{}, fmt.Errorf("error while writing mirror file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	// The header of a CVD file holds the MD5 of the content after it
+	body := md5.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash, &skipWriter{w: body, n: databases.HeaderSize}), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return File{}, fmt.Errorf("error while writing mirror file: %w", err)
+	}
+	if n == 0 {
+		return File{}, fmt.Errorf("%w: %s is empty", ErrInvalid, name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := filepath.Join(s.dir, name)
+	var version int
+	if strings.HasSuffix(name, ".cvd") {
+		h, err := readHeader(tmp.Name())
+		if err != nil {
+			return File{}, fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+		if sum := hex.EncodeToString(body.Sum(nil)); !strings.EqualFold(sum, h.MD5) {
+			return File{}, fmt.Errorf("%w: MD5 %s of %s doesn't match the MD5 %s of its header", ErrInvalid, sum, name, h.MD5)
+		}
+		if cur, err := readHeader(path); err == nil && h.Version < cur.Version {
+			return File{}, fmt.Errorf("%w: version %d of %s is older than the version %d of the mirror", ErrOutdated, h.Version, name, cur.Version)
+		}
+		version = h.Version
+		// freshclam compares the build time of its databases to the
+		// Last-Modified of the mirror
+		if !h.BuildTime.IsZero() {
+			if err := os.Chtimes(tmp.Name(), h.BuildTime, h.BuildTime); err != nil {
+				return File{}, fmt.Errorf("error while writing mirror file: %w", err)
+			}
+		}
+	} else if err := checkDiff(tmp.Name()); err != nil {
+		return File{}, err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return File{}, fmt.Errorf("error while writing mirror file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return File{}, fmt.Errorf("error while writing mirror file: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return File{}, fmt.Errorf("error while writing mirror file: %w", err)
+	}
+	file := newFile(name, info, version)
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
+
+// newFile returns the file name described by info, holding the database
+// version, if a CVD file. Its ETag changes when the file is replaced.
+func newFile(name string, info os.FileInfo, version int) File {
+	return File{
+		Name:       name,
+		Version:    version,
+		Size:       info.Size(),
+		ModifiedAt: info.ModTime().UTC(),
+		ETag: `"` + strconv.Itoa(version) + "-" + strconv.FormatInt(info.Size(), 16) + "-" +
+			strconv.FormatInt(info.ModTime().UnixNano(), 16) + `"`,
+	}
+}
+
+// skipWriter writes to w the bytes written after the first n.
+type skipWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (s *skipWriter) Write(p []byte) (int, error) {
+	skip := min(s.n, int64(len(p)))
+	s.n -= skip
+	if _, err := s.w.Write(p[skip:]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// checkDiff checks the CDIFF file path is gzip compressed content starting
+// with diffMagic.
+func checkDiff(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error while reading mirror file: %w", err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%w: content isn't gzip compressed: %w", ErrInvalid, err)
+	}
+	b := make([]byte, len(diffMagic))
+	if _, err := io.ReadFull(zr, b); err != nil || string(b) != diffMagic {
+		return fmt.Errorf("%w: content doesn't start with %q", ErrInvalid, diffMagic)
+	}
+	return nil
+}
+
+// readHeader reads the header of the CVD file path.
+func readHeader(path string) (databases.Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return databases.Header{}, err
+	}
+	defer f.Close()
+	return databases.ReadHeader(f)
+}
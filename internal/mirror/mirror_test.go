@@ -0,0 +1,163 @@
+package mirror
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/databases"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cvd returns a CVD file of the given version, built at buildTime.
+func cvd(version int, buildTime int64) string {
+	return cvdOf(version, buildTime, "signatures")
+}
+
+// cvdOf returns a CVD file of the given version, built at buildTime, holding content.
+func cvdOf(version int, buildTime int64, content string) string {
+	sum := md5.Sum([]byte(content))
+	h := "ClamAV-VDB:17 Oct 2026 07-26 +0000:" + strconv.Itoa(version) + ":2070134:90:" + hex.EncodeToString(sum[:]) + ":dsig:raynman:" + strconv.FormatInt(buildTime, 10)
+	return h + strings.Repeat(" ", databases.HeaderSize-len(h)) + content
+}
+
+// gzipped returns content gzip compressed.
+func gzipped(content string) string {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	_, _ = zw.Write([]byte(content))
+	_ = zw.Close()
+	return b.String()
+}
+
+// cdiff is a CDIFF file.
+var cdiff = gzipped("ClamAV-Diff:27433:\nOPEN daily.ldb\nADD Test.Sig;Target:0;0;41\nCLOSE\n") + ":dsig"
+
+func TestValidName(t *testing.T) {
+	for _, name := range []string{"main.cvd", "daily.cvd", "bytecode.cvd", "daily-27432.cdiff", "safebrowsing.cvd"} {
+		assert.True(t, ValidName(name), name)
+	}
+	for _, name := range []string{"", ".cvd", "../main.cvd", "main.cld", "daily.cdiff", "daily-x.cdiff", "freshclam.dat", ".tmp-main.cvd", "main.cvd/"} {
+		assert.False(t, ValidName(name), name)
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	_, err = New(file)
+	assert.Error(t, err)
+}
+
+func TestStorePut(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	require.NoError(t, err)
+
+	file, err := s.Put("daily.cvd", strings.NewReader(cvd(27432, 1792221960)))
+	require.NoError(t, err)
+	assert.Equal(t, "daily.cvd", file.Name)
+	assert.Equal(t, 27432, file.Version)
+	assert.Equal(t, int64(databases.HeaderSize+len("signatures")), file.Size)
+	assert.Equal(t, time.Unix(1792221960, 0).UTC(), file.ModifiedAt)
+	assert.NotEmpty(t, file.ETag)
+	assert.Len(t, file.SHA256, 64)
+
+	// Same version: replaced
+	newer, err := s.Put("daily.cvd", strings.NewReader(cvdOf(27432, 1792221960, "more signatures")))
+	require.NoError(t, err)
+	assert.NotEqual(t, file.ETag, newer.ETag)
+
+	// Older version: rejected
+	_, err = s.Put("daily.cvd", strings.NewReader(cvd(27431, 1792135560)))
+	assert.ErrorIs(t, err, ErrOutdated)
+
+	_, err = s.Put("daily-27433.cdiff", strings.NewReader(cdiff))
+	require.NoError(t, err)
+
+	for name, content := range map[string]string{
+		"main.cld":         cvd(62, 1631795520),
+		"../main.cvd":      cvd(62, 1631795520),
+		"main.cvd":         "truncated",
+		"daily-1.cdiff":    "",
+		"bytecode.cvd":     "",
+		"safebrowsing.cvd": strings.Repeat(" ", databases.HeaderSize),
+		"daily.cvd":        cvd(27433, 1792308360) + "tampered",
+		"daily-2.cdiff":    "cdiff",
+		"daily-3.cdiff":    gzipped("OPEN daily.ldb\n"),
+	} {
+		_, err := s.Put(name, strings.NewReader(content))
+		assert.ErrorIs(t, err, ErrInvalid, name)
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	// No temporary file is left behind
+	assert.ElementsMatch(t, []string{"daily.cvd", "daily-27433.cdiff"}, names)
+}
+
+func TestStoreOpen(t *testing.T) {
+	s, err := New(t.TempDir())
+	require.NoError(t, err)
+	put, err := s.Put("main.cvd", strings.NewReader(cvd(62, 1631795520)))
+	require.NoError(t, err)
+
+	f, file, err := s.Open("main.cvd")
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, put.ETag, file.ETag)
+	assert.Equal(t, put.ModifiedAt, file.ModifiedAt)
+	assert.Equal(t, 62, file.Version)
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, cvd(62, 1631795520), string(b))
+
+	for _, name := range []string{"daily.cvd", "../main.cvd", "main.cld"} {
+		_, _, err := s.Open(name)
+		assert.ErrorIs(t, err, ErrNotFound, name)
+	}
+}
+
+func TestStoreList(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	require.NoError(t, err)
+
+	files, err := s.List()
+	require.NoError(t, err)
+	assert.Empty(t, files)
+	assert.NotNil(t, files)
+
+	_, err = s.Put("main.cvd", strings.NewReader(cvd(62, 1631795520)))
+	require.NoError(t, err)
+	_, err = s.Put("daily-27433.cdiff", strings.NewReader(cdiff))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "freshclam.dat"), []byte("state"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.cvd"), []byte("truncated"), 0o600))
+
+	files, err = s.List()
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	assert.Equal(t, "broken.cvd", files[0].Name)
+	assert.Zero(t, files[0].Version)
+	assert.Equal(t, "daily-27433.cdiff", files[1].Name)
+	assert.Equal(t, int64(len(cdiff)), files[1].Size)
+	assert.Equal(t, "main.cvd", files[2].Name)
+	assert.Equal(t, 62, files[2].Version)
+}
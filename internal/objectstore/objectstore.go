@@ -0,0 +1,54 @@
+// Package objectstore reads the objects to scan from S3-compatible object
+// storage and writes the verdicts back as object tags.
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrNotFound indicates the bucket, object or version doesn't exist.
+	ErrNotFound = errors.New("object not found")
+	// ErrBucketNotAllowed indicates the bucket isn't in the allowed buckets.
+	ErrBucketNotAllowed = errors.New("bucket not allowed")
+	// ErrInvalidRef indicates the bucket or key of the object is invalid.
+	ErrInvalidRef = errors.New("invalid object reference")
+	// ErrStorage indicates the object storage failed to serve the request.
+	ErrStorage = errors.New("object storage error")
+)
+
+// Ref references an object.
+type Ref struct {
+	Bucket string
+	Key    string
+	// VersionID is the version of the object. Empty means the latest version.
+	VersionID string
+}
+
+// String returns the URI of the object, such as "s3://bucket/key?versionId=v1".
+func (r Ref) String() string {
+	s := "s3://" + r.Bucket + "/" + r.Key
+	if r.VersionID != "" {
+		s += "?versionId=" + r.VersionID
+	}
+	return s
+}
+
+// Object is an object read from the object storage.
+// Body must be closed by the caller.
+type Object struct {
+	Body      io.ReadCloser
+	Size      int64
+	VersionID string
+	ETag      string
+}
+
+// Store is an object storage.
+type Store interface {
+	// Get opens the object referenced by ref.
+	Get(ctx context.Context, ref Ref) (*Object, error)
+	// SetTags sets tags on the object referenced by ref, keeping its other tags.
+	SetTags(ctx context.Context, ref Ref, tags map[string]string) error
+}
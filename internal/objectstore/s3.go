@@ -0,0 +1,138 @@
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"github.com/minio/minio-go/v7/pkg/tags"
+)
+
+// S3Config is the configuration of an S3 store.
+type S3Config struct {
+	// Endpoint is the host[:port] of the S3-compatible service.
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Region    string
+	// UseSSL connects to the endpoint with HTTPS.
+	UseSSL bool
+	// MaxRetries is the maximum number of attempts of a request.
+	// Zero uses the default of the S3 client.
+	MaxRetries int
+	// AllowedBuckets restricts the buckets that can be read. Empty allows all.
+	AllowedBuckets []string
+}
+
+// S3 is a Store backed by an S3-compatible service.
+type S3 struct {
+	client  *minio.Client
+	allowed []string
+}
+
+var _ Store = (*S3)(nil)
+
+// NewS3 returns an S3 store configured with cfg.
+func NewS3(cfg S3Config) (*S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:      credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:     cfg.UseSSL,
+		Region:     cfg.Region,
+		MaxRetries: cfg.MaxRetries,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 configuration: %w", err)
+	}
+
+	return &S3{client: client, allowed: cfg.AllowedBuckets}, nil
+}
+
+// Get opens the object referenced by ref.
+func (s *S3) Get(ctx context.Context, ref Ref) (*Object, error) {
+	if err := s.check(ref); err != nil {
+		return nil, err
+	}
+
+	obj, err := s.client.GetObject(ctx, ref.Bucket, ref.Key, minio.GetObjectOptions{VersionID: ref.VersionID})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	// The object is only requested on its first use
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, s3Error(err)
+	}
+
+	return &Object{
+		Body:      obj,
+		Size:      info.Size,
+		VersionID: info.VersionID,
+		ETag:      info.ETag,
+	}, nil
+}
+
+// SetTags sets tags on the object referenced by ref, keeping its other tags.
+func (s *S3) SetTags(ctx context.Context, ref Ref, t map[string]string) error {
+	if err := s.check(ref); err != nil {
+		return err
+	}
+
+	current, err := s.client.GetObjectTagging(ctx, ref.Bucket, ref.Key, minio.GetObjectTaggingOptions{VersionID: ref.VersionID})
+	if err != nil {
+		return s3Error(err)
+	}
+
+	merged := current.ToMap()
+	for k, v := range t {
+		if v == "" {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+
+	otags, err := tags.NewTags(merged, true)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStorage, err)
+	}
+
+	err = s.client.PutObjectTagging(ctx, ref.Bucket, ref.Key, otags, minio.PutObjectTaggingOptions{VersionID: ref.VersionID})
+	if err != nil {
+		return s3Error(err)
+	}
+	return nil
+}
+
+// check validates ref against the allowed buckets.
+func (s *S3) check(ref Ref) error {
+	if err := s3utils.CheckValidBucketName(ref.Bucket); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRef, err)
+	}
+	if err := s3utils.CheckValidObjectName(ref.Key); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRef, err)
+	}
+	if len(s.allowed) > 0 && !slices.Contains(s.allowed, ref.Bucket) {
+		return fmt.Errorf("%w: %s", ErrBucketNotAllowed, ref.Bucket)
+	}
+	return nil
+}
+
+// s3Error maps the errors of the S3 client to the errors of the package.
+// The original errors are only kept as text, so that network errors of the
+// object storage can't be mistaken for errors talking to clamd.
+func s3Error(err error) error {
+	resp := minio.ToErrorResponse(err)
+	switch {
+	case resp.StatusCode == http.StatusNotFound,
+		resp.Code == "NoSuchBucket", resp.Code == "NoSuchKey", resp.Code == "NoSuchVersion":
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	default:
+		return fmt.Errorf("%w: %v", ErrStorage, err)
+	}
+}
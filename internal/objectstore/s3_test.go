@@ -0,0 +1,191 @@
+package objectstore
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeObject is an object stored by fakeS3.
+type fakeObject struct {
+	data    string
+	version string
+	tags    map[string]string
+}
+
+// fakeS3 is a minimal stand-in for MinIO, serving path-style GetObject,
+// GetObjectTagging and PutObjectTagging requests.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]*fakeObject // by bucket/key
+}
+
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Tags    []struct {
+		Key   string `xml:"Key"`
+		Value string `xml:"Value"`
+	} `xml:"TagSet>Tag"`
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	obj, ok := f.objects[bucket+"/"+key]
+	if version := r.URL.Query().Get("versionId"); ok && version != "" && version != obj.version {
+		ok = false
+	}
+	if !ok {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+		return
+	}
+	w.Header().Set("x-amz-version-id", obj.version)
+
+	_, isTagging := r.URL.Query()["tagging"]
+	switch {
+	case isTagging && r.Method == http.MethodGet:
+		var t tagging
+		for k, v := range obj.tags {
+			t.Tags = append(t.Tags, struct {
+				Key   string `xml:"Key"`
+				Value string `xml:"Value"`
+			}{k, v})
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		_ = xml.NewEncoder(w).Encode(t)
+	case isTagging && r.Method == http.MethodPut:
+		var t tagging
+		if err := xml.NewDecoder(r.Body).Decode(&t); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		obj.tags = make(map[string]string)
+		for _, tag := range t.Tags {
+			obj.tags[tag.Key] = tag.Value
+		}
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if r.Method == http.MethodGet {
+			_, _ = io.WriteString(w, obj.data)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3(t *testing.T, allowed ...string) (*S3, *fakeS3) {
+	t.Helper()
+
+	fake := &fakeS3{objects: map[string]*fakeObject{
+		"uploads/docs/report.pdf": {data: "report", version: "v2", tags: map[string]string{"owner": "alice"}},
+		"private/secret.txt":      {data: "secret", version: "v1"},
+	}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	s, err := NewS3(S3Config{
+		Endpoint:       strings.TrimPrefix(srv.URL, "http://"),
+		AccessKey:      "minioadmin",
+		SecretKey:      "minioadmin",
+		Region:         "us-east-1",
+		AllowedBuckets: allowed,
+	})
+	require.NoError(t, err)
+	return s, fake
+}
+
+func TestS3Get(t *testing.T) {
+	s, _ := newTestS3(t, "uploads")
+
+	tests := []struct {
+		desc    string
+		ref     Ref
+		want    string
+		wantErr error
+	}{
+		{desc: "latest", ref: Ref{Bucket: "uploads", Key: "docs/report.pdf"}, want: "report"},
+		{desc: "version", ref: Ref{Bucket: "uploads", Key: "docs/report.pdf", VersionID: "v2"}, want: "report"},
+		{desc: "unknown version", ref: Ref{Bucket: "uploads", Key: "docs/report.pdf", VersionID: "v1"}, wantErr: ErrNotFound},
+		{desc: "unknown key", ref: Ref{Bucket: "uploads", Key: "missing"}, wantErr: ErrNotFound},
+		{desc: "bucket not allowed", ref: Ref{Bucket: "private", Key: "secret.txt"}, wantErr: ErrBucketNotAllowed},
+		{desc: "invalid bucket", ref: Ref{Bucket: "a", Key: "secret.txt"}, wantErr: ErrInvalidRef},
+		{desc: "missing key", ref: Ref{Bucket: "uploads"}, wantErr: ErrInvalidRef},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			obj, err := s.Get(context.Background(), test.ref)
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer obj.Body.Close()
+
+			b, err := io.ReadAll(obj.Body)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, string(b))
+			assert.Equal(t, int64(len(test.want)), obj.Size)
+			assert.Equal(t, "v2", obj.VersionID)
+		})
+	}
+}
+
+func TestS3GetUnreachable(t *testing.T) {
+	s, err := NewS3(S3Config{Endpoint: "127.0.0.1:1", Region: "us-east-1", MaxRetries: 1})
+	require.NoError(t, err)
+
+	_, err = s.Get(context.Background(), Ref{Bucket: "uploads", Key: "file"})
+	assert.ErrorIs(t, err, ErrStorage)
+}
+
+func TestS3SetTags(t *testing.T) {
+	s, fake := newTestS3(t)
+	ref := Ref{Bucket: "uploads", Key: "docs/report.pdf", VersionID: "v2"}
+
+	err := s.SetTags(context.Background(), ref, map[string]string{
+		"clamav-verdict":   "infected",
+		"clamav-signature": "Win.Test.EICAR_HDB-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"owner":            "alice",
+		"clamav-verdict":   "infected",
+		"clamav-signature": "Win.Test.EICAR_HDB-1",
+	}, fake.objects["uploads/docs/report.pdf"].tags)
+
+	// Empty values remove the tags
+	err = s.SetTags(context.Background(), ref, map[string]string{
+		"clamav-verdict":   "clean",
+		"clamav-signature": "",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"owner":          "alice",
+		"clamav-verdict": "clean",
+	}, fake.objects["uploads/docs/report.pdf"].tags)
+
+	err = s.SetTags(context.Background(), Ref{Bucket: "uploads", Key: "missing"}, map[string]string{"a": "b"})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRefString(t *testing.T) {
+	assert.Equal(t, "s3://uploads/docs/report.pdf", Ref{Bucket: "uploads", Key: "docs/report.pdf"}.String())
+	assert.Equal(t, "s3://uploads/docs/report.pdf?versionId=v2", Ref{Bucket: "uploads", Key: "docs/report.pdf", VersionID: "v2"}.String())
+}
@@ -0,0 +1,149 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type embedded struct {
+	Embedded string `json:"embedded"`
+}
+
+type child struct {
+	Name string `json:"name"`
+}
+
+type sample struct {
+	embedded
+	String   string         `json:"string"`
+	Int      int            `json:"int"`
+	Int64    int64          `json:"int64,omitempty"`
+	Float    float64        `json:"float"`
+	Bool     bool           `json:"bool"`
+	Time     time.Time      `json:"time"`
+	Strings  []string       `json:"strings"`
+	Bytes    []byte         `json:"bytes,omitempty"`
+	Map      map[string]int `json:"map,omitempty"`
+	Child    child          `json:"child"`
+	Children []*child       `json:"children,omitempty"`
+	Skipped  string         `json:"-"`
+	NoTag    string
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/rest/v1/scan", Path("/rest/v1/scan"))
+	assert.Equal(t, "/rest/v1/quarantine/{id}", Path("/rest/v1/quarantine/:id"))
+	assert.Equal(t, "/files/{filepath}", Path("/files/*filepath"))
+}
+
+func TestSchema(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/sample"}, d.Schema(sample{}))
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/sample"}, d.Schema(&sample{}))
+
+	assert.Equal(t, &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"embedded": {Type: "string"},
+			"string":   {Type: "string"},
+			"int":      {Type: "integer", Format: "int32"},
+			"int64":    {Type: "integer", Format: "int64"},
+			"float":    {Type: "number"},
+			"bool":     {Type: "boolean"},
+			"time":     {Type: "string", Format: "date-time"},
+			"strings":  {Type: "array", Items: &Schema{Type: "string"}},
+			"bytes":    {Type: "string", Format: "byte"},
+			"map":      {Type: "object", AdditionalProperties: &Schema{Type: "integer", Format: "int32"}},
+			"child":    {Ref: "#/components/schemas/child"},
+			"children": {Type: "array", Items: &Schema{Ref: "#/components/schemas/child"}},
+			"NoTag":    {Type: "string"},
+			"headers":  {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+		},
+		Required: []string{"embedded", "string", "int", "float", "bool", "time", "strings", "child", "NoTag"},
+	}, d.Components.Schemas["sample"])
+
+	assert.Equal(t, &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{"name": {Type: "string"}},
+		Required:   []string{"name"},
+	}, d.Components.Schemas["child"])
+}
+
+func TestOperationMarshalJSON(t *testing.T) {
+	b, err := json.Marshal(&Operation{OperationID: "protected"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"operationId":"protected","responses":null}`, string(b))
+
+	b, err = json.Marshal(&Operation{OperationID: "public", Security: []SecurityRequirement{}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"operationId":"public","responses":null,"security":[]}`, string(b))
+}
+
+func TestValidate(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	s := d.Schema(sample{})
+
+	valid := sample{Time: time.Now(), Strings: []string{"a"}, Map: map[string]int{"a": 1}, Children: []*child{{Name: "a"}}}
+	b, err := json.Marshal(valid)
+	require.NoError(t, err)
+	assert.NoError(t, d.Validate(s, b))
+
+	tests := []struct {
+		name string
+		json string
+	}{
+		{name: "not an object", json: `[]`},
+		{name: "missing required property", json: `{"string":""}`},
+		{name: "unknown property", json: string(b[:len(b)-1]) + `,"unknown":1}`},
+		{name: "wrong type", json: `{"embedded":"","string":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, d.Validate(s, []byte(tt.json)), ErrInvalid)
+		})
+	}
+}
+
+func TestValidateOneOf(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	s := d.OneOf(child{}, []child{})["application/json"].Schema
+
+	assert.NoError(t, d.Validate(s, []byte(`{"name":"a"}`)))
+	assert.NoError(t, d.Validate(s, []byte(`[{"name":"a"}]`)))
+	assert.ErrorIs(t, d.Validate(s, []byte(`"a"`)), ErrInvalid)
+	assert.ErrorIs(t, d.Validate(s, []byte(`[{"name":1}]`)), ErrInvalid)
+}
+
+func TestHandler(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	d.AddOperation(http.MethodGet, "/items/:id", &Operation{OperationID: "getItem"})
+
+	rr := httptest.NewRecorder()
+	Handler(d).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"openapi": "3.1.0",
+		"info": {"title": "test", "version": "1"},
+		"paths": {"/items/{id}": {"get": {"operationId": "getItem", "responses": null}}},
+		"components": {}
+	}`, rr.Body.String())
+}
+
+func TestSwaggerUIHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	SwaggerUIHandler("test", "/openapi.json").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), `url: "/openapi.json"`)
+}
@@ -0,0 +1,24 @@
+package openapi
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed swagger.html
+var swaggerHTML string
+
+var swaggerTemplate = template.Must(template.New("swagger").Parse(swaggerHTML))
+
+// SwaggerUIHandler returns a http.Handler serving a Swagger UI page
+// rendering the document served at specURL.
+//
+// The Swagger UI assets are loaded from a CDN by the browser.
+func SwaggerUIHandler(title, specURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_ = swaggerTemplate.Execute(w, struct{ Title, SpecURL string }{title, specURL})
+	})
+}
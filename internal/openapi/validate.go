@@ -0,0 +1,125 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalid indicates a JSON value doesn't match its schema.
+var ErrInvalid = errors.New("value doesn't match the schema")
+
+// Validate checks that the JSON document data matches the schema s, resolving
+// the references to the components of d. Properties not described by the
+// schema are rejected.
+func (d *Document) Validate(s *Schema, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("error while decoding json: %w", err)
+	}
+	return d.validate(s, v, "$")
+}
+
+func (d *Document) validate(s *Schema, v any, path string) error {
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		ref, ok := d.Components.Schemas[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema reference %q", path, s.Ref)
+		}
+		s = ref
+	}
+
+	if len(s.OneOf) > 0 {
+		matches := 0
+		for _, one := range s.OneOf {
+			if d.validate(one, v, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%w: %s: expected exactly one schema to match, %d did", ErrInvalid, path, matches)
+		}
+		return nil
+	}
+
+	invalid := func(want string) error {
+		return fmt.Errorf("%w: %s: expected %s, got %T", ErrInvalid, path, want, v)
+	}
+
+	switch s.Type {
+	case "object":
+		m, ok := v.(map[string]any)
+		if !ok {
+			return invalid("object")
+		}
+		for _, name := range s.Required {
+			if _, ok := m[name]; !ok {
+				return fmt.Errorf("%w: %s: missing required property %q", ErrInvalid, path, name)
+			}
+		}
+
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			ps, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties == nil {
+					return fmt.Errorf("%w: %s: unknown property %q", ErrInvalid, path, k)
+				}
+				ps = s.AdditionalProperties
+			}
+			if err := d.validate(ps, m[k], path+"."+k); err != nil {
+				return err
+			}
+		}
+	case "array":
+		a, ok := v.([]any)
+		if !ok {
+			return invalid("array")
+		}
+		for i, item := range a {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return invalid("string")
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%w: %s: invalid date-time %q", ErrInvalid, path, str)
+			}
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return invalid("integer")
+		}
+		if _, err := n.Int64(); err != nil {
+			return invalid("integer")
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return invalid("number")
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return invalid("boolean")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+// Package policy decides the verdict of scans, so that the same reply of
+// clamd can be allowed by some and blocked by others.
+//
+// A policy is an ordered list of rules matching the signatures reported by
+// clamd, the names of the scanned files and their types, detected from their
+// content. The first matching rule decides
+// the verdict: allow, warn or block. Without a matching rule, the files
+// clamd reports are blocked and the others allowed.
+//
+// An Engine holds several policies, selected by the authenticated principal
+// of the scan, such as an API key id.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPolicy is the name of the policy applied when Engine.Default is empty.
+const DefaultPolicy = "default"
+
+// ErrInvalid indicates the policies are invalid.
+var ErrInvalid = errors.New("invalid verdict policy")
+
+// Action is the verdict of a scan.
+type Action string
+
+// Verdicts of scans.
+const (
+	ActionAllow Action = "allow"
+	ActionWarn  Action = "warn"
+	ActionBlock Action = "block"
+)
+
+// Rule decides the verdict of the scans it matches. A rule matches a scan if
+// one of its signatures matches the signature reported by clamd, if any, one
+// of its file types matches the file name, if any, and one of its MIME types
+// matches the detected type of the file, if any.
+type Rule struct {
+	Name string `yaml:"name" json:"name"`
+	// Signatures are glob patterns, eg. "PUA.*", or regular expressions
+	// between slashes, eg. "/^Heuristics\\./".
+	Signatures []string `yaml:"signatures" json:"signatures"`
+	// FileTypes are glob patterns of file names, eg. "*.exe".
+	FileTypes []string `yaml:"file_types" json:"file_types"`
+	// MIMETypes are categories of file types, eg. "executable", or glob
+	// patterns of MIME types, eg. "application/x-*", matched against the
+	// type detected from the content of the file.
+	MIMETypes []string `yaml:"mime_types" json:"mime_types"`
+	Action    Action   `yaml:"action" json:"action"`
+
+	signatures []matcher
+	fileTypes  []matcher
+}
+
+// Policy is an ordered list of rules.
+type Policy struct {
+	Rules []*Rule `yaml:"rules" json:"rules"`
+}
+
+// Engine selects the policy of the scans and decides their verdict.
+type Engine struct {
+	// Default is the name of the policy of the principals without one.
+	// Empty means DefaultPolicy.
+	Default  string             `yaml:"default" json:"default"`
+	Policies map[string]*Policy `yaml:"policies" json:"policies"`
+	// Principals maps the principals, such as the API key ids,
+	// to the name of their policy.
+	Principals map[string]string `yaml:"principals" json:"principals"`
+}
+
+// Input describes a scan.
+type Input struct {
+	// Signature is the signature reported by clamd, empty if none.
+	Signature string
+	// FileName is the name of the scanned file, if known.
+	FileName string
+	// Type is the type detected from the content of the scanned file,
+	// the zero Type if not detected.
+	Type filetype.Type
+}
+
+// Decision is the verdict of a scan.
+type Decision struct {
+	Verdict Action
+	// Policy is the name of the policy applied.
+	Policy string
+	// Rule is the name of the rule which matched, empty if none did.
+	Rule string
+}
+
+// Load reads the policies from the YAML, or JSON, file at name.
+func Load(name string) (*Engine, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading verdict policy file: %w", err)
+	}
+	return Parse(b)
+}
+
+// Parse parses YAML, or JSON, policies.
+func Parse(b []byte) (*Engine, error) {
+	var e Engine
+	dec := yaml.NewDecoder(strings.NewReader(string(b)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&e); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if err := e.compile(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// compile validates the policies and compiles their rules.
+func (e *Engine) compile() error {
+	if e.Default == "" {
+		e.Default = DefaultPolicy
+	}
+	if _, ok := e.Policies[e.Default]; !ok {
+		return fmt.Errorf("%w: default policy %q isn't defined", ErrInvalid, e.Default)
+	}
+	for principal, name := range e.Principals {
+		if _, ok := e.Policies[name]; !ok {
+			return fmt.Errorf("%w: policy %q of principal %q isn't defined", ErrInvalid, name, principal)
+		}
+	}
+
+	for name, p := range e.Policies {
+		if p == nil {
+			return fmt.Errorf("%w: policy %q is empty", ErrInvalid, name)
+		}
+		for i, rule := range p.Rules {
+			if err := rule.compile(); err != nil {
+				return fmt.Errorf("%w: rule %d of policy %q: %v", ErrInvalid, i+1, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return errors.New("missing name")
+	}
+	switch r.Action {
+	case ActionAllow, ActionWarn, ActionBlock:
+	default:
+		return fmt.Errorf("invalid action %q: must be %q, %q or %q", r.Action, ActionAllow, ActionWarn, ActionBlock)
+	}
+	if len(r.Signatures) == 0 && len(r.FileTypes) == 0 && len(r.MIMETypes) == 0 {
+		return errors.New("no signature, file type nor MIME type to match")
+	}
+
+	r.signatures = r.signatures[:0]
+	for _, pattern := range r.Signatures {
+		m, err := newMatcher(pattern, false)
+		if err != nil {
+			return err
+		}
+		r.signatures = append(r.signatures, m)
+	}
+	r.fileTypes = r.fileTypes[:0]
+	for _, pattern := range r.FileTypes {
+		m, err := newMatcher(pattern, true)
+		if err != nil {
+			return err
+		}
+		r.fileTypes = append(r.fileTypes, m)
+	}
+	for _, entry := range r.MIMETypes {
+		if err := filetype.ValidateEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decide returns the verdict of the scan in, performed on behalf of principal.
+func (e *Engine) Decide(principal string, in Input) Decision {
+	name, ok := e.Principals[principal]
+	if !ok {
+		name = e.Default
+	}
+
+	d := Decision{Verdict: ActionAllow, Policy: name}
+	if in.Signature != "" {
+		d.Verdict = ActionBlock
+	}
+
+	for _, rule := range e.Policies[name].Rules {
+		if rule.match(in) {
+			d.Verdict = rule.Action
+			d.Rule = rule.Name
+			break
+		}
+	}
+	return d
+}
+
+// match returns true if r matches the scan in.
+func (r *Rule) match(in Input) bool {
+	if len(r.signatures) > 0 && (in.Signature == "" || !matchAny(r.signatures, in.Signature)) {
+		return false
+	}
+	if len(r.fileTypes) > 0 {
+		base := path.Base(strings.ToLower(in.FileName))
+		if in.FileName == "" || !matchAny(r.fileTypes, base) {
+			return false
+		}
+	}
+	if len(r.MIMETypes) > 0 && !slices.ContainsFunc(r.MIMETypes, in.Type.Match) {
+		return false
+	}
+	return true
+}
+
+// matcher matches a glob pattern or a regular expression.
+type matcher struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// newMatcher returns the matcher of pattern, a regular expression if between
+// slashes and a glob pattern otherwise. Glob patterns are lower-cased if fold.
+func newMatcher(pattern string, fold bool) (matcher, error) {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return matcher{}, fmt.Errorf("invalid regular expression %q: %v", pattern, err)
+		}
+		return matcher{re: re}, nil
+	}
+
+	if fold {
+		pattern = strings.ToLower(pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return matcher{}, fmt.Errorf("invalid glob pattern %q: %v", pattern, err)
+	}
+	return matcher{glob: pattern}, nil
+}
+
+func (m matcher) match(s string) bool {
+	if m.re != nil {
+		return m.re.MatchString(s)
+	}
+	ok, _ := path.Match(m.glob, s)
+	return ok
+}
+
+func matchAny(matchers []matcher, s string) bool {
+	for _, m := range matchers {
+		if m.match(s) {
+			return true
+		}
+	}
+	return false
+}
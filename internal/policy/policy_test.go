@@ -0,0 +1,205 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lescactus/clamav-api-go/internal/filetype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicies = `
+principals:
+  partner: strict
+policies:
+  default:
+    rules:
+      - name: allow-pua
+        signatures: ["PUA.*"]
+        action: allow
+      - name: warn-heuristics
+        signatures: ["/^Heuristics\\.(Encrypted|Limits)\\./"]
+        action: warn
+      - name: allow-test-archives
+        signatures: ["*.Test.*"]
+        file_types: ["*.zip"]
+        action: allow
+  strict:
+    rules:
+      - name: block-executables
+        file_types: ["*.exe", "*.DLL"]
+        action: block
+      - name: block-disguised-executables
+        mime_types: ["executable", "text/x-*script"]
+        action: block
+`
+
+func TestDecide(t *testing.T) {
+	e, err := Parse([]byte(testPolicies))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		principal string
+		in        Input
+		want      Decision
+	}{
+		{
+			name: "clean",
+			in:   Input{FileName: "report.pdf"},
+			want: Decision{Verdict: ActionAllow, Policy: "default"},
+		},
+		{
+			name: "detection without rule",
+			in:   Input{Signature: "Win.Trojan.Agent-1", FileName: "report.pdf"},
+			want: Decision{Verdict: ActionBlock, Policy: "default"},
+		},
+		{
+			name: "glob",
+			in:   Input{Signature: "PUA.Win.Packer.Upx-1"},
+			want: Decision{Verdict: ActionAllow, Policy: "default", Rule: "allow-pua"},
+		},
+		{
+			name: "regular expression",
+			in:   Input{Signature: "Heuristics.Encrypted.Zip"},
+			want: Decision{Verdict: ActionWarn, Policy: "default", Rule: "warn-heuristics"},
+		},
+		{
+			name: "signature and file type",
+			in:   Input{Signature: "Win.Test.EICAR_HDB-1", FileName: "dir/Samples.ZIP"},
+			want: Decision{Verdict: ActionAllow, Policy: "default", Rule: "allow-test-archives"},
+		},
+		{
+			name: "signature without file type",
+			in:   Input{Signature: "Win.Test.EICAR_HDB-1", FileName: "eicar.com"},
+			want: Decision{Verdict: ActionBlock, Policy: "default"},
+		},
+		{
+			name:      "policy of principal",
+			principal: "partner",
+			in:        Input{FileName: "setup.dll"},
+			want:      Decision{Verdict: ActionBlock, Policy: "strict", Rule: "block-executables"},
+		},
+		{
+			name:      "detected category",
+			principal: "partner",
+			in:        Input{FileName: "invoice.pdf", Type: filetype.TypePE},
+			want:      Decision{Verdict: ActionBlock, Policy: "strict", Rule: "block-disguised-executables"},
+		},
+		{
+			name:      "detected MIME type",
+			principal: "partner",
+			in:        Input{FileName: "readme.txt", Type: filetype.TypeScript},
+			want:      Decision{Verdict: ActionBlock, Policy: "strict", Rule: "block-disguised-executables"},
+		},
+		{
+			name:      "type not detected",
+			principal: "partner",
+			in:        Input{FileName: "invoice.pdf"},
+			want:      Decision{Verdict: ActionAllow, Policy: "strict"},
+		},
+		{
+			name:      "default policy of principal",
+			principal: "other",
+			in:        Input{FileName: "setup.dll"},
+			want:      Decision{Verdict: ActionAllow, Policy: "default"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, e.Decide(tt.principal, tt.in))
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			policy: testPolicies,
+		},
+		{
+			name:   "named default",
+			policy: `{"default": "base", "policies": {"base": {"rules": []}}}`,
+		},
+		{
+			name:    "missing default",
+			policy:  `policies: {other: {rules: []}}`,
+			wantErr: true,
+		},
+		{
+			name:    "undefined policy of principal",
+			policy:  `{principals: {partner: strict}, policies: {default: {rules: []}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid action",
+			policy:  `{policies: {default: {rules: [{name: r, signatures: ["*"], action: drop}]}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "nothing to match",
+			policy:  `{policies: {default: {rules: [{name: r, action: allow}]}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			policy:  `{policies: {default: {rules: [{signatures: ["*"], action: allow}]}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid glob",
+			policy:  `{policies: {default: {rules: [{name: r, signatures: ["["], action: allow}]}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid regular expression",
+			policy:  `{policies: {default: {rules: [{name: r, signatures: ["/(/"], action: allow}]}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown category",
+			policy:  `{policies: {default: {rules: [{name: r, mime_types: ["binary"], action: block}]}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid MIME type pattern",
+			policy:  `{policies: {default: {rules: [{name: r, mime_types: ["application/["], action: block}]}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			policy:  `{policies: {default: {rules: []}}, fallback: default}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.policy))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalid)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(name, []byte(testPolicies), 0o600))
+
+	e, err := Load(name)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultPolicy, e.Default)
+	assert.Len(t, e.Policies, 2)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package quarantine
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Payloads are encrypted with AES-256-GCM in segments, following the STREAM
+// construction: the nonce of each segment is made of a random prefix, the
+// segment counter and a flag marking the last segment, so that segments can't
+// be reordered, removed or truncated without being detected.
+const (
+	segmentSize     = 64 * 1024
+	noncePrefixSize = 7
+	formatVersion   = 1
+)
+
+var (
+	magic = []byte("CAVQ")
+
+	// ErrCorrupted indicates an encrypted payload can't be authenticated.
+	ErrCorrupted = errors.New("quarantined payload is corrupted or the key is wrong")
+)
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating cipher: %w", err)
+	}
+	return aead, nil
+}
+
+func segmentNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 0, noncePrefixSize+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// encrypt reads the plaintext from r and writes it encrypted with key to w.
+// The additional data ad is authenticated with every segment.
+// It returns the size of the plaintext.
+func encrypt(w io.Writer, r io.Reader, key, ad []byte) (int64, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return 0, err
+	}
+
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return 0, fmt.Errorf("error while generating nonce: %w", err)
+	}
+
+	header := append(append(append([]byte{}, magic...), formatVersion), prefix...)
+	if _, err := w.Write(header); err != nil {
+		return 0, fmt.Errorf("error while writing encrypted payload: %w", err)
+	}
+
+	// One extra byte is read ahead to know whether a segment is the last one
+	buf := make([]byte, segmentSize+1)
+	out := make([]byte, 0, segmentSize+aead.Overhead())
+
+	n, err := io.ReadFull(r, buf)
+	var total int64
+	for counter := uint32(0); ; counter++ {
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return total, fmt.Errorf("error while reading payload: %w", err)
+		}
+		last := n <= segmentSize
+
+		chunk := buf[:min(n, segmentSize)]
+		out = aead.Seal(out[:0], segmentNonce(prefix, counter, last), chunk, ad)
+		if _, err := w.Write(out); err != nil {
+			return total, fmt.Errorf("error while writing encrypted payload: %w", err)
+		}
+		total += int64(len(chunk))
+
+		if last {
+			return total, nil
+		}
+		if counter == ^uint32(0) {
+			return total, errors.New("payload is too large to be encrypted")
+		}
+
+		buf[0] = buf[segmentSize]
+		n, err = io.ReadFull(r, buf[1:])
+		n++
+	}
+}
+
+// decrypt reads a payload encrypted by encrypt from r and writes the
+// plaintext to w. Each segment is only written once authenticated.
+func decrypt(w io.Writer, r io.Reader, key, ad []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, len(magic)+1+noncePrefixSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("%w: %w", ErrCorrupted, err)
+	}
+	if !bytes.Equal(header[:len(magic)], magic) || header[len(magic)] != formatVersion {
+		return fmt.Errorf("%w: unknown format", ErrCorrupted)
+	}
+	prefix := header[len(magic)+1:]
+
+	sealedSize := segmentSize + aead.Overhead()
+	buf := make([]byte, sealedSize+1)
+	out := make([]byte, 0, segmentSize)
+
+	n, err := io.ReadFull(r, buf)
+	for counter := uint32(0); ; counter++ {
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("error while reading encrypted payload: %w", err)
+		}
+		last := n <= sealedSize
+
+		out, err = aead.Open(out[:0], segmentNonce(prefix, counter, last), buf[:min(n, sealedSize)], ad)
+		if err != nil {
+			return ErrCorrupted
+		}
+		if _, err := w.Write(out); err != nil {
+			return fmt.Errorf("error while writing payload: %w", err)
+		}
+
+		if last {
+			return nil
+		}
+
+		buf[0] = buf[sealedSize]
+		n, err = io.ReadFull(r, buf[1:])
+		n++
+	}
+}
@@ -0,0 +1,71 @@
+package quarantine
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, KeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := testKey(t)
+
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 5} {
+		plaintext := make([]byte, size)
+		_, _ = rand.Read(plaintext)
+
+		var sealed bytes.Buffer
+		n, err := encrypt(&sealed, bytes.NewReader(plaintext), key, []byte("id"))
+		require.NoError(t, err, size)
+		assert.Equal(t, int64(size), n)
+
+		var opened bytes.Buffer
+		require.NoError(t, decrypt(&opened, bytes.NewReader(sealed.Bytes()), key, []byte("id")), size)
+		assert.True(t, bytes.Equal(plaintext, opened.Bytes()), size)
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	key := testKey(t)
+	plaintext := make([]byte, 2*segmentSize+10)
+
+	var buf bytes.Buffer
+	_, err := encrypt(&buf, bytes.NewReader(plaintext), key, []byte("id"))
+	require.NoError(t, err)
+	sealed := buf.Bytes()
+	headerSize := len(magic) + 1 + noncePrefixSize
+	sealedSegment := segmentSize + 16
+
+	flipped := bytes.Clone(sealed)
+	flipped[headerSize+10] ^= 1
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		key    []byte
+		ad     string
+	}{
+		{name: "flipped bit", sealed: flipped, key: key, ad: "id"},
+		{name: "truncated at segment boundary", sealed: sealed[:headerSize+2*sealedSegment], key: key, ad: "id"},
+		{name: "removed segment", sealed: append(bytes.Clone(sealed[:headerSize+sealedSegment]), sealed[headerSize+2*sealedSegment:]...), key: key, ad: "id"},
+		{name: "wrong key", sealed: sealed, key: testKey(t), ad: "id"},
+		{name: "wrong additional data", sealed: sealed, key: key, ad: "other"},
+		{name: "unknown format", sealed: []byte("not encrypted at all"), key: key, ad: "id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decrypt(&bytes.Buffer{}, bytes.NewReader(tt.sealed), tt.key, []byte(tt.ad))
+			assert.ErrorIs(t, err, ErrCorrupted)
+		})
+	}
+}
@@ -0,0 +1,343 @@
+// Package quarantine stores infected uploads for later analysis.
+//
+// Each item is made of the payload, encrypted with a configured key, and of
+// its metadata as plain JSON, in a local directory:
+//
+//	<dir>/<id>.bin   encrypted payload
+//	<dir>/<id>.json  metadata
+//
+// Items older than the retention period are purged.
+package quarantine
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// KeySize is the size of the encryption key, in bytes (AES-256).
+const KeySize = 32
+
+const (
+	payloadExt  = ".bin"
+	metadataExt = ".json"
+	tmpPrefix   = ".tmp-"
+)
+
+var (
+	// ErrNotFound indicates the requested item isn't in quarantine.
+	ErrNotFound = errors.New("quarantined item not found")
+	// ErrInvalidID indicates the requested item identifier is malformed.
+	ErrInvalidID = errors.New("invalid quarantined item id")
+	// ErrInvalidKey indicates the encryption key doesn't have the expected size.
+	ErrInvalidKey = fmt.Errorf("invalid quarantine key: must be %d bytes", KeySize)
+)
+
+var idRegexp = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Item is the metadata of a quarantined payload.
+type Item struct {
+	ID            string    `json:"id"`
+	FileName      string    `json:"file_name"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+	Signature     string    `json:"signature"`
+	Principal     string    `json:"principal,omitempty"`
+	ClientIP      string    `json:"client_ip,omitempty"`
+	RequestID     string    `json:"request_id,omitempty"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// Store is a quarantine directory.
+// It is safe for concurrent use.
+type Store struct {
+	dir       string
+	key       []byte
+	retention time.Duration
+	now       func() time.Time
+}
+
+// New creates a new Store in dir, created if needed, encrypting payloads with
+// key. Items older than retention are purged by PurgeExpired; a retention of
+// 0 keeps them forever.
+func New(dir string, key []byte, retention time.Duration) (*Store, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error while creating quarantine directory: %w", err)
+	}
+	return &Store{
+		dir:       dir,
+		key:       key,
+		retention: retention,
+		now:       time.Now,
+	}, nil
+}
+
+// Put encrypts and stores the payload read from r.
+// The ID, Size, SHA256 and QuarantinedAt fields of item are set by the store.
+func (s *Store) Put(r io.Reader, item Item) (*Item, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("error while generating quarantine id: %w", err)
+	}
+	item.ID = hex.EncodeToString(id)
+	item.QuarantinedAt = s.now().UTC()
+
+	h := sha256.New()
+	err := s.writeFile(item.ID+payloadExt, func(w io.Writer) error {
+		size, err := encrypt(w, io.TeeReader(r, h), s.key, []byte(item.ID))
+		item.Size = size
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	item.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	// The metadata is written last: items without metadata are incomplete
+	err = s.writeFile(item.ID+metadataExt, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(item)
+	})
+	if err != nil {
+		_ = os.Remove(s.path(item.ID + payloadExt))
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// writeFile atomically writes the content produced by write to name.
+func (s *Store) writeFile(name string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(s.dir, tmpPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("error while creating quarantine file: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error while syncing quarantine file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error while closing quarantine file: %w", err)
+	}
+	if err := os.Rename(f.Name(), s.path(name)); err != nil {
+		return fmt.Errorf("error while writing quarantine file: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// Get returns the metadata of the item identified by id.
+func (s *Store) Get(id string) (*Item, error) {
+	if !idRegexp.MatchString(id) {
+		return nil, ErrInvalidID
+	}
+
+	b, err := os.ReadFile(s.path(id + metadataExt))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("error while reading quarantine metadata: %w", err)
+	}
+
+	var item Item
+	if err := json.Unmarshal(b, &item); err != nil {
+		return nil, fmt.Errorf("error while parsing quarantine metadata of %s: %w", id, err)
+	}
+	return &item, nil
+}
+
+// List returns the metadata of all the items, oldest first.
+func (s *Store) List() ([]Item, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing quarantine directory: %w", err)
+	}
+
+	items := []Item{}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), metadataExt)
+		if !ok || !idRegexp.MatchString(id) {
+			continue
+		}
+		item, err := s.Get(id)
+		if err != nil {
+			// Deleted concurrently
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].QuarantinedAt.Before(items[j].QuarantinedAt)
+	})
+	return items, nil
+}
+
+// Extract decrypts the payload of the item identified by id to w.
+func (s *Store) Extract(id string, w io.Writer) error {
+	if !idRegexp.MatchString(id) {
+		return ErrInvalidID
+	}
+
+	f, err := os.Open(s.path(id + payloadExt))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("error while opening quarantined payload: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	return decrypt(w, f, s.key, []byte(id))
+}
+
+// WriteArchive writes to w a ZIP archive protected by password holding the
+// payload of the item identified by id, under its original file name, and
+// its metadata.
+func (s *Store) WriteArchive(w io.Writer, id, password string) error {
+	item, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	// The CRC-32 of the payload is needed before writing it
+	crc := crc32.NewIEEE()
+	if err := s.Extract(id, crc); err != nil {
+		return err
+	}
+
+	metadata, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error while marshalling quarantine metadata: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+
+	err = encryptedZipEntry(zw, archiveName(item), password, item.QuarantinedAt, crc.Sum32(), item.Size, func(w io.Writer) error {
+		return s.Extract(id, w)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = encryptedZipEntry(zw, item.ID+metadataExt, password, item.QuarantinedAt, crc32.ChecksumIEEE(metadata), int64(len(metadata)), func(w io.Writer) error {
+		_, err := w.Write(metadata)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("error while writing archive: %w", err)
+	}
+	return nil
+}
+
+// archiveName returns the name of the payload in the archive: the base name
+// of the uploaded file, or the item id when it can't be used.
+func archiveName(item *Item) string {
+	name := filepath.Base(strings.ReplaceAll(item.FileName, `\`, "/"))
+	if name == "." || name == "/" || name == ".." || name == item.ID+metadataExt {
+		return item.ID + payloadExt
+	}
+	return name
+}
+
+// Delete removes the item identified by id.
+func (s *Store) Delete(id string) error {
+	if !idRegexp.MatchString(id) {
+		return ErrInvalidID
+	}
+
+	err := os.Remove(s.path(id + metadataExt))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("error while deleting quarantine metadata: %w", err)
+	}
+	if err := os.Remove(s.path(id + payloadExt)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error while deleting quarantined payload: %w", err)
+	}
+	return nil
+}
+
+// Purge removes the items quarantined before t and returns their number.
+func (s *Store) Purge(t time.Time) (int, error) {
+	items, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, item := range items {
+		if !item.QuarantinedAt.Before(t) {
+			break
+		}
+		if err := s.Delete(item.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// PurgeExpired removes the items older than the retention period.
+func (s *Store) PurgeExpired() (int, error) {
+	if s.retention <= 0 {
+		return 0, nil
+	}
+	return s.Purge(s.now().Add(-s.retention))
+}
+
+// Run purges the expired items every interval until ctx is cancelled.
+func (s *Store) Run(ctx context.Context, interval time.Duration, logger *zerolog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.PurgeExpired()
+		if err != nil {
+			logger.Error().Err(err).Msg("error while purging expired quarantined items")
+		} else if n > 0 {
+			logger.Info().Int("purged", n).Msg("purged expired quarantined items")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package quarantine
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+func newTestStore(t *testing.T, retention time.Duration) (*Store, *time.Time) {
+	t.Helper()
+	s, err := New(filepath.Join(t.TempDir(), "quarantine"), testKey(t), retention)
+	require.NoError(t, err)
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(t.TempDir(), []byte("short"), 0)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestStore(t *testing.T) {
+	s, _ := newTestStore(t, 0)
+
+	item, err := s.Put(strings.NewReader(eicar), Item{FileName: "eicar.com", Signature: "Eicar-Signature", Principal: "key-1"})
+	require.NoError(t, err)
+	assert.Regexp(t, idRegexp, item.ID)
+	assert.Equal(t, int64(len(eicar)), item.Size)
+	assert.Equal(t, "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f", item.SHA256)
+
+	// The payload isn't stored in clear
+	b, err := os.ReadFile(filepath.Join(s.dir, item.ID+payloadExt))
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "EICAR")
+
+	got, err := s.Get(item.ID)
+	require.NoError(t, err)
+	assert.Equal(t, item, got)
+
+	items, err := s.List()
+	require.NoError(t, err)
+	assert.Equal(t, []Item{*item}, items)
+
+	var payload bytes.Buffer
+	require.NoError(t, s.Extract(item.ID, &payload))
+	assert.Equal(t, eicar, payload.String())
+
+	require.NoError(t, s.Delete(item.ID))
+	assert.ErrorIs(t, s.Delete(item.ID), ErrNotFound)
+	_, err = s.Get(item.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	entries, err := os.ReadDir(s.dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestStoreInvalidID(t *testing.T) {
+	s, _ := newTestStore(t, 0)
+
+	for _, id := range []string{"", "../../etc/passwd", "ABCDEF0123456789ABCDEF0123456789"} {
+		_, err := s.Get(id)
+		assert.ErrorIs(t, err, ErrInvalidID)
+		assert.ErrorIs(t, s.Extract(id, io.Discard), ErrInvalidID)
+		assert.ErrorIs(t, s.Delete(id), ErrInvalidID)
+	}
+}
+
+func TestStorePurge(t *testing.T) {
+	s, now := newTestStore(t, 24*time.Hour)
+
+	old, err := s.Put(strings.NewReader("old"), Item{FileName: "old"})
+	require.NoError(t, err)
+	*now = now.Add(12 * time.Hour)
+	recent, err := s.Put(strings.NewReader("recent"), Item{FileName: "recent"})
+	require.NoError(t, err)
+
+	// Nothing has expired yet
+	n, err := s.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	*now = now.Add(13 * time.Hour)
+	n, err = s.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	items, err := s.List()
+	require.NoError(t, err)
+	assert.Equal(t, []Item{*recent}, items)
+	_, err = s.Get(old.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Explicit purge of everything
+	n, err = s.Purge(now.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestStorePurgeNoRetention(t *testing.T) {
+	s, now := newTestStore(t, 0)
+
+	_, err := s.Put(strings.NewReader("old"), Item{})
+	require.NoError(t, err)
+	*now = now.Add(10 * 365 * 24 * time.Hour)
+
+	n, err := s.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestStoreRun(t *testing.T) {
+	s, now := newTestStore(t, time.Hour)
+	_, err := s.Put(strings.NewReader("old"), Item{})
+	require.NoError(t, err)
+	*now = now.Add(2 * time.Hour)
+
+	logger := zerolog.New(io.Discard)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Run(ctx, time.Hour, &logger)
+
+	items, err := s.List()
+	require.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+// zipDecrypt decrypts the content of an entry encrypted with zipCrypto.
+func zipDecrypt(password string, data []byte) []byte {
+	z := newZipCrypto(password)
+	out := make([]byte, len(data))
+	for i, c := range data {
+		out[i] = c ^ z.streamByte()
+		z.update(out[i])
+	}
+	return out
+}
+
+func TestStoreWriteArchive(t *testing.T) {
+	s, _ := newTestStore(t, 0)
+
+	item, err := s.Put(strings.NewReader(eicar), Item{FileName: `C:\Users\foo\eicar.com`, Signature: "Eicar-Signature"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, s.WriteArchive(&buf, item.ID, "infected"))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+
+	want := map[string]string{"eicar.com": eicar, item.ID + ".json": ""}
+	for _, f := range zr.File {
+		assert.Equal(t, uint16(0x1), f.Flags&0x1, f.Name)
+		assert.Contains(t, want, f.Name)
+
+		r, err := f.OpenRaw()
+		require.NoError(t, err)
+		raw, err := io.ReadAll(r)
+		require.NoError(t, err)
+
+		plain := zipDecrypt("infected", raw)
+		assert.Equal(t, byte(f.CRC32>>24), plain[zipCryptoHeaderSize-1], f.Name)
+		content := plain[zipCryptoHeaderSize:]
+		assert.Equal(t, f.CRC32, crc32.ChecksumIEEE(content), f.Name)
+		if want[f.Name] != "" {
+			assert.Equal(t, want[f.Name], string(content))
+		} else {
+			assert.Contains(t, string(content), `"signature": "Eicar-Signature"`)
+		}
+	}
+
+	assert.ErrorIs(t, s.WriteArchive(io.Discard, "0123456789abcdef0123456789abcdef", "infected"), ErrNotFound)
+}
@@ -0,0 +1,106 @@
+package quarantine
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// zipCryptoHeaderSize is the size of the encryption header prepended to
+// the content of each entry.
+const zipCryptoHeaderSize = 12
+
+// zipCrypto implements the traditional PKWARE encryption of ZIP entries
+// (APPNOTE.TXT, section 6.1).
+//
+// It is cryptographically weak and only meant to keep payloads from being
+// opened, executed or picked up by antivirus software by accident, the way
+// malware samples are commonly exchanged. Confidentiality at rest is provided
+// by the encryption of the store.
+type zipCrypto struct {
+	keys [3]uint32
+}
+
+func newZipCrypto(password string) *zipCrypto {
+	z := &zipCrypto{keys: [3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for i := 0; i < len(password); i++ {
+		z.update(password[i])
+	}
+	return z
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ (crc >> 8)
+}
+
+func (z *zipCrypto) update(b byte) {
+	z.keys[0] = crc32Update(z.keys[0], b)
+	z.keys[1] = (z.keys[1]+z.keys[0]&0xff)*134775813 + 1
+	z.keys[2] = crc32Update(z.keys[2], byte(z.keys[1]>>24))
+}
+
+func (z *zipCrypto) streamByte() byte {
+	t := z.keys[2] | 2
+	return byte((t * (t ^ 1)) >> 8)
+}
+
+func (z *zipCrypto) encrypt(dst, src []byte) {
+	for i, b := range src {
+		dst[i] = b ^ z.streamByte()
+		z.update(b)
+	}
+}
+
+// zipCryptoWriter encrypts the data written to it.
+type zipCryptoWriter struct {
+	w   io.Writer
+	z   *zipCrypto
+	buf []byte
+}
+
+func (w *zipCryptoWriter) Write(p []byte) (int, error) {
+	if cap(w.buf) < len(p) {
+		w.buf = make([]byte, len(p))
+	}
+	buf := w.buf[:len(p)]
+	w.z.encrypt(buf, p)
+	return w.w.Write(buf)
+}
+
+// encryptedZipEntry adds a stored entry encrypted with password to zw and
+// writes the content produced by write to it.
+// crc and size are the CRC-32 and size of the content, which are needed
+// beforehand to write the local file header.
+func encryptedZipEntry(zw *zip.Writer, name, password string, modified time.Time, crc uint32, size int64, write func(io.Writer) error) error {
+	fh := &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		Flags:              0x1, // encrypted
+		CRC32:              crc,
+		CompressedSize64:   uint64(size) + zipCryptoHeaderSize,
+		UncompressedSize64: uint64(size),
+	}
+	fh.SetModTime(modified) //nolint:staticcheck // Modified isn't encoded by CreateRaw
+
+	raw, err := zw.CreateRaw(fh)
+	if err != nil {
+		return fmt.Errorf("error while creating archive entry: %w", err)
+	}
+
+	w := &zipCryptoWriter{w: raw, z: newZipCrypto(password)}
+
+	// The last byte of the encryption header allows to check the password
+	header := make([]byte, zipCryptoHeaderSize)
+	if _, err := rand.Read(header[:zipCryptoHeaderSize-1]); err != nil {
+		return fmt.Errorf("error while generating encryption header: %w", err)
+	}
+	header[zipCryptoHeaderSize-1] = byte(crc >> 24)
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("error while writing archive entry: %w", err)
+	}
+
+	return write(w)
+}
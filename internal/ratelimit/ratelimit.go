@@ -0,0 +1,204 @@
+// Package ratelimit implements per-client token-bucket rate limits
+// and concurrency quotas.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrRateLimited indicates the client exhausted its token bucket.
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrConcurrencyLimited indicates the client reached its maximum number of concurrent requests.
+	ErrConcurrencyLimited = errors.New("too many concurrent requests")
+)
+
+// defaultIdleTTL is the duration after which an idle client is forgotten.
+const defaultIdleTTL = 10 * time.Minute
+
+// Rule describes the limits applied to each client of a route.
+type Rule struct {
+	// Rate is the number of requests per second refilling the token bucket.
+	// A zero rate disables the token bucket.
+	Rate float64
+	// Burst is the size of the token bucket.
+	Burst int
+	// MaxConcurrent is the maximum number of in-flight requests per client.
+	// Zero means unlimited.
+	MaxConcurrent int
+}
+
+// ParseRules parses a comma-separated list of per-route rules of the form
+// "route=rate:burst[:max_concurrent]", eg.
+//
+//	/rest/v1/scan=5:10:2,/rest/v1/stats=1:5
+func ParseRules(s string) (map[string]Rule, error) {
+	rules := make(map[string]Rule)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, spec, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("invalid rate limit rule %q: expected \"route=rate:burst[:max_concurrent]\"", entry)
+		}
+
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid rate limit rule %q: expected \"route=rate:burst[:max_concurrent]\"", entry)
+		}
+
+		var rule Rule
+		var err error
+		if rule.Rate, err = strconv.ParseFloat(parts[0], 64); err != nil || rule.Rate < 0 {
+			return nil, fmt.Errorf("invalid rate in rate limit rule %q", entry)
+		}
+		if rule.Burst, err = strconv.Atoi(parts[1]); err != nil || rule.Burst < 0 || (rule.Rate > 0 && rule.Burst == 0) {
+			return nil, fmt.Errorf("invalid burst in rate limit rule %q", entry)
+		}
+		if len(parts) == 3 {
+			if rule.MaxConcurrent, err = strconv.Atoi(parts[2]); err != nil || rule.MaxConcurrent < 0 {
+				return nil, fmt.Errorf("invalid max concurrent in rate limit rule %q", entry)
+			}
+		}
+		if rule.Rate == 0 && rule.MaxConcurrent == 0 {
+			return nil, fmt.Errorf("rate limit rule %q doesn't limit anything", entry)
+		}
+
+		if _, dup := rules[route]; dup {
+			return nil, fmt.Errorf("duplicate rate limit rule for route %q", route)
+		}
+		rules[route] = rule
+	}
+	return rules, nil
+}
+
+// Usage is a snapshot of the usage of a Limiter.
+type Usage struct {
+	// Clients is the number of tracked clients.
+	Clients int
+	// InFlight is the number of in-flight requests, all clients included.
+	InFlight int
+}
+
+// Limiter enforces a Rule for each client, identified by an arbitrary key.
+type Limiter struct {
+	rule    Rule
+	idleTTL time.Duration
+
+	mu        sync.Mutex
+	clients   map[string]*client
+	inflight  int
+	lastPrune time.Time
+}
+
+type client struct {
+	bucket   *rate.Limiter
+	inflight int
+	lastSeen time.Time
+}
+
+// NewLimiter creates a new Limiter enforcing rule.
+func NewLimiter(rule Rule) *Limiter {
+	// Idle clients must not be forgotten before their bucket is full again
+	idleTTL := defaultIdleTTL
+	if rule.Rate > 0 {
+		if refill := time.Duration(float64(rule.Burst) / rule.Rate * float64(time.Second)); refill > idleTTL {
+			idleTTL = refill
+		}
+	}
+
+	return &Limiter{
+		rule:    rule,
+		idleTTL: idleTTL,
+		clients: make(map[string]*client),
+	}
+}
+
+// Acquire accounts for a new request of the client identified by key.
+//
+// On success, the returned release function must be called once the request
+// is complete. Otherwise, it returns ErrRateLimited or ErrConcurrencyLimited
+// along with the duration after which the client may retry.
+func (l *Limiter) Acquire(key string, now time.Time) (func(), time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{}
+		if l.rule.Rate > 0 {
+			c.bucket = rate.NewLimiter(rate.Limit(l.rule.Rate), l.rule.Burst)
+		}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+
+	if l.rule.MaxConcurrent > 0 && c.inflight >= l.rule.MaxConcurrent {
+		return nil, time.Second, ErrConcurrencyLimited
+	}
+
+	if c.bucket != nil {
+		r := c.bucket.ReserveN(now, 1)
+		if delay := r.DelayFrom(now); delay > 0 {
+			r.CancelAt(now)
+			return nil, delay, ErrRateLimited
+		}
+	}
+
+	c.inflight++
+	l.inflight++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			c.inflight--
+			l.inflight--
+		})
+	}
+	return release, 0, nil
+}
+
+// Usage returns a snapshot of the current usage of the limiter.
+func (l *Limiter) Usage() Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return Usage{Clients: len(l.clients), InFlight: l.inflight}
+}
+
+// prune forgets the clients idle for longer than idleTTL.
+// A forgotten client has no in-flight request and, given the TTL,
+// a full token bucket, so forgetting it doesn't change its limits.
+// Must be called with l.mu held.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.idleTTL {
+		return
+	}
+	for key, c := range l.clients {
+		if c.inflight == 0 && now.Sub(c.lastSeen) > l.idleTTL {
+			delete(l.clients, key)
+		}
+	}
+	l.lastPrune = now
+}
+
+// RetryAfterSeconds rounds d up to a whole number of seconds, as expected
+// by the Retry-After header. It never returns less than 1.
+func RetryAfterSeconds(d time.Duration) int {
+	return int(math.Max(1, math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string]Rule
+		wantErr bool
+	}{
+		{
+			name: "empty string",
+			s:    "",
+			want: map[string]Rule{},
+		},
+		{
+			name: "rate and burst",
+			s:    "/rest/v1/stats=1:5",
+			want: map[string]Rule{"/rest/v1/stats": {Rate: 1, Burst: 5}},
+		},
+		{
+			name: "multiple rules",
+			s:    "/rest/v1/scan=0.5:10:2, /rest/v1/stats=1:5",
+			want: map[string]Rule{
+				"/rest/v1/scan":  {Rate: 0.5, Burst: 10, MaxConcurrent: 2},
+				"/rest/v1/stats": {Rate: 1, Burst: 5},
+			},
+		},
+		{
+			name: "concurrency only",
+			s:    "/rest/v1/scan=0:0:4",
+			want: map[string]Rule{"/rest/v1/scan": {MaxConcurrent: 4}},
+		},
+		{
+			name:    "missing route",
+			s:       "1:5",
+			wantErr: true,
+		},
+		{
+			name:    "relative route",
+			s:       "scan=1:5",
+			wantErr: true,
+		},
+		{
+			name:    "missing burst",
+			s:       "/rest/v1/scan=1",
+			wantErr: true,
+		},
+		{
+			name:    "zero burst with a rate",
+			s:       "/rest/v1/scan=1:0",
+			wantErr: true,
+		},
+		{
+			name:    "negative rate",
+			s:       "/rest/v1/scan=-1:5",
+			wantErr: true,
+		},
+		{
+			name:    "invalid max concurrent",
+			s:       "/rest/v1/scan=1:5:x",
+			wantErr: true,
+		},
+		{
+			name:    "no limit",
+			s:       "/rest/v1/scan=0:0",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate route",
+			s:       "/rest/v1/scan=1:5,/rest/v1/scan=2:5",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRules(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(Rule{Rate: 1, Burst: 2})
+
+	// The burst is consumed
+	for i := 0; i < 2; i++ {
+		release, _, err := l.Acquire("a", now)
+		assert.NoError(t, err)
+		release()
+	}
+
+	_, retryAfter, err := l.Acquire("a", now)
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, time.Second, retryAfter)
+
+	// Other clients are not affected
+	release, _, err := l.Acquire("b", now)
+	assert.NoError(t, err)
+	release()
+
+	// The bucket is refilled over time
+	release, _, err = l.Acquire("a", now.Add(time.Second))
+	assert.NoError(t, err)
+	release()
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(Rule{MaxConcurrent: 2})
+
+	r1, _, err := l.Acquire("a", now)
+	assert.NoError(t, err)
+	r2, _, err := l.Acquire("a", now)
+	assert.NoError(t, err)
+
+	_, retryAfter, err := l.Acquire("a", now)
+	assert.ErrorIs(t, err, ErrConcurrencyLimited)
+	assert.Equal(t, time.Second, retryAfter)
+	assert.Equal(t, Usage{Clients: 1, InFlight: 2}, l.Usage())
+
+	// Releasing twice must not free two slots
+	r1()
+	r1()
+	assert.Equal(t, Usage{Clients: 1, InFlight: 1}, l.Usage())
+
+	r3, _, err := l.Acquire("a", now)
+	assert.NoError(t, err)
+	_, _, err = l.Acquire("a", now)
+	assert.ErrorIs(t, err, ErrConcurrencyLimited)
+
+	r2()
+	r3()
+	assert.Equal(t, Usage{Clients: 1, InFlight: 0}, l.Usage())
+}
+
+func TestLimiterConcurrencyRejectionDoesNotConsumeTokens(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(Rule{Rate: 1, Burst: 2, MaxConcurrent: 1})
+
+	release, _, err := l.Acquire("a", now)
+	assert.NoError(t, err)
+
+	_, _, err = l.Acquire("a", now)
+	assert.ErrorIs(t, err, ErrConcurrencyLimited)
+
+	release()
+	release, _, err = l.Acquire("a", now)
+	assert.NoError(t, err)
+	release()
+}
+
+func TestLimiterPrune(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(Rule{Rate: 1, Burst: 1})
+
+	release, _, err := l.Acquire("a", now)
+	assert.NoError(t, err)
+	release()
+	busy, _, err := l.Acquire("b", now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, l.Usage().Clients)
+
+	release, _, err = l.Acquire("c", now.Add(defaultIdleTTL+time.Second))
+	assert.NoError(t, err)
+	release()
+
+	// "a" is forgotten, "b" still has an in-flight request
+	assert.Equal(t, 2, l.Usage().Clients)
+	assert.NotContains(t, l.clients, "a")
+	busy()
+}
+
+func TestNewLimiterIdleTTL(t *testing.T) {
+	assert.Equal(t, defaultIdleTTL, NewLimiter(Rule{MaxConcurrent: 1}).idleTTL)
+	assert.Equal(t, defaultIdleTTL, NewLimiter(Rule{Rate: 1, Burst: 10}).idleTTL)
+	assert.Equal(t, time.Hour, NewLimiter(Rule{Rate: 0.01, Burst: 36}).idleTTL)
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, 1, RetryAfterSeconds(0))
+	assert.Equal(t, 1, RetryAfterSeconds(200*time.Millisecond))
+	assert.Equal(t, 2, RetryAfterSeconds(1200*time.Millisecond))
+	assert.Equal(t, 10, RetryAfterSeconds(10*time.Second))
+}
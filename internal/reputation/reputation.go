@@ -0,0 +1,266 @@
+// Package reputation looks the hashes of files up in local allow-lists and
+// deny-lists, such as threat intelligence feeds ClamAV doesn't ship.
+//
+// A list file has a hash per line, MD5, SHA-1 or SHA-256 in hexadecimal,
+// optionally followed by a name, such as the name of the threat, like the
+// output of sha256sum. Empty lines and lines starting with "#" are ignored.
+//
+// The files are reloaded when they change, a file failing to reload keeping
+// its previous entries.
+package reputation
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/rs/zerolog"
+)
+
+// List tells allow-lists from deny-lists.
+type List string
+
+// Kinds of lists.
+const (
+	ListAllow List = "allow"
+	ListDeny  List = "deny"
+)
+
+// Names of the hash algorithms.
+const (
+	AlgorithmMD5    = "md5"
+	AlgorithmSHA1   = "sha1"
+	AlgorithmSHA256 = "sha256"
+)
+
+// Hashes are the hashes of a file, in lower case hexadecimal.
+type Hashes struct {
+	MD5    string
+	SHA1   string
+	SHA256 string
+}
+
+// Sum returns the hashes of the content of r.
+func Sum(r io.Reader) (Hashes, error) {
+	m, s1, s256 := md5.New(), sha1.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(m, s1, s256), r); err != nil {
+		return Hashes{}, err
+	}
+	return Hashes{
+		MD5:    hex.EncodeToString(m.Sum(nil)),
+		SHA1:   hex.EncodeToString(s1.Sum(nil)),
+		SHA256: hex.EncodeToString(s256.Sum(nil)),
+	}, nil
+}
+
+// Match is a listed hash of a file.
+type Match struct {
+	List List
+	// Source is the name of the list file.
+	Source string
+	// Hash is the listed hash, prefixed with its algorithm, eg. "sha256:...".
+	Hash string
+	// Name is the name given to the hash by the list, if any.
+	Name string
+}
+
+// Config is the configuration of a Store.
+type Config struct {
+	AllowFiles []string
+	DenyFiles  []string
+}
+
+// listFile is a loaded list file.
+type listFile struct {
+	path    string
+	list    List
+	modTime time.Time
+	size    int64
+	entries map[string]string // Hash to name
+}
+
+// Store holds the lists.
+type Store struct {
+	mu    sync.RWMutex
+	files []*listFile
+}
+
+// Load loads the list files of cfg.
+func Load(cfg Config) (*Store, error) {
+	s := &Store{}
+	for _, path := range cfg.DenyFiles {
+		s.files = append(s.files, &listFile{path: path, list: ListDeny})
+	}
+	for _, path := range cfg.AllowFiles {
+		s.files = append(s.files, &listFile{path: path, list: ListAllow})
+	}
+
+	for _, f := range s.files {
+		if err := s.load(f); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// load (re)loads the list file f.
+func (s *Store) load(f *listFile) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("error while opening hash list: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("error while opening hash list: %w", err)
+	}
+	entries, err := parse(file)
+	if err != nil {
+		return fmt.Errorf("invalid hash list %s: %w", f.path, err)
+	}
+
+	s.mu.Lock()
+	f.modTime, f.size, f.entries = info.ModTime(), info.Size(), entries
+	s.mu.Unlock()
+	return nil
+}
+
+// parse parses the lines of a list file.
+func parse(r io.Reader) (map[string]string, error) {
+	entries := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, name := line, ""
+		if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+			hash, name = line[:i], line[i:]
+		}
+		hash = strings.ToLower(hash)
+		if _, err := hex.DecodeString(hash); err != nil || algorithm(hash) == "" {
+			return nil, fmt.Errorf("line %d: invalid hash %q", n, hash)
+		}
+		// sha256sum marks the files read in binary mode with "*"
+		entries[hash] = strings.TrimPrefix(strings.TrimSpace(name), "*")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// algorithm returns the algorithm of the hash, told by its length.
+func algorithm(hash string) string {
+	switch len(hash) {
+	case md5.Size * 2:
+		return AlgorithmMD5
+	case sha1.Size * 2:
+		return AlgorithmSHA1
+	case sha256.Size * 2:
+		return AlgorithmSHA256
+	default:
+		return ""
+	}
+}
+
+// Lookup returns the match of the hashes h. Deny-lists take precedence
+// over allow-lists.
+func (s *Store) Lookup(h Hashes) (Match, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// The deny-lists are first
+	for _, f := range s.files {
+		for _, hash := range []string{h.SHA256, h.SHA1, h.MD5} {
+			if hash == "" {
+				continue
+			}
+			if name, ok := f.entries[hash]; ok {
+				return Match{
+					List:   f.list,
+					Source: filepath.Base(f.path),
+					Hash:   algorithm(hash) + ":" + hash,
+					Name:   name,
+				}, true
+			}
+		}
+	}
+	return Match{}, false
+}
+
+// Len returns the number of hashes of the lists.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n int
+	for _, f := range s.files {
+		n += len(f.entries)
+	}
+	return n
+}
+
+// Reload reloads the list files which changed since they were loaded.
+// The files failing to reload keep their previous entries.
+func (s *Store) Reload() (reloaded int, err error) {
+	var errs []error
+	for _, f := range s.files {
+		info, statErr := os.Stat(f.path)
+		if statErr != nil {
+			errs = append(errs, fmt.Errorf("error while reading hash list: %w", statErr))
+			continue
+		}
+
+		s.mu.RLock()
+		changed := !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+		s.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		if loadErr := s.load(f); loadErr != nil {
+			errs = append(errs, loadErr)
+			continue
+		}
+		reloaded++
+	}
+	return reloaded, errors.Join(errs...)
+}
+
+// Run reloads the list files which changed every interval until ctx is cancelled.
+func (s *Store) Run(ctx context.Context, interval time.Duration, logger *zerolog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := s.Reload()
+		if err != nil {
+			logger.Error().Err(err).Msg("error while reloading hash lists")
+		}
+		if n > 0 {
+			logger.Info().Int("reloaded", n).Int("hashes", s.Len()).Msg("hash lists reloaded")
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package reputation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeList(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+}
+
+func TestSum(t *testing.T) {
+	h, err := Sum(strings.NewReader("foobar"))
+	require.NoError(t, err)
+	assert.Equal(t, Hashes{
+		MD5:    "3858f62230ac3c915f300c664312c63f",
+		SHA1:   "8843d7f92416211de9ebb963ff4ce28125932878",
+		SHA256: "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2",
+	}, h)
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	deny := filepath.Join(dir, "deny.txt")
+	allow := filepath.Join(dir, "allow.txt")
+	writeList(t, deny,
+		"# Threat feed",
+		"",
+		"3858F62230AC3C915F300C664312C63F\tWin.Trojan.Foobar",
+		"bbe960a25ea311d21d40669e93df2003ba9b90a2 *baz.exe",
+	)
+	writeList(t, allow,
+		"c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2  foobar.txt",
+		"fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9",
+	)
+
+	s, err := Load(Config{AllowFiles: []string{allow}, DenyFiles: []string{deny}})
+	require.NoError(t, err)
+	assert.Equal(t, 4, s.Len())
+
+	tests := []struct {
+		name    string
+		content string
+		want    Match
+		wantOK  bool
+	}{
+		{
+			name:    "deny takes precedence",
+			content: "foobar",
+			want:    Match{List: ListDeny, Source: "deny.txt", Hash: "md5:3858f62230ac3c915f300c664312c63f", Name: "Win.Trojan.Foobar"},
+			wantOK:  true,
+		},
+		{
+			name:    "sha1",
+			content: "baz",
+			want:    Match{List: ListDeny, Source: "deny.txt", Hash: "sha1:bbe960a25ea311d21d40669e93df2003ba9b90a2", Name: "baz.exe"},
+			wantOK:  true,
+		},
+		{
+			name:    "allowed",
+			content: "bar",
+			want:    Match{List: ListAllow, Source: "allow.txt", Hash: "sha256:fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"},
+			wantOK:  true,
+		},
+		{
+			name:    "not listed",
+			content: "qux",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := Sum(strings.NewReader(tt.content))
+			require.NoError(t, err)
+			got, ok := s.Lookup(h)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	writeList(t, path, "not-a-hash name")
+	_, err := Load(Config{DenyFiles: []string{path}})
+	assert.ErrorContains(t, err, "line 1")
+
+	_, err = Load(Config{DenyFiles: []string{filepath.Join(t.TempDir(), "missing.txt")}})
+	assert.Error(t, err)
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	writeList(t, path, "3858f62230ac3c915f300c664312c63f")
+	s, err := Load(Config{DenyFiles: []string{path}})
+	require.NoError(t, err)
+
+	// Unchanged files aren't reloaded
+	n, err := s.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	baz, err := Sum(strings.NewReader("baz"))
+	require.NoError(t, err)
+	writeList(t, path, "3858f62230ac3c915f300c664312c63f", baz.SHA256+" Baz")
+	require.NoError(t, os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	n, err = s.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	m, ok := s.Lookup(baz)
+	assert.True(t, ok)
+	assert.Equal(t, "Baz", m.Name)
+
+	// Invalid files keep their previous entries
+	writeList(t, path, "invalid")
+	require.NoError(t, os.Chtimes(path, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute)))
+	_, err = s.Reload()
+	assert.Error(t, err)
+	_, ok = s.Lookup(baz)
+	assert.True(t, ok)
+}
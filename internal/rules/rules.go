@@ -0,0 +1,431 @@
+// Package rules manages custom rule files, YARA rules and logical signatures,
+// in the database directory of clamd.
+//
+// The rule files are validated before being written: their syntax is checked
+// and, optionally, they are given to a validator command, such as clamscan.
+// clamd is then reloaded and pinged for a while: if the reload fails or clamd
+// stops answering, the previous version of the file is restored.
+//
+// The versions of the rule files are kept in a hidden directory of the
+// database directory, which clamd ignores:
+//
+//	<dir>/<name>                         current version, eg. phishing.yar
+//	<dir>/.clamav-api-go-rules/<name>/<n>  version n
+//	<dir>/.clamav-api-go-rules/<name>/versions.json
+package rules
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Types of rule files.
+const (
+	TypeYARA    = "yara"
+	TypeLogical = "ldb"
+)
+
+const (
+	// DefaultCheckDuration is the default duration clamd is pinged for after a reload.
+	DefaultCheckDuration = 10 * time.Second
+	// defaultCheckInterval is the default interval between two pings.
+	defaultCheckInterval = time.Second
+	// validatorTimeout is the maximum duration of the validator command.
+	validatorTimeout = 2 * time.Minute
+	// maxValidatorOutput is the maximum length of the output of the validator reported.
+	maxValidatorOutput = 1024
+
+	historyDir   = ".clamav-api-go-rules"
+	versionsFile = "versions.json"
+	tmpPrefix    = ".tmp-"
+)
+
+var (
+	// ErrInvalid indicates a rule file which isn't valid.
+	ErrInvalid = errors.New("invalid rule file")
+	// ErrNotFound indicates the requested rule file isn't managed.
+	ErrNotFound = errors.New("rule file not found")
+	// ErrExists indicates a file of the same name, not managed, is in the database directory.
+	ErrExists = errors.New("unmanaged file already exists")
+	// ErrRolledBack indicates the change was rolled back, clamd failing to reload it.
+	ErrRolledBack = errors.New("clamd failed to reload, change rolled back")
+)
+
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}\.(yar|yara|ldb)$`)
+
+// Version is a version of a rule file.
+type Version struct {
+	Version   int       `json:"version"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Rule is a managed rule file.
+type Rule struct {
+	// Name is the name of the file, eg. "phishing.yar".
+	Name string `json:"name"`
+	// Type is the type of the file, TypeYARA or TypeLogical.
+	Type string `json:"type"`
+	// Version is the current version of the file.
+	Version
+	// Versions are the versions of the file, oldest first. Only filled by Get.
+	Versions []Version `json:"versions,omitempty"`
+}
+
+// Clamd is the part of clamd the rule files are applied with.
+type Clamd interface {
+	Ping(ctx context.Context) ([]byte, error)
+	Reload(ctx context.Context) error
+}
+
+// Config is the configuration of a Store.
+type Config struct {
+	// Dir is the database directory of clamd.
+	Dir string
+	// Validator is the optional command validating the rule files. Its "{}"
+	// arguments are replaced by the path of the file, appended if there are none.
+	Validator []string
+	// CheckDuration is the duration clamd is pinged for after a reload.
+	// Zero means DefaultCheckDuration.
+	CheckDuration time.Duration
+	// CheckInterval is the interval between two pings. Zero means a second.
+	CheckInterval time.Duration
+}
+
+// Store manages the rule files of a database directory.
+// It is safe for concurrent use.
+type Store struct {
+	mu    sync.Mutex
+	cfg   Config
+	clamd Clamd
+	now   func() time.Time
+}
+
+// New returns a Store of the rule files of cfg.Dir, which must exist,
+// applied with clamd.
+func New(cfg Config, clamd Clamd) (*Store, error) {
+	info, err := os.Stat(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening rule directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("rule directory %s isn't a directory", cfg.Dir)
+	}
+	if err := os.MkdirAll(filepath.Join(cfg.Dir, historyDir), 0o700); err != nil {
+		return nil, fmt.Errorf("error while creating rule history directory: %w", err)
+	}
+	if cfg.CheckDuration == 0 {
+		cfg.CheckDuration = DefaultCheckDuration
+	}
+	if cfg.CheckInterval == 0 {
+		cfg.CheckInterval = defaultCheckInterval
+	}
+	return &Store{cfg: cfg, clamd: clamd, now: time.Now}, nil
+}
+
+// ruleType returns the type of the rule file name, or an error if the name isn't valid.
+func ruleType(name string) (string, error) {
+	if !nameRegexp.MatchString(name) {
+		return "", fmt.Errorf("%w: name must be made of letters, digits, '.', '-' and '_', and end with .yar, .yara or .ldb", ErrInvalid)
+	}
+	if filepath.Ext(name) == ".ldb" {
+		return TypeLogical, nil
+	}
+	return TypeYARA, nil
+}
+
+// List returns the managed rule files, sorted by name.
+func (s *Store) List() ([]Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(s.cfg.Dir, historyDir))
+	if err != nil {
+		return nil, fmt.Errorf("error while listing rule files: %w", err)
+	}
+
+	rules := []Rule{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		rule, err := s.get(entry.Name())
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rule.Versions = nil
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules, nil
+}
+
+// Get returns the managed rule file name, with its versions.
+func (s *Store) Get(name string) (Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(name)
+}
+
+func (s *Store) get(name string) (Rule, error) {
+	typ, err := ruleType(name)
+	if err != nil {
+		return Rule{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	versions, err := s.versions(name)
+	if err != nil {
+		return Rule{}, err
+	}
+	if len(versions) == 0 {
+		return Rule{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return Rule{Name: name, Type: typ, Version: versions[len(versions)-1], Versions: versions}, nil
+}
+
+// Put validates content and writes it as a new version of the rule file name,
+// then reloads clamd. The change is rolled back if clamd fails to reload it.
+func (s *Store) Put(ctx context.Context, name string, content []byte) (Rule, error) {
+	typ, err := ruleType(name)
+	if err != nil {
+		return Rule{}, err
+	}
+	if err := checkSyntax(typ, content); err != nil {
+		return Rule{}, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if err := s.validate(ctx, name, content); err != nil {
+		return Rule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions, err := s.versions(name)
+	if err != nil {
+		return Rule{}, err
+	}
+	path := filepath.Join(s.cfg.Dir, name)
+	previous, err := os.ReadFile(path)
+	switch {
+	case err == nil && len(versions) == 0:
+		return Rule{}, fmt.Errorf("%w: %s", ErrExists, name)
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return Rule{}, fmt.Errorf("error while reading rule file: %w", err)
+	}
+
+	if err := writeFile(path, content, 0o644); err != nil {
+		return Rule{}, err
+	}
+	if err := s.apply(ctx); err != nil {
+		return Rule{}, s.rollback(ctx, path, previous, err)
+	}
+
+	sum := sha256.Sum256(content)
+	v := Version{Version: 1, SHA256: hex.EncodeToString(sum[:]), Size: int64(len(content)), CreatedAt: s.now().UTC()}
+	if len(versions) > 0 {
+		v.Version = versions[len(versions)-1].Version + 1
+	}
+	versions = append(versions, v)
+	if err := s.saveVersion(name, v, content, versions); err != nil {
+		return Rule{}, err
+	}
+	return Rule{Name: name, Type: typ, Version: v}, nil
+}
+
+// Delete removes the rule file name and its versions, then reloads clamd.
+// The removal is rolled back if clamd fails to reload.
+func (s *Store) Delete(ctx context.Context, name string) (Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule, err := s.get(name)
+	if err != nil {
+		return Rule{}, err
+	}
+	path := filepath.Join(s.cfg.Dir, name)
+	previous, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Rule{}, fmt.Errorf("error while reading rule file: %w", err)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Rule{}, fmt.Errorf("error while removing rule file: %w", err)
+	}
+	if err := s.apply(ctx); err != nil {
+		return Rule{}, s.rollback(ctx, path, previous, err)
+	}
+
+	if err := os.RemoveAll(filepath.Join(s.cfg.Dir, historyDir, name)); err != nil {
+		return Rule{}, fmt.Errorf("error while removing rule history: %w", err)
+	}
+	rule.Versions = nil
+	return rule, nil
+}
+
+// apply reloads clamd and pings it for the check duration.
+func (s *Store) apply(ctx context.Context) error {
+	if err := s.clamd.Reload(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.cfg.CheckInterval)
+	defer ticker.Stop()
+	deadline := time.After(s.cfg.CheckDuration)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return nil
+		case <-ticker.C:
+		}
+		if _, err := s.clamd.Ping(ctx); err != nil {
+			return fmt.Errorf("clamd stopped answering: %w", err)
+		}
+	}
+}
+
+// rollback restores the previous content of the rule file path, or removes it
+// if there was none, and reloads clamd again. It returns the error to report.
+func (s *Store) rollback(ctx context.Context, path string, previous []byte, cause error) error {
+	var err error
+	if previous != nil {
+		err = writeFile(path, previous, 0o644)
+	} else if rmErr := os.Remove(path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+		err = rmErr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w (rollback failed: %v)", ErrRolledBack, cause, err)
+	}
+
+	// The request may have been cancelled: the previous rules must be
+	// reloaded anyway, clamd may have restarted since
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), validatorTimeout)
+	defer cancel()
+	if err := s.clamd.Reload(ctx); err != nil {
+		return fmt.Errorf("%w: %w (reload after rollback failed: %v)", ErrRolledBack, cause, err)
+	}
+	return fmt.Errorf("%w: %w", ErrRolledBack, cause)
+}
+
+// validate runs the validator command, if any, on a copy of content named name.
+func (s *Store) validate(ctx context.Context, name string, content []byte) error {
+	if len(s.cfg.Validator) == 0 {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "clamav-api-go-rule-")
+	if err != nil {
+		return fmt.Errorf("error while validating rule file: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		return fmt.Errorf("error while validating rule file: %w", err)
+	}
+
+	args := make([]string, 0, len(s.cfg.Validator)+1)
+	replaced := false
+	for _, arg := range s.cfg.Validator {
+		if arg == "{}" {
+			arg, replaced = path, true
+		}
+		args = append(args, arg)
+	}
+	if !replaced {
+		args = append(args, path)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, validatorTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		output = bytes.TrimSpace(output)
+		if len(output) > maxValidatorOutput {
+			output = output[len(output)-maxValidatorOutput:]
+		}
+		return fmt.Errorf("%w: rejected by validator: %s", ErrInvalid, output)
+	}
+	if err != nil {
+		return fmt.Errorf("error while running rule validator: %w", err)
+	}
+	return nil
+}
+
+// versions reads the versions of the rule file name, oldest first.
+func (s *Store) versions(name string) ([]Version, error) {
+	b, err := os.ReadFile(filepath.Join(s.cfg.Dir, historyDir, name, versionsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading rule history: %w", err)
+	}
+	var versions []Version
+	if err := json.Unmarshal(b, &versions); err != nil {
+		return nil, fmt.Errorf("invalid rule history of %s: %w", name, err)
+	}
+	return versions, nil
+}
+
+// saveVersion saves the content of the version v of the rule file name, and
+// its new list of versions.
+func (s *Store) saveVersion(name string, v Version, content []byte, versions []Version) error {
+	dir := filepath.Join(s.cfg.Dir, historyDir, name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("error while writing rule history: %w", err)
+	}
+	if err := writeFile(filepath.Join(dir, strconv.Itoa(v.Version)), content, 0o600); err != nil {
+		return err
+	}
+	b, err := json.Marshal(versions)
+	if err != nil {
+		return fmt.Errorf("error while writing rule history: %w", err)
+	}
+	return writeFile(filepath.Join(dir, versionsFile), b, 0o600)
+}
+
+// writeFile replaces the file path with content atomically. The temporary
+// file doesn't have a database extension, so that clamd ignores it.
+func writeFile(path string, content []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), tmpPrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("error while writing rule file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("error while writing rule file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const yaraRule = `import "pe"
+
+/* Detects the test sample */
+rule Test_Sample : test
+{
+    meta:
+        author = "security team" // inline comment
+    strings:
+        $a = "foo{bar" nocase
+        $b = { 4D 5A ?? [2-4] ( 90 | 91 ) }
+        $c = /ba[rz]\/{2}/i
+    condition:
+        pe.is_pe and ($a or #b > 1) and !c[1] > 0
+}
+
+private rule Helper { condition: filesize < 10KB }
+`
+
+const ldbRule = "Win.Trojan.Test-1;Engine:81-255,Target:1;(0&1)|2>1,2;6869;414141;deadbeef\n"
+
+// fakeClamd fails the next reload or ping with reloadErr or pingErr, if set.
+type fakeClamd struct {
+	mu        sync.Mutex
+	reloads   int
+	reloadErr error
+	pingErr   error
+}
+
+func (f *fakeClamd) Reload(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reloads++
+	err := f.reloadErr
+	// clamd recovers once the previous rules are restored
+	f.reloadErr = nil
+	return err
+}
+
+func (f *fakeClamd) Ping(context.Context) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.pingErr
+	f.pingErr = nil
+	return []byte("PONG"), err
+}
+
+func newTestStore(t *testing.T, clamd Clamd, validator ...string) (*Store, string) {
+	t.Helper()
+	dir := t.TempDir()
+	s, err := New(Config{Dir: dir, Validator: validator, CheckDuration: 30 * time.Millisecond, CheckInterval: 5 * time.Millisecond}, clamd)
+	require.NoError(t, err)
+	return s, dir
+}
+
+func TestStorePut(t *testing.T) {
+	clamd := &fakeClamd{}
+	s, dir := newTestStore(t, clamd)
+	ctx := context.Background()
+
+	rule, err := s.Put(ctx, "test.yar", []byte(yaraRule))
+	require.NoError(t, err)
+	assert.Equal(t, "test.yar", rule.Name)
+	assert.Equal(t, TypeYARA, rule.Type)
+	assert.Equal(t, 1, rule.Version.Version)
+	assert.Equal(t, 1, clamd.reloads)
+
+	b, err := os.ReadFile(filepath.Join(dir, "test.yar"))
+	require.NoError(t, err)
+	assert.Equal(t, yaraRule, string(b))
+
+	rule, err = s.Put(ctx, "test.yar", []byte("rule Other { condition: true }"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, rule.Version.Version)
+
+	_, err = s.Put(ctx, "test.ldb", []byte(ldbRule))
+	require.NoError(t, err)
+
+	rules, err := s.List()
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "test.ldb", rules[0].Name)
+	assert.Equal(t, TypeLogical, rules[0].Type)
+	assert.Nil(t, rules[1].Versions)
+
+	rule, err = s.Get("test.yar")
+	require.NoError(t, err)
+	require.Len(t, rule.Versions, 2)
+	assert.Equal(t, 2, rule.Version.Version)
+
+	rule, err = s.Delete(ctx, "test.yar")
+	require.NoError(t, err)
+	assert.Equal(t, 2, rule.Version.Version)
+	_, err = os.Stat(filepath.Join(dir, "test.yar"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = s.Get("test.yar")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = s.Delete(ctx, "test.yar")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestStorePutUnmanaged(t *testing.T) {
+	s, dir := newTestStore(t, &fakeClamd{})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "vendor.yar"), []byte(yaraRule), 0o600))
+
+	_, err := s.Put(context.Background(), "vendor.yar", []byte(yaraRule))
+	assert.ErrorIs(t, err, ErrExists)
+}
+
+func TestStoreRollback(t *testing.T) {
+	tests := []struct {
+		name  string
+		clamd *fakeClamd
+	}{
+		{name: "reload failure", clamd: &fakeClamd{reloadErr: errors.New("connection refused")}},
+		{name: "ping failure", clamd: &fakeClamd{pingErr: errors.New("connection refused")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, dir := newTestStore(t, &fakeClamd{})
+			ctx := context.Background()
+			_, err := s.Put(ctx, "test.yar", []byte(yaraRule))
+			require.NoError(t, err)
+
+			s.clamd = tt.clamd
+			_, err = s.Put(ctx, "test.yar", []byte("rule Other { condition: true }"))
+			assert.ErrorIs(t, err, ErrRolledBack)
+
+			// The previous version is restored and reloaded
+			b, err := os.ReadFile(filepath.Join(dir, "test.yar"))
+			require.NoError(t, err)
+			assert.Equal(t, yaraRule, string(b))
+			assert.Equal(t, 2, tt.clamd.reloads)
+			rule, err := s.Get("test.yar")
+			require.NoError(t, err)
+			assert.Equal(t, 1, rule.Version.Version)
+
+			// New files are removed
+			tt.clamd.pingErr = errors.New("connection refused")
+			_, err = s.Put(ctx, "new.ldb", []byte(ldbRule))
+			assert.ErrorIs(t, err, ErrRolledBack)
+			_, err = os.Stat(filepath.Join(dir, "new.ldb"))
+			assert.ErrorIs(t, err, os.ErrNotExist)
+
+			// Removed files are restored
+			tt.clamd.pingErr = errors.New("connection refused")
+			_, err = s.Delete(ctx, "test.yar")
+			assert.ErrorIs(t, err, ErrRolledBack)
+			_, err = os.Stat(filepath.Join(dir, "test.yar"))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestStoreValidator(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no shell")
+	}
+
+	s, _ := newTestStore(t, &fakeClamd{}, "/bin/sh", "-c", `grep -q Test_Sample "$0" || { echo "$0: unknown rule" >&2; exit 1; }`, "{}")
+	_, err := s.Put(context.Background(), "test.yar", []byte(yaraRule))
+	require.NoError(t, err)
+
+	_, err = s.Put(context.Background(), "other.yar", []byte("rule Other { condition: true }"))
+	assert.ErrorIs(t, err, ErrInvalid)
+	assert.ErrorContains(t, err, "other.yar: unknown rule")
+}
+
+func TestCheckSyntax(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     string
+		content string
+		wantErr string
+	}{
+		{name: "yara", typ: TypeYARA, content: yaraRule},
+		{name: "ldb", typ: TypeLogical, content: ldbRule},
+		{name: "ldb with comparisons", typ: TypeLogical, content: "Test.Sig;Target:0;0=2&1>1,3;41;42\n"},
+		{name: "binary", typ: TypeYARA, content: "rule A { condition: true }\x00", wantErr: "not a text file"},
+		{name: "empty yara", typ: TypeYARA, content: "// nothing\n", wantErr: "no rule"},
+		{name: "no condition", typ: TypeYARA, content: "rule A { strings: $a = \"condition:\" }", wantErr: "must have a condition"},
+		{name: "unterminated rule", typ: TypeYARA, content: "rule A { condition: true", wantErr: "unterminated rule"},
+		{name: "unterminated string", typ: TypeYARA, content: "rule A { strings: $a = \"foo\n condition: $a }", wantErr: "line 1: unterminated string"},
+		{name: "duplicate rule", typ: TypeYARA, content: "rule A { condition: true }\nrule A { condition: true }", wantErr: "line 2: duplicate rule"},
+		{name: "include", typ: TypeYARA, content: "include \"other.yar\"", wantErr: "includes aren't supported"},
+		{name: "garbage", typ: TypeYARA, content: "hello world", wantErr: "expected a rule"},
+		{name: "empty ldb", typ: TypeLogical, content: "\n", wantErr: "no signature"},
+		{name: "ldb without subsignature", typ: TypeLogical, content: "Test.Sig;Target:0;0", wantErr: "line 1"},
+		{name: "ldb without target", typ: TypeLogical, content: "Test.Sig;Engine:81-255;0;41", wantErr: "Target attribute"},
+		{name: "ldb missing subsignature", typ: TypeLogical, content: "Test.Sig;Target:0;0&1;41", wantErr: "missing subsignature 1"},
+		{name: "ldb unbalanced", typ: TypeLogical, content: "Test.Sig;Target:0;(0&1;41;42", wantErr: "unbalanced"},
+		{name: "ldb invalid expression", typ: TypeLogical, content: "Test.Sig;Target:0;0 and 1;41;42", wantErr: "invalid logical expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSyntax(tt.typ, []byte(tt.content))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleType(t *testing.T) {
+	for _, name := range []string{"../main.yar", "rules.txt", ".hidden.yar", "main.cvd", ""} {
+		_, err := ruleType(name)
+		assert.ErrorIs(t, err, ErrInvalid, name)
+	}
+}
@@ -0,0 +1,305 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxSubsignatures is the maximum number of subsignatures of a logical signature.
+const maxSubsignatures = 64
+
+var (
+	sigNameRegexp    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._{}-]*$`)
+	logicalRegexp    = regexp.MustCompile(`^[0-9&|()=<>,]+$`)
+	logicalIdxRegexp = regexp.MustCompile(`[0-9]+`)
+	identRegexp      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+)
+
+// checkSyntax checks the syntax of a rule file of type typ. The checks are
+// structural: a file passing them may still be refused by clamd, hence the
+// validator command and the rollback.
+func checkSyntax(typ string, content []byte) error {
+	if !isText(content) {
+		return errors.New("not a text file")
+	}
+	if typ == TypeLogical {
+		return checkLogical(string(content))
+	}
+	return checkYARA(string(content))
+}
+
+func isText(content []byte) bool {
+	for _, r := range string(content) {
+		if r == unicode.ReplacementChar || (unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkLogical checks the logical signatures of an .ldb file, a signature per line:
+//
+//	SignatureName;TargetDescriptionBlock;LogicalExpression;Subsig0;Subsig1;...
+func checkLogical(content string) error {
+	var n int
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		if err := checkLogicalSignature(line); err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		n++
+	}
+	if n == 0 {
+		return errors.New("no signature")
+	}
+	return nil
+}
+
+func checkLogicalSignature(line string) error {
+	fields := strings.Split(line, ";")
+	if len(fields) < 4 {
+		return errors.New("a logical signature must have a name, a target description block, a logical expression and subsignatures")
+	}
+	name, tdb, expr, subsigs := fields[0], fields[1], fields[2], fields[3:]
+
+	if !sigNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid signature name %q", name)
+	}
+
+	var target bool
+	for _, attr := range strings.Split(tdb, ",") {
+		key, value, ok := strings.Cut(attr, ":")
+		if !ok || key == "" || value == "" {
+			return fmt.Errorf("invalid target description block attribute %q", attr)
+		}
+		target = target || key == "Target"
+	}
+	if !target {
+		return errors.New("the target description block must have a Target attribute")
+	}
+
+	if len(subsigs) > maxSubsignatures {
+		return fmt.Errorf("more than %d subsignatures", maxSubsignatures)
+	}
+	for i, subsig := range subsigs {
+		if subsig == "" {
+			return fmt.Errorf("empty subsignature %d", i)
+		}
+	}
+
+	if !logicalRegexp.MatchString(expr) {
+		return fmt.Errorf("invalid logical expression %q", expr)
+	}
+	var depth int
+	for _, r := range expr {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth < 0 {
+			break
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("unbalanced parentheses in logical expression %q", expr)
+	}
+	// Only the numbers not following a comparison or a comma are subsignature indexes
+	for _, loc := range logicalIdxRegexp.FindAllStringIndex(expr, -1) {
+		if loc[0] > 0 && strings.ContainsRune("=<>,", rune(expr[loc[0]-1])) {
+			continue
+		}
+		idx, _ := strconv.Atoi(expr[loc[0]:loc[1]])
+		if idx >= len(subsigs) {
+			return fmt.Errorf("logical expression refers to the missing subsignature %d", idx)
+		}
+	}
+	return nil
+}
+
+// yaraToken is a token of a YARA file.
+type yaraToken struct {
+	text string
+	line int
+}
+
+// checkYARA checks the structure of the rules of a YARA file:
+//
+//	import "module"
+//	[private] [global] rule Name [: tags] { [meta: ...] [strings: ...] condition: ... }
+func checkYARA(content string) error {
+	tokens, err := tokenizeYARA(content)
+	if err != nil {
+		return err
+	}
+
+	rules := make(map[string]bool)
+	for i := 0; i < len(tokens); {
+		tok := tokens[i]
+		switch tok.text {
+		case "import":
+			if i+1 >= len(tokens) || !strings.HasPrefix(tokens[i+1].text, `"`) {
+				return fmt.Errorf("line %d: import must be followed by a module name", tok.line)
+			}
+			i += 2
+			continue
+		case "include":
+			return fmt.Errorf("line %d: includes aren't supported", tok.line)
+		case "private", "global":
+			i++
+			continue
+		case "rule":
+		default:
+			return fmt.Errorf("line %d: unexpected %q, expected a rule", tok.line, tok.text)
+		}
+
+		// rule Name
+		i++
+		if i >= len(tokens) || !identRegexp.MatchString(tokens[i].text) {
+			return fmt.Errorf("line %d: rule must be followed by its name", tok.line)
+		}
+		name := tokens[i].text
+		if rules[name] {
+			return fmt.Errorf("line %d: duplicate rule %q", tokens[i].line, name)
+		}
+		rules[name] = true
+		i++
+
+		// [: tags]
+		if i < len(tokens) && tokens[i].text == ":" {
+			i++
+			for i < len(tokens) && identRegexp.MatchString(tokens[i].text) {
+				i++
+			}
+		}
+
+		// { ... condition: ... }
+		if i >= len(tokens) || tokens[i].text != "{" {
+			return fmt.Errorf("line %d: rule %q must have a body", tok.line, name)
+		}
+		depth, condition := 0, false
+		for ; i < len(tokens); i++ {
+			switch tokens[i].text {
+			case "{":
+				depth++
+			case "}":
+				depth--
+			case "condition":
+				if depth == 1 && i+1 < len(tokens) && tokens[i+1].text == ":" {
+					condition = true
+				}
+			}
+			if depth == 0 {
+				break
+			}
+		}
+		if depth != 0 {
+			return fmt.Errorf("line %d: unterminated rule %q", tok.line, name)
+		}
+		if !condition {
+			return fmt.Errorf("line %d: rule %q must have a condition", tok.line, name)
+		}
+		i++
+	}
+
+	if len(rules) == 0 {
+		return errors.New("no rule")
+	}
+	return nil
+}
+
+// tokenizeYARA splits a YARA file into tokens: identifiers and numbers,
+// quoted strings, and punctuation. Comments are dropped, and hex strings and
+// regular expressions, following "=", are single tokens.
+func tokenizeYARA(content string) ([]yaraToken, error) {
+	var tokens []yaraToken
+	line := 1
+	s := content
+	for len(s) > 0 {
+		c := s[0]
+		switch {
+		case c == '\n':
+			line++
+			s = s[1:]
+		case c == ' ' || c == '\t' || c == '\r':
+			s = s[1:]
+		case strings.HasPrefix(s, "//"):
+			end := strings.IndexByte(s, '\n')
+			if end < 0 {
+				end = len(s)
+			}
+			s = s[end:]
+		case strings.HasPrefix(s, "/*"):
+			end := strings.Index(s[2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(s[:end+4], "\n")
+			s = s[end+4:]
+		case c == '"':
+			end := closingQuote(s, '"')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, yaraToken{text: s[:end+1], line: line})
+			s = s[end+1:]
+		case c == '/' && afterAssignment(tokens):
+			end := closingQuote(s, '/')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated regular expression", line)
+			}
+			tokens = append(tokens, yaraToken{text: s[:end+1], line: line})
+			s = s[end+1:]
+		case c == '{' && afterAssignment(tokens):
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated hex string", line)
+			}
+			tokens = append(tokens, yaraToken{text: s[:end+1], line: line})
+			line += strings.Count(s[:end], "\n")
+			s = s[end+1:]
+		case c == '_' || c == '$' || c == '#' || c == '@' || c == '!' && len(s) > 1 && s[1] == '$' ||
+			c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9':
+			end := 1
+			for end < len(s) && (s[end] == '_' || s[end] == '*' || s[end] == '.' ||
+				s[end] >= 'a' && s[end] <= 'z' || s[end] >= 'A' && s[end] <= 'Z' || s[end] >= '0' && s[end] <= '9') {
+				end++
+			}
+			tokens = append(tokens, yaraToken{text: s[:end], line: line})
+			s = s[end:]
+		default:
+			tokens = append(tokens, yaraToken{text: s[:1], line: line})
+			s = s[1:]
+		}
+	}
+	return tokens, nil
+}
+
+// afterAssignment returns true if the last token is "=", which strings follow.
+func afterAssignment(tokens []yaraToken) bool {
+	return len(tokens) > 0 && tokens[len(tokens)-1].text == "="
+}
+
+// closingQuote returns the index of the quote q closing the string or regular
+// expression starting s, skipping the escaped characters, or -1.
+func closingQuote(s string, q byte) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case q:
+			return i
+		case '\n':
+			return -1
+		}
+	}
+	return -1
+}
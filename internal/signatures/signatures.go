@@ -0,0 +1,285 @@
+// Package signatures manages a local database of custom hash signatures,
+// written in the database directory of clamd, so that new samples can be
+// blocked without waiting for the upstream signatures.
+//
+// The signatures are stored in the ClamAV hash signature formats, a line per
+// signature:
+//
+//	<dir>/<name>.hdb  MD5:FileSize:MalwareName
+//	<dir>/<name>.hsb  SHA1or256:FileSize:MalwareName
+//
+// The files are replaced atomically, so that clamd never reads them half
+// written, and removed when they no longer hold any signature, as clamd
+// refuses empty databases. clamd must be reloaded for the changes to apply.
+package signatures
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultDatabaseName is the default name of the database files, without extension.
+const DefaultDatabaseName = "clamav-api-go"
+
+// Names of the hash algorithms.
+const (
+	AlgorithmMD5    = "md5"
+	AlgorithmSHA1   = "sha1"
+	AlgorithmSHA256 = "sha256"
+)
+
+// Extensions of the database files.
+const (
+	extMD5 = ".hdb"
+	extSHA = ".hsb"
+)
+
+const tmpPrefix = ".tmp-"
+
+var (
+	// ErrInvalid indicates a malformed signature.
+	ErrInvalid = errors.New("invalid signature")
+	// ErrNotFound indicates the requested signature isn't in the database.
+	ErrNotFound = errors.New("signature not found")
+	// ErrExists indicates the database already has a signature of the hash.
+	ErrExists = errors.New("signature already exists")
+)
+
+// nameRegexp matches the names valid as malware names and database names:
+// the hash signature formats are colon-separated.
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// ValidName returns true if name is valid as a malware name or a database name.
+func ValidName(name string) bool {
+	return nameRegexp.MatchString(name)
+}
+
+// Signature is a hash signature.
+type Signature struct {
+	// Name is the malware name reported by clamd, eg. "Win.Trojan.Agent-1".
+	Name string `json:"name"`
+	// Hash is the hash of the file, in lower case hexadecimal.
+	Hash string `json:"hash"`
+	// Algorithm is the algorithm of Hash, told by its length.
+	Algorithm string `json:"algorithm"`
+	// Size is the size of the file in bytes.
+	Size int64 `json:"size"`
+	// Database is the name of the database file holding the signature.
+	Database string `json:"database"`
+}
+
+// String returns the signature in the hash signature format.
+func (s Signature) String() string {
+	return s.Hash + ":" + strconv.FormatInt(s.Size, 10) + ":" + s.Name
+}
+
+// Store is a database of custom hash signatures.
+// It is safe for concurrent use.
+type Store struct {
+	mu   sync.Mutex
+	dir  string
+	name string
+}
+
+// New returns a Store of the database files name.hdb and name.hsb in dir,
+// which must exist.
+func New(dir, name string) (*Store, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid database name %q", name)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening signature database directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("signature database directory %s isn't a directory", dir)
+	}
+	return &Store{dir: dir, name: name}, nil
+}
+
+// Add validates sig and adds it to the database matching its algorithm.
+// It returns the signature as stored.
+func (s *Store) Add(sig Signature) (Signature, error) {
+	sig.Hash = strings.ToLower(sig.Hash)
+	sig.Algorithm = algorithm(sig.Hash)
+	if _, err := hex.DecodeString(sig.Hash); err != nil || sig.Algorithm == "" {
+		return Signature{}, fmt.Errorf("%w: hash must be a MD5, SHA-1 or SHA-256 in hexadecimal", ErrInvalid)
+	}
+	if sig.Size <= 0 {
+		return Signature{}, fmt.Errorf("%w: size must be positive", ErrInvalid)
+	}
+	if !ValidName(sig.Name) {
+		return Signature{}, fmt.Errorf("%w: name must be made of letters, digits, '.', '-' and '_'", ErrInvalid)
+	}
+	sig.Database = s.database(sig.Algorithm)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sigs, err := s.read(sig.Database)
+	if err != nil {
+		return Signature{}, err
+	}
+	for _, existing := range sigs {
+		if existing.Hash == sig.Hash {
+			return Signature{}, fmt.Errorf("%w: %s", ErrExists, sig.Hash)
+		}
+	}
+	if err := s.write(sig.Database, append(sigs, sig)); err != nil {
+		return Signature{}, err
+	}
+	return sig, nil
+}
+
+// List returns the signatures of the databases, in the order they were added,
+// MD5 signatures first.
+func (s *Store) List() ([]Signature, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var all []Signature
+	for _, db := range []string{s.name + extMD5, s.name + extSHA} {
+		sigs, err := s.read(db)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, sigs...)
+	}
+	return all, nil
+}
+
+// Delete deletes the signature of hash, and returns it.
+func (s *Store) Delete(hash string) (Signature, error) {
+	hash = strings.ToLower(hash)
+	alg := algorithm(hash)
+	if alg == "" {
+		return Signature{}, fmt.Errorf("%w: %s", ErrNotFound, hash)
+	}
+	db := s.database(alg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sigs, err := s.read(db)
+	if err != nil {
+		return Signature{}, err
+	}
+	for i, sig := range sigs {
+		if sig.Hash == hash {
+			if err := s.write(db, append(sigs[:i:i], sigs[i+1:]...)); err != nil {
+				return Signature{}, err
+			}
+			return sig, nil
+		}
+	}
+	return Signature{}, fmt.Errorf("%w: %s", ErrNotFound, hash)
+}
+
+// database returns the name of the database file of the signatures of alg.
+func (s *Store) database(alg string) string {
+	if alg == AlgorithmMD5 {
+		return s.name + extMD5
+	}
+	return s.name + extSHA
+}
+
+// read reads the signatures of the database file db. A missing file has no signature.
+func (s *Store) read(db string) ([]Signature, error) {
+	f, err := os.Open(filepath.Join(s.dir, db))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading signature database: %w", err)
+	}
+	defer f.Close()
+
+	var sigs []Signature
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		// Extra fields, such as the minimum functionality level, are ignored
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid signature database %s: line %d: malformed signature", db, n)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature database %s: line %d: invalid size %q", db, n, fields[1])
+		}
+		hash := strings.ToLower(fields[0])
+		sigs = append(sigs, Signature{Name: fields[2], Hash: hash, Algorithm: algorithm(hash), Size: size, Database: db})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading signature database: %w", err)
+	}
+	return sigs, nil
+}
+
+// write replaces the database file db with sigs, or removes it if sigs is empty.
+func (s *Store) write(db string, sigs []Signature) error {
+	path := filepath.Join(s.dir, db)
+	if len(sigs) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error while writing signature database: %w", err)
+		}
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(s.dir, tmpPrefix+db+"-*")
+	if err != nil {
+		return fmt.Errorf("error while writing signature database: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, sig := range sigs {
+		_, _ = w.WriteString(sig.String() + "\n")
+	}
+	err = w.Flush()
+	if err == nil {
+		// clamd usually runs as another user
+		err = tmp.Chmod(0o644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("error while writing signature database: %w", err)
+	}
+	return nil
+}
+
+// algorithm returns the algorithm of the hash, told by its length.
+func algorithm(hash string) string {
+	switch len(hash) {
+	case md5.Size * 2:
+		return AlgorithmMD5
+	case sha1.Size * 2:
+		return AlgorithmSHA1
+	case sha256.Size * 2:
+		return AlgorithmSHA256
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,93 @@
+package signatures
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	md5Foobar    = "3858f62230ac3c915f300c664312c63f"
+	sha256Foobar = "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir, DefaultDatabaseName)
+	require.NoError(t, err)
+
+	sigs, err := s.List()
+	require.NoError(t, err)
+	assert.Empty(t, sigs)
+
+	sig, err := s.Add(Signature{Name: "Win.Trojan.Foobar", Hash: sha256Foobar, Size: 6})
+	require.NoError(t, err)
+	assert.Equal(t, Signature{Name: "Win.Trojan.Foobar", Hash: sha256Foobar, Algorithm: AlgorithmSHA256, Size: 6, Database: "clamav-api-go.hsb"}, sig)
+
+	_, err = s.Add(Signature{Name: "Win.Trojan.Foobar-MD5", Hash: "3858F62230AC3C915F300C664312C63F", Size: 6})
+	require.NoError(t, err)
+
+	// The files are in the hash signature formats
+	b, err := os.ReadFile(filepath.Join(dir, "clamav-api-go.hsb"))
+	require.NoError(t, err)
+	assert.Equal(t, sha256Foobar+":6:Win.Trojan.Foobar\n", string(b))
+	b, err = os.ReadFile(filepath.Join(dir, "clamav-api-go.hdb"))
+	require.NoError(t, err)
+	assert.Equal(t, md5Foobar+":6:Win.Trojan.Foobar-MD5\n", string(b))
+
+	sigs, err = s.List()
+	require.NoError(t, err)
+	require.Len(t, sigs, 2)
+	assert.Equal(t, AlgorithmMD5, sigs[0].Algorithm)
+	assert.Equal(t, sig, sigs[1])
+
+	_, err = s.Add(Signature{Name: "Other", Hash: sha256Foobar, Size: 6})
+	assert.ErrorIs(t, err, ErrExists)
+
+	deleted, err := s.Delete(md5Foobar)
+	require.NoError(t, err)
+	assert.Equal(t, "Win.Trojan.Foobar-MD5", deleted.Name)
+	_, err = s.Delete(md5Foobar)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Empty databases are removed, as clamd refuses them
+	_, err = os.Stat(filepath.Join(dir, "clamav-api-go.hdb"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files are left behind")
+}
+
+func TestStoreAddInvalid(t *testing.T) {
+	s, err := New(t.TempDir(), DefaultDatabaseName)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		sig  Signature
+	}{
+		{name: "invalid hash", sig: Signature{Name: "Foo", Hash: "foobar", Size: 6}},
+		{name: "invalid hash length", sig: Signature{Name: "Foo", Hash: "abcd", Size: 6}},
+		{name: "zero size", sig: Signature{Name: "Foo", Hash: sha256Foobar}},
+		{name: "empty name", sig: Signature{Hash: sha256Foobar, Size: 6}},
+		{name: "name with colon", sig: Signature{Name: "Foo:1", Hash: sha256Foobar, Size: 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Add(tt.sig)
+			assert.ErrorIs(t, err, ErrInvalid)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(t.TempDir(), "custom:db")
+	assert.Error(t, err)
+
+	_, err = New(filepath.Join(t.TempDir(), "missing"), DefaultDatabaseName)
+	assert.Error(t, err)
+}
@@ -0,0 +1,326 @@
+// Package urlfetch fetches remote content to scan, protecting against
+// server-side request forgery (SSRF).
+//
+// Destinations are checked against allow-lists of schemes and hosts, on the
+// first request and on every redirect. The IP addresses are checked when
+// connecting, after DNS resolution, so that a host name can't be made to
+// resolve to an internal address.
+package urlfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrInvalidURL indicates the URL is malformed.
+	ErrInvalidURL = errors.New("invalid url")
+	// ErrForbidden indicates the URL or one of its redirects isn't allowed:
+	// its scheme or host isn't allowed, or it resolves to a blocked address.
+	ErrForbidden = errors.New("url not allowed")
+	// ErrTooLarge indicates the content exceeds the maximum size.
+	ErrTooLarge = errors.New("remote content too large")
+	// ErrFetch indicates the content couldn't be fetched.
+	ErrFetch = errors.New("error while fetching url")
+)
+
+// blockedPrefixes are the ranges blocked on top of the loopback, private,
+// link-local, multicast and unspecified addresses.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),         // "This" network
+	netip.MustParsePrefix("100.64.0.0/10"),     // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),      // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),     // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),       // Reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),      // NAT64, may map to internal IPv4 addresses
+	netip.MustParsePrefix("64:ff9b:1::/48"),    // Local-use NAT64
+	netip.MustParsePrefix("2002::/16"),         // 6to4, may map to internal IPv4 addresses
+	netip.MustParsePrefix("fd00:ec2::254/128"), // AWS metadata service over IPv6, also in fc00::/7
+}
+
+// forbiddenError is an ErrForbidden error, telling why the URL isn't allowed.
+type forbiddenError struct {
+	reason string
+}
+
+func forbidden(format string, a ...any) error {
+	return &forbiddenError{reason: fmt.Sprintf(format, a...)}
+}
+
+func (e *forbiddenError) Error() string {
+	return ErrForbidden.Error() + ": " + e.reason
+}
+
+func (e *forbiddenError) Unwrap() error {
+	return ErrForbidden
+}
+
+// Config is the configuration of a Fetcher.
+type Config struct {
+	// AllowedSchemes are the allowed URL schemes. Empty allows http and https.
+	AllowedSchemes []string
+	// AllowedHosts are the allowed host names. An entry starting with "*."
+	// allows the subdomains of the domain. Empty allows all the hosts.
+	AllowedHosts []string
+	// AllowedNetworks are exempted from the blocking of the internal addresses,
+	// eg. to scan content from an intranet.
+	AllowedNetworks []netip.Prefix
+	// MaxSize is the maximum size of the content. Zero means no limit.
+	MaxSize int64
+	// Timeout bounds the whole fetch, including the read of the content.
+	// Zero means no timeout.
+	Timeout time.Duration
+	// MaxRedirects is the maximum number of redirects followed.
+	MaxRedirects int
+}
+
+// Response is the response to a fetch. Body must be closed by the caller.
+type Response struct {
+	// URL is the final URL, after the redirects.
+	URL        string
+	StatusCode int
+	Header     http.Header
+	// Body is the content, limited to the maximum size.
+	Body io.ReadCloser
+	// Size is the size of the content, or -1 if unknown.
+	Size int64
+}
+
+// Fetcher fetches remote content.
+type Fetcher struct {
+	cfg    Config
+	client *http.Client
+}
+
+// New returns a Fetcher configured with cfg.
+func New(cfg Config) *Fetcher {
+	if len(cfg.AllowedSchemes) == 0 {
+		cfg.AllowedSchemes = []string{"http", "https"}
+	}
+	schemes := make([]string, len(cfg.AllowedSchemes))
+	for i, scheme := range cfg.AllowedSchemes {
+		schemes[i] = strings.ToLower(scheme)
+	}
+	cfg.AllowedSchemes = schemes
+
+	f := &Fetcher{cfg: cfg}
+
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: f.control,
+	}
+	transport := &http.Transport{
+		// Proxies would connect on our behalf, bypassing the checks of the addresses
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	f.client = &http.Client{
+		Transport:     transport,
+		Timeout:       cfg.Timeout,
+		CheckRedirect: f.checkRedirect,
+	}
+	return f
+}
+
+// Fetch fetches rawURL. Only successful responses are returned, others
+// are reported as ErrFetch.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidURL, rawURL)
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("%w: credentials aren't allowed in the url", ErrInvalidURL)
+	}
+	if err := f.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fetchError(err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s responded with status %d", ErrFetch, resp.Request.URL, resp.StatusCode)
+	}
+	if f.cfg.MaxSize > 0 && resp.ContentLength > f.cfg.MaxSize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %d bytes, the limit is %d bytes", ErrTooLarge, resp.ContentLength, f.cfg.MaxSize)
+	}
+
+	return &Response{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       &body{ReadCloser: resp.Body, max: f.cfg.MaxSize, left: f.cfg.MaxSize, limited: f.cfg.MaxSize > 0},
+		Size:       resp.ContentLength,
+	}, nil
+}
+
+// checkURL checks the scheme and host of u against the allow-lists.
+func (f *Fetcher) checkURL(u *url.URL) error {
+	if !slices.Contains(f.cfg.AllowedSchemes, strings.ToLower(u.Scheme)) {
+		return forbidden("scheme %q isn't allowed", u.Scheme)
+	}
+	if !f.allowedHost(strings.ToLower(u.Hostname())) {
+		return forbidden("host %q isn't allowed", u.Hostname())
+	}
+	// Report literal addresses right away rather than when connecting
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && f.blocked(addr) {
+		return forbidden("address %s is blocked", addr)
+	}
+	return nil
+}
+
+// allowedHost returns true if host matches the allowed hosts.
+func (f *Fetcher) allowedHost(host string) bool {
+	if len(f.cfg.AllowedHosts) == 0 {
+		return true
+	}
+	for _, allowed := range f.cfg.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if domain, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect checks the destination of the redirects.
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > f.cfg.MaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", f.cfg.MaxRedirects)
+	}
+	if req.URL.User != nil {
+		return forbidden("credentials aren't allowed in the url")
+	}
+	return f.checkURL(req.URL)
+}
+
+// control checks the address about to be connected to, once resolved.
+func (f *Fetcher) control(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return forbidden("invalid address %q", address)
+	}
+	if f.blocked(addrPort.Addr()) {
+		return forbidden("address %s is blocked", addrPort.Addr())
+	}
+	return nil
+}
+
+// blocked returns true if addr is an internal address which isn't
+// in the allowed networks.
+func (f *Fetcher) blocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range f.cfg.AllowedNetworks {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return IsInternal(addr)
+}
+
+// IsInternal returns true if addr is a loopback, private, link-local,
+// multicast, unspecified or otherwise reserved address. The cloud metadata
+// services, such as 169.254.169.254, are link-local.
+func IsInternal(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return true
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchError maps the errors of the HTTP client to the errors of the package.
+// Other errors are only kept as text, so that network errors of the fetch
+// can't be mistaken for errors talking to clamd.
+func fetchError(err error) error {
+	var fe *forbiddenError
+	switch {
+	case errors.As(err, &fe):
+		return fe
+	case errors.Is(err, context.Canceled):
+		return err
+	default:
+		return fmt.Errorf("%w: %v", ErrFetch, unwrapURLError(err))
+	}
+}
+
+// unwrapURLError returns the error wrapped by a *url.Error, which repeats the URL.
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// body limits the read of the content to the maximum size.
+type body struct {
+	io.ReadCloser
+	max     int64
+	left    int64
+	limited bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.limited && b.left <= 0 {
+		// Tell a body of exactly the maximum size from a larger one
+		var probe [1]byte
+		n, err := io.ReadAtLeast(b.ReadCloser, probe[:], 1)
+		if n > 0 {
+			return 0, fmt.Errorf("%w: the limit is %d bytes", ErrTooLarge, b.max)
+		}
+		return 0, bodyError(err)
+	}
+	if b.limited && int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	return n, bodyError(err)
+}
+
+// bodyError maps the errors reading the content, io.EOF excepted.
+func bodyError(err error) error {
+	if err == nil || errors.Is(err, io.EOF) {
+		return err
+	}
+	return fetchError(err)
+}
@@ -6,22 +6,47 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
+	"github.com/lescactus/clamav-api-go/internal/admission"
+	"github.com/lescactus/clamav-api-go/internal/audit"
+	"github.com/lescactus/clamav-api-go/internal/capabilities"
 	"github.com/lescactus/clamav-api-go/internal/clamav"
 	"github.com/lescactus/clamav-api-go/internal/config"
 	"github.com/lescactus/clamav-api-go/internal/controllers"
+	"github.com/lescactus/clamav-api-go/internal/freshclam"
+	"github.com/lescactus/clamav-api-go/internal/grpcserver"
+	"github.com/lescactus/clamav-api-go/internal/heuristics"
+	"github.com/lescactus/clamav-api-go/internal/icap"
 	"github.com/lescactus/clamav-api-go/internal/logger"
+	"github.com/lescactus/clamav-api-go/internal/metrics"
+	"github.com/lescactus/clamav-api-go/internal/mirror"
+	"github.com/lescactus/clamav-api-go/internal/objectstore"
+	"github.com/lescactus/clamav-api-go/internal/openapi"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/internal/ratelimit"
+	"github.com/lescactus/clamav-api-go/internal/reputation"
+	"github.com/lescactus/clamav-api-go/internal/rules"
+	"github.com/lescactus/clamav-api-go/internal/signatures"
+	"github.com/lescactus/clamav-api-go/internal/urlfetch"
 	"github.com/rs/zerolog/hlog"
+	"google.golang.org/grpc"
 )
 
+// quarantinePurgeInterval is the interval between two purges of the
+// expired quarantined files.
+const quarantinePurgeInterval = time.Hour
+
 func main() {
 	// Get application configuration
 	cfg, err := config.New()
@@ -42,9 +67,69 @@ func main() {
 		cfg.ClamavKeepAlive,
 	)
 
+	// Query the commands supported by clamd, so that the features needing a
+	// command it doesn't support fail without sending it
+	caps := capabilities.New(client, cfg.ClamavCapabilitiesRefresh)
+	capsCtx, capsCancel := context.WithTimeout(context.Background(), cfg.ClamavTimeout)
+	if err := caps.Refresh(capsCtx); err != nil {
+		logger.Warn().Err(err).Msg("commands supported by clamd unknown, assuming all are supported")
+	} else {
+		logger.Info().Strs("commands", caps.Status().Commands).Msg("commands supported by clamd")
+	}
+	capsCancel()
+	clamd := caps.Client(client)
+
 	// Create http router, server and handler controller
 	r := httprouter.New()
-	h := controllers.NewHandler(logger, client)
+	h := controllers.NewHandler(logger, clamd)
+	freshclamEnv, err := config.ParseEnv(cfg.FreshClamEnv)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid freshclam environment")
+	}
+	client.SetFreshClamOptions(clamav.FreshClamOptions{
+		Binary:     cfg.FreshClamBinary,
+		ConfigFile: cfg.FreshClamConfigFile,
+		DataDir:    cfg.FreshClamDataDir,
+		Args:       strings.Fields(cfg.FreshClamExtraArgs),
+		Env:        freshclamEnv,
+	})
+	// clamd is reloaded once a database has been updated, whether the update
+	// was requested through the API or scheduled
+	h.FreshClamJobs = freshclam.New(client.FreshClam, freshclam.Config{
+		Timeout:     cfg.FreshClamTimeout,
+		HistorySize: cfg.FreshClamHistorySize,
+		OnDone:      freshclam.NewReloader(clamd, cfg.FreshClamReloadConfirm).Reload,
+	})
+	h.DatabasesDir = cfg.DatabasesDir
+	h.DatabasesMaxAge = cfg.DatabasesMaxAge
+
+	heuristicsPolicy, err := heuristics.ParsePolicy(cfg.ArchiveHeuristicsPolicy)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid archive heuristics policy")
+	}
+	h.HeuristicsPolicy = heuristicsPolicy
+
+	// Verdict policy deciding whether the scanned files are allowed, warned about or blocked
+	if cfg.PolicyFile != "" {
+		h.Policy, err = policy.Load(cfg.PolicyFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid verdict policy")
+		}
+	}
+
+	// Audit log of scans and administrative actions
+	if cfg.AuditLogOutput != "" {
+		auditLogger, err := newAuditLogger(cfg)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to open the audit log")
+		}
+		defer func() {
+			if err := auditLogger.Close(); err != nil {
+				logger.Warn().Err(err).Msg("Failed to close the audit log")
+			}
+		}()
+		h.Audit = auditLogger
+	}
 	c := alice.New()
 	s := &http.Server{
 		Addr:              cfg.ServerAddr,
@@ -72,26 +157,356 @@ func main() {
 	c = c.Append(hlog.RemoteAddrHandler("remote_client"))
 	c = c.Append(hlog.UserAgentHandler("user_agent"))
 	c = c.Append(hlog.RequestIDHandler("req_id", "X-Request-ID"))
-	c = c.Append(controllers.MaxReqSize(cfg.ServerMaxRequestSize))
+	// The databases imported into the mirror, such as main.cvd, are larger than the requests
+	c = c.Append(controllers.MaxReqSizeByPath(cfg.ServerMaxRequestSize, map[string]int64{
+		"/rest/v1/mirror": cfg.MirrorMaxUploadSize,
+	}))
+
+	// Resolve the client IP address, trusting the forwarding headers
+	// only when they are set by one of the trusted proxies
+	trustedProxies, err := config.ParseTrustedProxies(cfg.ServerTrustedProxies)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid trusted proxies")
+	}
+	c = c.Append(controllers.RealIP(trustedProxies))
 
-	// Add optional API key authentication
+	// Add optional API key and HMAC signature authentication
 	// If AUTH_API_KEY is set, authentication is enabled for protected endpoints
+	// If AUTH_HMAC_KEYS is set, signed requests are accepted as well
 	// Public endpoints like /ping remain accessible without authentication
-	if cfg.AuthAPIKey != "" {
+	hmacKeys, err := config.ParseHMACKeys(cfg.AuthHMACKeys)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid HMAC keys")
+	}
+
+	var verifier *controllers.HMACVerifier
+	switch {
+	case len(hmacKeys) > 0:
+		var apiKeyAuth func(http.Handler) http.Handler
+		if cfg.AuthAPIKey != "" {
+			logger.Info().Msg("API key authentication enabled")
+			apiKeyAuth = controllers.APIKeyAuth(cfg.AuthAPIKey, cfg.AuthAPIKeyHeader)
+		}
+		logger.Info().Int("keys", len(hmacKeys)).Msg("HMAC signature authentication enabled")
+		verifier = controllers.NewHMACVerifier(hmacKeys, cfg.AuthHMACMaxClockSkew)
+		c = c.Append(controllers.ConditionalHMACAuth(verifier, apiKeyAuth))
+	case cfg.AuthAPIKey != "":
 		logger.Info().Msg("API key authentication enabled")
 		c = c.Append(controllers.ConditionalAPIKeyAuth(cfg.AuthAPIKey, cfg.AuthAPIKeyHeader))
-	} else {
+	default:
 		logger.Info().Msg("API key authentication disabled")
 	}
 
+	// Add optional per-client rate limiting
+	// It must come after the authentication to identify clients by principal
+	rateLimitRules, err := ratelimit.ParseRules(cfg.RateLimitRules)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid rate limit rules")
+	}
+	if len(rateLimitRules) > 0 {
+		limiters := make(map[string]*ratelimit.Limiter, len(rateLimitRules))
+		for route, rule := range rateLimitRules {
+			logger.Info().Str("route", route).
+				Float64("rate", rule.Rate).
+				Int("burst", rule.Burst).
+				Int("max_concurrent", rule.MaxConcurrent).
+				Msg("rate limiting enabled")
+			limiters[route] = ratelimit.NewLimiter(rule)
+		}
+		c = c.Append(controllers.RateLimit(limiters))
+	}
+
+	// Add optional global admission control on the scan endpoints
+	// Background tasks are stopped when the server shuts down
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+	defer bgCancel()
+	go caps.Run(bgCtx, logger)
+
+	scan := c
+	var ac *admission.Controller
+	admissionCfg := admission.Config{
+		MaxInFlight:         cfg.AdmissionMaxInFlightScans,
+		MaxQueued:           cfg.AdmissionMaxQueuedScans,
+		QueueTimeout:        cfg.AdmissionQueueTimeout,
+		MaxClamdQueue:       cfg.AdmissionClamdMaxQueue,
+		MinClamdIdleThreads: cfg.AdmissionClamdMinIdleThreads,
+		PollInterval:        cfg.AdmissionClamdPollInterval,
+	}
+	if admissionCfg.Enabled() {
+		logger.Info().
+			Int("max_inflight", admissionCfg.MaxInFlight).
+			Int("max_queued", admissionCfg.MaxQueued).
+			Dur("queue_timeout", admissionCfg.QueueTimeout).
+			Int("clamd_max_queue", admissionCfg.MaxClamdQueue).
+			Int("clamd_min_idle_threads", admissionCfg.MinClamdIdleThreads).
+			Msg("scan admission control enabled")
+		ac = admission.New(admissionCfg)
+		if admissionCfg.PollsClamd() {
+			go ac.Poll(bgCtx, clamd, logger)
+		}
+		scan = scan.Append(controllers.AdmissionControl(ac))
+	}
+
 	r.Handler(http.MethodGet, "/rest/v1/ping", c.ThenFunc(h.Ping))
 	r.Handler(http.MethodGet, "/rest/v1/version", c.ThenFunc(h.Version))
 	r.Handler(http.MethodGet, "/rest/v1/stats", c.ThenFunc(h.Stats))
 	r.Handler(http.MethodGet, "/rest/v1/versioncommands", c.ThenFunc(h.VersionCommands))
+	r.Handler(http.MethodGet, "/rest/v1/databases", c.ThenFunc(h.Databases))
 	r.Handler(http.MethodPost, "/rest/v1/reload", c.ThenFunc(h.Reload))
 	r.Handler(http.MethodPost, "/rest/v1/shutdown", c.ThenFunc(h.Shutdown))
-	r.Handler(http.MethodPost, "/rest/v1/scan", c.ThenFunc(h.InStream))
+	r.Handler(http.MethodPost, "/rest/v1/scan", scan.ThenFunc(h.InStream))
+	r.Handler(http.MethodPost, "/rest/v1/scan/json", scan.ThenFunc(h.ScanJSON))
 	r.Handler(http.MethodPost, "/rest/v1/freshclam", c.ThenFunc(h.FreshClam))
+	r.Handler(http.MethodGet, "/rest/v1/freshclam", c.ThenFunc(h.FreshClamStatus))
+	r.Handler(http.MethodGet, "/rest/v1/freshclam/jobs/:id", c.ThenFunc(h.FreshClamJob))
+	r.Handler(http.MethodGet, "/metrics", c.Then(metrics.Handler()))
+
+	// API documentation
+	r.Handler(http.MethodGet, controllers.OpenAPIPath, c.Then(openapi.Handler(controllers.NewOpenAPIDocument(cfg.AuthAPIKeyHeader))))
+	if cfg.ServerSwaggerUI {
+		r.Handler(http.MethodGet, controllers.SwaggerUIPath, c.Then(openapi.SwaggerUIHandler(config.AppName, controllers.OpenAPIPath)))
+	}
+
+	// Optional quarantine of infected uploads
+	if cfg.QuarantineDir != "" {
+		key, err := config.ParseQuarantineKey(cfg.QuarantineKey)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to open the quarantine")
+		}
+		store, err := quarantine.New(cfg.QuarantineDir, key, cfg.QuarantineRetention)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to open the quarantine")
+		}
+		logger.Info().
+			Str("dir", cfg.QuarantineDir).
+			Dur("retention", cfg.QuarantineRetention).
+			Msg("quarantine of infected files enabled")
+
+		h.Quarantine = store
+		h.QuarantineArchivePassword = cfg.QuarantineArchivePassword
+		go store.Run(bgCtx, quarantinePurgeInterval, logger)
+
+		r.Handler(http.MethodGet, "/rest/v1/quarantine", c.ThenFunc(h.QuarantineList))
+		r.Handler(http.MethodDelete, "/rest/v1/quarantine", c.ThenFunc(h.QuarantinePurge))
+		r.Handler(http.MethodGet, "/rest/v1/quarantine/:id", c.ThenFunc(h.QuarantineDownload))
+		r.Handler(http.MethodDelete, "/rest/v1/quarantine/:id", c.ThenFunc(h.QuarantineDelete))
+	}
+
+	// Optional management of custom hash signatures, written in the database
+	// directory of clamd
+	if cfg.SignaturesDBDir != "" {
+		h.Signatures, err = signatures.New(cfg.SignaturesDBDir, cfg.SignaturesDBName)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to open the custom signature database")
+		}
+		logger.Info().
+			Str("dir", cfg.SignaturesDBDir).
+			Str("name", cfg.SignaturesDBName).
+			Msg("custom signatures enabled")
+
+		r.Handler(http.MethodGet, "/rest/v1/signatures", c.ThenFunc(h.SignatureList))
+		r.Handler(http.MethodPost, "/rest/v1/signatures", c.ThenFunc(h.SignatureAdd))
+		r.Handler(http.MethodDelete, "/rest/v1/signatures/:hash", c.ThenFunc(h.SignatureDelete))
+	}
+
+	// Optional management of custom rule files, written in the database
+	// directory of clamd
+	if cfg.RulesDir != "" {
+		h.Rules, err = rules.New(rules.Config{
+			Dir:           cfg.RulesDir,
+			Validator:     strings.Fields(cfg.RulesValidator),
+			CheckDuration: cfg.RulesReloadCheck,
+		}, clamd)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to open the custom rule directory")
+		}
+		logger.Info().
+			Str("dir", cfg.RulesDir).
+			Str("validator", cfg.RulesValidator).
+			Msg("custom rules enabled")
+
+		r.Handler(http.MethodGet, "/rest/v1/rules", c.ThenFunc(h.RuleList))
+		r.Handler(http.MethodPost, "/rest/v1/rules", c.ThenFunc(h.RuleUpload))
+		r.Handler(http.MethodGet, "/rest/v1/rules/:name", c.ThenFunc(h.RuleGet))
+		r.Handler(http.MethodDelete, "/rest/v1/rules/:name", c.ThenFunc(h.RuleDelete))
+	}
+
+	// Optional scan of objects from S3-compatible object storage
+	if cfg.S3Endpoint != "" {
+		store, err := objectstore.NewS3(objectstore.S3Config{
+			Endpoint:       cfg.S3Endpoint,
+			AccessKey:      cfg.S3AccessKey,
+			SecretKey:      cfg.S3SecretKey,
+			Region:         cfg.S3Region,
+			UseSSL:         cfg.S3UseSSL,
+			AllowedBuckets: config.ParseS3AllowedBuckets(cfg.S3AllowedBuckets),
+		})
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to configure the object storage")
+		}
+		logger.Info().
+			Str("endpoint", cfg.S3Endpoint).
+			Bool("tag_verdict", cfg.S3TagVerdict).
+			Msg("scan of s3 objects enabled")
+
+		h.ObjectStore = store
+		h.ObjectStoreTagVerdict = cfg.S3TagVerdict
+
+		r.Handler(http.MethodPost, "/rest/v1/scan/s3", scan.ThenFunc(h.ScanS3))
+	}
+
+	// Optional scan of remote content by URL
+	if cfg.URLScanEnabled {
+		networks, err := config.ParseURLScanAllowedNetworks(cfg.URLScanAllowedNetworks)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid url scan allowed networks")
+		}
+		h.URLFetcher = urlfetch.New(urlfetch.Config{
+			AllowedSchemes:  config.ParseList(cfg.URLScanAllowedSchemes),
+			AllowedHosts:    config.ParseList(cfg.URLScanAllowedHosts),
+			AllowedNetworks: networks,
+			MaxSize:         cfg.URLScanMaxSize,
+			Timeout:         cfg.URLScanTimeout,
+			MaxRedirects:    cfg.URLScanMaxRedirects,
+		})
+		logger.Info().
+			Str("allowed_hosts", cfg.URLScanAllowedHosts).
+			Int64("max_size", cfg.URLScanMaxSize).
+			Msg("scan of urls enabled")
+
+		r.Handler(http.MethodPost, "/rest/v1/scan/url", scan.ThenFunc(h.ScanURL))
+	}
+
+	// Optional detection of the types of the scanned files
+	if cfg.FileTypeDetectionEnabled {
+		h.FileTypes, err = config.NewFileTypeDetector(cfg)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid file type lists")
+		}
+		logger.Info().
+			Str("allow", cfg.FileTypeAllow).
+			Str("deny", cfg.FileTypeDeny).
+			Msg("file type detection enabled")
+	}
+
+	// Optional scheduled updates of the virus definitions, reloading clamd
+	if cfg.FreshClamScheduleInterval > 0 {
+		h.FreshClamSchedule = freshclam.NewScheduler(h.FreshClamJobs, freshclam.ScheduleConfig{
+			Interval:   cfg.FreshClamScheduleInterval,
+			Jitter:     cfg.FreshClamScheduleJitter,
+			Backoff:    cfg.FreshClamScheduleBackoff,
+			MaxBackoff: cfg.FreshClamScheduleMaxBackoff,
+		})
+		go h.FreshClamSchedule.Run(bgCtx, logger)
+		logger.Info().
+			Dur("interval", cfg.FreshClamScheduleInterval).
+			Dur("jitter", cfg.FreshClamScheduleJitter).
+			Msg("scheduled virus definitions updates enabled")
+	}
+
+	// Optional management of the freshclam settings, rendered into its
+	// configuration file
+	if cfg.FreshClamConfigTemplate != "" {
+		h.FreshClamSettings, err = freshclam.NewSettingsStore(cfg.FreshClamConfigTemplate, cfg.FreshClamConfigFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to render the freshclam configuration")
+		}
+		logger.Info().
+			Str("template", cfg.FreshClamConfigTemplate).
+			Str("config_file", cfg.FreshClamConfigFile).
+			Msg("freshclam settings management enabled")
+
+		r.Handler(http.MethodGet, "/rest/v1/freshclam/config", c.ThenFunc(h.FreshClamConfig))
+		r.Handler(http.MethodPut, "/rest/v1/freshclam/config", c.ThenFunc(h.FreshClamConfigUpdate))
+	}
+
+	// Optional mirror of the virus databases, feeding the freshclam of
+	// other instances
+	if cfg.MirrorDir != "" {
+		h.Mirror, err = mirror.New(cfg.MirrorDir)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to open the mirror of the virus databases")
+		}
+		logger.Info().
+			Str("dir", cfg.MirrorDir).
+			Str("path", controllers.MirrorPath).
+			Msg("virus databases mirror enabled")
+
+		r.Handler(http.MethodGet, "/mirror/:file", c.ThenFunc(h.MirrorFile))
+		r.Handler(http.MethodGet, "/rest/v1/mirror", c.ThenFunc(h.MirrorList))
+		r.Handler(http.MethodPost, "/rest/v1/mirror", c.ThenFunc(h.MirrorUpload))
+	}
+
+	// Optional lookup of the uploads in hash lists, reloaded when they change
+	if cfg.ReputationAllowFiles != "" || cfg.ReputationDenyFiles != "" {
+		h.Reputation, err = reputation.Load(reputation.Config{
+			AllowFiles: config.ParseList(cfg.ReputationAllowFiles),
+			DenyFiles:  config.ParseList(cfg.ReputationDenyFiles),
+		})
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid hash lists")
+		}
+		go h.Reputation.Run(bgCtx, cfg.ReputationReloadInterval, logger)
+		logger.Info().
+			Str("allow_files", cfg.ReputationAllowFiles).
+			Str("deny_files", cfg.ReputationDenyFiles).
+			Int("hashes", h.Reputation.Len()).
+			Msg("hash reputation enabled")
+	}
+
+	// Optional gRPC server, sharing the authentication, admission control
+	// and audit log of the REST API
+	var gs *grpc.Server
+	if cfg.ServerGRPCAddr != "" {
+		srv := grpcserver.New(logger, clamd)
+		srv.MaxScanSize = cfg.ServerMaxRequestSize
+		srv.Admission = ac
+		srv.Audit = h.Audit
+		srv.HeuristicsPolicy = h.HeuristicsPolicy
+		srv.Policy = h.Policy
+		srv.FileTypes = h.FileTypes
+		gs = grpcserver.NewGRPCServer(srv, &grpcserver.Authenticator{
+			APIKey:       cfg.AuthAPIKey,
+			APIKeyHeader: cfg.AuthAPIKeyHeader,
+			HMAC:         verifier,
+		})
+
+		lis, err := net.Listen("tcp", cfg.ServerGRPCAddr)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to start the gRPC server")
+		}
+		go func() {
+			logger.Info().Msgf("Starting gRPC server %s on address %s ...", config.AppName, cfg.ServerGRPCAddr)
+			if err := gs.Serve(lis); err != nil {
+				logger.Fatal().Err(err).Msg("gRPC server startup failed")
+			}
+		}()
+	}
+
+	// Optional ICAP server, sharing the admission control and audit log
+	// of the REST API
+	var is *icap.Server
+	if cfg.ServerICAPAddr != "" {
+		is = icap.New(logger, clamd)
+		is.Admission = ac
+		is.Audit = h.Audit
+		is.HeuristicsPolicy = h.HeuristicsPolicy
+		is.Policy = h.Policy
+		is.FileTypes = h.FileTypes
+		is.IdleTimeout = cfg.ServerICAPIdleTimeout
+		is.TrustedProxies = trustedProxies
+
+		lis, err := net.Listen("tcp", cfg.ServerICAPAddr)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to start the ICAP server")
+		}
+		go func() {
+			logger.Info().Msgf("Starting ICAP server %s on address %s ...", config.AppName, cfg.ServerICAPAddr)
+			if err := is.Serve(lis); err != nil && err != icap.ErrServerClosed {
+				logger.Fatal().Err(err).Msg("ICAP server startup failed")
+			}
+		}()
+	}
 
 	// Start server
 	go func() {
@@ -108,6 +523,7 @@ func main() {
 	sig := <-sigChan
 
 	logger.Info().Msgf("Server received %s signal. Shutting down...", sig)
+	bgCancel()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer func() {
 		cancel()
@@ -117,4 +533,45 @@ func main() {
 	if err := s.Shutdown(ctx); err != nil {
 		logger.Warn().Msg("Failed to gracefully shutdown the server")
 	}
+	if gs != nil {
+		stopped := make(chan struct{})
+		go func() {
+			gs.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			logger.Warn().Msg("Failed to gracefully shutdown the gRPC server")
+			gs.Stop()
+		}
+	}
+	if is != nil {
+		if err := is.Shutdown(ctx); err != nil {
+			logger.Warn().Msg("Failed to gracefully shutdown the ICAP server")
+		}
+	}
+}
+
+// newAuditLogger opens the audit log sink configured in cfg and, for files,
+// continues the hash chain from the last record written.
+func newAuditLogger(cfg *config.App) (*audit.Logger, error) {
+	switch cfg.AuditLogOutput {
+	case config.AuditLogOutputSyslog:
+		sink, err := audit.NewSyslogSink(cfg.AuditLogSyslogNetwork, cfg.AuditLogSyslogAddr, config.AppName)
+		if err != nil {
+			return nil, err
+		}
+		return audit.New(sink, nil)
+	default:
+		last, err := audit.LastRecord(cfg.AuditLogFile, cfg.AuditLogMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sink, err := audit.NewFileSink(cfg.AuditLogFile, cfg.AuditLogMaxSize, cfg.AuditLogMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		return audit.New(sink, last)
+	}
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lescactus/clamav-api-go/internal/controllers"
+	"github.com/lescactus/clamav-api-go/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registeredRoutes returns the "METHOD path" of the routes registered
+// on the router in main.go.
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+
+	f, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	require.NoError(t, err)
+
+	// Constants of the controllers package used as paths
+	consts := map[string]string{
+		"OpenAPIPath":   controllers.OpenAPIPath,
+		"SwaggerUIPath": controllers.SwaggerUIPath,
+	}
+
+	var routes []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 3 {
+			return true
+		}
+		fun, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || fun.Sel.Name != "Handler" {
+			return true
+		}
+		if recv, ok := fun.X.(*ast.Ident); !ok || recv.Name != "r" {
+			return true
+		}
+
+		method, ok := call.Args[0].(*ast.SelectorExpr)
+		require.True(t, ok, "route method must be a http.MethodXxx constant")
+
+		var path string
+		switch arg := call.Args[1].(type) {
+		case *ast.BasicLit:
+			path, err = strconv.Unquote(arg.Value)
+			require.NoError(t, err)
+		case *ast.SelectorExpr:
+			path, ok = consts[arg.Sel.Name]
+			require.True(t, ok, "unknown path constant %s", arg.Sel.Name)
+		default:
+			t.Fatalf("route path must be a string literal or a constant")
+		}
+
+		routes = append(routes, strings.ToUpper(strings.TrimPrefix(method.Sel.Name, "Method"))+" "+path)
+		return true
+	})
+	return routes
+}
+
+// TestOpenAPIRoutes checks that the OpenAPI document describes exactly
+// the routes registered in main.go.
+func TestOpenAPIRoutes(t *testing.T) {
+	registered := registeredRoutes(t)
+	require.NotEmpty(t, registered)
+	assert.Contains(t, registered, http.MethodPost+" /rest/v1/scan")
+
+	var documented []string
+	for path, item := range controllers.NewOpenAPIDocument("X-API-Key").Paths {
+		for method := range item {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	for i, route := range registered {
+		method, path, _ := strings.Cut(route, " ")
+		registered[i] = method + " " + openapi.Path(path)
+	}
+
+	sort.Strings(registered)
+	sort.Strings(documented)
+	assert.Equal(t, registered, documented)
+}
@@ -0,0 +1,727 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: clamav/v1/clamav.proto
+
+package clamavv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ScanRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Name of the scanned file, for logging and auditing purposes.
+	FileName string `protobuf:"bytes,1,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	// Next chunk of the scanned file.
+	Chunk         []byte `protobuf:"bytes,2,opt,name=chunk,proto3" json:"chunk,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScanRequest) Reset() {
+	*x = ScanRequest{}
+	mi := &file_clamav_v1_clamav_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanRequest) ProtoMessage() {}
+
+func (x *ScanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clamav_v1_clamav_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanRequest.ProtoReflect.Descriptor instead.
+func (*ScanRequest) Descriptor() ([]byte, []int) {
+	return file_clamav_v1_clamav_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ScanRequest) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *ScanRequest) GetChunk() []byte {
+	if x != nil {
+		return x.Chunk
+	}
+	return nil
+}
+
+type ScanResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Status string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Msg    string                 `protobuf:"bytes,2,opt,name=msg,proto3" json:"msg,omitempty"`
+	// Name of the signature matched by the file, if infected.
+	Signature  string `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	VirusFound bool   `protobuf:"varint,4,opt,name=virus_found,json=virusFound,proto3" json:"virus_found,omitempty"`
+	// Archive heuristic reported by clamd, if any.
+	Heuristic *Heuristic `protobuf:"bytes,5,opt,name=heuristic,proto3" json:"heuristic,omitempty"`
+	// Verdict of the verdict policy: allow, warn or block. Empty if no verdict
+	// policy is configured.
+	Verdict string `protobuf:"bytes,6,opt,name=verdict,proto3" json:"verdict,omitempty"`
+	// Rule of the verdict policy which decided the verdict, empty if the
+	// default verdict applied.
+	PolicyRule string `protobuf:"bytes,7,opt,name=policy_rule,json=policyRule,proto3" json:"policy_rule,omitempty"`
+	// Type of the file detected from its content. Empty if file type detection
+	// is disabled.
+	MimeType string `protobuf:"bytes,8,opt,name=mime_type,json=mimeType,proto3" json:"mime_type,omitempty"`
+	// Whether the extension of the file name isn't one of the usual extensions
+	// of the detected type.
+	ExtensionMismatch bool `protobuf:"varint,9,opt,name=extension_mismatch,json=extensionMismatch,proto3" json:"extension_mismatch,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *ScanResponse) Reset() {
+	*x = ScanResponse{}
+	mi := &file_clamav_v1_clamav_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanResponse) ProtoMessage() {}
+
+func (x *ScanResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clamav_v1_clamav_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanResponse.ProtoReflect.Descriptor instead.
+func (*ScanResponse) Descriptor() ([]byte, []int) {
+	return file_clamav_v1_clamav_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ScanResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ScanResponse) GetMsg() string {
+	if x != nil {
+		return x.Msg
+	}
+	return ""
+}
+
+func (x *ScanResponse) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *ScanResponse) GetVirusFound() bool {
+	if x != nil {
+		return x.VirusFound
+	}
+	return false
+}
+
+func (x *ScanResponse) GetHeuristic() *Heuristic {
+	if x != nil {
+		return x.Heuristic
+	}
+	return nil
+}
+
+func (x *ScanResponse) GetVerdict() string {
+	if x != nil {
+		return x.Verdict
+	}
+	return ""
+}
+
+func (x *ScanResponse) GetPolicyRule() string {
+	if x != nil {
+		return x.PolicyRule
+	}
+	return ""
+}
+
+func (x *ScanResponse) GetMimeType() string {
+	if x != nil {
+		return x.MimeType
+	}
+	return ""
+}
+
+func (x *ScanResponse) GetExtensionMismatch() bool {
+	if x != nil {
+		return x.ExtensionMismatch
+	}
+	return false
+}
+
+// Heuristic is an archive heuristic reported by clamd, such as an encrypted
+// archive or a scan limit exceeded.
+type Heuristic struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Category of the heuristic: encrypted, limits_exceeded or broken_executable.
+	Category  string `protobuf:"bytes,1,opt,name=category,proto3" json:"category,omitempty"`
+	Signature string `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+	// How the heuristic is reported, according to the archive heuristics
+	// policy: infected, suspicious or clean.
+	Verdict       string `protobuf:"bytes,3,opt,name=verdict,proto3" json:"verdict,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Heuristic) Reset() {
+	*x = Heuristic{}
+	mi := &file_clamav_v1_clamav_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Heuristic) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Heuristic) ProtoMessage() {}
+
+func (x *Heuristic) ProtoReflect() protoreflect.Message {
+	mi := &file_clamav_v1_clamav_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Heuristic.ProtoReflect.Descriptor instead.
+func (*Heuristic) Descriptor() ([]byte, []int) {
+	return file_clamav_v1_clamav_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Heuristic) GetCategory() string {
+	if x != nil {
+		return x.Category
+	}
+	return ""
+}
+
+func (x *Heuristic) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *Heuristic) GetVerdict() string {
+	if x != nil {
+		return x.Verdict
+	}
+	return ""
+}
+
+type PingRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PingRequest) Reset() {
+	*x = PingRequest{}
+	mi := &file_clamav_v1_clamav_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingRequest) ProtoMessage() {}
+
+func (x *PingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clamav_v1_clamav_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingRequest.ProtoReflect.Descriptor instead.
+func (*PingRequest) Descriptor() ([]byte, []int) {
+	return file_clamav_v1_clamav_proto_rawDescGZIP(), []int{3}
+}
+
+type PingResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ping          string                 `protobuf:"bytes,1,opt,name=ping,proto3" json:"ping,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PingResponse) Reset() {
+	*x = PingResponse{}
+	mi := &file_clamav_v1_clamav_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PingResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingResponse) ProtoMessage() {}
+
+func (x *PingResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clamav_v1_clamav_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingResponse.ProtoReflect.Descriptor instead.
+func (*PingResponse) Descriptor() ([]byte, []int) {
+	return file_clamav_v1_clamav_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PingResponse) GetPing() string {
+	if x != nil {
+		return x.Ping
+	}
+	return ""
+}
+
+type VersionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VersionRequest) Reset() {
+	*x = VersionRequest{}
+	mi := &file_clamav_v1_clamav_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VersionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VersionRequest) ProtoMessage() {}
+
+func (x *VersionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clamav_v1_clamav_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VersionRequest.ProtoReflect.Descriptor instead.
+func (*VersionRequest) Descriptor() ([]byte, []int) {
+	return file_clamav_v1_clamav_proto_rawDescGZIP(), []int{5}
+}
+
+type VersionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ClamavVersion string                 `protobuf:"bytes,1,opt,name=clamav_version,json=clamavVersion,proto3" json:"clamav_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VersionResponse) Reset() {
+	*x = VersionResponse{}
+	mi := &file_clamav_v1_clamav_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VersionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VersionResponse) ProtoMessage() {}
+
+func (x *VersionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clamav_v1_clamav_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VersionResponse.ProtoReflect.Descriptor instead.
+func (*VersionResponse) Descriptor() ([]byte, []int) {
+	return file_clamav_v1_clamav_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *VersionResponse) GetClamavVersion() string {
+	if x != nil {
+		return x.ClamavVersion
+	}
+	return ""
+}
+
+type StatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsRequest) Reset() {
+	*x = StatsRequest{}
+	mi := &file_clamav_v1_clamav_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsRequest) ProtoMessage() {}
+
+func (x *StatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clamav_v1_clamav_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsRequest.ProtoReflect.Descriptor instead.
+func (*StatsRequest) Descriptor() ([]byte, []int) {
+	return file_clamav_v1_clamav_proto_rawDescGZIP(), []int{7}
+}
+
+type StatsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pools         int32                  `protobuf:"varint,1,opt,name=pools,proto3" json:"pools,omitempty"`
+	State         string                 `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	Threads       string                 `protobuf:"bytes,3,opt,name=threads,proto3" json:"threads,omitempty"`
+	Queue         string                 `protobuf:"bytes,4,opt,name=queue,proto3" json:"queue,omitempty"`
+	Memstats      string                 `protobuf:"bytes,5,opt,name=memstats,proto3" json:"memstats,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsResponse) Reset() {
+	*x = StatsResponse{}
+	mi := &file_clamav_v1_clamav_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsResponse) ProtoMessage() {}
+
+func (x *StatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clamav_v1_clamav_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsResponse.ProtoReflect.Descriptor instead.
+func (*StatsResponse) Descriptor() ([]byte, []int) {
+	return file_clamav_v1_clamav_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *StatsResponse) GetPools() int32 {
+	if x != nil {
+		return x.Pools
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *StatsResponse) GetThreads() string {
+	if x != nil {
+		return x.Threads
+	}
+	return ""
+}
+
+func (x *StatsResponse) GetQueue() string {
+	if x != nil {
+		return x.Queue
+	}
+	return ""
+}
+
+func (x *StatsResponse) GetMemstats() string {
+	if x != nil {
+		return x.Memstats
+	}
+	return ""
+}
+
+type ReloadRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReloadRequest) Reset() {
+	*x = ReloadRequest{}
+	mi := &file_clamav_v1_clamav_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadRequest) ProtoMessage() {}
+
+func (x *ReloadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clamav_v1_clamav_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadRequest.ProtoReflect.Descriptor instead.
+func (*ReloadRequest) Descriptor() ([]byte, []int) {
+	return file_clamav_v1_clamav_proto_rawDescGZIP(), []int{9}
+}
+
+type ReloadResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReloadResponse) Reset() {
+	*x = ReloadResponse{}
+	mi := &file_clamav_v1_clamav_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadResponse) ProtoMessage() {}
+
+func (x *ReloadResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_clamav_v1_clamav_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadResponse.ProtoReflect.Descriptor instead.
+func (*ReloadResponse) Descriptor() ([]byte, []int) {
+	return file_clamav_v1_clamav_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ReloadResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+var File_clamav_v1_clamav_proto protoreflect.FileDescriptor
+
+const file_clamav_v1_clamav_proto_rawDesc = "" +
+	"\n" +
+	"\x16clamav/v1/clamav.proto\x12\tclamav.v1\"@\n" +
+	"\vScanRequest\x12\x1b\n" +
+	"\tfile_name\x18\x01 \x01(\tR\bfileName\x12\x14\n" +
+	"\x05chunk\x18\x02 \x01(\fR\x05chunk\"\xb2\x02\n" +
+	"\fScanResponse\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\x12\x10\n" +
+	"\x03msg\x18\x02 \x01(\tR\x03msg\x12\x1c\n" +
+	"\tsignature\x18\x03 \x01(\tR\tsignature\x12\x1f\n" +
+	"\vvirus_found\x18\x04 \x01(\bR\n" +
+	"virusFound\x122\n" +
+	"\theuristic\x18\x05 \x01(\v2\x14.clamav.v1.HeuristicR\theuristic\x12\x18\n" +
+	"\averdict\x18\x06 \x01(\tR\averdict\x12\x1f\n" +
+	"\vpolicy_rule\x18\a \x01(\tR\n" +
+	"policyRule\x12\x1b\n" +
+	"\tmime_type\x18\b \x01(\tR\bmimeType\x12-\n" +
+	"\x12extension_mismatch\x18\t \x01(\bR\x11extensionMismatch\"_\n" +
+	"\tHeuristic\x12\x1a\n" +
+	"\bcategory\x18\x01 \x01(\tR\bcategory\x12\x1c\n" +
+	"\tsignature\x18\x02 \x01(\tR\tsignature\x12\x18\n" +
+	"\averdict\x18\x03 \x01(\tR\averdict\"\r\n" +
+	"\vPingRequest\"\"\n" +
+	"\fPingResponse\x12\x12\n" +
+	"\x04ping\x18\x01 \x01(\tR\x04ping\"\x10\n" +
+	"\x0eVersionRequest\"8\n" +
+	"\x0fVersionResponse\x12%\n" +
+	"\x0eclamav_version\x18\x01 \x01(\tR\rclamavVersion\"\x0e\n" +
+	"\fStatsRequest\"\x87\x01\n" +
+	"\rStatsResponse\x12\x14\n" +
+	"\x05pools\x18\x01 \x01(\x05R\x05pools\x12\x14\n" +
+	"\x05state\x18\x02 \x01(\tR\x05state\x12\x18\n" +
+	"\athreads\x18\x03 \x01(\tR\athreads\x12\x14\n" +
+	"\x05queue\x18\x04 \x01(\tR\x05queue\x12\x1a\n" +
+	"\bmemstats\x18\x05 \x01(\tR\bmemstats\"\x0f\n" +
+	"\rReloadRequest\"(\n" +
+	"\x0eReloadResponse\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status2\xb9\x02\n" +
+	"\x06ClamAV\x129\n" +
+	"\x04Scan\x12\x16.clamav.v1.ScanRequest\x1a\x17.clamav.v1.ScanResponse(\x01\x127\n" +
+	"\x04Ping\x12\x16.clamav.v1.PingRequest\x1a\x17.clamav.v1.PingResponse\x12@\n" +
+	"\aVersion\x12\x19.clamav.v1.VersionRequest\x1a\x1a.clamav.v1.VersionResponse\x12:\n" +
+	"\x05Stats\x12\x17.clamav.v1.StatsRequest\x1a\x18.clamav.v1.StatsResponse\x12=\n" +
+	"\x06Reload\x12\x18.clamav.v1.ReloadRequest\x1a\x19.clamav.v1.ReloadResponseB>Z<github.com/lescactus/clamav-api-go/pkg/pb/clamav/v1;clamavv1b\x06proto3"
+
+var (
+	file_clamav_v1_clamav_proto_rawDescOnce sync.Once
+	file_clamav_v1_clamav_proto_rawDescData []byte
+)
+
+func file_clamav_v1_clamav_proto_rawDescGZIP() []byte {
+	file_clamav_v1_clamav_proto_rawDescOnce.Do(func() {
+		file_clamav_v1_clamav_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_clamav_v1_clamav_proto_rawDesc), len(file_clamav_v1_clamav_proto_rawDesc)))
+	})
+	return file_clamav_v1_clamav_proto_rawDescData
+}
+
+var file_clamav_v1_clamav_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_clamav_v1_clamav_proto_goTypes = []any{
+	(*ScanRequest)(nil),     // 0: clamav.v1.ScanRequest
+	(*ScanResponse)(nil),    // 1: clamav.v1.ScanResponse
+	(*Heuristic)(nil),       // 2: clamav.v1.Heuristic
+	(*PingRequest)(nil),     // 3: clamav.v1.PingRequest
+	(*PingResponse)(nil),    // 4: clamav.v1.PingResponse
+	(*VersionRequest)(nil),  // 5: clamav.v1.VersionRequest
+	(*VersionResponse)(nil), // 6: clamav.v1.VersionResponse
+	(*StatsRequest)(nil),    // 7: clamav.v1.StatsRequest
+	(*StatsResponse)(nil),   // 8: clamav.v1.StatsResponse
+	(*ReloadRequest)(nil),   // 9: clamav.v1.ReloadRequest
+	(*ReloadResponse)(nil),  // 10: clamav.v1.ReloadResponse
+}
+var file_clamav_v1_clamav_proto_depIdxs = []int32{
+	2,  // 0: clamav.v1.ScanResponse.heuristic:type_name -> clamav.v1.Heuristic
+	0,  // 1: clamav.v1.ClamAV.Scan:input_type -> clamav.v1.ScanRequest
+	3,  // 2: clamav.v1.ClamAV.Ping:input_type -> clamav.v1.PingRequest
+	5,  // 3: clamav.v1.ClamAV.Version:input_type -> clamav.v1.VersionRequest
+	7,  // 4: clamav.v1.ClamAV.Stats:input_type -> clamav.v1.StatsRequest
+	9,  // 5: clamav.v1.ClamAV.Reload:input_type -> clamav.v1.ReloadRequest
+	1,  // 6: clamav.v1.ClamAV.Scan:output_type -> clamav.v1.ScanResponse
+	4,  // 7: clamav.v1.ClamAV.Ping:output_type -> clamav.v1.PingResponse
+	6,  // 8: clamav.v1.ClamAV.Version:output_type -> clamav.v1.VersionResponse
+	8,  // 9: clamav.v1.ClamAV.Stats:output_type -> clamav.v1.StatsResponse
+	10, // 10: clamav.v1.ClamAV.Reload:output_type -> clamav.v1.ReloadResponse
+	6,  // [6:11] is the sub-list for method output_type
+	1,  // [1:6] is the sub-list for method input_type
+	1,  // [1:1] is the sub-list for extension type_name
+	1,  // [1:1] is the sub-list for extension extendee
+	0,  // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_clamav_v1_clamav_proto_init() }
+func file_clamav_v1_clamav_proto_init() {
+	if File_clamav_v1_clamav_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_clamav_v1_clamav_proto_rawDesc), len(file_clamav_v1_clamav_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_clamav_v1_clamav_proto_goTypes,
+		DependencyIndexes: file_clamav_v1_clamav_proto_depIdxs,
+		MessageInfos:      file_clamav_v1_clamav_proto_msgTypes,
+	}.Build()
+	File_clamav_v1_clamav_proto = out.File
+	file_clamav_v1_clamav_proto_goTypes = nil
+	file_clamav_v1_clamav_proto_depIdxs = nil
+}
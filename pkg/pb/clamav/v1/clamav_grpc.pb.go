@@ -0,0 +1,295 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: clamav/v1/clamav.proto
+
+package clamavv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ClamAV_Scan_FullMethodName    = "/clamav.v1.ClamAV/Scan"
+	ClamAV_Ping_FullMethodName    = "/clamav.v1.ClamAV/Ping"
+	ClamAV_Version_FullMethodName = "/clamav.v1.ClamAV/Version"
+	ClamAV_Stats_FullMethodName   = "/clamav.v1.ClamAV/Stats"
+	ClamAV_Reload_FullMethodName  = "/clamav.v1.ClamAV/Reload"
+)
+
+// ClamAVClient is the client API for ClamAV service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ClamAV exposes the clamd daemon over gRPC.
+//
+// Requests are authenticated like the REST API: with the API key in the
+// metadata entry named after AUTH_API_KEY_HEADER (lower-cased), or with
+// the HMAC signature metadata described in pkg/signing.
+// Errors carry a google.rpc.ErrorInfo detail whose reason is the stable
+// error code of docs/ERRORS.md.
+type ClamAVClient interface {
+	// Scan streams a file to clamd. The first message should carry the
+	// file name, all of them carry the successive chunks of the file.
+	Scan(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ScanRequest, ScanResponse], error)
+	// Ping checks clamd is up. It doesn't require authentication.
+	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error)
+	// Version returns the version of clamd and of its signature database.
+	Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error)
+	// Stats returns the statistics about the scan queue and memory usage of clamd.
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+	// Reload asks clamd to reload its signature database.
+	Reload(ctx context.Context, in *ReloadRequest, opts ...grpc.CallOption) (*ReloadResponse, error)
+}
+
+type clamAVClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClamAVClient(cc grpc.ClientConnInterface) ClamAVClient {
+	return &clamAVClient{cc}
+}
+
+func (c *clamAVClient) Scan(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ScanRequest, ScanResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ClamAV_ServiceDesc.Streams[0], ClamAV_Scan_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ScanRequest, ScanResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ClamAV_ScanClient = grpc.ClientStreamingClient[ScanRequest, ScanResponse]
+
+func (c *clamAVClient) Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PingResponse)
+	err := c.cc.Invoke(ctx, ClamAV_Ping_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clamAVClient) Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VersionResponse)
+	err := c.cc.Invoke(ctx, ClamAV_Version_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clamAVClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, ClamAV_Stats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clamAVClient) Reload(ctx context.Context, in *ReloadRequest, opts ...grpc.CallOption) (*ReloadResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReloadResponse)
+	err := c.cc.Invoke(ctx, ClamAV_Reload_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClamAVServer is the server API for ClamAV service.
+// All implementations must embed UnimplementedClamAVServer
+// for forward compatibility.
+//
+// ClamAV exposes the clamd daemon over gRPC.
+//
+// Requests are authenticated like the REST API: with the API key in the
+// metadata entry named after AUTH_API_KEY_HEADER (lower-cased), or with
+// the HMAC signature metadata described in pkg/signing.
+// Errors carry a google.rpc.ErrorInfo detail whose reason is the stable
+// error code of docs/ERRORS.md.
+type ClamAVServer interface {
+	// Scan streams a file to clamd. The first message should carry the
+	// file name, all of them carry the successive chunks of the file.
+	Scan(grpc.ClientStreamingServer[ScanRequest, ScanResponse]) error
+	// Ping checks clamd is up. It doesn't require authentication.
+	Ping(context.Context, *PingRequest) (*PingResponse, error)
+	// Version returns the version of clamd and of its signature database.
+	Version(context.Context, *VersionRequest) (*VersionResponse, error)
+	// Stats returns the statistics about the scan queue and memory usage of clamd.
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+	// Reload asks clamd to reload its signature database.
+	Reload(context.Context, *ReloadRequest) (*ReloadResponse, error)
+	mustEmbedUnimplementedClamAVServer()
+}
+
+// UnimplementedClamAVServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedClamAVServer struct{}
+
+func (UnimplementedClamAVServer) Scan(grpc.ClientStreamingServer[ScanRequest, ScanResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedClamAVServer) Ping(context.Context, *PingRequest) (*PingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
+}
+func (UnimplementedClamAVServer) Version(context.Context, *VersionRequest) (*VersionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
+}
+func (UnimplementedClamAVServer) Stats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedClamAVServer) Reload(context.Context, *ReloadRequest) (*ReloadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reload not implemented")
+}
+func (UnimplementedClamAVServer) mustEmbedUnimplementedClamAVServer() {}
+func (UnimplementedClamAVServer) testEmbeddedByValue()                {}
+
+// UnsafeClamAVServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ClamAVServer will
+// result in compilation errors.
+type UnsafeClamAVServer interface {
+	mustEmbedUnimplementedClamAVServer()
+}
+
+func RegisterClamAVServer(s grpc.ServiceRegistrar, srv ClamAVServer) {
+	// If the following call pancis, it indicates UnimplementedClamAVServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ClamAV_ServiceDesc, srv)
+}
+
+func _ClamAV_Scan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ClamAVServer).Scan(&grpc.GenericServerStream[ScanRequest, ScanResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ClamAV_ScanServer = grpc.ClientStreamingServer[ScanRequest, ScanResponse]
+
+func _ClamAV_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClamAVServer).Ping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClamAV_Ping_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClamAVServer).Ping(ctx, req.(*PingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClamAV_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VersionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClamAVServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClamAV_Version_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClamAVServer).Version(ctx, req.(*VersionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClamAV_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClamAVServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClamAV_Stats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClamAVServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClamAV_Reload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClamAVServer).Reload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ClamAV_Reload_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClamAVServer).Reload(ctx, req.(*ReloadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ClamAV_ServiceDesc is the grpc.ServiceDesc for ClamAV service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ClamAV_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "clamav.v1.ClamAV",
+	HandlerType: (*ClamAVServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Ping",
+			Handler:    _ClamAV_Ping_Handler,
+		},
+		{
+			MethodName: "Version",
+			Handler:    _ClamAV_Version_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _ClamAV_Stats_Handler,
+		},
+		{
+			MethodName: "Reload",
+			Handler:    _ClamAV_Reload_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Scan",
+			Handler:       _ClamAV_Scan_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "clamav/v1/clamav.proto",
+}
@@ -0,0 +1,109 @@
+package signing
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyDigest(t *testing.T) {
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", BodyDigest(nil))
+	assert.Equal(t, "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2", BodyDigest([]byte("foobar")))
+	assert.Equal(t, BodyDigest(nil), EmptyBodyDigest)
+}
+
+func TestStringToSign(t *testing.T) {
+	got := StringToSign("post", "/rest/v1/scan?x=1", "1700000000", "abcd", "C3AB")
+	assert.Equal(t, "POST\n/rest/v1/scan?x=1\n1700000000\nabcd\nc3ab", got)
+}
+
+func TestSign(t *testing.T) {
+	// Reference value computed with:
+	// printf 'GET\n/rest/v1/version\n1700000000\nnonce\n<empty body digest>' | openssl dgst -sha256 -hmac secret
+	sts := StringToSign("GET", "/rest/v1/version", "1700000000", "nonce", EmptyBodyDigest)
+	sig := Sign([]byte("secret"), sts)
+
+	assert.Equal(t, "89c8c2e87501f4908a38cc4ccc55a1f7d5cb1608ace48a79772cacc79d13fa79", sig)
+	assert.NotEqual(t, sig, Sign([]byte("other"), sts))
+}
+
+func TestSignerSign(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewSigner("client-a", []byte("secret"))
+	s.Now = func() time.Time { return now }
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:8888/rest/v1/scan", strings.NewReader("foobar"))
+	assert.NoError(t, err)
+
+	err = s.Sign(req)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "client-a", req.Header.Get(HeaderKeyID))
+	assert.Equal(t, "1700000000", req.Header.Get(HeaderTimestamp))
+	assert.Len(t, req.Header.Get(HeaderNonce), 32)
+	assert.Equal(t, BodyDigest([]byte("foobar")), req.Header.Get(HeaderContentSHA256))
+
+	want := Sign([]byte("secret"), StringToSign(http.MethodPost, "/rest/v1/scan",
+		"1700000000", req.Header.Get(HeaderNonce), BodyDigest([]byte("foobar"))))
+	assert.Equal(t, want, req.Header.Get(HeaderSignature))
+
+	// The body must still be readable
+	body, err := io.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "foobar", string(body))
+}
+
+func TestSignerSignNoBody(t *testing.T) {
+	s := NewSigner("client-a", []byte("secret"))
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:8888/rest/v1/version", nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Sign(req))
+	assert.Equal(t, EmptyBodyDigest, req.Header.Get(HeaderContentSHA256))
+}
+
+func TestSignerSignEmptySecret(t *testing.T) {
+	s := NewSigner("client-a", nil)
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:8888/rest/v1/version", nil)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, s.Sign(req), ErrMissingSecret)
+	assert.Empty(t, req.Header.Get(HeaderSignature))
+}
+
+func TestSignerNonceIsUnique(t *testing.T) {
+	s := NewSigner("client-a", []byte("secret"))
+
+	req1, _ := http.NewRequest(http.MethodGet, "http://localhost:8888/rest/v1/version", nil)
+	req2, _ := http.NewRequest(http.MethodGet, "http://localhost:8888/rest/v1/version", nil)
+	assert.NoError(t, s.Sign(req1))
+	assert.NoError(t, s.Sign(req2))
+
+	assert.NotEqual(t, req1.Header.Get(HeaderNonce), req2.Header.Get(HeaderNonce))
+}
+
+func TestSignerSignRPC(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewSigner("client-a", []byte("secret"))
+	s.Now = func() time.Time { return now }
+
+	md, err := s.SignRPC("/clamav.v1.ClamAV/Scan")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "client-a", md["x-signature-key-id"])
+	assert.Equal(t, "1700000000", md["x-signature-timestamp"])
+	assert.Equal(t, EmptyBodyDigest, md["x-content-sha256"])
+
+	want := Sign([]byte("secret"), StringToSign(http.MethodPost, "/clamav.v1.ClamAV/Scan",
+		"1700000000", md["x-signature-nonce"], EmptyBodyDigest))
+	assert.Equal(t, want, md["x-signature"])
+
+	_, err = NewSigner("client-a", nil).SignRPC("/clamav.v1.ClamAV/Scan")
+	assert.ErrorIs(t, err, ErrMissingSecret)
+}